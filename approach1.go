@@ -1,310 +1,1201 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
+	"database/sql"
+	"embed"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
-	"math"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+
+	"approach1/valact"
 )
 
-func create_array(value float64) [120]float64 {
-	var array [120]float64
-	for i := range len(array) {
-		array[i] = value
-	}
-	return array
+const usage = `Usage: approach1 <command> [flags]
+
+Commands:
+  illustrate  project a policy at a given premium and write the ledger
+  solve       solve for the minimum level premium to maturity
+  batch       illustrate or solve every policy in a census CSV
+  bench       time repeated solves/illustrations (single or multi worker)
+  stochastic  project every policy in a census across interest scenarios
+  sensitivity solve and project a policy under COI, interest, and load shocks
+  support     run the self-support and lapse-support illustration tests on census cells
+  profit      profit test census cells: distributable earnings, NPV, IRR, and margin
+  project     expected aggregate projection of a census under experience decrements
+  compare     compare a ledger with an expected one and report the differences
+  serve       serve illustrations, solves, and batches over HTTP as JSON
+  worker      answer JSON line requests on stdin with JSON lines on stdout
+  validate    check the rate tables for gaps, duplicates, and bad values
+
+Run "approach1 <command> -h" for the flags of a command.
+`
+
+// policyFlags are the case parameters shared by every command.
+type policyFlags struct {
+	issueAge  int
+	gender    string
+	riskClass string
+	face      float64
+	premium   float64
+	target    float64
+	dbOption  string
+	mode      string
+	changes   []valact.PolicyChange
+	loans     []valact.ScheduledAmount
+	repays    []valact.ScheduledAmount
+	withdraws []valact.ScheduledAmount
+	schedule  []float64
+	deposits  []valact.Deposit
+	gpt       string
+	test      string
+	mec       bool
+	nlg       bool
+	reserves  string
+	valuation float64
+	rating    float64
+	extras    []valact.FlatExtra
+	second    valact.Life
+	joint     string
+	death     *valact.FirstDeath
+	term      valact.TermRider
+	waiver    bool
+	wpBasis   string
+	wpExpiry  int
+	adb       valact.ADBRider
+	chronic   bool
+	claim     valact.ChronicRider
+	iul       bool
+	indexed   valact.IndexedCrediting
+	returns   string
+	funds     string
+	order     string
+	steps     string
+	money     string
+	rounding  string
+	basis     valact.RateBasis
+	maturity  int
+	extended  int
+	interest  float64
+	scenario  string
+	minimum   *float64
+	bonuses   []interestBonus
+	state     string
+	birth     time.Time
+	issued    time.Time
+	ageBasis  string
+	backdate  int
+	inforce   valact.Inforce
+	dataDir   string
+	builtin   bool
+	asOf      ratesAsOf
+	improve   *valact.MortalityImprovement
+	// versions is the AsOf of the table versions read, once resolved
+	versions time.Time
+	product  string
+	missing  *valact.MissingRates
+	store    *valact.SQLStore
+	// cache, when set, serves the rate tables from memory
+	cache *valact.RateCache
+	// selected is the product of -product, once read
+	selected *valact.Product
 }
 
-func get_per_unit_rates(issue_age int) [120]float64 {
-	// create default output
-	rates := create_array(0)
+func (p *policyFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&p.issueAge, "issue-age", 35, "issue age of the insured")
+	fs.Func("birth-date", "date of birth (YYYY-MM-DD); with -issue-date, sets the issue age on -age-basis", func(s string) (err error) {
+		p.birth, err = time.Parse(valact.DateLayout, s)
+		return err
+	})
+	fs.Func("issue-date", "policy date (YYYY-MM-DD) for -birth-date, and for -rates-as-of issue", func(s string) (err error) {
+		p.issued, err = time.Parse(valact.DateLayout, s)
+		return err
+	})
+	fs.StringVar(&p.ageBasis, "age-basis", "nearest", "issue age basis for -birth-date: nearest (age nearest birthday) or last (age last birthday)")
+	fs.IntVar(&p.backdate, "backdate", 0, "backdate the policy up to this many months to save an age (with -birth-date)")
+	fs.IntVar(&p.inforce.PolicyMonth, "inforce-month", 0, "project an inforce policy from the month after this completed policy month (0 for a new issue)")
+	fs.Float64Var(&p.inforce.AccountValue, "inforce-value", 0, "account value at the end of -inforce-month")
+	fs.Float64Var(&p.inforce.LoanBalance, "inforce-loan", 0, "loan balance at the end of -inforce-month")
+	fs.Float64Var(&p.inforce.PremiumsPaid, "inforce-premiums", 0, "premiums paid to date, less withdrawals, for an inforce policy")
+	fs.Func("inforce-surrender-charge", "remaining surrender charge of an inforce policy (default the table's)", func(s string) error {
+		charge, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid amount %q", s)
+		}
+		p.inforce.SurrenderCharge = &charge
+		return nil
+	})
+	fs.StringVar(&p.gender, "gender", "M", "gender of the insured (M or F, or a code mapped in code_map.csv)")
+	fs.StringVar(&p.riskClass, "class", "NS", "risk class of the insured (NS or SM, or a code mapped in code_map.csv)")
+	fs.Float64Var(&p.face, "face", 100000, "face amount")
+	fs.StringVar(&p.state, "state", "", "state of issue, for its premium tax and surrender charge cap from state_variations.csv")
+	fs.Float64Var(&p.premium, "premium", 1255.03, "level annual premium")
+	fs.Float64Var(&p.target, "target-premium", 0, "annual target premium, the breakpoint between the target and excess premium loads (0 for target_premium.csv's)")
+	fs.StringVar(&p.dbOption, "db-option", "A", "death benefit option: A (level) or B (increasing)")
+	fs.StringVar(&p.mode, "mode", "annual", "premium mode: annual, semiannual, quarterly, or monthly")
+	fs.Func("change", "face and/or DB option change as year:face[:option], e.g. 10:50000 or 15::B (repeatable)", func(s string) error {
+		change, err := parseChange(s)
+		p.changes = append(p.changes, change)
+		return err
+	})
+	fs.Func("loan", "new loan as year:amount (repeatable)", scheduleFlag(&p.loans))
+	fs.Func("repay", "loan repayment as year:amount (repeatable)", scheduleFlag(&p.repays))
+	fs.Func("premium-schedule", "comma separated annual premiums from policy year 1, e.g. 2000,2000,0,0 (later years pay -premium)", func(s string) error {
+		p.schedule = p.schedule[:0]
+		for _, text := range strings.Split(s, ",") {
+			premium, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return fmt.Errorf("invalid premium %q", text)
+			}
+			p.schedule = append(p.schedule, premium)
+		}
+		return nil
+	})
+	fs.Func("deposit", "unscheduled premium as month:amount, e.g. 1:50000 for a 1035 rollover (repeatable)", func(s string) error {
+		month, amount, err := parseTimedAmount(s)
+		p.deposits = append(p.deposits, valact.Deposit{PolicyMonth: month, Amount: amount})
+		return err
+	})
+	fs.Func("withdraw", "partial withdrawal as year:amount (repeatable)", scheduleFlag(&p.withdraws))
+	fs.StringVar(&p.gpt, "gpt", "off", "7702 guideline premium test: off, flag (report excess premium), or cap (refuse it)")
+	fs.StringVar(&p.test, "test", "gpt", "7702 compliance test the product qualifies under: gpt or cvat")
+	fs.BoolVar(&p.mec, "mec", false, "test for modified endowment contract (7-pay) status")
+	fs.BoolVar(&p.nlg, "nlg", false, "project the no-lapse guarantee shadow account")
+	fs.StringVar(&p.reserves, "reserves", "", "set the terminal and mean reserves on the ledger by the method: nlp (net level premium) or crvm, on the mortality of "+valact.ValuationMortalityFile+" (default the guaranteed COI rates)")
+	fs.Float64Var(&p.valuation, "valuation-interest", 0.035, "annual effective valuation interest rate of -reserves")
+	fs.Float64Var(&p.rating, "table-rating", 0, "substandard table rating as a COI multiple, e.g. 1.5 for 150% (0 for standard)")
+	fs.Func("flat-extra", "flat extra per $1,000 of face as rate:years[:from-year], e.g. 5:10 (repeatable)", func(s string) error {
+		extra, err := parseFlatExtra(s)
+		p.extras = append(p.extras, extra)
+		return err
+	})
+	fs.IntVar(&p.second.IssueAge, "joint-age", 0, "issue age of the second life of a survivorship policy (0 for single life)")
+	fs.StringVar(&p.second.Gender, "joint-gender", "F", "gender of the second life")
+	fs.StringVar(&p.second.RiskClass, "joint-class", "NS", "risk class of the second life")
+	fs.Float64Var(&p.second.TableRating, "joint-rating", 0, "table rating of the second life as a COI multiple (0 for standard)")
+	fs.StringVar(&p.joint, "joint-method", "frasier", "survivorship COI method: frasier or exact")
+	fs.Func("first-death", "first death on a survivorship policy as life:year, e.g. 1:20 (coverage continues on the other life from year 20)", func(s string) error {
+		life, year, err := parseTimedAmount(s)
+		if err != nil || (life != 1 && life != 2) {
+			return fmt.Errorf("expected life:year with life 1 or 2, got %q", s)
+		}
+		p.death = &valact.FirstDeath{Life: life, PolicyYear: int(year)}
+		return nil
+	})
+	fs.Float64Var(&p.term.FaceAmount, "term-face", 0, "face amount of a term rider on the insured (0 for none)")
+	fs.IntVar(&p.term.ExpiryAge, "term-expiry-age", 0, "attained age at which the term rider ends (0 for maturity)")
+	fs.BoolVar(&p.waiver, "waiver", false, "add a waiver of premium rider")
+	fs.StringVar(&p.wpBasis, "waiver-basis", "deduction", "waiver of premium rate basis: deduction (share of the monthly deduction) or per-unit (per $1,000 of face)")
+	fs.IntVar(&p.wpExpiry, "waiver-expiry-age", 65, "attained age at which the waiver of premium rider ends (0 for maturity)")
+	fs.Float64Var(&p.adb.FaceAmount, "adb-face", 0, "face amount of an accidental death benefit rider (0 for none)")
+	fs.IntVar(&p.adb.ExpiryAge, "adb-expiry-age", 70, "attained age at which the accidental death benefit rider ends (0 for maturity)")
+	fs.BoolVar(&p.chronic, "chronic", false, "add a chronic illness acceleration rider")
+	fs.Float64Var(&p.claim.BenefitRate, "chronic-benefit", 0.02, "monthly chronic illness benefit as a share of the face amount at claim")
+	fs.IntVar(&p.claim.ClaimMonth, "chronic-claim", 0, "policy month a chronic illness claim starts (0 for no claim)")
+	fs.BoolVar(&p.iul, "iul", false, "credit indexed UL segments alongside the fixed account")
+	fs.Float64Var(&p.indexed.Cap, "index-cap", 0.10, "index segment cap rate")
+	fs.Float64Var(&p.indexed.Floor, "index-floor", 0, "index segment floor rate")
+	fs.Float64Var(&p.indexed.Participation, "index-participation", 1, "index segment participation rate")
+	fs.IntVar(&p.indexed.SegmentMonths, "segment-months", 12, "index segment term in months")
+	fs.Float64Var(&p.indexed.Allocation, "index-allocation", 1, "share of net premium allocated to index segments")
+	fs.Float64Var(&p.indexed.HypotheticalReturn, "index-return", 0.065, "hypothetical annual index return")
+	fs.StringVar(&p.returns, "index-returns", "", "CSV of annual index returns (Return column) to use instead of -index-return")
+	fs.StringVar(&p.funds, "funds", "", "CSV of variable funds (Fund, Return, Fee, Allocation) sharing net premium with the fixed account")
+	fs.StringVar(&p.steps, "monthly-steps", "", "comma separated order of the monthly waterfall: premium, expenses, coi, interest (default in that order)")
+	fs.StringVar(&p.money, "arithmetic", "", arithmeticUsage)
+	fs.StringVar(&p.rounding, "rounding-rules", "", roundingUsage)
+	fs.StringVar(&p.product, "product", "", "product code from "+valact.ProductsFile+" in the data directory, whose charges and rules apply where there is no rate table (default the built-in product)")
+	fs.IntVar(&p.maturity, "maturity-age", 0, fmt.Sprintf("attained age at which the policy matures (0 for the product's, %d for the built-in one)", valact.MaturityAge))
+	fs.IntVar(&p.extended, "extended-maturity-age", 0, "extend coverage past maturity to this age, without premiums or charges, crediting interest only")
+	fs.StringVar(&p.order, "deduction-order", "", "comma separated buckets to take deductions from in order: fixed, indexed, or fund names (default fixed, then the rest pro rata)")
+	fs.Float64Var(&p.interest, "interest", 0, "crediting rate, annual effective unless -interest-basis (0 for the product's current rate)")
+	fs.Func("interest-basis", "basis of -interest and -minimum-interest: annual (effective), monthly (effective), nominal (annual, convertible monthly), or continuous (default annual)", func(s string) error {
+		if p.basis = valact.RateBasis(s); !p.basis.Valid() {
+			return fmt.Errorf("unknown rate basis %q", s)
+		}
+		return nil
+	})
+	fs.StringVar(&p.scenario, "interest-scenario", "", "crediting rate scenario from interest_scenarios.csv, e.g. new_money or down_100")
+	fs.Func("minimum-interest", "guaranteed minimum crediting rate, annual effective unless -interest-basis (default the product's 2%)", func(s string) error {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rate %q", s)
+		}
+		p.minimum = &rate
+		return nil
+	})
+	fs.Func("interest-bonus", "annual interest bonus as rate:from-year[:to-year], e.g. 0.0025:11 (repeatable)", func(s string) error {
+		bonus, err := parseInterestBonus(s)
+		p.bonuses = append(p.bonuses, bonus)
+		return err
+	})
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		p.missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		p.store, err = openRateStore(s)
+		return err
+	})
+	fs.StringVar(&p.dataDir, "data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	fs.BoolVar(&p.builtin, "builtin-tables", true, builtinTablesUsage)
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		p.asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		p.improve, err = parseImprovement(s)
+		return err
+	})
+}
+
+// missingRatesUsage is the usage of the -missing-rates flags.
+const missingRatesUsage = "rules for rates missing from the tables: strict, carry, or interpolate, for every table or as TABLE=RULE, comma separated, e.g. strict,corridor_factors.csv=carry (default 0, and 1 for corridor factors)"
 
-	// create variables outside of loops
-	var age_col, year_col, rate_col int
-	var file_age, file_year int
-	var file_rate float64
+// rateDBUsage is the usage of the -rate-db flags.
+const rateDBUsage = "database to read the rate tables it has from, as DRIVER:DSN, e.g. sqlite:rates.db, through a database/sql driver linked into the build"
 
-	// open file
-	file, err := os.Open("unit_load.csv")
+// openRateStore opens the -rate-db database.
+func openRateStore(spec string) (*valact.SQLStore, error) {
+	driver, dsn, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("rate database %q: want DRIVER:DSN", spec)
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		have := strings.Join(sql.Drivers(), ", ")
+		if have == "" {
+			have = "none"
+		}
+		return nil, fmt.Errorf("rate database: no database/sql driver %q in this build (have %s)", driver, have)
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
-		log.Fatal("Error while reading the file", err)
+		return nil, err
 	}
+	var placeholder func(n int) string
+	if driver == "postgres" || driver == "pgx" {
+		placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+	}
+	return valact.NewSQLStore(db, placeholder)
+}
+
+// arithmeticUsage is the usage of the -arithmetic flags.
+const arithmeticUsage = "money arithmetic: float, at full precision for pricing, or cents, rounding each amount to the cent for regulatory illustrations (default the product's, float)"
+
+// roundingUsage is the usage of the -rounding-rules flags.
+const roundingUsage = "comma separated rounding rules, AMOUNT=PLACES[:METHOD] or none, with a bare PLACES[:METHOD] for the other amounts, to tie to an administration system, e.g. coi=2,interest=2:down; amounts are premium, premium_load, expenses, coi, riders, interest, value, loan, withdrawal, surrender_charge, death_benefit, face, and methods nearest, half-even, down, up (default the product's, then -arithmetic)"
+
+// modelPointsUsage is the usage of the -model-points flags.
+const modelPointsUsage = "group census policies of the same rating cell into model points, each projected once, by these face bands, the smallest face of each, e.g. 0,100000,250000,1000000; each policy's values are its model point's scaled by face"
+
+// ratesAsOfUsage is the usage of the -rates-as-of flags.
+const ratesAsOfUsage = "date whose rate table versions to read from " + valact.TableVersionsFile + ": YYYY-MM-DD, e.g. the valuation date, or issue for each policy's issue date (default each table's own file)"
+
+// ratesAsOf is a -rates-as-of date, or each policy's issue date.
+type ratesAsOf struct {
+	date  time.Time
+	issue bool
+}
+
+func parseRatesAsOf(s string) (ratesAsOf, error) {
+	if s == "issue" {
+		return ratesAsOf{issue: true}, nil
+	}
+	date, err := time.Parse(valact.DateLayout, s)
+	return ratesAsOf{date: date}, err
+}
 
-	defer file.Close()
-	reader := csv.NewReader(file)
-	row, _ := reader.Read()
+// apply returns the source reading the table versions of the date, or of
+// each policy's issue date.
+func (r ratesAsOf) apply(source valact.RateSource) (valact.RateSource, error) {
+	if r.issue {
+		source.VersionsAtIssue = true
+		return source, nil
+	}
+	if r.date.IsZero() {
+		return source, nil
+	}
+	return source.AtDate(r.date)
+}
 
-	for idx, val := range row {
-		switch val {
-		case "Issue_Age":
-			age_col = idx
-		case "Policy_Year":
-			year_col = idx
-		case "Rate":
-			rate_col = idx
+// improvementUsage is the usage of the -mortality-improvement flags.
+const improvementUsage = "improve mortality by the scale of " + valact.ImprovementScaleFile + " from the base year of the rate tables to each policy year's calendar year, from the issue date's year (else the base year): [coi|valuation|both:]BASE_YEAR, e.g. 2024 or both:2024 (default no improvement)"
+
+// parseImprovement parses a -mortality-improvement setting.
+func parseImprovement(s string) (*valact.MortalityImprovement, error) {
+	target, year, found := strings.Cut(s, ":")
+	if !found {
+		target, year = "", s
+	}
+	improvement := &valact.MortalityImprovement{Target: valact.ImprovementTarget(target)}
+	if !improvement.Target.Valid() {
+		return nil, fmt.Errorf("unknown mortality improvement target %q", target)
+	}
+	var err error
+	if improvement.BaseYear, err = strconv.Atoi(year); err != nil {
+		return nil, fmt.Errorf("invalid mortality improvement base year %q", year)
+	}
+	return improvement, nil
+}
+
+// builtinTables are the sample rate tables and products shipped in the
+// binary, so that it runs out of the box without a data directory.
+//
+//go:embed *.csv products.toml
+var builtinTables embed.FS
+
+// builtinTablesUsage is the usage of the -builtin-tables flags.
+const builtinTablesUsage = "read rate tables missing from the data directory from the sample tables built into the binary"
+
+// defaultTables returns the built-in tables, or nil when turned off.
+func defaultTables(builtin bool) fs.FS {
+	if !builtin {
+		return nil
+	}
+	return builtinTables
+}
+
+// datedPolicy returns a policy carrying the issue age, computed from the
+// birth and issue dates when -birth-date is given.
+func (p *policyFlags) datedPolicy() (valact.Policy, error) {
+	policy := valact.Policy{IssueAge: p.issueAge, BirthDate: p.birth, IssueDate: p.issued, AgeBasis: valact.AgeBasis(p.ageBasis)}
+	if p.birth.IsZero() {
+		return policy, nil
+	}
+	if p.backdate > 0 {
+		_, err := policy.BackdateToSaveAge(p.backdate)
+		return policy, err
+	}
+	return policy, policy.SetIssueAge()
+}
+
+func (p *policyFlags) policy() valact.Policy {
+	// rates reports any error in the dates
+	dated, _ := p.datedPolicy()
+	policy := valact.Policy{
+		IssueAge:        dated.IssueAge,
+		BirthDate:       dated.BirthDate,
+		IssueDate:       dated.IssueDate,
+		AgeBasis:        dated.AgeBasis,
+		Gender:          p.gender,
+		RiskClass:       p.riskClass,
+		FaceAmount:      p.face,
+		AnnualPremium:   p.premium,
+		TargetPremium:   p.target,
+		DBOption:        valact.DBOption(p.dbOption),
+		PremiumMode:     valact.PremiumMode(p.mode),
+		Changes:         p.changes,
+		Loans:           p.loans,
+		LoanRepayments:  p.repays,
+		Withdrawals:     p.withdraws,
+		PremiumSchedule: p.schedule,
+		Deposits:        p.deposits,
+		TableRating:     p.rating,
+		FlatExtras:      p.extras,
+		State:           p.state,
+	}
+	if p.second.IssueAge > 0 {
+		second := p.second
+		policy.Second = &second
+		policy.FirstDeath = p.death
+	}
+	if p.term.FaceAmount > 0 {
+		term := p.term
+		policy.TermRider = &term
+	}
+	if p.waiver {
+		policy.Waiver = &valact.WaiverRider{ExpiryAge: p.wpExpiry}
+	}
+	if p.adb.FaceAmount > 0 {
+		adb := p.adb
+		policy.ADB = &adb
+	}
+	if p.chronic {
+		claim := p.claim
+		policy.Chronic = &claim
+	}
+	if p.inforce.PolicyMonth > 0 {
+		inforce := p.inforce
+		policy.Inforce = &inforce
+	}
+	return policy
+}
+
+func (p *policyFlags) source() valact.RateSource {
+	source := valact.DefaultRateSource()
+	if p.dataDir != "" {
+		source.Dir = p.dataDir
+	}
+	source.Cache = p.cache
+	source.Missing = p.missing
+	source.Store = p.store
+	source.Defaults = defaultTables(p.builtin)
+	source.AsOf = p.versions
+	source.Improvement = p.improve
+	if p.selected != nil || p.maturity != 0 || p.extended != 0 {
+		product := valact.DefaultProduct()
+		if p.selected != nil {
+			product = *p.selected
 		}
+		// the rate vectors run to the product's maturity
+		if p.maturity != 0 {
+			product.MaturityAge = p.maturity
+		}
+		if p.extended != 0 {
+			product.ExtendedMaturityAge = p.extended
+		}
+		source = source.SelectProduct(product)
 	}
+	return source
+}
 
-	for {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
+func (p *policyFlags) rates() (*valact.RateSet, error) {
+	if p.product != "" && p.selected == nil {
+		source, err := p.source().WithProduct(p.product)
+		if err != nil {
+			return nil, err
 		}
-		file_age, _ = strconv.Atoi(row[age_col])
-		if file_age == issue_age {
-			file_rate, _ = strconv.ParseFloat(row[rate_col], 64)
-			file_year, _ = strconv.Atoi(row[year_col])
-			rates[file_year-1] = file_rate
+		p.selected = source.Product
+	}
+	dated, err := p.datedPolicy()
+	if err != nil {
+		return nil, err
+	}
+	p.issueAge = dated.IssueAge
+	asOf := p.asOf
+	if asOf.issue {
+		asOf = ratesAsOf{date: dated.IssueDate}
+	}
+	source, err := asOf.apply(p.source())
+	if err != nil {
+		return nil, err
+	}
+	p.versions = source.AsOf
+	if !valact.DBOption(p.dbOption).Valid() {
+		return nil, fmt.Errorf("unknown death benefit option %q", p.dbOption)
+	}
+	if !valact.PremiumMode(p.mode).Valid() {
+		return nil, fmt.Errorf("unknown premium mode %q", p.mode)
+	}
+	if p.gpt != "off" && p.gpt != "flag" && p.gpt != "cap" {
+		return nil, fmt.Errorf("unknown guideline premium test setting %q", p.gpt)
+	}
+	test := valact.ComplianceTest(p.test)
+	if !test.Valid() {
+		return nil, fmt.Errorf("unknown compliance test %q", p.test)
+	}
+	if test == valact.TestCVAT && p.gpt != "off" {
+		return nil, fmt.Errorf("-gpt applies only to -test gpt")
+	}
+	if p.interest != 0 && p.scenario != "" {
+		return nil, fmt.Errorf("-interest and -interest-scenario are exclusive")
+	}
+	ratesSource := p.source()
+	ratesSource.Joint = valact.JointMethod(p.joint)
+	ratesSource.NoLapseGuarantee = p.nlg
+	ratesSource.Reserves = valact.ReserveMethod(p.reserves)
+	if p.reserves != "" && !ratesSource.Reserves.Valid() {
+		return nil, fmt.Errorf("unknown reserve method %q", p.reserves)
+	}
+	rates, err := ratesSource.PolicyRates(p.policy(), valact.WaiverBasis(p.wpBasis))
+	if err != nil {
+		return nil, err
+	}
+	if p.interest != 0 {
+		rates.Interest = valact.CreateVector(p.basis.Monthly(p.interest), len(rates.Interest))
+	}
+	if p.scenario != "" {
+		if rates.MonthlyInterest, err = p.source().GetInterestScenario(p.scenario); err != nil {
+			return nil, err
+		}
+	}
+	if p.minimum != nil {
+		rates.MinimumInterest = valact.CreateVector(p.basis.Monthly(*p.minimum), len(rates.MinimumInterest))
+	}
+	for _, bonus := range p.bonuses {
+		rates.AddInterestBonus(bonus.rate, bonus.fromYear, bonus.toYear)
+	}
+	if rates.Valuation != nil {
+		rates.Valuation.Interest = p.valuation
+	}
+	if p.iul {
+		if rates.Indexed, err = p.indexedCrediting(); err != nil {
+			return nil, err
+		}
+	}
+	if p.funds != "" {
+		file, err := valact.OpenFile(p.funds)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if rates.Funds, err = valact.ReadFunds(file, p.funds); err != nil {
+			return nil, err
+		}
+	}
+	if p.order != "" {
+		rates.DeductionOrder = strings.Split(p.order, ",")
+	}
+	if err := rates.CheckAllocations(); err != nil {
+		return nil, err
+	}
+	if p.steps != "" {
+		for _, step := range strings.Split(p.steps, ",") {
+			rates.MonthlySteps = append(rates.MonthlySteps, valact.MonthlyStep(step))
 		}
+		if err := rates.CheckMonthlySteps(); err != nil {
+			return nil, err
+		}
+	}
+	if p.money != "" {
+		if rates.Arithmetic = valact.Arithmetic(p.money); !rates.Arithmetic.Valid() {
+			return nil, fmt.Errorf("unknown arithmetic %q", p.money)
+		}
+	}
+	if p.rounding != "" {
+		if rates.Rounding, err = valact.ParseRoundingRules(p.rounding); err != nil {
+			return nil, err
+		}
+	}
+	if test != valact.TestCVAT && !p.mec {
+		return rates, nil
+	}
+	basis, err := p.source().GetGuidelineBasis(p.gender, p.riskClass, p.issueAge)
+	if err != nil {
+		return nil, err
+	}
+	if test == valact.TestCVAT {
+		rates.QualifyCVAT(basis, p.issueAge)
 	}
-	return rates
+	if p.mec {
+		rates.ApplySevenPayTest(basis, p.issueAge)
+	}
+	return rates, nil
 }
 
-func get_coi_rates(gender string, risk_class string, issue_age int) [120]float64 {
-	// create array
-	rates := create_array(0)
+// indexedCrediting returns the -iul crediting, reading -index-returns when
+// given.
+func (p *policyFlags) indexedCrediting() (*valact.IndexedCrediting, error) {
+	if p.indexed.SegmentMonths < 1 {
+		return nil, fmt.Errorf("invalid segment term %d months", p.indexed.SegmentMonths)
+	}
+	indexed := p.indexed
+	if p.returns != "" {
+		file, err := valact.OpenFile(p.returns)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if indexed.Returns, err = valact.ReadIndexReturns(file, p.returns); err != nil {
+			return nil, err
+		}
+	}
+	return &indexed, nil
+}
 
-	// create variables outside of loops
-	var age_col, year_col, rate_col, gender_col, class_col int
-	var file_age, file_year int
-	var file_rate float64
+// applyGuideline computes the guideline premiums for the policy's face and
+// attaches the limit when -gpt is flag or cap.
+func (p *policyFlags) applyGuideline(policy *valact.Policy, rates *valact.RateSet) error {
+	if p.gpt == "off" {
+		return nil
+	}
+	basis, err := p.source().GetGuidelineBasis(p.gender, p.riskClass, p.issueAge)
+	if err != nil {
+		return err
+	}
+	premiums, err := valact.ComputeGuidelinePremiums(*policy, rates, basis)
+	if err != nil {
+		return err
+	}
+	policy.Guideline = &valact.GuidelineLimit{GuidelinePremiums: premiums, Cap: p.gpt == "cap"}
+	return nil
+}
 
-	// open file
-	file, err := os.Open("coi.csv")
+// parseChange parses a year:face[:option] policy change flag.
+func parseChange(s string) (valact.PolicyChange, error) {
+	var change valact.PolicyChange
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return change, fmt.Errorf("expected year:face[:option], got %q", s)
+	}
+	year, err := strconv.Atoi(parts[0])
+	if err != nil || year < 1 {
+		return change, fmt.Errorf("invalid policy year %q", parts[0])
+	}
+	change.PolicyYear = year
+	if parts[1] != "" {
+		change.FaceAmount, err = strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return change, fmt.Errorf("invalid face amount %q", parts[1])
+		}
+	}
+	if len(parts) == 3 {
+		change.DBOption = valact.DBOption(parts[2])
+		if !change.DBOption.Valid() {
+			return change, fmt.Errorf("unknown death benefit option %q", parts[2])
+		}
+	}
+	return change, nil
+}
+
+// interestBonus is an -interest-bonus flag.
+type interestBonus struct {
+	rate             float64
+	fromYear, toYear int
+}
+
+// parseInterestBonus parses a rate:from-year[:to-year] interest bonus flag.
+func parseInterestBonus(s string) (interestBonus, error) {
+	var bonus interestBonus
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return bonus, fmt.Errorf("expected rate:from-year[:to-year], got %q", s)
+	}
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return bonus, fmt.Errorf("invalid bonus rate %q", parts[0])
+	}
+	bonus.rate = rate
+	if bonus.fromYear, err = strconv.Atoi(parts[1]); err != nil || bonus.fromYear < 1 {
+		return bonus, fmt.Errorf("invalid policy year %q", parts[1])
+	}
+	if len(parts) == 3 {
+		if bonus.toYear, err = strconv.Atoi(parts[2]); err != nil || bonus.toYear < bonus.fromYear {
+			return bonus, fmt.Errorf("invalid policy year %q", parts[2])
+		}
+	}
+	return bonus, nil
+}
+
+// parseFlatExtra parses a rate:years[:from-year] flat extra flag.
+func parseFlatExtra(s string) (valact.FlatExtra, error) {
+	var extra valact.FlatExtra
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return extra, fmt.Errorf("expected rate:years[:from-year], got %q", s)
+	}
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return extra, fmt.Errorf("invalid flat extra rate %q", parts[0])
+	}
+	extra.Rate = rate
+	if extra.Years, err = strconv.Atoi(parts[1]); err != nil || extra.Years < 1 {
+		return extra, fmt.Errorf("invalid number of years %q", parts[1])
+	}
+	if len(parts) == 3 {
+		if extra.FromYear, err = strconv.Atoi(parts[2]); err != nil || extra.FromYear < 1 {
+			return extra, fmt.Errorf("invalid policy year %q", parts[2])
+		}
+	}
+	return extra, nil
+}
+
+// scheduleFlag returns a flag.Func parser appending year:amount entries to
+// schedule.
+func scheduleFlag(schedule *[]valact.ScheduledAmount) func(string) error {
+	return func(s string) error {
+		year, amount, err := parseTimedAmount(s)
+		*schedule = append(*schedule, valact.ScheduledAmount{PolicyYear: year, Amount: amount})
+		return err
+	}
+}
+
+// parseTimedAmount parses a period:amount flag value, where period is a
+// policy year or month starting at 1.
+func parseTimedAmount(s string) (int, float64, error) {
+	periodText, amountText, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("expected period:amount, got %q", s)
+	}
+	period, err := strconv.Atoi(periodText)
+	if err != nil || period < 1 {
+		return 0, 0, fmt.Errorf("invalid policy period %q", periodText)
+	}
+	amount, err := strconv.ParseFloat(amountText, 64)
 	if err != nil {
-		log.Fatal("Error while reading the file", err)
+		return 0, 0, fmt.Errorf("invalid amount %q", amountText)
 	}
+	return period, amount, nil
+}
+
+// createOutput opens path for writing, compressed by its suffix, or stdout
+// for "" and "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return valact.CreateFile(path)
+}
 
-	defer file.Close()
-	reader := csv.NewReader(file)
-	row, _ := reader.Read()
+// runContext returns a context ended by an interrupt (Ctrl-C) or, when
+// timeout is positive, once the timeout passes.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
 
-	for idx, val := range row {
-		switch val {
-		case "Issue_Age":
-			age_col = idx
-		case "Policy_Year":
-			year_col = idx
-		case "Rate":
-			rate_col = idx
-		case "Gender":
-			gender_col = idx
-		case "Risk_Class":
-			class_col = idx
+// progressReport returns a progress callback writing to stderr at most once
+// per interval and on completion, or nil when interval is not positive.
+func progressReport(interval time.Duration) func(valact.Progress) {
+	if interval <= 0 {
+		return nil
+	}
+	var last time.Duration
+	return func(progress valact.Progress) {
+		if progress.Elapsed-last < interval && progress.Done < progress.Total {
+			return
 		}
+		last = progress.Elapsed
+		fmt.Fprintln(os.Stderr, progress)
 	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
 
-	for {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func runIllustrate(args []string) error {
+	fs := flag.NewFlagSet("illustrate", flag.ExitOnError)
+	var p policyFlags
+	p.register(fs)
+	format := fs.String("format", "csv", "output format: csv or json")
+	annual := fs.Bool("annual", false, "write policy year totals instead of months (csv only)")
+	out := fs.String("out", "", "output file (default stdout)")
+	annuitize := fs.Int("annuitize", 0, "annuity payments per year to report from the maturity value (0 to skip)")
+	scales := fs.Bool("scales", false, "write guaranteed, midpoint, and current values side by side by policy year (csv)")
+	trace := fs.String("trace", "", "also write a trace of every month's premium load, expense charge, NAAR, COI, and interest with the rates applied and the table and row each came from, to this file: JSON Lines when it ends in .jsonl, CSV otherwise")
+	fs.Parse(args)
+
+	if *scales {
+		if *trace != "" {
+			return fmt.Errorf("-trace does not apply to -scales")
 		}
-		file_age, _ = strconv.Atoi(row[age_col])
-		if file_age == issue_age && row[gender_col] == gender && row[class_col] == risk_class {
-			file_rate, _ = strconv.ParseFloat(row[rate_col], 64)
-			file_year, _ = strconv.Atoi(row[year_col])
-			rates[file_year-1] = file_rate
+		return writeScales(p, *out)
+	}
+	rates, err := p.rates()
+	if err != nil {
+		return err
+	}
+	policy := p.policy()
+	if err := p.applyGuideline(&policy, rates); err != nil {
+		return err
+	}
+	if *trace != "" {
+		if err := writeTrace(&p, policy, rates, *trace); err != nil {
+			return err
 		}
 	}
-	return rates
+	return writeResult(policy, rates, p.source(), nil, nil, *format, *annual, *out, *annuitize)
 }
 
-func get_corridor_factors(issue_age int) [120]float64 {
-	rates := create_array(1.0)
-	var age_col, rate_col int
+func runSolve(args []string) error {
+	fs := flag.NewFlagSet("solve", flag.ExitOnError)
+	var p policyFlags
+	p.register(fs)
+	target := fs.String("for", "premium", "value to solve for: premium (given -face), face (given -premium), max-non-mec (the largest premium that is not a MEC; implies -mec), nlg-premium (the smallest premium holding the no-lapse guarantee to -nlg-age; implies -nlg), endow-premium (the smallest premium whose value at maturity reaches the face), value-premium (the smallest premium whose -target-metric at -target-age reaches -target-value), or withdrawal (the largest level annual withdrawal from -income-age through -target-age that keeps the -target-metric there above -target-value, given -premium paid until -income-age), or catch-up (the smallest level annual premium, paid on top of the policy's premiums from the month after -inforce-month and then each policy anniversary, that keeps the policy in force through -target-age)")
+	nlgAge := fs.Int("nlg-age", 0, "attained age through which -for nlg-premium holds the guarantee (0 for the year before maturity)")
+	targetAge := fs.Int("target-age", 65, "attained age at the end of the policy year -for value-premium and withdrawal target")
+	targetValue := fs.Float64("target-value", 0, "value the -target-metric must reach at -target-age")
+	targetMetric := fs.String("target-metric", "account-value", "value -for value-premium and withdrawal target: account-value or cash-value")
+	incomeAge := fs.Int("income-age", 65, "attained age at the start of the first policy year of the -for withdrawal withdrawals")
+	guaranteed := fs.Bool("guaranteed", false, "also solve on the guaranteed basis (maximum COI, minimum interest, maximum loads and fee) and report that premium beside the current one; premium solves only")
+	var solver solveFlags
+	solver.register(fs)
+	format := fs.String("format", "text", "output format: text, csv, or json")
+	annual := fs.Bool("annual", false, "write policy year totals instead of months (csv only)")
+	out := fs.String("out", "", "output file (default stdout)")
+	annuitize := fs.Int("annuitize", 0, "annuity payments per year to report from the maturity value (0 to skip)")
+	fs.Parse(args)
 
-	file, err := os.Open("corridor_factors.csv")
+	switch *target {
+	case "max-non-mec":
+		p.mec = true
+	case "nlg-premium":
+		p.nlg = true
+	}
+	rates, err := p.rates()
 	if err != nil {
-		log.Fatal("Error when opening file", err)
-	}
-
-	defer file.Close()
-	reader := csv.NewReader(file)
-	row, _ := reader.Read()
-	for idx, val := range row {
-		switch val {
-		case "Attained_Age":
-			age_col = idx
-		case "Rate":
-			rate_col = idx
-		}
-	}
-
-	var file_age int
-	var file_rate float64
-	for {
-		row, err = reader.Read()
-		if err == io.EOF {
-			break
-		}
-		file_age, _ = strconv.Atoi(row[age_col])
-		if file_age >= issue_age {
-			file_rate, _ = strconv.ParseFloat(row[rate_col], 64)
-			rates[file_age-issue_age] = file_rate
-		}
-	}
-	return rates
-}
-
-func get_rates(gender string, risk_class string, issue_age int) map[string][120]float64 {
-	var rates map[string][120]float64
-	rates = make(map[string][120]float64)
-	coi_rates := get_coi_rates(gender, risk_class, issue_age)
-	per_unit_rates := get_per_unit_rates(issue_age)
-	corridor_factors := get_corridor_factors(issue_age)
-	premium_loads := create_array(0.06)
-	policy_fees := create_array(120)
-	naar_discount := create_array(math.Pow(1.01, -1/12.0))
-	interest_rates := create_array(math.Pow(1.03, 1/12.0) - 1)
-
-	rates["premium_load"] = premium_loads
-	rates["policy_fee"] = policy_fees
-	rates["per_unit"] = per_unit_rates
-	rates["cf"] = corridor_factors
-	rates["naar_disc"] = naar_discount
-	rates["coi"] = coi_rates
-	rates["interest"] = interest_rates
-	
-	return rates
-}
-
-func illustrate(rates map[string][120]float64, issue_age int, face_amount float64, annual_premium float64) float64 {
-	maturity_age := 121
-	projection_years := maturity_age - issue_age
-
-	end_value := 0.0
-	policy_year := 0
-	var start_value, premium, premium_load, expense_charge, av_for_db, db, naar, coi, av_for_interest, interest float64
-	for i := 1; i <= 12*projection_years; i++ {
-		if (i % 12) == 1 {
-			policy_year += 1
-			premium = annual_premium
-		} else {
-			premium = 0.0
+		return err
+	}
+	policy := p.policy()
+	seek := valact.GoalSeek{Target: valact.Target{Metric: valact.MetricMaturityValue}}
+	seek.SolveOptions, err = solver.options()
+	if err != nil {
+		return err
+	}
+	if *guaranteed && (*target == "face" || *target == "withdrawal" || *target == "catch-up") {
+		return fmt.Errorf("-guaranteed applies to premium solves, not -for %s", *target)
+	}
+	// guaranteedPremium is the premium solved for on the guaranteed basis
+	// with -guaranteed, set by guarantee
+	var guaranteedPremium *float64
+	guarantee := func(policy valact.Policy) error {
+		if !*guaranteed {
+			return nil
+		}
+		basis, err := p.source().GuaranteedBasis(rates, p.gender, p.riskClass, p.issueAge)
+		if err != nil {
+			return err
+		}
+		premium, err := seek.Solve(policy, basis)
+		if err != nil {
+			return fmt.Errorf("guaranteed basis: %w", err)
+		}
+		guaranteedPremium = &premium
+		return nil
+	}
+	switch *target {
+	case "value-premium", "withdrawal":
+		if *targetAge <= p.issueAge || *targetAge > rates.MaturityAge {
+			return fmt.Errorf("-target-age %d is not after issue age %d and by maturity", *targetAge, p.issueAge)
+		}
+		seek.Target = valact.Target{Metric: valact.MetricAccountValue, AttainedAge: *targetAge, Value: *targetValue}
+		switch *targetMetric {
+		case "account-value":
+		case "cash-value":
+			seek.Target.Metric = valact.MetricCashValue
+		default:
+			return fmt.Errorf("unknown target metric %q", *targetMetric)
+		}
+		if err := p.applyGuideline(&policy, rates); err != nil {
+			return err
 		}
-		start_value = end_value
-		premium_load = premium * rates["premium_load"][policy_year-1]
-		expense_charge = (rates["policy_fee"][policy_year-1] + rates["per_unit"][policy_year-1]*face_amount/1000) / 12.0
-		av_for_db = start_value + premium - premium_load - expense_charge
-		db = max(face_amount, rates["cf"][policy_year-1]*av_for_db)
-		naar = max(0, db*rates["naar_disc"][policy_year-1]-max(0, av_for_db))
-		coi = (naar / 1000.0) * (rates["coi"][policy_year-1] / 12)
-		av_for_interest = av_for_db - coi
-		interest = max(0, av_for_interest) * rates["interest"][policy_year-1]
-		end_value = av_for_interest + interest
+		if *target == "value-premium" {
+			seek.Variable.Kind = valact.VaryPremium
+			premium, err := seek.Solve(policy, rates)
+			if err != nil {
+				return err
+			}
+			if err := guarantee(policy); err != nil {
+				return err
+			}
+			policy.AnnualPremium = premium
+			return writeResult(policy, rates, p.source(), &premium, guaranteedPremium, *format, *annual, *out, *annuitize)
+		}
+		if *incomeAge <= p.issueAge || *incomeAge >= *targetAge {
+			return fmt.Errorf("-income-age %d is not after issue age %d and before -target-age %d", *incomeAge, p.issueAge, *targetAge)
+		}
+		seek.Variable = valact.Variable{Kind: valact.VaryWithdrawal, FromYear: *incomeAge - p.issueAge + 1, ToYear: *targetAge - p.issueAge}
+		// premiums stop when the income starts, as withdrawals are limited
+		// to the cash value and later premiums would sustain any amount
+		schedule := make([]float64, seek.Variable.FromYear-1)
+		for year := range schedule {
+			schedule[year] = policy.AnnualPremium
+			if year < len(policy.PremiumSchedule) {
+				schedule[year] = policy.PremiumSchedule[year]
+			}
+		}
+		policy.PremiumSchedule, policy.AnnualPremium = schedule, 0
+		withdrawal, err := seek.Solve(policy, rates)
+		if err != nil {
+			return err
+		}
+		policy = seek.Variable.Apply(policy, rates, withdrawal)
+		if *format == "text" {
+			w, err := createOutput(*out)
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			_, err = fmt.Fprintln(w, "Withdrawal", withdrawal)
+			return err
+		}
+		return writeResult(policy, rates, p.source(), nil, nil, *format, *annual, *out, *annuitize)
+	case "catch-up":
+		if *targetAge <= p.issueAge {
+			return fmt.Errorf("-target-age %d is not after issue age %d", *targetAge, p.issueAge)
+		}
+		if err := p.applyGuideline(&policy, rates); err != nil {
+			return err
+		}
+		catchUp, err := valact.SolveCatchUp(policy, rates, *targetAge)
+		if err != nil {
+			return err
+		}
+		if catchUp > 0 {
+			// catch-up premiums past maturity are not paid
+			toYear := *targetAge - p.issueAge
+			policy = valact.Variable{Kind: valact.VaryCatchUp, ToYear: toYear}.Apply(policy, rates, catchUp)
+		}
+		if *format == "text" {
+			w, err := createOutput(*out)
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			_, err = fmt.Fprintln(w, "Catch-up", catchUp)
+			return err
+		}
+		return writeResult(policy, rates, p.source(), nil, nil, *format, *annual, *out, *annuitize)
+	case "premium", "max-non-mec", "nlg-premium", "endow-premium":
+		if err := p.applyGuideline(&policy, rates); err != nil {
+			return err
+		}
+		seek.Variable.Kind = valact.VaryPremium
+		switch *target {
+		case "max-non-mec":
+			seek.Target.Metric = valact.MetricSevenPayMargin
+		case "nlg-premium":
+			if *nlgAge == 0 {
+				*nlgAge = rates.MaturityAge - 1
+			}
+			seek.Target = valact.Target{Metric: valact.MetricShadowValue, AttainedAge: *nlgAge}
+		case "endow-premium":
+			seek.Target.Metric = valact.MetricEndowment
+		}
+		premium, err := seek.Solve(policy, rates)
+		if err != nil {
+			return err
+		}
+		if err := guarantee(policy); err != nil {
+			return err
+		}
+		policy.AnnualPremium = premium
+		return writeResult(policy, rates, p.source(), &premium, guaranteedPremium, *format, *annual, *out, *annuitize)
+	case "face":
+		seek.Variable.Kind = valact.VaryFace
+		policy.FaceAmount, err = seek.Solve(policy, rates)
+		if err != nil {
+			return err
+		}
+		// the guideline premiums depend on the face, so test the solved one
+		if err := p.applyGuideline(&policy, rates); err != nil {
+			return err
+		}
+		if *format == "text" {
+			w, err := createOutput(*out)
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			_, err = fmt.Fprintln(w, "Face", policy.FaceAmount)
+			return err
+		}
+		return writeResult(policy, rates, p.source(), nil, nil, *format, *annual, *out, *annuitize)
 	}
+	return fmt.Errorf("unknown solve target %q", *target)
+}
 
-	return end_value
+// solveFlags are the solver options shared by the commands that solve.
+type solveFlags struct {
+	method    string
+	tolerance float64
+	increment float64
+	rounding  string
+	warm      bool
 }
 
-func solve(rates map[string][120]float64, issue_age int, face_amount float64) float64 {
-	guess_lo := 0.0
-	guess_hi := face_amount / 100.0
+func (s *solveFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.method, "method", "bisection", "root finder: bisection or brent")
+	fs.Float64Var(&s.tolerance, "tolerance", 0, "bracket width to converge to (default half the increment)")
+	fs.Float64Var(&s.increment, "increment", 0, "rounding increment of the solution, e.g. 0.01 or 1 (default cents, dollars for face)")
+	fs.StringVar(&s.rounding, "rounding", "sufficient", "rounding rule: sufficient (bump to meet the target), nearest, or conservative")
+}
 
-	for {
-		end_value := illustrate(rates, issue_age, face_amount, guess_hi)
-		if end_value <= 0 {
-			guess_lo = guess_hi
-			guess_hi *= 2
-		} else {
-			break
+// registerWarmStart adds -warm-start for the commands solving many
+// policies.
+func (s *solveFlags) registerWarmStart(fs *flag.FlagSet) {
+	fs.BoolVar(&s.warm, "warm-start", false, "start each premium solve from the trend of the last two policies' solutions per dollar of face instead of face/100, saving projections over a grid of neighboring cells (in census order); solutions may differ within -tolerance")
+}
+
+// options validates the flags and returns them as solver options.
+func (s *solveFlags) options() (valact.SolveOptions, error) {
+	options := valact.SolveOptions{Tolerance: s.tolerance, Increment: s.increment, WarmStart: s.warm}
+	switch s.method {
+	case "bisection":
+		options.Method = valact.MethodBisection
+	case "brent":
+		options.Method = valact.MethodBrent
+	default:
+		return options, fmt.Errorf("unknown solve method %q", s.method)
+	}
+	switch s.rounding {
+	case "sufficient":
+		options.Rounding = valact.RoundSufficient
+	case "nearest":
+		options.Rounding = valact.RoundNearest
+	case "conservative":
+		options.Rounding = valact.RoundConservative
+	default:
+		return options, fmt.Errorf("unknown rounding rule %q", s.rounding)
+	}
+	if s.tolerance < 0 || s.increment < 0 {
+		return options, fmt.Errorf("-tolerance and -increment must not be negative")
+	}
+	return options, nil
+}
+
+// writeScales writes the side by side guaranteed/midpoint/current ledger.
+func writeScales(p policyFlags, out string) error {
+	if _, err := p.rates(); err != nil {
+		return err
+	}
+	scales, err := p.source().GetScales(p.gender, p.riskClass, p.issueAge)
+	if err != nil {
+		return err
+	}
+	w, err := createOutput(out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return valact.WriteScaleLedgerCSV(w, valact.IllustrateScales(p.policy(), scales))
+}
+
+// writeResult writes the illustration of policy in the requested format. A
+// non-nil solved premium is reported as such, with the guaranteed basis
+// premium beside it when set.
+func writeResult(policy valact.Policy, rates *valact.RateSet, source valact.RateSource, solved *float64, guaranteed *float64, format string, annual bool, out string, annuitize int) error {
+	// optional post-maturity phase: convert the maturity value into an
+	// annuity payment
+	var payment *float64
+	if annuitize > 0 {
+		amount, err := source.Annuitize(rates, valact.Illustrate(policy, rates), annuitize)
+		if err != nil {
+			return err
 		}
+		payment = &amount
+	}
+
+	w, err := createOutput(out)
+	if err != nil {
+		return err
 	}
+	defer w.Close()
 
-	guess_md := 0.0
-	for ; (guess_hi - guess_lo) > 0.005; {
-		guess_md = (guess_lo + guess_hi) / 2.0
-		end_value := illustrate(rates, issue_age, face_amount, guess_md)
-		if end_value <= 0 {
-			guess_lo = guess_md
+	switch format {
+	case "csv":
+		ledger := valact.IllustrateLedger(policy, rates)
+		if annual {
+			ledger = ledger.Annual()
+		}
+		if payment != nil {
+			err = valact.WriteAnnuityLedgerCSV(w, ledger, *payment)
 		} else {
-			guess_hi = guess_md
-		}
-	}
-
-	result := math.Round(guess_md * 100.0) / 100.0
-	end_value := illustrate(rates, issue_age, face_amount, result)
-	if end_value <= 0 {result += 0.01}
-	return result
-}
-
-func single() {
-	issue_age := 35
-	gender := "M"
-	risk_class := "NS"
-	face_amount := 100000.0
-	//premium := 1255.03
-	x := 0.0
-
-	fmt.Println("Starting...")
-	start := time.Now()
-	iter := 1000
-	//rates := get_rates(gender, risk_class, issue_age)
-	for i := 0; i < iter; i++ {
-		rates := get_rates(gender, risk_class, issue_age)
-		//x = illustrate(rates, issue_age, face_amount, premium)
-		x = solve(rates, issue_age, face_amount)
-	}
-	end := time.Now()
-	fmt.Println("Ending...")
-	elapsed := end.Sub(start)
-	fmt.Println("Prem", x)
-	fmt.Println("Total time", elapsed)
-	fmt.Println("Runs", iter)
-	fmt.Println("Per iteration", float64(elapsed)/float64(iter))
-}
-
-func worker(id int, jobs <-chan int, results chan<- float64) {
-	gender := "M"
-	risk_class := "NS"
-	issue_age := 35
-	rates := get_rates(gender, risk_class, issue_age)	
-	for _ = range jobs {
-		
-		face_amount := 100000.0
-		premium := 1255.03
-		result := 0.0
-		
-		result = illustrate(rates, issue_age, face_amount, premium)
-		//result = solve(rates, issue_age, face_amount)
-		results <- result
-	}
-}
-
-func multi() {
-	fmt.Println("Starting...")
-	start := time.Now()
-	numWorkers := 8
-	numJobs := 1000
-	jobs := make(chan int, numJobs)
-	results := make(chan float64, numJobs)
-
-	for i :=1; i <= numWorkers; i++ {
-		go worker(i, jobs, results)
-	}
-
-	for i := 1; i <= numJobs; i++ {
-		jobs <- i
-	}
-	close(jobs)
-	var result float64
-	for i := 1; i <= numJobs; i++ {
-		result = <- results	
-	}
-	end := time.Now()
-	fmt.Println("Ending...")
-	elapsed := end.Sub(start)
-	fmt.Println("Prem", result)
-	fmt.Println("Total time", elapsed)
-	fmt.Println("Runs", numJobs)
-	fmt.Println("Per iteration", float64(elapsed)/float64(numJobs))
+			err = valact.WriteLedgerCSV(w, ledger)
+		}
+	case "json":
+		result := valact.NewResult(policy, rates)
+		result.SolvedPremium = solved
+		result.GuaranteedPremium = guaranteed
+		result.AnnuityPayment = payment
+		err = valact.WriteJSON(w, result)
+	case "text":
+		switch {
+		case solved != nil && guaranteed != nil:
+			_, err = fmt.Fprintln(w, "Prem", *solved, "Guaranteed", *guaranteed)
+		case solved != nil:
+			_, err = fmt.Fprintln(w, "Prem", *solved)
+		default:
+			_, err = fmt.Fprintln(w, "Maturity value", valact.Illustrate(policy, rates))
+		}
+		if err == nil && payment != nil {
+			_, err = fmt.Fprintln(w, "Annuity payment", *payment)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return err
 }
 
 func main() {
-	//single()
-	multi()
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "illustrate":
+		err = runIllustrate(os.Args[2:])
+	case "solve":
+		err = runSolve(os.Args[2:])
+	case "batch":
+		err = runBatch(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "stochastic":
+		err = runStochastic(os.Args[2:])
+	case "sensitivity":
+		err = runSensitivity(os.Args[2:])
+	case "support":
+		err = runSupport(os.Args[2:])
+	case "profit":
+		err = runProfit(os.Args[2:])
+	case "project":
+		err = runProject(os.Args[2:])
+	case "compare":
+		err = runCompare(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "worker":
+		err = runWorker(os.Args[2:])
+	case "validate":
+		err = runValidate(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runSensitivity(args []string) error {
+	fs := flag.NewFlagSet("sensitivity", flag.ExitOnError)
+	var p policyFlags
+	p.register(fs)
+	var solver solveFlags
+	solver.register(fs)
+	coi := fs.Float64("coi-shock", 0.10, "COI shock as a proportion, run up and down (0 to skip)")
+	interest := fs.Float64("interest-shock", 0.01, "crediting rate shock in annual rate, run up and down (0 to skip)")
+	loads := fs.Float64("load-shock", 0.10, "premium load, policy fee, and per unit shock as a proportion, run up and down (0 to skip)")
+	out := fs.String("out", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	rates, err := p.rates()
+	if err != nil {
+		return err
+	}
+	options, err := solver.options()
+	if err != nil {
+		return err
+	}
+	results := valact.RunSensitivity(p.policy(), rates, valact.StandardShocks(*coi, *interest, *loads), options)
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return valact.WriteSensitivityCSV(w, results)
 }
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"approach1/valact"
+)
+
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	census := fs.String("census", "", "census CSV of model points (Policy_ID, Issue_Age, Gender, Risk_Class, Face_Amount, Annual_Premium)")
+	mode := fs.String("mode", "illustrate", "calculation per policy: illustrate, solve (the minimum premium to maturity), or endow (the minimum premium to endow)")
+	var targets []valact.SolveTarget
+	fs.Func("targets", "premiums to solve each policy for besides -mode, in one pass: a comma-separated list of minimum (to maturity), endow, and max-non-mec (the largest premium that is not a MEC); fills the Minimum_Premium, Endow_Premium, and Max_Non_MEC_Premium columns", func(s string) (err error) {
+		targets, err = valact.ParseSolveTargets(s)
+		return err
+	})
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines")
+	ordered := fs.Bool("ordered", false, "write results in census order instead of as they complete")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for census Waiver riders: deduction or per-unit")
+	arithmetic := fs.String("arithmetic", "", arithmeticUsage)
+	roundingRules := fs.String("rounding-rules", "", roundingUsage)
+	var commission valact.CommissionSchedule
+	fs.Float64Var(&commission.FirstYear, "fyc", 0, "first year commission rate on premium up to target; enables the commission columns")
+	fs.Float64Var(&commission.Renewal, "renewal-commission", 0.03, "renewal commission rate on premium up to target")
+	fs.IntVar(&commission.RenewalYears, "renewal-years", 9, "number of years after the first paying renewal commission")
+	fs.Float64Var(&commission.Excess, "excess-commission", 0.03, "commission rate on premium above target")
+	fs.IntVar(&commission.RollingYears, "rolling-years", 0, "years over which unpaid first year target rolls forward (0 for none)")
+	fs.IntVar(&commission.ChargebackMonths, "chargeback-months", 12, "months after issue in which a lapse charges back unearned first year commission")
+	var solver solveFlags
+	solver.register(fs)
+	solver.registerWarmStart(fs)
+	var modelPoints *[]float64
+	fs.Func("model-points", modelPointsUsage, func(s string) error {
+		bands, err := valact.ParseFaceBands(s)
+		modelPoints = &bands
+		return err
+	})
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "csv", "output format: csv, jsonl (JSON lines), or parquet")
+	summaryPath := fs.String("summary", "", "also write summary statistics by issue age band and risk class (policies, failures, lapses, face, and the mean, median, and percentiles of the solved or annual premium) to this file, as CSV or, ending in .json, JSON")
+	summary := valact.BatchSummary{AgeBands: []int{30, 40, 50, 60, 70}}
+	fs.Func("age-bands", "issue ages starting each -summary age band after the first (default 30,40,50,60,70)", func(s string) (err error) {
+		summary.AgeBands, err = valact.ParseAgeBands(s)
+		return err
+	})
+	summaryLevels := fs.String("summary-percentiles", "0.05,0.25,0.75,0.95", "comma separated premium percentile levels of -summary")
+	checkpointPath := fs.String("checkpoint", "", "file recording completed policies, so an interrupted run can be resumed (requires -out)")
+	checkpointEvery := fs.Duration("checkpoint-every", time.Minute, "interval between checkpoints")
+	resume := fs.Bool("resume", false, "resume from -checkpoint, skipping completed policies and appending to -out")
+	progress := fs.Duration("progress", 0, "report progress (policies done, rate, ETA) on stderr at this interval, e.g. 10s (0 for none)")
+	timeout := fs.Duration("timeout", 0, "stop the run after this long, e.g. 30m, keeping the rows already written (0 for no limit)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" in the data directory (default the built-in product)")
+	var missing *valact.MissingRates
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var improve *valact.MortalityImprovement
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		improve, err = parseImprovement(s)
+		return err
+	})
+	fs.Parse(args)
+
+	if *census == "" {
+		return fmt.Errorf("batch: -census is required")
+	}
+	if *checkpointPath != "" && (*out == "" || *out == "-") {
+		return fmt.Errorf("batch: -checkpoint requires -out")
+	}
+	if *format != "csv" && *format != "jsonl" && *format != "parquet" {
+		return fmt.Errorf("batch: unknown format %q", *format)
+	}
+	if *format == "parquet" && (strings.HasSuffix(*out, valact.GzipSuffix) || strings.HasSuffix(*out, valact.ZstdSuffix)) {
+		return fmt.Errorf("batch: Parquet output is compressed within; write %s without the suffix", *out)
+	}
+	if *resume && *checkpointPath == "" {
+		return fmt.Errorf("batch: -resume requires -checkpoint")
+	}
+	if modelPoints != nil && *checkpointPath != "" {
+		return fmt.Errorf("batch: -model-points cannot be checkpointed")
+	}
+	if *summaryPath != "" && *checkpointPath != "" {
+		return fmt.Errorf("batch: -summary cannot be checkpointed")
+	}
+	var err error
+	if summary.Percentiles, err = parseLevels(*summaryLevels); err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+	batch := valact.Batch{Source: valact.DefaultRateSource(), Workers: *workers, Ordered: *ordered, WaiverBasis: valact.WaiverBasis(*waiverBasis), Targets: targets}
+	if !batch.WaiverBasis.Valid() {
+		return fmt.Errorf("batch: unknown waiver basis %q", *waiverBasis)
+	}
+	if batch.Arithmetic = valact.Arithmetic(*arithmetic); !batch.Arithmetic.Valid() {
+		return fmt.Errorf("batch: unknown arithmetic %q", *arithmetic)
+	}
+	if *roundingRules != "" {
+		rules, err := valact.ParseRoundingRules(*roundingRules)
+		if err != nil {
+			return fmt.Errorf("batch: %w", err)
+		}
+		batch.Rounding = rules
+	}
+	if *dataDir != "" {
+		batch.Source.Dir = *dataDir
+	}
+	if *product != "" {
+		var err error
+		if batch.Source, err = batch.Source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	batch.Source.Missing = missing
+	batch.Source.Improvement = improve
+	batch.Source.Store = store
+	batch.Source.Defaults = defaultTables(*builtin)
+	if batch.Source, err = asOf.apply(batch.Source); err != nil {
+		return err
+	}
+	// model points sharing an insured share their rates
+	batch.Source.Cache = valact.NewRateCache()
+	if commission.FirstYear > 0 {
+		batch.Commission = &commission
+	}
+	batch.SolveOptions, err = solver.options()
+	if err != nil {
+		return err
+	}
+	switch *mode {
+	case "illustrate":
+		batch.Mode = valact.BatchIllustrate
+	case "solve":
+		batch.Mode = valact.BatchSolve
+	case "endow":
+		batch.Mode = valact.BatchEndow
+	default:
+		return fmt.Errorf("batch: unknown mode %q", *mode)
+	}
+
+	file, err := valact.OpenFile(*census)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// the census is read as the pool takes its policies, all at once only
+	// to compress it to model points
+	reader, err := valact.NewCensusReader(file, *census)
+	if err != nil {
+		return err
+	}
+
+	if *checkpointPath != "" {
+		return runCheckpointed(batch, reader.All(), *format, *out, *checkpointPath, *checkpointEvery, *resume, *progress, *timeout)
+	}
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	writer, err := batchSink(w, *format, nil, 0)
+	if err != nil {
+		return err
+	}
+	// an interrupt or the timeout stops the run; the finished rows are kept
+	batch.Progress = progressReport(*progress)
+	ctx, stop := runContext(*timeout)
+	defer stop()
+	write := writer.Write
+	if *summaryPath != "" {
+		write = func(result valact.BatchResult) error {
+			summary.Add(result)
+			return writer.Write(result)
+		}
+	}
+	var runErr error
+	if modelPoints != nil {
+		policies, err := reader.ReadAll()
+		if err != nil {
+			return err
+		}
+		// each model point's members are written together, in census order
+		points := valact.CompressCensus(policies, *modelPoints)
+		runErr = batch.RunContext(ctx, points.Policies, func(result valact.BatchResult) error {
+			for _, member := range points.ExpandBatch(result) {
+				if err := write(member); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	} else {
+		runErr = batch.RunSeq(ctx, reader.All(), write)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	// the summary covers the rows written, also of a stopped run
+	if *summaryPath != "" {
+		if err := writeSummary(&summary, *summaryPath); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		return fmt.Errorf("batch: %w", runErr)
+	}
+	return nil
+}
+
+// runCheckpointed runs the batch writing to the output file and recording
+// the completed policies in the checkpoint file at each interval and at the
+// end of the run, however it ends. On resume the policies completed at the
+// last checkpoint are skipped and the output is cut back to its length then,
+// dropping any rows written after it, before new rows are appended. A
+// compressed output is written a member per checkpoint, so the output cut
+// back to one is still whole.
+func runCheckpointed(batch valact.Batch, policies iter.Seq2[valact.Policy, error], format string, out string, path string, every time.Duration, resume bool, progress time.Duration, timeout time.Duration) error {
+	if !resume {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	checkpoint, err := valact.OpenCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	var file *os.File
+	var writer valact.ResultSink[valact.BatchResult]
+	counter := &countingWriter{}
+	member := &memberWriter{dest: counter, name: out}
+	if err := member.end(); err != nil {
+		return err
+	}
+	if checkpoint.Offset > 0 {
+		policies = checkpoint.Remaining(policies)
+		if file, err = os.OpenFile(out, os.O_RDWR, 0); err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() < checkpoint.Offset {
+			return fmt.Errorf("batch: %s is shorter than at the last checkpoint in %s", out, path)
+		}
+		if err := file.Truncate(checkpoint.Offset); err != nil {
+			return err
+		}
+		if _, err := file.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		counter.w, counter.n = file, checkpoint.Offset
+		if writer, err = batchSink(member, format, file, checkpoint.Offset); err != nil {
+			return err
+		}
+	} else {
+		if file, err = os.Create(out); err != nil {
+			return err
+		}
+		defer file.Close()
+		counter.w = file
+		if writer, err = batchSink(member, format, nil, 0); err != nil {
+			return err
+		}
+	}
+
+	// the rows are on disk before the checkpoint records their policies
+	sync := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if err := member.end(); err != nil {
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		return checkpoint.Sync(counter.n)
+	}
+	last := time.Now()
+	emit := func(result valact.BatchResult) error {
+		if err := writer.Write(result); err != nil {
+			return err
+		}
+		if err := checkpoint.Record(result.Policy.ID); err != nil {
+			return err
+		}
+		if time.Since(last) < every {
+			return nil
+		}
+		last = time.Now()
+		return sync()
+	}
+	batch.Progress = progressReport(progress)
+	ctx, stop := runContext(timeout)
+	defer stop()
+	runErr := batch.RunSeq(ctx, policies, emit)
+	if err := sync(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("batch: %w", runErr)
+	}
+	return nil
+}
+
+// memberWriter writes an output compressed by its name's suffix as a
+// series of members, which gzip readers read as one stream.
+type memberWriter struct {
+	dest   io.Writer
+	name   string
+	member io.WriteCloser
+}
+
+func (m *memberWriter) Write(p []byte) (int, error) {
+	return m.member.Write(p)
+}
+
+// end ends the current member, writing it out, and starts the next.
+func (m *memberWriter) end() error {
+	if m.member != nil {
+		if err := m.member.Close(); err != nil {
+			return err
+		}
+	}
+	var err error
+	m.member, err = valact.Compress(nopCloser{m.dest}, m.name)
+	return err
+}
+
+// batchSink returns the sink writing batch results to w in the format.
+// Resumed output, read from resumed up to its size, already has its CSV
+// header or Parquet row groups.
+func batchSink(w io.Writer, format string, resumed io.ReaderAt, size int64) (valact.ResultSink[valact.BatchResult], error) {
+	switch {
+	case format == "jsonl":
+		return valact.NewBatchJSONWriter(w), nil
+	case format == "parquet" && resumed != nil:
+		return valact.ResumeBatchParquetWriter(w, resumed, size)
+	case format == "parquet":
+		return valact.NewBatchParquetWriter(w), nil
+	case resumed != nil:
+		return valact.ResumeBatchWriter(w), nil
+	default:
+		return valact.NewBatchWriter(w)
+	}
+}
+
+// writeSummary writes the batch summary to path, as JSON when it ends in
+// .json and CSV otherwise.
+func writeSummary(summary *valact.BatchSummary, path string) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".json") {
+		err = summary.WriteJSON(w)
+	} else {
+		err = summary.WriteCSV(w)
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"time"
+
+	"approach1/valact"
+)
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var p policyFlags
+	p.register(fs)
+	multiple := fs.Bool("multi", false, "spread runs over a pool of worker goroutines")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines with -multi")
+	runs := fs.Int("runs", 1000, "number of runs")
+	solve := fs.Bool("solve", false, "solve for premium instead of illustrating at -premium")
+	var solver solveFlags
+	solver.register(fs)
+	reload := fs.Bool("reload-rates", false, "re-read the rate tables on every run")
+	cached := fs.Bool("cache-rates", false, "serve the rate tables from an in-memory cache, so -reload-rates reads them once")
+	fs.Parse(args)
+	if *cached {
+		p.cache = valact.NewRateCache()
+	}
+
+	var seek *valact.GoalSeek
+	if *solve {
+		seek = &valact.GoalSeek{
+			Variable: valact.Variable{Kind: valact.VaryPremium},
+			Target:   valact.Target{Metric: valact.MetricMaturityValue},
+		}
+		var err error
+		if seek.SolveOptions, err = solver.options(); err != nil {
+			return err
+		}
+	}
+	if *multiple {
+		return multi(p, *workers, *runs, seek)
+	}
+	return single(p, *runs, seek, *reload)
+}
+
+// run performs one timed unit of work: a solve when seek is set, otherwise
+// an illustration.
+func run(policy valact.Policy, rates *valact.RateSet, seek *valact.GoalSeek) float64 {
+	if seek != nil {
+		premium, _ := seek.Solve(policy, rates)
+		return premium
+	}
+	return valact.Illustrate(policy, rates)
+}
+
+func single(p policyFlags, iter int, seek *valact.GoalSeek, reload bool) error {
+	policy := p.policy()
+	x := 0.0
+
+	fmt.Println("Starting...")
+	start := time.Now()
+	rates, err := p.rates()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < iter; i++ {
+		if reload {
+			rates, err = p.rates()
+			if err != nil {
+				return err
+			}
+		}
+		x = run(policy, rates, seek)
+	}
+	end := time.Now()
+	fmt.Println("Ending...")
+	elapsed := end.Sub(start)
+	fmt.Println("Result", x)
+	fmt.Println("Total time", elapsed)
+	fmt.Println("Runs", iter)
+	fmt.Println("Per iteration", float64(elapsed)/float64(iter))
+	return nil
+}
+
+// benchResult is the result of the run with the job number.
+type benchResult struct {
+	job    int
+	result float64
+}
+
+func worker(policy valact.Policy, rates *valact.RateSet, seek *valact.GoalSeek, jobs <-chan int, results chan<- benchResult) {
+	for job := range jobs {
+		results <- benchResult{job: job, result: run(policy, rates, seek)}
+	}
+}
+
+func multi(p policyFlags, numWorkers int, numJobs int, seek *valact.GoalSeek) error {
+	fmt.Println("Starting...")
+	start := time.Now()
+	policy := p.policy()
+	numWorkers = max(1, numWorkers)
+	jobs := make(chan int, numWorkers)
+	results := make(chan benchResult, numWorkers)
+
+	// the workers share one parse of the rate tables, each taking a copy
+	if p.cache == nil {
+		p.cache = valact.NewRateCache()
+	}
+	for i := 1; i <= numWorkers; i++ {
+		rates, err := p.rates()
+		if err != nil {
+			return err
+		}
+		go worker(policy, rates, seek, jobs, results)
+	}
+
+	go func() {
+		for i := 1; i <= numJobs; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	// report the last job's result, whichever worker finishes last
+	var result float64
+	for i := 1; i <= numJobs; i++ {
+		if r := <-results; r.job == numJobs {
+			result = r.result
+		}
+	}
+	end := time.Now()
+	fmt.Println("Ending...")
+	elapsed := end.Sub(start)
+	fmt.Println("Result", result)
+	fmt.Println("Total time", elapsed)
+	fmt.Println("Runs", numJobs)
+	fmt.Println("Per iteration", float64(elapsed)/float64(numJobs))
+	return nil
+}
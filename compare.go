@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"approach1/valact"
+)
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var p policyFlags
+	p.register(fs)
+	expected := fs.String("expected", "", "expected ledger CSV, e.g. exported from the administration system or written by a prior release, matched on Policy_Month (or Policy_Year without it)")
+	actual := fs.String("actual", "", "ledger CSV to compare (default the illustration of the policy flags)")
+	annual := fs.Bool("annual", false, "illustrate policy year totals instead of months, for an annual expected ledger")
+	var tolerance valact.CompareTolerance
+	fs.Float64Var(&tolerance.Absolute, "tolerance", 0.01, "absolute difference a cell may have from the expected value without being reported")
+	fs.Float64Var(&tolerance.Relative, "relative", 0, "difference a cell may have, as a proportion of the expected value, without being reported")
+	out := fs.String("out", "", "output file for the differing cells as CSV (default stdout); the summary goes to stderr")
+	fs.Parse(args)
+
+	if *expected == "" {
+		return fmt.Errorf("compare: -expected is required")
+	}
+	if tolerance.Absolute < 0 || tolerance.Relative < 0 {
+		return fmt.Errorf("compare: -tolerance and -relative must not be negative")
+	}
+	want, err := valact.OpenFile(*expected)
+	if err != nil {
+		return err
+	}
+	defer want.Close()
+	var got io.Reader
+	name := *actual
+	if *actual != "" {
+		file, err := valact.OpenFile(*actual)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		got = file
+	} else {
+		rates, err := p.rates()
+		if err != nil {
+			return err
+		}
+		policy := p.policy()
+		if err := p.applyGuideline(&policy, rates); err != nil {
+			return err
+		}
+		ledger := valact.IllustrateLedger(policy, rates)
+		if *annual {
+			ledger = ledger.Annual()
+		}
+		var buf bytes.Buffer
+		if err := valact.WriteLedgerCSV(&buf, ledger); err != nil {
+			return err
+		}
+		got, name = &buf, "illustration"
+	}
+
+	comparison, err := valact.CompareLedgerCSV(want, *expected, got, name, tolerance)
+	if err != nil {
+		return err
+	}
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := comparison.WriteDiffsCSV(w); err != nil {
+		return err
+	}
+	if err := comparison.WriteSummary(os.Stderr); err != nil {
+		return err
+	}
+	if comparison.Differs() {
+		return fmt.Errorf("compare: the ledger differs from %s", *expected)
+	}
+	return nil
+}
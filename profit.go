@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+
+	"approach1/valact"
+)
+
+func runProfit(args []string) error {
+	fs := flag.NewFlagSet("profit", flag.ExitOnError)
+	census := fs.String("census", "", "census CSV of the pricing cells as model points (see batch)")
+	mode := fs.String("mode", "illustrate", "premium priced per cell: illustrate (the census premium) solve (the minimum premium to maturity), or endow (the minimum premium to endow)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines")
+	ordered := fs.Bool("ordered", false, "write results in census order instead of as they complete")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for census Waiver riders: deduction or per-unit")
+	var basis valact.Experience
+	experience := registerExperience(fs, &basis)
+	hurdle := fs.Float64("hurdle-rate", 0.1, "annual effective hurdle rate the earnings are discounted at")
+	var commission valact.CommissionSchedule
+	fs.Float64Var(&commission.FirstYear, "fyc", 0.9, "first year commission rate on premium up to target")
+	fs.Float64Var(&commission.Renewal, "renewal-commission", 0.03, "renewal commission rate on premium up to target")
+	fs.IntVar(&commission.RenewalYears, "renewal-years", 9, "number of years after the first paying renewal commission")
+	fs.Float64Var(&commission.Excess, "excess-commission", 0.03, "commission rate on premium above target")
+	fs.IntVar(&commission.RollingYears, "rolling-years", 0, "years over which unpaid first year target rolls forward (0 for none)")
+	fs.IntVar(&commission.ChargebackMonths, "chargeback-months", 12, "months after issue in which a lapse charges back unearned first year commission")
+	var solver solveFlags
+	solver.register(fs)
+	solver.registerWarmStart(fs)
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "csv", "output format: csv or jsonl (JSON lines, with the earnings by policy year)")
+	progress := fs.Duration("progress", 0, "report progress (policies done, rate, ETA) on stderr at this interval, e.g. 10s (0 for none)")
+	timeout := fs.Duration("timeout", 0, "stop the run after this long, e.g. 30m, keeping the rows already written (0 for no limit)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" in the data directory (default the built-in product)")
+	var missing *valact.MissingRates
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var improve *valact.MortalityImprovement
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		improve, err = parseImprovement(s)
+		return err
+	})
+	fs.Parse(args)
+
+	if *census == "" {
+		return fmt.Errorf("profit: -census is required")
+	}
+	run := valact.ProfitTest{Source: valact.DefaultRateSource(), Workers: *workers, Ordered: *ordered, WaiverBasis: valact.WaiverBasis(*waiverBasis), Commission: commission, HurdleRate: *hurdle}
+	if *dataDir != "" {
+		run.Source.Dir = *dataDir
+	}
+	if *product != "" {
+		var err error
+		if run.Source, err = run.Source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	run.Source.Missing = missing
+	run.Source.Improvement = improve
+	run.Source.Store = store
+	run.Source.Defaults = defaultTables(*builtin)
+	var err error
+	if run.Source, err = asOf.apply(run.Source); err != nil {
+		return err
+	}
+	// model points sharing an insured share their rates
+	run.Source.Cache = valact.NewRateCache()
+	if !run.WaiverBasis.Valid() {
+		return fmt.Errorf("profit: unknown waiver basis %q", *waiverBasis)
+	}
+	switch *mode {
+	case "illustrate":
+		run.Mode = valact.BatchIllustrate
+	case "solve":
+		run.Mode = valact.BatchSolve
+	case "endow":
+		run.Mode = valact.BatchEndow
+	default:
+		return fmt.Errorf("profit: unknown mode %q", *mode)
+	}
+	if run.SolveOptions, err = solver.options(); err != nil {
+		return err
+	}
+	if run.Experience, err = experience(); err != nil {
+		return fmt.Errorf("profit: %w", err)
+	}
+
+	file, err := valact.OpenFile(*census)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	policies, err := valact.ReadCensus(file, *census)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	var writer valact.ResultSink[valact.ProfitResult]
+	switch *format {
+	case "csv":
+		if writer, err = valact.NewProfitWriter(w); err != nil {
+			return err
+		}
+	case "jsonl":
+		writer = valact.NewProfitJSONWriter(w)
+	default:
+		return fmt.Errorf("profit: unknown format %q", *format)
+	}
+	// an interrupt or the timeout stops the run; the finished rows are kept
+	run.Progress = progressReport(*progress)
+	ctx, stop := runContext(*timeout)
+	defer stop()
+	runErr := run.RunContext(ctx, policies, writer.Write)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("profit: %w", runErr)
+	}
+	return nil
+}
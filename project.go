@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+
+	"approach1/valact"
+)
+
+func runProject(args []string) error {
+	fs := flag.NewFlagSet("project", flag.ExitOnError)
+	census := fs.String("census", "", "census CSV of the block as model points (see batch)")
+	mode := fs.String("mode", "illustrate", "premium projected per policy: illustrate (the census premium) solve (the minimum premium to maturity), or endow (the minimum premium to endow)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines")
+	ordered := fs.Bool("ordered", false, "write results in census order instead of as they complete")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for census Waiver riders: deduction or per-unit")
+	var basis valact.Experience
+	experience := registerExperience(fs, &basis)
+	var solver solveFlags
+	solver.register(fs)
+	solver.registerWarmStart(fs)
+	var modelPoints *[]float64
+	fs.Func("model-points", modelPointsUsage, func(s string) error {
+		bands, err := valact.ParseFaceBands(s)
+		modelPoints = &bands
+		return err
+	})
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "csv", "output format: csv or jsonl (JSON lines), one row per projection year")
+	progress := fs.Duration("progress", 0, "report progress (policies done, rate, ETA) on stderr at this interval, e.g. 10s (0 for none)")
+	timeout := fs.Duration("timeout", 0, "stop the run after this long, e.g. 30m, keeping the rows already written (0 for no limit)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" in the data directory (default the built-in product)")
+	var missing *valact.MissingRates
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var improve *valact.MortalityImprovement
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		improve, err = parseImprovement(s)
+		return err
+	})
+	fs.Parse(args)
+
+	if *census == "" {
+		return fmt.Errorf("project: -census is required")
+	}
+	run := valact.Projection{Source: valact.DefaultRateSource(), Workers: *workers, Ordered: *ordered, WaiverBasis: valact.WaiverBasis(*waiverBasis)}
+	if *dataDir != "" {
+		run.Source.Dir = *dataDir
+	}
+	if *product != "" {
+		var err error
+		if run.Source, err = run.Source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	run.Source.Missing = missing
+	run.Source.Improvement = improve
+	run.Source.Store = store
+	run.Source.Defaults = defaultTables(*builtin)
+	var err error
+	if run.Source, err = asOf.apply(run.Source); err != nil {
+		return err
+	}
+	// model points sharing an insured share their rates
+	run.Source.Cache = valact.NewRateCache()
+	if !run.WaiverBasis.Valid() {
+		return fmt.Errorf("project: unknown waiver basis %q", *waiverBasis)
+	}
+	switch *mode {
+	case "illustrate":
+		run.Mode = valact.BatchIllustrate
+	case "solve":
+		run.Mode = valact.BatchSolve
+	case "endow":
+		run.Mode = valact.BatchEndow
+	default:
+		return fmt.Errorf("project: unknown mode %q", *mode)
+	}
+	if run.SolveOptions, err = solver.options(); err != nil {
+		return err
+	}
+	if run.Experience, err = experience(); err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+
+	file, err := valact.OpenFile(*census)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	policies, err := valact.ReadCensus(file, *census)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	var writer valact.ResultSink[valact.ProjectionYear]
+	switch *format {
+	case "csv":
+		if writer, err = valact.NewProjectionWriter(w); err != nil {
+			return err
+		}
+	case "jsonl":
+		writer = valact.NewProjectionJSONWriter(w)
+	default:
+		return fmt.Errorf("project: unknown format %q", *format)
+	}
+	// the totals are written once every policy is projected, so an
+	// interrupt or the timeout writes none
+	run.Progress = progressReport(*progress)
+	ctx, stop := runContext(*timeout)
+	defer stop()
+	var points *valact.ModelPoints
+	if modelPoints != nil {
+		points = valact.CompressCensus(policies, *modelPoints)
+		policies = points.Policies
+	}
+	var totals valact.ProjectionTotals
+	var failed error
+	if err := run.RunContext(ctx, policies, func(result valact.ProjectionResult) error {
+		if result.Err != nil && failed == nil {
+			failed = fmt.Errorf("%s: %w", result.Policy.ID, result.Err)
+		}
+		if points != nil {
+			totals.AddWeighted(result, points.Weight(result.Policy))
+		} else {
+			totals.Add(result)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+	for _, year := range totals.Years {
+		if err := writer.Write(year); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if failed != nil {
+		return fmt.Errorf("project: %d of %d policies left out, first %w", totals.Failed, totals.Policies, failed)
+	}
+	return nil
+}
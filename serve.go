@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"approach1/valact"
+)
+
+// maxRequestBody bounds the size of a request body, census included.
+const maxRequestBody = 64 << 20
+
+// adminTokenEnv is the environment variable the -admin-token flag defaults
+// to, keeping the token off the command line.
+const adminTokenEnv = "VALACT_ADMIN_TOKEN"
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines per batch")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for Waiver riders: deduction or per-unit")
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	jobTTL := fs.Duration("job-ttl", time.Hour, "how long a finished batch job is kept for its results to be fetched")
+	adminToken := fs.String("admin-token", os.Getenv(adminTokenEnv), "bearer token the /admin endpoints require (default $"+adminTokenEnv+"); without one they are not served, and SIGHUP reloads the rate tables")
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	fs.Parse(args)
+
+	s := &server{base: valact.DefaultRateSource(), asOf: asOf, workers: *workers, waiverBasis: valact.WaiverBasis(*waiverBasis), adminToken: *adminToken, jobTTL: *jobTTL, jobs: make(map[string]*batchJob)}
+	if !s.waiverBasis.Valid() {
+		return fmt.Errorf("serve: unknown waiver basis %q", *waiverBasis)
+	}
+	if *dataDir != "" {
+		s.base.Dir = *dataDir
+	}
+	s.base.Store = store
+	s.base.Defaults = defaultTables(*builtin)
+	source, err := asOf.apply(s.base)
+	if err != nil {
+		return err
+	}
+	// requests for the same insured share their rates
+	source.Cache = valact.NewRateCache()
+	s.source.Store(&source)
+
+	// an interrupt shuts the server down and cancels the running batches
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s.ctx = ctx
+	// a hangup reloads the rate tables
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				if err := s.reload(); err != nil {
+					log.Print(err)
+				} else {
+					log.Print("rate tables reloaded")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	srv := &http.Server{Addr: *addr, Handler: s.handler()}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	log.Printf("serving on %s", *addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
+
+// server serves illustrations, premium solves, and batches over HTTP:
+//
+//	POST   /illustrate           policy JSON -> result JSON
+//	POST   /solve                policy JSON -> result JSON at the solved premium
+//	POST   /batches              {"mode", "policies"} JSON or a census CSV -> job status
+//	GET    /batches/{id}         job status
+//	GET    /batches/{id}/results JSON lines of the results completed so far
+//	DELETE /batches/{id}         cancel a running job, or remove a finished one
+//	POST   /admin/reload         reload the rate tables, as on SIGHUP
+//
+// A finished job is removed once its results are fetched, or after the
+// job TTL. The /admin endpoints are served only with an admin token, and require it
+// as an "Authorization: Bearer" header. Errors are returned as
+// {"error": "..."}.
+type server struct {
+	ctx context.Context
+	// base is the source of the rate tables as configured, from which
+	// each reload starts
+	base valact.RateSource
+	asOf ratesAsOf
+	// source is the source requests read their rates from, with a cache
+	// of the tables swapped for a new one on each reload
+	source      atomic.Pointer[valact.RateSource]
+	reloading   sync.Mutex
+	workers     int
+	waiverBasis valact.WaiverBasis
+	adminToken  string
+	jobTTL      time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+// Job statuses.
+const (
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// batchJob is a batch submitted to the server, run in the background.
+type batchJob struct {
+	id     string
+	total  int
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	status  string
+	results []valact.BatchResult
+	err     error
+	// finished is when the job stopped running
+	finished time.Time
+}
+
+// jobStatus is the JSON status of a batch job.
+type jobStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchRequest is the JSON body of a batch submission; mode is illustrate
+// (the default), solve, or endow.
+type batchRequest struct {
+	Mode     string          `json:"mode"`
+	Policies []valact.Policy `json:"policies"`
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /illustrate", s.illustrate)
+	mux.HandleFunc("POST /solve", s.solve)
+	mux.HandleFunc("POST /batches", s.submit)
+	mux.HandleFunc("GET /batches/{id}", s.status)
+	mux.HandleFunc("GET /batches/{id}/results", s.results)
+	mux.HandleFunc("DELETE /batches/{id}", s.remove)
+	if s.adminToken != "" {
+		mux.HandleFunc("POST /admin/reload", s.admin(s.reloadTables))
+	}
+	return mux
+}
+
+// admin wraps the handler of an admin endpoint, refusing requests without
+// the admin token.
+func (s *server) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("admin token required"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// reload reads the rate tables afresh into a new cache, checking them as
+// validate does, and swaps it in for the requests that follow; requests
+// and batches in flight finish on the tables they started with. Tables
+// with problems are not swapped in, leaving the old ones serving.
+func (s *server) reload() error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	source, err := s.asOf.apply(s.base)
+	if err != nil {
+		return fmt.Errorf("rate tables not reloaded: %w", err)
+	}
+	source.Cache = valact.NewRateCache()
+	if problems := source.ValidateTables(); len(problems) > 0 {
+		texts := make([]string, len(problems))
+		for i, problem := range problems {
+			texts[i] = problem.String()
+		}
+		return fmt.Errorf("rate tables not reloaded, %d problems: %s", len(problems), strings.Join(texts, "; "))
+	}
+	s.source.Store(&source)
+	return nil
+}
+
+func (s *server) reloadTables(w http.ResponseWriter, r *http.Request) {
+	if err := s.reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	log.Print("rate tables reloaded")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+func (s *server) illustrate(w http.ResponseWriter, r *http.Request) {
+	policy, rates, ok := s.policyRates(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, valact.NewResult(policy, rates))
+}
+
+func (s *server) solve(w http.ResponseWriter, r *http.Request) {
+	policy, rates, ok := s.policyRates(w, r)
+	if !ok {
+		return
+	}
+	result, err := valact.NewSolveResult(policy, rates)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// policyRates reads the policy in the request body and loads its rates,
+// writing the error response when either fails.
+func (s *server) policyRates(w http.ResponseWriter, r *http.Request) (valact.Policy, *valact.RateSet, bool) {
+	var policy valact.Policy
+	if err := decodeJSON(w, r, &policy); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return policy, nil, false
+	}
+	if err := policy.Check(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return policy, nil, false
+	}
+	rates, err := s.source.Load().PolicyRates(policy, s.waiverBasis)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return policy, nil, false
+	}
+	return policy, rates, true
+}
+
+func (s *server) submit(w http.ResponseWriter, r *http.Request) {
+	var request batchRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		policies, err := valact.ReadCensus(http.MaxBytesReader(w, r.Body, maxRequestBody), "census")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		request = batchRequest{Mode: r.URL.Query().Get("mode"), Policies: policies}
+	} else if err := decodeJSON(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for i := range request.Policies {
+		if err := request.Policies[i].Check(); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("policy %d: %w", i+1, err))
+			return
+		}
+	}
+	batch := valact.Batch{Source: *s.source.Load(), Workers: s.workers, Ordered: true, WaiverBasis: s.waiverBasis}
+	switch request.Mode {
+	case "", "illustrate":
+		batch.Mode = valact.BatchIllustrate
+	case "solve":
+		batch.Mode = valact.BatchSolve
+	case "endow":
+		batch.Mode = valact.BatchEndow
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown mode %q", request.Mode))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &batchJob{id: rand.Text(), total: len(request.Policies), cancel: cancel, status: jobRunning}
+	s.mu.Lock()
+	s.evict(time.Now())
+	s.jobs[job.id] = job
+	s.mu.Unlock()
+	go func() {
+		defer cancel()
+		err := batch.RunContext(ctx, request.Policies, func(result valact.BatchResult) error {
+			job.mu.Lock()
+			job.results = append(job.results, result)
+			job.mu.Unlock()
+			return nil
+		})
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		job.finished = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			job.status = jobCanceled
+		case err != nil:
+			job.status, job.err = jobFailed, err
+		default:
+			job.status = jobDone
+		}
+	}()
+	w.Header().Set("Location", "/batches/"+job.id)
+	writeJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+// results writes the results completed so far, in census order. Once the
+// job has finished, and they are all written, the job is removed.
+func (s *server) results(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	job.mu.Lock()
+	results := job.results[:len(job.results):len(job.results)]
+	finished := job.status != jobRunning
+	job.mu.Unlock()
+	w.Header().Set("Content-Type", "application/jsonl")
+	writer := valact.NewBatchJSONWriter(w)
+	for _, result := range results {
+		if err := writer.Write(result); err != nil {
+			return
+		}
+	}
+	if err := writer.Flush(); err != nil || !finished {
+		return
+	}
+	s.mu.Lock()
+	delete(s.jobs, job.id)
+	s.mu.Unlock()
+}
+
+// evict removes the jobs finished longer ago than the job TTL. s.mu is
+// held.
+func (s *server) evict(now time.Time) {
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := job.status != jobRunning && now.Sub(job.finished) > s.jobTTL
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// remove cancels a running job, which stays listed as canceled, or
+// removes a finished one.
+func (s *server) remove(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	job.mu.Lock()
+	running := job.status == jobRunning
+	job.mu.Unlock()
+	if running {
+		job.cancel()
+	} else {
+		s.mu.Lock()
+		delete(s.jobs, job.id)
+		s.mu.Unlock()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// job looks up the job in the request path, writing a 404 when unknown.
+func (s *server) job(w http.ResponseWriter, r *http.Request) (*batchJob, bool) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown batch %q", r.PathValue("id")))
+	}
+	return job, ok
+}
+
+func (j *batchJob) snapshot() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := jobStatus{ID: j.id, Status: j.status, Done: len(j.results), Total: j.total}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
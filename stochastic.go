@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"approach1/valact"
+)
+
+func runStochastic(args []string) error {
+	fs := flag.NewFlagSet("stochastic", flag.ExitOnError)
+	census := fs.String("census", "", "census CSV of model points (see batch)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines")
+	ordered := fs.Bool("ordered", false, "write results in census order instead of as they complete")
+	generator := fs.String("generator", "lognormal", "scenario source: lognormal or file")
+	count := fs.Int("scenarios", 1000, "number of lognormal scenarios")
+	var lognormal valact.LognormalScenarios
+	fs.Float64Var(&lognormal.Initial, "initial-rate", 0.03, "initial annual crediting rate of the lognormal scenarios")
+	fs.Float64Var(&lognormal.Volatility, "volatility", 0.15, "annual volatility of the lognormal crediting rate")
+	fs.Float64Var(&lognormal.Floor, "floor", 0.02, "minimum crediting rate of the lognormal scenarios")
+	fs.Float64Var(&lognormal.Cap, "cap", 0.12, "maximum crediting rate of the lognormal scenarios (0 for none)")
+	fs.Uint64Var(&lognormal.Seed, "seed", 1, "random seed of the lognormal scenarios")
+	scenarioFile := fs.String("scenario-file", "", "CSV of scenarios (Scenario, Policy_Year or Policy_Month, Rate) with -generator file")
+	percentiles := fs.String("percentiles", "0.05,0.5,0.95", "comma separated percentile levels to report")
+	cte := fs.Float64("cte", 0.7, "CTE level, e.g. 0.7 for the mean of the worst 30%")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for census Waiver riders: deduction or per-unit")
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "csv", "output format: csv or jsonl (JSON lines)")
+	progress := fs.Duration("progress", 0, "report progress (policies done, rate, ETA) on stderr at this interval, e.g. 10s (0 for none)")
+	timeout := fs.Duration("timeout", 0, "stop the run after this long, e.g. 30m, keeping the rows already written (0 for no limit)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" in the data directory (default the built-in product)")
+	var missing *valact.MissingRates
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var improve *valact.MortalityImprovement
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		improve, err = parseImprovement(s)
+		return err
+	})
+	fs.Parse(args)
+
+	if *census == "" {
+		return fmt.Errorf("stochastic: -census is required")
+	}
+	run := valact.Stochastic{Source: valact.DefaultRateSource(), Workers: *workers, Ordered: *ordered, WaiverBasis: valact.WaiverBasis(*waiverBasis), CTELevel: *cte}
+	if *dataDir != "" {
+		run.Source.Dir = *dataDir
+	}
+	if *product != "" {
+		var err error
+		if run.Source, err = run.Source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	run.Source.Missing = missing
+	run.Source.Improvement = improve
+	run.Source.Store = store
+	run.Source.Defaults = defaultTables(*builtin)
+	var err error
+	if run.Source, err = asOf.apply(run.Source); err != nil {
+		return err
+	}
+	// model points sharing an insured share their rates
+	run.Source.Cache = valact.NewRateCache()
+	if !run.WaiverBasis.Valid() {
+		return fmt.Errorf("stochastic: unknown waiver basis %q", *waiverBasis)
+	}
+	if *cte < 0 || *cte >= 1 {
+		return fmt.Errorf("stochastic: invalid CTE level %v", *cte)
+	}
+	if run.Percentiles, err = parseLevels(*percentiles); err != nil {
+		return fmt.Errorf("stochastic: %w", err)
+	}
+	switch *generator {
+	case "lognormal":
+		// scenarios cover issue at age 0 through the product's maturity
+		lognormal.Years = run.Source.ProjectionEndAge()
+		run.Scenarios = lognormal.Generate(*count)
+	case "file":
+		if *scenarioFile == "" {
+			return fmt.Errorf("stochastic: -scenario-file is required with -generator file")
+		}
+		file, err := valact.OpenFile(*scenarioFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if run.Scenarios, err = valact.ReadScenarios(file, *scenarioFile); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("stochastic: unknown generator %q", *generator)
+	}
+
+	file, err := valact.OpenFile(*census)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	policies, err := valact.ReadCensus(file, *census)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	var writer valact.ResultSink[valact.StochasticResult]
+	switch *format {
+	case "csv":
+		if writer, err = valact.NewStochasticWriter(w, run.Percentiles, run.CTELevel); err != nil {
+			return err
+		}
+	case "jsonl":
+		writer = valact.NewStochasticJSONWriter(w)
+	default:
+		return fmt.Errorf("stochastic: unknown format %q", *format)
+	}
+	// an interrupt or the timeout stops the run; the finished rows are kept
+	run.Progress = progressReport(*progress)
+	ctx, stop := runContext(*timeout)
+	defer stop()
+	runErr := run.RunContext(ctx, policies, writer.Write)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("stochastic: %w", runErr)
+	}
+	return nil
+}
+
+// parseLevels parses comma separated percentile levels from 0 to 1.
+func parseLevels(spec string) ([]float64, error) {
+	var levels []float64
+	for _, text := range strings.Split(spec, ",") {
+		level, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || level < 0 || level > 1 {
+			return nil, fmt.Errorf("invalid percentile level %q", text)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"approach1/valact"
+)
+
+func runSupport(args []string) error {
+	fs := flag.NewFlagSet("support", flag.ExitOnError)
+	census := fs.String("census", "", "census CSV of the test cells as model points (see batch)")
+	mode := fs.String("mode", "illustrate", "premium tested per cell: illustrate (the census premium) solve (the minimum premium to maturity), or endow (the minimum premium to endow)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of worker goroutines")
+	ordered := fs.Bool("ordered", false, "write results in census order instead of as they complete")
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for census Waiver riders: deduction or per-unit")
+	var basis valact.SupportBasis
+	experience := registerExperience(fs, &basis.Experience)
+	fs.IntVar(&basis.FirstYear, "first-year", 15, "first test year, then every -interval years and the last year illustrated (15 or 20)")
+	fs.IntVar(&basis.Interval, "interval", 5, "years between test years")
+	var solver solveFlags
+	solver.register(fs)
+	solver.registerWarmStart(fs)
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "csv", "output format: csv or jsonl (JSON lines)")
+	progress := fs.Duration("progress", 0, "report progress (policies done, rate, ETA) on stderr at this interval, e.g. 10s (0 for none)")
+	timeout := fs.Duration("timeout", 0, "stop the run after this long, e.g. 30m, keeping the rows already written (0 for no limit)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" in the data directory (default the built-in product)")
+	var missing *valact.MissingRates
+	fs.Func("missing-rates", missingRatesUsage, func(s string) (err error) {
+		missing, err = valact.ParseMissingRates(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var improve *valact.MortalityImprovement
+	fs.Func("mortality-improvement", improvementUsage, func(s string) (err error) {
+		improve, err = parseImprovement(s)
+		return err
+	})
+	fs.Parse(args)
+
+	if *census == "" {
+		return fmt.Errorf("support: -census is required")
+	}
+	run := valact.SupportTests{Source: valact.DefaultRateSource(), Workers: *workers, Ordered: *ordered, WaiverBasis: valact.WaiverBasis(*waiverBasis), SupportBasis: basis}
+	if *dataDir != "" {
+		run.Source.Dir = *dataDir
+	}
+	if *product != "" {
+		var err error
+		if run.Source, err = run.Source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	run.Source.Missing = missing
+	run.Source.Improvement = improve
+	run.Source.Store = store
+	run.Source.Defaults = defaultTables(*builtin)
+	var err error
+	if run.Source, err = asOf.apply(run.Source); err != nil {
+		return err
+	}
+	// model points sharing an insured share their rates
+	run.Source.Cache = valact.NewRateCache()
+	if !run.WaiverBasis.Valid() {
+		return fmt.Errorf("support: unknown waiver basis %q", *waiverBasis)
+	}
+	switch *mode {
+	case "illustrate":
+		run.Mode = valact.BatchIllustrate
+	case "solve":
+		run.Mode = valact.BatchSolve
+	case "endow":
+		run.Mode = valact.BatchEndow
+	default:
+		return fmt.Errorf("support: unknown mode %q", *mode)
+	}
+	if run.SolveOptions, err = solver.options(); err != nil {
+		return err
+	}
+	if run.Experience, err = experience(); err != nil {
+		return fmt.Errorf("support: %w", err)
+	}
+	if basis.FirstYear < 1 || basis.Interval < 1 {
+		return fmt.Errorf("support: -first-year and -interval must be positive")
+	}
+
+	file, err := valact.OpenFile(*census)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	policies, err := valact.ReadCensus(file, *census)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	var writer valact.ResultSink[valact.SupportResult]
+	switch *format {
+	case "csv":
+		if writer, err = valact.NewSupportWriter(w); err != nil {
+			return err
+		}
+	case "jsonl":
+		writer = valact.NewSupportJSONWriter(w)
+	default:
+		return fmt.Errorf("support: unknown format %q", *format)
+	}
+	// an interrupt or the timeout stops the run; the finished rows are kept
+	run.Progress = progressReport(*progress)
+	ctx, stop := runContext(*timeout)
+	defer stop()
+	runErr := run.RunContext(ctx, policies, writer.Write)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("support: %w", runErr)
+	}
+	return nil
+}
+
+// registerExperience defines the flags of the experience assumptions on fs
+// and returns a function giving the experience once they are parsed.
+func registerExperience(fs *flag.FlagSet, experience *valact.Experience) func() (valact.Experience, error) {
+	fs.Float64Var(&experience.EarnedRate, "earned-rate", 0.045, "annual effective rate earned on the cash flows")
+	fs.Float64Var(&experience.Mortality, "mortality", 1, "experience mortality as a multiple of the current COI rates")
+	lapses := fs.String("lapse-rates", "0.1,0.08,0.06,0.05,0.04", "comma separated annual lapse rates by policy year, the last continuing to maturity")
+	fs.Float64Var(&experience.ExpensePerPolicy, "expense-per-policy", 75, "annual experience expense per policy")
+	fs.Float64Var(&experience.ExpensePerThousand, "expense-per-thousand", 0, "annual experience expense per $1,000 of face")
+	fs.Float64Var(&experience.ExpensePremium, "expense-premium", 0.05, "experience expense as a share of premium, including premium tax")
+	fs.Float64Var(&experience.IssueExpense, "issue-expense", 0, "acquisition expense per policy at issue")
+	fs.Float64Var(&experience.IssuePerThousand, "issue-per-thousand", 0, "acquisition expense per $1,000 of face at issue")
+	decrements := fs.String("decrements", "", "CSV of experience assumptions by Policy_Year, with Lapse_Rate and/or Mortality_Multiple columns replacing -lapse-rates and scaling -mortality")
+	return func() (valact.Experience, error) {
+		result := *experience
+		result.Lapses = nil
+		for _, text := range strings.Split(*lapses, ",") {
+			if text = strings.TrimSpace(text); text == "" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(text, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return result, fmt.Errorf("invalid lapse rate %q", text)
+			}
+			result.Lapses = append(result.Lapses, rate)
+		}
+		if result.Mortality <= 0 {
+			return result, fmt.Errorf("-mortality must be positive")
+		}
+		if *decrements != "" {
+			file, err := valact.OpenFile(*decrements)
+			if err != nil {
+				return result, err
+			}
+			defer file.Close()
+			if err := valact.ReadDecrements(file, *decrements, &result); err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+}
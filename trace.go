@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"approach1/valact"
+)
+
+// writeTrace writes the trace of the policy's illustration to path, as JSON
+// Lines when it ends in .jsonl and CSV otherwise. The sources of the rates
+// set by flags are the flags.
+func writeTrace(p *policyFlags, policy valact.Policy, rates *valact.RateSet, path string) error {
+	sources, err := p.source().TraceSources(policy)
+	if err != nil {
+		return err
+	}
+	basis := p.basis
+	if basis == "" {
+		basis = "annual"
+	}
+	if p.interest != 0 {
+		sources.Interest = fmt.Sprintf("-interest %g (%s)", p.interest, basis)
+	}
+	if p.minimum != nil {
+		sources.MinimumInterest = fmt.Sprintf("-minimum-interest %g (%s)", *p.minimum, basis)
+	}
+	if len(p.bonuses) > 0 {
+		sources.InterestBonus = "-interest-bonus"
+	}
+	if p.scenario != "" {
+		sources.InterestScenario += " " + p.scenario
+	}
+	_, entries := valact.TraceLedger(policy, rates, sources)
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".jsonl") {
+		err = valact.WriteTraceJSON(w, entries)
+	} else {
+		err = valact.WriteTraceCSV(w, entries)
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
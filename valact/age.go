@@ -0,0 +1,93 @@
+package valact
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateLayout is the layout of dates in census files and flags.
+const DateLayout = "2006-01-02"
+
+// AgeBasis is how an age is computed from a date of birth.
+type AgeBasis string
+
+const (
+	// AgeNearest is the age at the nearest birthday, rounding up from six
+	// months past the last birthday.
+	AgeNearest AgeBasis = "nearest"
+	// AgeLastBirthday is the age at the last birthday.
+	AgeLastBirthday AgeBasis = "last"
+)
+
+// Valid reports whether the basis is nearest, last, or empty (nearest).
+func (b AgeBasis) Valid() bool {
+	return b == "" || b == AgeNearest || b == AgeLastBirthday
+}
+
+// Age is the age on the date of someone born on birthDate.
+func (b AgeBasis) Age(birthDate time.Time, on time.Time) int {
+	years := on.Year() - birthDate.Year()
+	if birthDate.AddDate(years, 0, 0).After(on) {
+		years--
+	}
+	if b != AgeLastBirthday && !birthDate.AddDate(years, 6, 0).After(on) {
+		years++
+	}
+	return years
+}
+
+// ageChange is the date on which the age on the date was first reached.
+func (b AgeBasis) ageChange(birthDate time.Time, on time.Time) time.Time {
+	age := b.Age(birthDate, on)
+	if b == AgeLastBirthday {
+		return birthDate.AddDate(age, 0, 0)
+	}
+	// the nearest age steps up six months before each birthday
+	return birthDate.AddDate(age-1, 6, 0)
+}
+
+// stubFraction is the share of the issue month remaining from a mid-month
+// issue date, the stub period before monthly processing on the first of
+// each month; 0 without an issue date or for one on the first.
+func (p Policy) stubFraction() float64 {
+	if p.IssueDate.IsZero() || p.IssueDate.Day() == 1 {
+		return 0
+	}
+	days := time.Date(p.IssueDate.Year(), p.IssueDate.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return float64(days-p.IssueDate.Day()+1) / float64(days)
+}
+
+// SetIssueAge sets the issue age from the birth and issue dates on the
+// policy's age basis.
+func (p *Policy) SetIssueAge() error {
+	if p.BirthDate.IsZero() || p.IssueDate.IsZero() {
+		return fmt.Errorf("issue age: birth and issue dates are required")
+	}
+	if !p.AgeBasis.Valid() {
+		return fmt.Errorf("issue age: unknown age basis %q", p.AgeBasis)
+	}
+	if p.IssueDate.Before(p.BirthDate) {
+		return fmt.Errorf("issue age: issue date %s is before birth date %s", p.IssueDate.Format(DateLayout), p.BirthDate.Format(DateLayout))
+	}
+	p.IssueAge = p.AgeBasis.Age(p.BirthDate, p.IssueDate)
+	return nil
+}
+
+// BackdateToSaveAge moves the issue date back to the last day of the
+// insured's previous age, when that is no more than maxMonths before the
+// issue date, and sets the issue age from the dates. It reports whether
+// the policy was backdated.
+func (p *Policy) BackdateToSaveAge(maxMonths int) (bool, error) {
+	if err := p.SetIssueAge(); err != nil {
+		return false, err
+	}
+	if p.IssueAge == 0 {
+		return false, nil
+	}
+	saved := p.AgeBasis.ageChange(p.BirthDate, p.IssueDate).AddDate(0, 0, -1)
+	if saved.Before(p.IssueDate.AddDate(0, -maxMonths, 0)) || saved.Before(p.BirthDate) {
+		return false, nil
+	}
+	p.IssueDate = saved
+	return true, p.SetIssueAge()
+}
@@ -0,0 +1,60 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAgeNotInAnnuityTable is returned when the annuity factor table has no
+// row for the requested attained age.
+var ErrAgeNotInAnnuityTable = errors.New("attained age not found in annuity factor table")
+
+// GetAnnuityFactor reads the annuity factor for the attained age from the
+// annuity factor table, or ErrAgeNotInAnnuityTable when it has no row for
+// the age.
+func (s RateSource) GetAnnuityFactor(attainedAge int) (float64, error) {
+	path := s.path(s.AnnuityFactorsFile, AnnuityFactorsFile)
+	t, err := s.openTable(path, annuitySchema)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Close()
+	ageField, rateField := t.field("Attained_Age"), t.field("Rate")
+
+	for t.next() {
+		fileAge, err := t.int(ageField)
+		if err != nil {
+			return 0, err
+		}
+		if fileAge == attainedAge {
+			return t.float(rateField)
+		}
+	}
+	if err := t.err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s: %w: %d", path, ErrAgeNotInAnnuityTable, attainedAge)
+}
+
+// Annuitize converts the account value at maturity into a level annuity
+// payment. Annuity factors are the present value of 1 per year at the
+// attained age, so the periodic payment is the account value divided by
+// the factor and spread over paymentsPerYear. The factor is that of the
+// age the rates' projections end at, the extended maturity age when the
+// rates have one.
+func (s RateSource) Annuitize(rates *RateSet, maturityValue float64, paymentsPerYear int) (float64, error) {
+	factor, err := s.GetAnnuityFactor(rates.projectionEndAge())
+	if err != nil {
+		return 0, err
+	}
+	if maturityValue <= 0 || factor <= 0 || paymentsPerYear <= 0 {
+		return 0, nil
+	}
+	return maturityValue / factor / float64(paymentsPerYear), nil
+}
+
+// Annuitize converts the maturity value into a level annuity payment using
+// the DefaultRateSource annuity factors.
+func Annuitize(rates *RateSet, maturityValue float64, paymentsPerYear int) (float64, error) {
+	return DefaultRateSource().Annuitize(rates, maturityValue, paymentsPerYear)
+}
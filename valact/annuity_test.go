@@ -0,0 +1,25 @@
+package valact
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnnuitize(t *testing.T) {
+	source := RateSource{FS: TableFS{AnnuityFactorsFile: []byte("Attained_Age,Rate\n100,2\n110,1.25\n")}}
+	if _, err := source.GetAnnuityFactor(105); !errors.Is(err, ErrAgeNotInAnnuityTable) {
+		t.Errorf("factor at a missing age: %v, want ErrAgeNotInAnnuityTable", err)
+	}
+	rates := &RateSet{MaturityAge: 100}
+	if payment, err := source.Annuitize(rates, 1200, 12); err != nil || payment != 50 {
+		t.Errorf("payment at maturity %v, %v, want 50", payment, err)
+	}
+	rates.ExtendedMaturityAge = 110
+	if payment, err := source.Annuitize(rates, 1200, 12); err != nil || payment != 80 {
+		t.Errorf("payment at the extended maturity %v, %v, want 80", payment, err)
+	}
+	rates.ExtendedMaturityAge = 105
+	if _, err := source.Annuitize(rates, 1200, 12); !errors.Is(err, ErrAgeNotInAnnuityTable) {
+		t.Errorf("payment at an age without a factor: %v, want ErrAgeNotInAnnuityTable", err)
+	}
+}
@@ -0,0 +1,97 @@
+package valact
+
+// FaceBandColumn is the optional rate table column holding the smallest
+// face amount a row's rates apply to. Tables without it have a single band.
+const FaceBandColumn = "Min_Face"
+
+// RateBand is a rate vector by policy year for face amounts from MinFace up
+// to the next band.
+type RateBand struct {
+	MinFace float64
+	Rates   []float64
+}
+
+// bandRate returns the policy year's rate from the highest band whose
+// MinFace the face amount reaches, or from the lowest band below them all.
+func bandRate(bands []RateBand, faceAmount float64, policyYear int) float64 {
+	return bands[bandIndex(bands, faceAmount)].Rates[policyYear-1]
+}
+
+// bandIndex returns the index of the band whose rates apply to the face
+// amount, 0 without bands.
+func bandIndex(bands []RateBand, faceAmount float64) int {
+	band := 0
+	for i := 1; i < len(bands) && bands[i].MinFace <= faceAmount; i++ {
+		band = i
+	}
+	return band
+}
+
+// faceBands collects rows into bands kept in ascending MinFace order.
+type faceBands struct {
+	table *tableReader
+	// bandField is the FaceBandColumn, absent when the table is not banded
+	bandField field
+	years     int
+	bands     []RateBand
+	// selected marks policy years given by select rows, per band
+	selected [][]bool
+}
+
+// newFaceBands collects the bands of the table's rows, for rates over the
+// years.
+func newFaceBands(t *tableReader, years int) *faceBands {
+	return &faceBands{table: t, bandField: t.field(FaceBandColumn), years: years}
+}
+
+// band returns the index of the current row's band, adding it if new.
+func (b *faceBands) band() (int, error) {
+	minFace := 0.0
+	if b.table.has(b.bandField) {
+		var err error
+		if minFace, err = b.table.float(b.bandField); err != nil {
+			return 0, err
+		}
+	}
+	i := 0
+	for i < len(b.bands) && b.bands[i].MinFace < minFace {
+		i++
+	}
+	if i == len(b.bands) || b.bands[i].MinFace != minFace {
+		b.bands = append(b.bands[:i], append([]RateBand{{MinFace: minFace, Rates: make([]float64, b.years)}}, b.bands[i:]...)...)
+		b.selected = append(b.selected[:i], append([][]bool{make([]bool, b.years)}, b.selected[i:]...)...)
+	}
+	return i, nil
+}
+
+// result returns the bands, a single zero band when no rows matched.
+func (b *faceBands) result() []RateBand {
+	if len(b.bands) == 0 {
+		return []RateBand{{Rates: make([]float64, b.years)}}
+	}
+	return b.bands
+}
+
+// givenThrough returns the policy years through the last one every band
+// has a row for.
+func (b *faceBands) givenThrough() int {
+	through := b.years
+	for _, selected := range b.selected {
+		last := 0
+		for i, given := range selected {
+			if given {
+				last = i + 1
+			}
+		}
+		through = min(through, last)
+	}
+	return through
+}
+
+// banded returns bands for a RateSet: nil for a table with a single band.
+func banded(bands []RateBand) []RateBand {
+	if len(bands) < 2 {
+		return nil
+	}
+	return bands
+}
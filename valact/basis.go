@@ -0,0 +1,144 @@
+package valact
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// RateBasis is the compounding basis an interest rate is entered in.
+type RateBasis string
+
+const (
+	// BasisAnnual is an annual effective rate, the default.
+	BasisAnnual RateBasis = "annual"
+	// BasisMonthly is a monthly effective rate.
+	BasisMonthly RateBasis = "monthly"
+	// BasisNominal is an annual nominal rate convertible monthly, i(12):
+	// twelve times the monthly effective rate.
+	BasisNominal RateBasis = "nominal"
+	// BasisContinuous is an annual force of interest, compounded
+	// continuously.
+	BasisContinuous RateBasis = "continuous"
+)
+
+// rateBases are the names of the bases, for table schemas.
+var rateBases = []string{string(BasisAnnual), string(BasisMonthly), string(BasisNominal), string(BasisContinuous)}
+
+// Valid reports whether b is a known basis, or empty (annual).
+func (b RateBasis) Valid() bool {
+	switch b {
+	case "", BasisAnnual, BasisMonthly, BasisNominal, BasisContinuous:
+		return true
+	}
+	return false
+}
+
+// Monthly converts a rate on the basis to the monthly effective rate.
+func (b RateBasis) Monthly(rate float64) float64 {
+	switch b {
+	case BasisMonthly:
+		return rate
+	case BasisNominal:
+		return rate / 12
+	case BasisContinuous:
+		return math.Expm1(rate / 12)
+	}
+	return MonthlyRate(rate)
+}
+
+// Annual converts a rate on the basis to the annual effective rate.
+func (b RateBasis) Annual(rate float64) float64 {
+	switch b {
+	case BasisMonthly:
+		return AnnualRate(rate)
+	case BasisNominal:
+		return AnnualRate(rate / 12)
+	case BasisContinuous:
+		return math.Expm1(rate)
+	}
+	return rate
+}
+
+// discount converts a rate on the basis to the monthly discount factor.
+func (b RateBasis) discount(rate float64) float64 {
+	if b == "" || b == BasisAnnual {
+		return math.Pow(1+rate, -1/12.0)
+	}
+	return 1 / (1 + b.Monthly(rate))
+}
+
+// MonthlyRate converts an annual effective rate to the monthly effective
+// rate.
+func MonthlyRate(annual float64) float64 {
+	return math.Pow(1+annual, 1/12.0) - 1
+}
+
+// AnnualRate converts a monthly effective rate to the annual effective
+// rate.
+func AnnualRate(monthly float64) float64 {
+	return math.Pow(1+monthly, 12) - 1
+}
+
+// Names of the product's rates in RateBases.
+const (
+	RateInterest        = "interest"
+	RateMinimumInterest = "minimum_interest"
+	RateLoanInterest    = "loan_interest"
+	RateLoanCrediting   = "loan_crediting"
+	RateNAARDiscount    = "naar_discount"
+)
+
+// RateBases are the bases of a product's interest rates: Rates by name,
+// e.g. RateLoanInterest, and Default for the others.
+type RateBases struct {
+	Default RateBasis
+	Rates   map[string]RateBasis
+}
+
+// ParseRateBases parses comma separated bases, each a rate name and a
+// basis, or a basis for every other rate, e.g.
+// "annual,loan_interest=nominal".
+func ParseRateBases(spec string) (*RateBases, error) {
+	bases := &RateBases{Rates: make(map[string]RateBasis)}
+	names := []string{RateInterest, RateMinimumInterest, RateLoanInterest, RateLoanCrediting, RateNAARDiscount}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(item, "=")
+		if !ok {
+			name, text = "", item
+		}
+		basis := RateBasis(strings.TrimSpace(text))
+		if !basis.Valid() || basis == "" {
+			return nil, fmt.Errorf("rate basis %q: unknown basis %q (want %s)", item, basis, strings.Join(rateBases, ", "))
+		}
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			bases.Default = basis
+		case !slices.Contains(names, name):
+			return nil, fmt.Errorf("rate basis %q: unknown rate %q (want %s)", item, name, strings.Join(names, ", "))
+		default:
+			bases.Rates[name] = basis
+		}
+	}
+	return bases, nil
+}
+
+// basis returns the basis of the named rate; nil bases are annual.
+func (b *RateBases) basis(name string) RateBasis {
+	if b == nil {
+		return BasisAnnual
+	}
+	if basis, ok := b.Rates[name]; ok {
+		return basis
+	}
+	if b.Default != "" {
+		return b.Default
+	}
+	return BasisAnnual
+}
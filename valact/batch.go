@@ -0,0 +1,602 @@
+package valact
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BatchMode selects the calculation run for each policy in a batch.
+type BatchMode int
+
+const (
+	// BatchIllustrate projects each policy at its annual premium.
+	BatchIllustrate BatchMode = iota
+	// BatchSolve solves each policy for the minimum premium to maturity.
+	BatchSolve
+	// BatchEndow solves each policy for the minimum premium to endow at
+	// maturity.
+	BatchEndow
+)
+
+// target returns the target of the premium solve of the mode, false when
+// it does not solve.
+func (m BatchMode) target() (Target, bool) {
+	switch m {
+	case BatchSolve:
+		return Target{Metric: MetricMaturityValue}, true
+	case BatchEndow:
+		return Target{Metric: MetricEndowment}, true
+	}
+	return Target{}, false
+}
+
+// Batch runs many policies through a pool of worker goroutines.
+type Batch struct {
+	Source RateSource
+	Mode   BatchMode
+	// Workers is the number of worker goroutines; zero means one per CPU.
+	Workers int
+	// Ordered emits results in the order of the policies instead of as
+	// they complete.
+	Ordered bool
+	// Progress, when set, is called from the calling goroutine as each
+	// policy completes.
+	Progress func(Progress)
+	// WaiverBasis is the rate basis of waiver of premium riders in the
+	// census; empty means deduction.
+	WaiverBasis WaiverBasis
+	// Arithmetic, when set, replaces the money arithmetic of the product.
+	Arithmetic Arithmetic
+	// Rounding, when set, replaces the rounding rules of the product.
+	Rounding *RoundingRules
+	// Commission, when set, computes each policy's commissions at its
+	// annual (or solved) premium.
+	Commission *CommissionSchedule
+	// Targets are premium solves run for each policy besides the mode's,
+	// in one pass over the policy's rates; a mode solving for one of them
+	// uses its premium.
+	Targets []SolveTarget
+	// SolveOptions configure the premium solve of BatchSolve and BatchEndow,
+	// and of the Targets.
+	SolveOptions
+}
+
+// BatchResult is the outcome for one policy. Err is set, and the values are
+// zero, when the policy's rates could not be loaded or its premium could not
+// be solved.
+type BatchResult struct {
+	Policy        Policy
+	SolvedPremium float64
+	MaturityValue float64
+	// LapseMonth is the policy month of lapse, 0 if in force to maturity.
+	LapseMonth int
+	// TargetPremium is the policy's annual target premium, 0 without a
+	// target premium table.
+	TargetPremium float64
+	// Commissions are set when the batch has a commission schedule.
+	Commissions *Commissions
+	// Solves are set when the batch has solve targets.
+	Solves *PremiumSolves
+	Err    error
+}
+
+func (r BatchResult) withErr(err error) BatchResult {
+	r.Err = err
+	return r
+}
+
+// Run processes every policy and passes each result to emit, in completion
+// order (policy order when Ordered), from the calling goroutine. Run stops at
+// the first error returned by emit.
+func (b Batch) Run(policies []Policy, emit func(BatchResult) error) error {
+	return b.RunContext(context.Background(), policies, emit)
+}
+
+// RunContext is Run, stopping when the context is done: no more policies
+// are started, policies in progress are abandoned, and the results already
+// complete are still emitted before it returns the context's error.
+func (b Batch) RunContext(ctx context.Context, policies []Policy, emit func(BatchResult) error) error {
+	b.SolveOptions = b.SolveOptions.forRun()
+	return runPool(ctx, pool{workers: b.Workers, ordered: b.Ordered, progress: b.Progress}, policies, b.runPolicy, emit)
+}
+
+// RunSeq is RunContext on policies read as the pool takes them, such as
+// the rows of a CensusReader, so no more than a few per worker are held at
+// once. The first error of the sequence stops the run like the end of the
+// context, and is returned once the results already complete are emitted.
+// The Total of the Progress is 0, as it is not known in advance.
+func (b Batch) RunSeq(ctx context.Context, policies iter.Seq2[Policy, error], emit func(BatchResult) error) error {
+	b.SolveOptions = b.SolveOptions.forRun()
+	return runPoolSeq(ctx, pool{workers: b.Workers, ordered: b.Ordered, progress: b.Progress}, policies, b.runPolicy, emit)
+}
+
+// queuePerWorker bounds the jobs and results waiting in a worker pool, per
+// worker, so a slow emit holds back the workers instead of buffering every
+// result.
+const queuePerWorker = 4
+
+// pool configures runPool: the number of workers (one per CPU when not
+// positive), whether results are emitted in the order of the policies, the
+// progress callback, and the number of policies reported to it, 0 when not
+// known.
+type pool struct {
+	workers  int
+	ordered  bool
+	progress func(Progress)
+	total    int
+}
+
+// poolJob is a policy queued in a worker pool with its index among the
+// policies, and poolResult the work result of the job with that index; err
+// is set when the work was abandoned because the context ended.
+type poolJob struct {
+	index  int
+	policy Policy
+}
+
+// poolValue is a result of pool work, which can carry the error of a policy
+// whose work failed.
+type poolValue[T any] interface {
+	withErr(err error) T
+}
+
+type poolResult[T any] struct {
+	index int
+	value T
+	err   error
+}
+
+// runPool runs work on every policy over a pool of worker goroutines and
+// passes each result to emit from the calling goroutine, in completion
+// order or, when ordered, in the order of the policies, reporting progress
+// as each completes. Jobs are fed to the pool as it takes them, and no more
+// than a few per worker are outstanding, counting results held back for
+// ordering. It stops emitting at the first error returned by emit. Work
+// that fails with an error other than the context's is emitted with it set
+// on its result, so the policy is reported rather than dropped.
+//
+// When the context ends, no more jobs are fed, queued jobs are skipped, and
+// work returns the context's error for jobs it abandons. The pool drains,
+// emits the results that completed (in index order past any gaps, when
+// ordered), and returns the context's error.
+func runPool[T poolValue[T]](ctx context.Context, p pool, policies []Policy, work func(context.Context, Policy) (T, error), emit func(T) error) error {
+	p.total = len(policies)
+	return runPoolSeq(ctx, p, func(yield func(Policy, error) bool) {
+		for _, policy := range policies {
+			if !yield(policy, nil) {
+				return
+			}
+		}
+	}, work, emit)
+}
+
+// runPoolSeq implements runPool over policies read one at a time as jobs
+// are fed. An error reading them stops the feeding as the end of the
+// context does, and is returned after the pool drains, unless emit failed.
+func runPoolSeq[T poolValue[T]](ctx context.Context, p pool, policies iter.Seq2[Policy, error], work func(context.Context, Policy) (T, error), emit func(T) error) error {
+	workers, ordered := p.workers, p.ordered
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan poolJob, queuePerWorker*workers)
+	results := make(chan poolResult[T], queuePerWorker*workers)
+	// a slot is taken for each job fed and freed when its result is emitted
+	slots := make(chan struct{}, 2*queuePerWorker*workers)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := poolResult[T]{index: job.index, err: ctx.Err()}
+				if result.err == nil {
+					result.value, result.err = work(ctx, job.policy)
+				}
+				if result.err != nil && !errors.Is(result.err, ctx.Err()) {
+					result.value, result.err = result.value.withErr(result.err), nil
+				}
+				results <- result
+			}
+		}()
+	}
+	// readErr is set by the feeder before it closes jobs, and so before
+	// results are closed
+	var readErr error
+	go func() {
+		defer close(jobs)
+		i := 0
+		for policy, err := range policies {
+			if err != nil {
+				readErr = err
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			jobs <- poolJob{index: i, policy: policy}
+			i++
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var emitErr error
+	pass := func(value T) {
+		if emitErr == nil {
+			emitErr = emit(value)
+		}
+		<-slots
+	}
+	// results received ahead of the next index to emit, when ordered
+	pending := make(map[int]T)
+	next := 0
+	start := time.Now()
+	done := 0
+	for result := range results {
+		if result.err != nil {
+			<-slots
+			continue
+		}
+		done++
+		if p.progress != nil {
+			p.progress(Progress{Done: done, Total: p.total, Elapsed: time.Since(start)})
+		}
+		if !ordered {
+			pass(result.value)
+			continue
+		}
+		pending[result.index] = result.value
+		for value, ok := pending[next]; ok; value, ok = pending[next] {
+			delete(pending, next)
+			next++
+			pass(value)
+		}
+	}
+	// after a cancellation, the results left behind gaps
+	for _, index := range slices.Sorted(maps.Keys(pending)) {
+		pass(pending[index])
+	}
+	if emitErr != nil {
+		return emitErr
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return ctx.Err()
+}
+
+func (b Batch) runPolicy(ctx context.Context, policy Policy) (BatchResult, error) {
+	result := BatchResult{Policy: policy}
+	rates, err := b.Source.PolicyRates(policy, b.WaiverBasis)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	if b.Arithmetic != "" {
+		rates.Arithmetic = b.Arithmetic
+	}
+	if b.Rounding != nil {
+		rates.Rounding = b.Rounding
+	}
+	if len(b.Targets) > 0 {
+		if result.Solves, err = b.solveTargets(ctx, policy, rates); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			result.Err = err
+			return result, nil
+		}
+	}
+	if target, ok := b.Mode.target(); ok {
+		if premium, solved := result.Solves.premium(b.Mode); solved {
+			result.SolvedPremium = premium
+		} else if result.SolvedPremium, _, err = solvePremium(ctx, policy, rates, target, b.SolveOptions, 0); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			result.Err = err
+			return result, nil
+		}
+		policy.AnnualPremium = result.SolvedPremium
+	}
+	outcome := IllustrateOutcome(policy, rates)
+	result.MaturityValue = outcome.Value
+	result.LapseMonth = outcome.LapseMonth
+	result.TargetPremium = rates.TargetPremium[0]
+	if b.Commission != nil {
+		ledger := getLedger()
+		project(policy, rates, ledger)
+		commissions := b.Commission.Commissions(*ledger, result.TargetPremium)
+		putLedger(ledger)
+		result.Commissions = &commissions
+	}
+	return result, nil
+}
+
+// PolicyRates loads the rates for the policy's insured, or for both lives
+// of a survivorship policy, and the rates of the riders it carries, with
+// waiver of premium rates on waiverBasis, and applies the variations of its
+// state of issue. The target premium is set from the target premium table
+// when it has the issue age. The shadow rates and valuation basis are
+// loaded as the source's NoLapseGuarantee and Reserves say. With
+// VersionsAtIssue, the tables are the versions in effect at the policy's
+// issue date. The rates must run to the maturity age (see CheckMaturity).
+func (s RateSource) PolicyRates(policy Policy, waiverBasis WaiverBasis) (*RateSet, error) {
+	if s.VersionsAtIssue && !policy.IssueDate.IsZero() {
+		var err error
+		if s, err = s.AtDate(policy.IssueDate); err != nil {
+			return nil, err
+		}
+	}
+	if !s.Reserves.Valid() {
+		return nil, fmt.Errorf("unknown reserve method %q", s.Reserves)
+	}
+	var rates *RateSet
+	var err error
+	if policy.Second != nil {
+		method := s.Joint
+		if method == "" {
+			method = JointFrasier
+		}
+		rates, err = s.GetSurvivorshipRates(policy, method)
+	} else {
+		rates, err = s.GetRates(policy.Gender, policy.RiskClass, policy.IssueAge)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.NoLapseGuarantee {
+		if rates.Shadow, err = s.GetShadowRates(policy.Gender, policy.RiskClass, policy.IssueAge); err != nil {
+			return nil, err
+		}
+	}
+	// loaded before the improvement, which may be of the valuation
+	// mortality
+	if s.Reserves != "" {
+		if rates.Valuation, err = s.GetValuationBasis(policy.Gender, policy.RiskClass, policy.IssueAge); err != nil {
+			return nil, err
+		}
+		rates.Valuation.Method = s.Reserves
+	}
+	if err := s.ImproveRates(rates, policy.IssueAge, policy.IssueDate); err != nil {
+		return nil, err
+	}
+	target, err := s.targetPremiumRate(policy.IssueAge)
+	if err != nil {
+		return nil, err
+	}
+	rates.setPolicyTarget(policy, target)
+	if policy.State != "" {
+		variation, err := s.GetStateVariation(policy.State)
+		if err != nil {
+			return nil, err
+		}
+		variation.Apply(rates)
+	}
+	if policy.TermRider != nil {
+		if rates.TermRider, err = s.GetTermRiderRates(policy.Gender, policy.RiskClass, policy.IssueAge); err != nil {
+			return nil, err
+		}
+	}
+	if policy.Waiver != nil {
+		if rates.Waiver, err = s.GetWaiverRates(policy.IssueAge, waiverBasis); err != nil {
+			return nil, err
+		}
+	}
+	if policy.ADB != nil {
+		if rates.ADB, err = s.GetADBRates(policy.IssueAge); err != nil {
+			return nil, err
+		}
+	}
+	if policy.Chronic != nil {
+		if rates.Chronic, err = s.GetChronicRates(policy.IssueAge); err != nil {
+			return nil, err
+		}
+	}
+	if err := rates.CheckMaturity(policy.IssueAge); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// targetPremiumRate is the target premium table's rate for the issue age,
+// 0 (no target premium) without the table or a row for the age.
+func (s RateSource) targetPremiumRate(issueAge int) (float64, error) {
+	target, err := s.GetTargetPremiumRate(issueAge)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrIssueAgeNotInTarget) {
+		return 0, nil
+	}
+	return target, err
+}
+
+// setPolicyTarget sets the target premium of the policy: its own, or else
+// that of the table's rate for its face amount.
+func (r *RateSet) setPolicyTarget(policy Policy, rate float64) {
+	if policy.TargetPremium != 0 {
+		r.TargetPremium = CreateVector(policy.TargetPremium, len(r.TargetPremium))
+		return
+	}
+	r.SetTargetPremium(rate, policy.FaceAmount)
+}
+
+// insuredKey is what PolicyRates reads of a policy besides its face
+// amount: cells of a grid with the same key share their rates.
+type insuredKey struct {
+	gender, riskClass               string
+	issueAge                        int
+	second                          Life
+	issueDate                       time.Time
+	state                           string
+	termRider, waiver, adb, chronic bool
+}
+
+// IllustrateMany projects the cells of a pricing grid, which differ in
+// premium, face amount, or other policy terms, and returns their outcomes
+// in order. The rates are loaded once for the cells sharing an insured
+// (gender, risk class, and issue age, with the same second life, state,
+// riders, and issue date) and every cell is projected against them, with the target
+// premium of its own face amount, without ledgers.
+func (s RateSource) IllustrateMany(policies []Policy) ([]Outcome, error) {
+	type insured struct {
+		rates  *RateSet
+		target float64
+	}
+	loaded := make(map[insuredKey]insured)
+	outcomes := make([]Outcome, len(policies))
+	for i, policy := range policies {
+		key := insuredKey{
+			gender: policy.Gender, riskClass: policy.RiskClass, issueAge: policy.IssueAge,
+			issueDate: policy.IssueDate, state: policy.State,
+			termRider: policy.TermRider != nil, waiver: policy.Waiver != nil, adb: policy.ADB != nil, chronic: policy.Chronic != nil,
+		}
+		if policy.Second != nil {
+			key.second = *policy.Second
+		}
+		cell, ok := loaded[key]
+		if !ok {
+			rates, err := s.PolicyRates(policy, "")
+			if err != nil {
+				return nil, fmt.Errorf("cell %d: %w", i+1, err)
+			}
+			target, err := s.targetPremiumRate(policy.IssueAge)
+			if err != nil {
+				return nil, fmt.Errorf("cell %d: %w", i+1, err)
+			}
+			cell = insured{rates, target}
+			loaded[key] = cell
+		}
+		// the cell's own target premium on the shared rates
+		rates := *cell.rates
+		rates.setPolicyTarget(policy, cell.target)
+		outcomes[i] = project(policy, &rates, nil)
+	}
+	return outcomes, nil
+}
+
+// BatchColumns is the column layout written by BatchWriter.
+var BatchColumns = []string{
+	"Policy_ID",
+	"Issue_Age",
+	"Gender",
+	"Risk_Class",
+	"Face_Amount",
+	"Annual_Premium",
+	"Solved_Premium",
+	"Maturity_Value",
+	"Lapse_Year",
+	"Lapse_Month",
+	"Target_Premium",
+	"First_Year_Commission",
+	"Renewal_Commission",
+	"Excess_Commission",
+	"Commission_Chargeback",
+	"Total_Commission",
+	"Minimum_Premium",
+	"Endow_Premium",
+	"Max_Non_MEC_Premium",
+	"Error",
+}
+
+// BatchWriter writes batch results as CSV, one row per policy.
+type BatchWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+// NewBatchWriter writes the BatchColumns header to w and returns a writer
+// for the result rows.
+func NewBatchWriter(w io.Writer) (*BatchWriter, error) {
+	writer := ResumeBatchWriter(w)
+	if err := writer.writer.Write(BatchColumns); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// ResumeBatchWriter returns a writer for result rows appended to output that
+// already has the header, as when resuming from a Checkpoint.
+func ResumeBatchWriter(w io.Writer) *BatchWriter {
+	writer := csv.NewWriter(bufio.NewWriterSize(w, sinkBufferSize))
+	return &BatchWriter{writer: writer, record: make([]string, len(BatchColumns))}
+}
+
+// Write writes one result row. Solved_Premium is left blank for
+// illustrations, the commissions without a commission schedule, the solve
+// targets not requested or without a solution, and the values for failed
+// policies.
+func (w *BatchWriter) Write(result BatchResult) error {
+	policy := result.Policy
+	record := append(w.record[:0],
+		policy.ID,
+		strconv.Itoa(policy.IssueAge),
+		policy.Gender,
+		policy.RiskClass,
+		formatFloat(policy.FaceAmount),
+		formatFloat(policy.AnnualPremium),
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+	)
+	switch {
+	case result.Err != nil:
+		record[19] = result.Err.Error()
+		return w.writer.Write(record)
+	case result.SolvedPremium != 0:
+		record[6] = formatFloat(result.SolvedPremium)
+	}
+	record[7] = formatFloat(result.MaturityValue)
+	if outcome := (Outcome{LapseMonth: result.LapseMonth}); outcome.Lapsed() {
+		record[8] = strconv.Itoa(outcome.LapseYear())
+		record[9] = strconv.Itoa(outcome.LapseMonth)
+	}
+	record[10] = formatFloat(result.TargetPremium)
+	if c := result.Commissions; c != nil {
+		record[11] = formatFloat(c.FirstYear)
+		record[12] = formatFloat(c.Renewal)
+		record[13] = formatFloat(c.Excess)
+		record[14] = formatFloat(c.Chargeback)
+		record[15] = formatFloat(c.Total)
+	}
+	if s := result.Solves; s != nil {
+		for i, premium := range []*float64{s.Minimum, s.Endow, s.MaxNonMEC} {
+			if premium != nil {
+				record[16+i] = formatFloat(*premium)
+			}
+		}
+	}
+	return w.writer.Write(record)
+}
+
+// Flush writes any buffered rows and reports write errors.
+func (w *BatchWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
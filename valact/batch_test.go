@@ -0,0 +1,177 @@
+package valact
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingFS counts the opens of each file of a file system.
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+	return c.FS.Open(name)
+}
+
+func TestIllustrateManySharesRates(t *testing.T) {
+	counting := &countingFS{FS: sampleTables, opens: make(map[string]int)}
+	source := RateSource{FS: counting, Dir: "testdata/tables"}
+	if _, err := source.PolicyRates(Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000}, ""); err != nil {
+		t.Fatal(err)
+	}
+	perLoad := counting.opens["testdata/tables/coi.csv"]
+	clear(counting.opens)
+	var cells []Policy
+	for _, face := range []float64{50000, 100000, 250000} {
+		for _, premium := range []float64{800, 1255.03, 3000} {
+			cells = append(cells, Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: face, AnnualPremium: premium})
+		}
+	}
+	cells = append(cells, Policy{IssueAge: 45, Gender: "F", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 2000})
+	outcomes, err := source.IllustrateMany(cells)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one load for each of the two insureds
+	if opens := counting.opens["testdata/tables/coi.csv"]; opens != 2*perLoad {
+		t.Errorf("coi.csv opened %d times for %d cells of two insureds, want %d", opens, len(cells), 2*perLoad)
+	}
+	for i, cell := range cells {
+		rates := sampleRates(t, cell)
+		if want := IllustrateOutcome(cell, rates); outcomes[i] != want {
+			t.Errorf("cell %d outcome %+v, want %+v as illustrated alone", i+1, outcomes[i], want)
+		}
+	}
+}
+
+// TestPolicyRatesWithoutTargetRow checks that an issue age the target
+// premium table lacks, 85 on tables covering issue to 80, has no target
+// premium rather than failing.
+func TestPolicyRatesWithoutTargetRow(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	policy := Policy{IssueAge: 85, Gender: "M", RiskClass: "NS", FaceAmount: 100000}
+	if _, err := source.GetTargetPremiumRate(policy.IssueAge); !errors.Is(err, ErrIssueAgeNotInTarget) {
+		t.Fatalf("target premium table error %v, want %v", err, ErrIssueAgeNotInTarget)
+	}
+	rates, err := source.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for year, target := range rates.TargetPremium {
+		if target != 0 {
+			t.Fatalf("year %d target premium %v, want none", year+1, target)
+		}
+	}
+	if premium, err := Solve(policy, rates); err != nil || premium <= 0 {
+		t.Errorf("solved premium %v, %v at age 85, want a positive one", premium, err)
+	}
+	sources, err := source.TraceSources(policy)
+	if err != nil || sources.TargetPremium != "" {
+		t.Errorf("trace target premium source %q, %v, want none", sources.TargetPremium, err)
+	}
+}
+
+// TestPolicyRatesSurvivorship checks that the rates of a survivorship
+// policy are the joint rates of its lives, and that the source's
+// NoLapseGuarantee loads the shadow rates with them.
+func TestPolicyRatesSurvivorship(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables", NoLapseGuarantee: true}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000,
+		Second: &Life{IssueAge: 35, Gender: "F", RiskClass: "NS"}}
+	rates, err := source.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joint, err := source.GetSurvivorshipRates(policy, JointFrasier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.Survivorship != JointFrasier || !slices.Equal(rates.COI, joint.COI) {
+		t.Errorf("%q COI %v, want the Frasier joint rates %v", rates.Survivorship, rates.COI[:3], joint.COI[:3])
+	}
+	if rates.Shadow == nil {
+		t.Error("no shadow rates with NoLapseGuarantee")
+	}
+}
+
+// TestRunPoolEmitsWorkErrors checks that a policy whose work fails is
+// emitted in its place with the error, not dropped.
+func TestRunPoolEmitsWorkErrors(t *testing.T) {
+	policies := []Policy{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	failed := errors.New("failed")
+	work := func(ctx context.Context, policy Policy) (BatchResult, error) {
+		if policy.ID == "2" {
+			return BatchResult{Policy: policy}, failed
+		}
+		return BatchResult{Policy: policy}, nil
+	}
+	var emitted []BatchResult
+	emit := func(result BatchResult) error {
+		emitted = append(emitted, result)
+		return nil
+	}
+	if err := runPool(context.Background(), pool{workers: 2, ordered: true}, policies, work, emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != len(policies) {
+		t.Fatalf("emitted %d results, want %d", len(emitted), len(policies))
+	}
+	for i, result := range emitted {
+		want := error(nil)
+		if i == 1 {
+			want = failed
+		}
+		if result.Policy.ID != policies[i].ID || result.Err != want {
+			t.Errorf("result %d is policy %q with error %v, want %q with %v", i, result.Policy.ID, result.Err, policies[i].ID, want)
+		}
+	}
+}
+
+// TestRunPoolSeqStreams checks that a run reads its policies as the pool
+// takes them, not all before it starts, and returns the error reading them
+// after emitting the results before it.
+func TestRunPoolSeqStreams(t *testing.T) {
+	const workers, count = 2, 1000
+	failed := errors.New("bad row")
+	var read atomic.Int64
+	policies := func(yield func(Policy, error) bool) {
+		for i := range count {
+			read.Add(1)
+			if !yield(Policy{ID: strconv.Itoa(i)}, nil) {
+				return
+			}
+		}
+		yield(Policy{}, failed)
+	}
+	work := func(ctx context.Context, policy Policy) (BatchResult, error) {
+		return BatchResult{Policy: policy}, nil
+	}
+	emitted := 0
+	emit := func(result BatchResult) error {
+		// the feeder is held back by the results not yet emitted
+		if ahead := int(read.Load()) - emitted; ahead > 2*queuePerWorker*workers+1 {
+			t.Fatalf("%d policies read ahead of the %d emitted", ahead, emitted)
+		}
+		emitted++
+		return nil
+	}
+	err := runPoolSeq(context.Background(), pool{workers: workers, ordered: true}, policies, work, emit)
+	if !errors.Is(err, failed) {
+		t.Errorf("error %v, want the read error", err)
+	}
+	if emitted != count {
+		t.Errorf("emitted %d results, want the %d read before the error", emitted, count)
+	}
+}
@@ -0,0 +1,238 @@
+package valact
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Bucket names used in a deduction order besides fund names.
+const (
+	FixedBucket   = "fixed"
+	IndexedBucket = "indexed"
+)
+
+// Fund is a variable (VUL) subaccount.
+type Fund struct {
+	Name string
+	// Return is the annual gross return and Fee the annual fund fee
+	// deducted from the fund's value, e.g. 0.06 and 0.008.
+	Return float64
+	Fee    float64
+	// Allocation is the share of net premium invested in the fund.
+	Allocation float64
+}
+
+// monthlyReturn is the fund's monthly return net of the fund fee.
+func (f Fund) monthlyReturn() float64 {
+	return math.Pow(1+f.Return, 1/12.0)*(1-f.Fee/12) - 1
+}
+
+// ReadFunds reads fund assumptions from a CSV with the columns Fund, Return,
+// Fee, and Allocation (annual rates and a share of net premium, e.g.
+// Equity,0.07,0.009,0.6). name is used in error messages.
+func ReadFunds(r io.Reader, name string) ([]Fund, error) {
+	t, err := newTableReader(r, name, fundSchema)
+	if err != nil {
+		return nil, err
+	}
+	nameField, returnField, feeField, allocationField := t.field("Fund"), t.field("Return"), t.field("Fee"), t.field("Allocation")
+
+	var funds []Fund
+	for t.next() {
+		fund := Fund{Name: t.raw(nameField)}
+		if fund.Name == FixedBucket || fund.Name == IndexedBucket {
+			return nil, t.fieldError(nameField, errInvalidOption)
+		}
+		if fund.Return, err = t.float(returnField); err != nil {
+			return nil, err
+		}
+		if fund.Fee, err = t.float(feeField); err != nil {
+			return nil, err
+		}
+		if fund.Allocation, err = t.float(allocationField); err != nil {
+			return nil, err
+		}
+		funds = append(funds, fund)
+	}
+	return funds, t.err()
+}
+
+// CheckAllocations reports an error unless the indexed and fund allocations
+// are non-negative and total at most 1 (the rest goes to the fixed account)
+// and every bucket in the deduction order exists.
+func (r *RateSet) CheckAllocations() error {
+	total := 0.0
+	buckets := map[string]bool{FixedBucket: true}
+	if r.Indexed != nil {
+		total += r.Indexed.Allocation
+		buckets[IndexedBucket] = true
+		if r.Indexed.Allocation < 0 {
+			return fmt.Errorf("negative indexed allocation %v", r.Indexed.Allocation)
+		}
+	}
+	for _, fund := range r.Funds {
+		if fund.Allocation < 0 {
+			return fmt.Errorf("fund %s: negative allocation %v", fund.Name, fund.Allocation)
+		}
+		total += fund.Allocation
+		buckets[fund.Name] = true
+	}
+	if total > 1+1e-9 {
+		return fmt.Errorf("premium allocations total %.4g, more than 100%%", total)
+	}
+	for _, name := range r.DeductionOrder {
+		if !buckets[name] {
+			return fmt.Errorf("deduction order: unknown bucket %q", name)
+		}
+	}
+	return nil
+}
+
+// accounts are the account value buckets besides the fixed account, which
+// holds the rest of the account value.
+type accounts struct {
+	indexed *indexedAccount
+	funds   []Fund
+	values  []float64
+	order   []string
+}
+
+// newAccounts returns the buckets of the rates, nil when everything is in
+// the fixed account.
+func newAccounts(rates *RateSet) *accounts {
+	if rates.Indexed == nil && len(rates.Funds) == 0 {
+		return nil
+	}
+	a := &accounts{funds: rates.Funds, values: make([]float64, len(rates.Funds)), order: rates.DeductionOrder}
+	if rates.Indexed != nil {
+		a.indexed = &indexedAccount{crediting: rates.Indexed}
+	}
+	return a
+}
+
+// value is the total value outside the fixed account.
+func (a *accounts) value() float64 {
+	if a == nil {
+		return 0
+	}
+	total := a.indexed.value()
+	for _, v := range a.values {
+		total += v
+	}
+	return total
+}
+
+// fundValue is the total value of the funds.
+func (a *accounts) fundValue() float64 {
+	if a == nil {
+		return 0
+	}
+	return a.value() - a.indexed.value()
+}
+
+// indexedValue is the value of the index segments.
+func (a *accounts) indexedValue() float64 {
+	if a == nil {
+		return 0
+	}
+	return a.indexed.value()
+}
+
+// deposit allocates net premium paid in the policy month to the index
+// segments and funds.
+func (a *accounts) deposit(policyMonth int, policyYear int, netPremium float64) {
+	if a.indexed != nil {
+		a.indexed.deposit(policyMonth, policyYear, netPremium*a.indexed.crediting.Allocation)
+	}
+	for i, fund := range a.funds {
+		a.values[i] += netPremium * fund.Allocation
+	}
+}
+
+// source takes the month's deductions (and withdrawals) from the buckets.
+// The deduction has already come out of the fixed account, which holds
+// the rest of the account value; buckets before FixedBucket in the
+// deduction order repay it in turn. Then, if the fixed account falls short
+// of the loan collateral (or of zero), the shortfall comes from the buckets
+// after it in order, or from every bucket pro rata without an order.
+func (a *accounts) source(deduction float64, accountValue float64, loanBalance float64) {
+	remaining := max(0, deduction)
+	fixedListed := false
+	for _, name := range a.order {
+		if name == FixedBucket {
+			fixedListed = true
+			break
+		}
+		remaining -= a.release(name, remaining)
+	}
+	shortfall := max(0, min(loanBalance, accountValue)) - (accountValue - a.value())
+	if shortfall <= 0 {
+		return
+	}
+	if fixedListed {
+		after := false
+		for _, name := range a.order {
+			if after {
+				shortfall -= a.release(name, shortfall)
+			}
+			after = after || name == FixedBucket
+		}
+	}
+	if shortfall > 0 {
+		if total := a.value(); total > 0 {
+			a.scale(1 - min(1, shortfall/total))
+		}
+	}
+}
+
+// release takes up to amount from the named bucket and returns the amount
+// taken.
+func (a *accounts) release(name string, amount float64) float64 {
+	if amount <= 0 {
+		return 0
+	}
+	if name == IndexedBucket {
+		value := a.indexed.value()
+		if value <= 0 {
+			return 0
+		}
+		taken := min(amount, value)
+		a.indexed.scale(1 - taken/value)
+		return taken
+	}
+	for i, fund := range a.funds {
+		if fund.Name == name {
+			taken := min(amount, max(0, a.values[i]))
+			a.values[i] -= taken
+			return taken
+		}
+	}
+	return 0
+}
+
+// scale multiplies every bucket outside the fixed account by factor.
+func (a *accounts) scale(factor float64) {
+	if a == nil {
+		return
+	}
+	a.indexed.scale(factor)
+	for i := range a.values {
+		a.values[i] *= factor
+	}
+}
+
+// credit applies the month's fund returns, for the fraction of a full
+// month, and the index credits of segments maturing at the end of the
+// policy month.
+func (a *accounts) credit(policyMonth int, fraction float64) (indexCredit float64, fundReturn float64) {
+	if a.indexed != nil {
+		indexCredit = a.indexed.mature(policyMonth)
+	}
+	for i, fund := range a.funds {
+		earned := max(0, a.values[i]) * prorate(fund.monthlyReturn(), fraction)
+		a.values[i] += earned
+		fundReturn += earned
+	}
+	return indexCredit, fundReturn
+}
@@ -0,0 +1,172 @@
+package valact
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+)
+
+// RateCache keeps rate tables in memory for the RateSources that share it:
+// each table file is read from disk once, and the rates GetRates assembles
+// are kept by gender, risk class, and issue age and served as copies. A
+// RateCache is safe for concurrent use, so the workers of a batch can share
+// one; workers asking for the same file or rates at once wait for a single
+// load. Tables changed on disk are not seen until a new cache is used. A
+// cache serves sources reading from one file system.
+type RateCache struct {
+	mu    sync.Mutex
+	files map[string]*cachedFile
+	rates map[rateKey]*cachedRates
+}
+
+// cachedFile is a table file's contents, or the error reading it.
+type cachedFile struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// cachedRates are the rates of one key, available once ready is closed.
+type cachedRates struct {
+	ready chan struct{}
+	rates *RateSet
+	err   error
+}
+
+// rateKey identifies the rates of one insured from one source.
+type rateKey struct {
+	source    RateSource
+	gender    string
+	riskClass string
+	issueAge  int
+}
+
+// NewRateCache returns an empty cache.
+func NewRateCache() *RateCache {
+	return &RateCache{
+		files: make(map[string]*cachedFile),
+		rates: make(map[rateKey]*cachedRates),
+	}
+}
+
+// open opens the version of a rate table in effect at the source's AsOf.
+func (s RateSource) open(path string) (io.ReadCloser, error) {
+	path, err := s.version(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.openPath(path)
+}
+
+// openPath opens the rate table at the path, from the source's cache when
+// it has one.
+func (s RateSource) openPath(path string) (io.ReadCloser, error) {
+	if s.Cache == nil {
+		return s.openRows(path, nil)
+	}
+	data, err := s.Cache.file(s, path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// openRows opens a rate table from the source's store when it has the
+// table, with the filter's rows, or else from its file, or from the
+// source's defaults when the file is missing.
+func (s RateSource) openRows(path string, filter *rowFilter) (io.ReadCloser, error) {
+	if s.Store != nil {
+		if r, ok, err := s.Store.open(path, filter); ok {
+			return r, err
+		}
+	}
+	file, err := openFile(s.FS, path)
+	if errors.Is(err, fs.ErrNotExist) && s.Defaults != nil {
+		if table, defaultErr := openFile(s.Defaults, baseName(path)); defaultErr == nil {
+			return table, nil
+		}
+	}
+	return file, err
+}
+
+// file returns the contents of the source's table at the path, reading it
+// on first use. A missing file is remembered like its contents.
+func (c *RateCache) file(s RateSource, path string) ([]byte, error) {
+	c.mu.Lock()
+	file, ok := c.files[path]
+	if !ok {
+		file = new(cachedFile)
+		c.files[path] = file
+	}
+	c.mu.Unlock()
+	file.once.Do(func() {
+		var r io.ReadCloser
+		if r, file.err = s.openRows(path, nil); file.err != nil {
+			return
+		}
+		defer r.Close()
+		file.data, file.err = io.ReadAll(r)
+	})
+	return file.data, file.err
+}
+
+// getRates returns a copy of the source's rates for the insured, loading
+// them on first use; concurrent callers wait for the first one's load.
+// Loading errors are returned to the callers waiting on the load but not
+// kept, so a later call retries.
+func (c *RateCache) getRates(s RateSource, gender string, riskClass string, issueAge int) (*RateSet, error) {
+	key := rateKey{source: s, gender: gender, riskClass: riskClass, issueAge: issueAge}
+	key.source.Cache, key.source.FS, key.source.Defaults = nil, nil, nil
+	c.mu.Lock()
+	entry, ok := c.rates[key]
+	if !ok {
+		entry = &cachedRates{ready: make(chan struct{})}
+		c.rates[key] = entry
+	}
+	c.mu.Unlock()
+	if ok {
+		<-entry.ready
+	} else {
+		entry.rates, entry.err = s.loadRates(gender, riskClass, issueAge)
+		if entry.err != nil {
+			c.mu.Lock()
+			delete(c.rates, key)
+			c.mu.Unlock()
+		}
+		close(entry.ready)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.rates.clone(), nil
+}
+
+// clone returns a copy of the rates whose vectors and bands may be changed
+// without affecting r. Rider, shadow account, and indexed crediting rates
+// are shared, as they are not changed once loaded.
+func (r *RateSet) clone() *RateSet {
+	c := *r
+	for _, vector := range []*[]float64{
+		&c.COI, &c.PerUnit, &c.CorridorFactors, &c.PremiumLoad, &c.PremiumLoadExcess,
+		&c.TargetPremium, &c.PremiumLoadCap, &c.PolicyFee, &c.MaximumPremiumLoad, &c.MaximumPolicyFee,
+		&c.NAARDiscount, &c.Interest,
+		&c.MonthlyInterest, &c.MinimumInterest, &c.InterestBonus, &c.LoanInterest,
+		&c.LoanCrediting, &c.SurrenderCharge, &c.FreeWithdrawal, &c.SevenPayRates,
+		&c.SevenPayAnnuities, &c.LifeCOI[0], &c.LifeCOI[1], &c.ADB, &c.Chronic,
+	} {
+		*vector = slices.Clone(*vector)
+	}
+	for _, bands := range []*[]RateBand{&c.COIBands, &c.PerUnitBands, &c.GuaranteedCOI} {
+		*bands = slices.Clone(*bands)
+		for i := range *bands {
+			(*bands)[i].Rates = slices.Clone((*bands)[i].Rates)
+		}
+	}
+	c.Funds = slices.Clone(c.Funds)
+	c.DeductionOrder = slices.Clone(c.DeductionOrder)
+	c.MonthlySteps = slices.Clone(c.MonthlySteps)
+	return &c
+}
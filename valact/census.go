@@ -0,0 +1,263 @@
+package valact
+
+import (
+	"fmt"
+	"io"
+	"iter"
+)
+
+// ReadCensus reads model points from a census CSV with the columns
+// Policy_ID, Issue_Age, Gender, Risk_Class, Face_Amount and, optionally,
+// Birth_Date and Issue_Date (YYYY-MM-DD) with Age_Basis (nearest or last),
+// which set the issue age when Issue_Age is blank or absent,
+// Annual_Premium, Target_Premium (the annual target premium, blank for the
+// target premium table's), DB_Option (A or B), Premium_Mode (annual, semiannual,
+// quarterly, monthly), Table_Rating (COI multiple, e.g. 1.5), Flat_Extra
+// with Flat_Extra_Years (per $1,000 of face from policy year 1),
+// Term_Rider_Face (a term rider to maturity), Waiver (true for a waiver of
+// premium rider to maturity), ADB_Face (an accidental death benefit rider to
+// maturity), and Chronic (true for a chronic illness rider paying 2% of face
+// a month on claim, projected without a claim), and State (the state of
+// issue). An inforce census adds Inforce_Month (the last policy month
+// completed) with Account_Value and, optionally, Loan_Balance,
+// Surrender_Charge (blank for the table's), and Premiums_Paid. name is used
+// in error messages.
+func ReadCensus(r io.Reader, name string) ([]Policy, error) {
+	census, err := NewCensusReader(r, name)
+	if err != nil {
+		return nil, err
+	}
+	return census.ReadAll()
+}
+
+// CensusReader reads the policies of a census CSV (see ReadCensus) one row
+// at a time, so a run can start on the first before the last is read.
+type CensusReader struct {
+	t                                              *tableReader
+	birth, issueDate, age                          field
+	id, gender, class, face, premium, option, mode field
+	target, rating, extra, extraYears, term        field
+	waiver, adb, chronic, state, basis             field
+	inforce                                        inforceFields
+}
+
+// NewCensusReader returns a reader of the census, having read its header.
+// name is used in error messages.
+func NewCensusReader(r io.Reader, name string) (*CensusReader, error) {
+	t, err := newTableReader(r, name, censusSchema)
+	if err != nil {
+		return nil, err
+	}
+	c := &CensusReader{
+		t:          t,
+		birth:      t.field("Birth_Date"),
+		issueDate:  t.field("Issue_Date"),
+		age:        t.field("Issue_Age"),
+		id:         t.field("Policy_ID"),
+		gender:     t.field("Gender"),
+		class:      t.field("Risk_Class"),
+		face:       t.field("Face_Amount"),
+		premium:    t.field("Annual_Premium"),
+		option:     t.field("DB_Option"),
+		mode:       t.field("Premium_Mode"),
+		target:     t.field("Target_Premium"),
+		rating:     t.field("Table_Rating"),
+		extra:      t.field("Flat_Extra"),
+		extraYears: t.field("Flat_Extra_Years"),
+		term:       t.field("Term_Rider_Face"),
+		waiver:     t.field("Waiver"),
+		adb:        t.field("ADB_Face"),
+		chronic:    t.field("Chronic"),
+		state:      t.field("State"),
+		basis:      t.field("Age_Basis"),
+		inforce: inforceFields{
+			month:  t.field("Inforce_Month"),
+			value:  t.field("Account_Value"),
+			loan:   t.field("Loan_Balance"),
+			charge: t.field("Surrender_Charge"),
+			paid:   t.field("Premiums_Paid"),
+		},
+	}
+	if !t.has(c.age) && (!t.has(c.birth) || !t.has(c.issueDate)) {
+		return nil, fmt.Errorf("%s: missing column Issue_Age", name)
+	}
+	return c, nil
+}
+
+// All returns the policies of the rows not yet read, in order, stopping
+// after the first error.
+func (c *CensusReader) All() iter.Seq2[Policy, error] {
+	return func(yield func(Policy, error) bool) {
+		for c.t.next() {
+			policy, err := c.policy()
+			if !yield(policy, err) || err != nil {
+				return
+			}
+		}
+		if err := c.t.err(); err != nil {
+			yield(Policy{}, err)
+		}
+	}
+}
+
+// ReadAll returns the policies of the rows not yet read.
+func (c *CensusReader) ReadAll() ([]Policy, error) {
+	var policies []Policy
+	for policy, err := range c.All() {
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// policy reads the policy of the current row.
+func (c *CensusReader) policy() (Policy, error) {
+	t := c.t
+	var err error
+	policy := Policy{
+		ID:        t.raw(c.id),
+		Gender:    t.raw(c.gender),
+		RiskClass: t.raw(c.class),
+		State:     t.raw(c.state),
+	}
+	if !t.blank(c.birth) {
+		if policy.BirthDate, err = t.date(c.birth); err != nil {
+			return Policy{}, err
+		}
+	}
+	if !t.blank(c.issueDate) {
+		if policy.IssueDate, err = t.date(c.issueDate); err != nil {
+			return Policy{}, err
+		}
+	}
+	basis, err := t.text(c.basis)
+	if err != nil {
+		return Policy{}, err
+	}
+	policy.AgeBasis = AgeBasis(basis)
+	if !t.blank(c.age) {
+		if policy.IssueAge, err = t.int(c.age); err != nil {
+			return Policy{}, err
+		}
+	} else if err := policy.SetIssueAge(); err != nil {
+		return Policy{}, fmt.Errorf("%s line %d: %w", t.name, t.line(), err)
+	}
+	if policy.FaceAmount, err = t.float(c.face); err != nil {
+		return Policy{}, err
+	}
+	if !t.blank(c.premium) {
+		if policy.AnnualPremium, err = t.float(c.premium); err != nil {
+			return Policy{}, err
+		}
+	}
+	if !t.blank(c.target) {
+		if policy.TargetPremium, err = t.float(c.target); err != nil {
+			return Policy{}, err
+		}
+	}
+	option, err := t.text(c.option)
+	if err != nil {
+		return Policy{}, err
+	}
+	policy.DBOption = DBOption(option)
+	mode, err := t.text(c.mode)
+	if err != nil {
+		return Policy{}, err
+	}
+	policy.PremiumMode = PremiumMode(mode)
+	if !t.blank(c.rating) {
+		if policy.TableRating, err = t.float(c.rating); err != nil {
+			return Policy{}, err
+		}
+	}
+	if !t.blank(c.extra) {
+		extra := FlatExtra{Years: -1}
+		if extra.Rate, err = t.float(c.extra); err != nil {
+			return Policy{}, err
+		}
+		if !t.blank(c.extraYears) {
+			if extra.Years, err = t.int(c.extraYears); err != nil {
+				return Policy{}, err
+			}
+		}
+		policy.FlatExtras = []FlatExtra{extra}
+	}
+	if !t.blank(c.term) {
+		rider := &TermRider{}
+		if rider.FaceAmount, err = t.float(c.term); err != nil {
+			return Policy{}, err
+		}
+		policy.TermRider = rider
+	}
+	if !t.blank(c.waiver) {
+		waiver, err := t.bool(c.waiver)
+		if err != nil {
+			return Policy{}, err
+		}
+		if waiver {
+			policy.Waiver = &WaiverRider{}
+		}
+	}
+	if !t.blank(c.adb) {
+		rider := &ADBRider{}
+		if rider.FaceAmount, err = t.float(c.adb); err != nil {
+			return Policy{}, err
+		}
+		policy.ADB = rider
+	}
+	if !t.blank(c.chronic) {
+		chronic, err := t.bool(c.chronic)
+		if err != nil {
+			return Policy{}, err
+		}
+		if chronic {
+			policy.Chronic = &ChronicRider{BenefitRate: 0.02}
+		}
+	}
+	if !t.blank(c.inforce.month) {
+		if policy.Inforce, err = c.inforce.read(t); err != nil {
+			return Policy{}, err
+		}
+	}
+	return policy, nil
+}
+
+// inforceFields are the inforce value columns of a census.
+type inforceFields struct {
+	month, value, loan, charge, paid field
+}
+
+// read reads the inforce values of the census row.
+func (f inforceFields) read(t *tableReader) (*Inforce, error) {
+	inforce := &Inforce{}
+	var err error
+	if inforce.PolicyMonth, err = t.int(f.month); err != nil {
+		return nil, err
+	}
+	if !t.has(f.value) {
+		return nil, fmt.Errorf("%s: missing column Account_Value", t.name)
+	}
+	if inforce.AccountValue, err = t.float(f.value); err != nil {
+		return nil, err
+	}
+	if !t.blank(f.loan) {
+		if inforce.LoanBalance, err = t.float(f.loan); err != nil {
+			return nil, err
+		}
+	}
+	if !t.blank(f.charge) {
+		charge, err := t.float(f.charge)
+		if err != nil {
+			return nil, err
+		}
+		inforce.SurrenderCharge = &charge
+	}
+	if !t.blank(f.paid) {
+		if inforce.PremiumsPaid, err = t.float(f.paid); err != nil {
+			return nil, err
+		}
+	}
+	return inforce, nil
+}
@@ -0,0 +1,122 @@
+package valact
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Checkpoint records the policies a batch has completed in a file, so an
+// interrupted run can resume without repeating them. Each completed policy
+// is recorded as a "+Policy_ID" line and each Sync as an "@offset" line
+// with the length of the output written so far; on opening, the policies
+// recorded after the last sync are dropped, as their output may not have
+// been written.
+type Checkpoint struct {
+	file   *os.File
+	writer *bufio.Writer
+	done   map[string]bool
+	// Offset is the length of the output at the last sync.
+	Offset int64
+}
+
+// OpenCheckpoint opens the checkpoint file at path, creating it if missing,
+// and reads the policies completed up to its last sync.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{file: file, done: make(map[string]bool)}
+	var pending []string
+	var synced int64 // length of the file through the last sync line
+	var read int64
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		read += int64(len(text)) + 1
+		switch {
+		case strings.HasPrefix(text, "+"):
+			pending = append(pending, text[1:])
+		case strings.HasPrefix(text, "@"):
+			offset, err := strconv.ParseInt(text[1:], 10, 64)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s line %d: offset %q: %w", path, line, text[1:], err)
+			}
+			for _, id := range pending {
+				c.done[id] = true
+			}
+			pending = pending[:0]
+			c.Offset, synced = offset, read
+		default:
+			file.Close()
+			return nil, fmt.Errorf("%s line %d: unrecognized entry %q", path, line, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := file.Truncate(synced); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(synced, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	c.writer = bufio.NewWriter(file)
+	return c, nil
+}
+
+// Done reports whether the policy was completed by the run being resumed.
+func (c *Checkpoint) Done(id string) bool {
+	return c.done[id]
+}
+
+// Remaining returns the policies not yet completed, read from policies as
+// they are taken, and any error reading them.
+func (c *Checkpoint) Remaining(policies iter.Seq2[Policy, error]) iter.Seq2[Policy, error] {
+	return func(yield func(Policy, error) bool) {
+		for policy, err := range policies {
+			if err == nil && c.done[policy.ID] {
+				continue
+			}
+			if !yield(policy, err) {
+				return
+			}
+		}
+	}
+}
+
+// Record notes the policy as completed; it takes effect at the next Sync.
+func (c *Checkpoint) Record(id string) error {
+	c.done[id] = true
+	_, err := fmt.Fprintf(c.writer, "+%s\n", id)
+	return err
+}
+
+// Sync commits the policies recorded so far, once their output has been
+// written, with offset the length of the output, and flushes the file to
+// disk.
+func (c *Checkpoint) Sync(offset int64) error {
+	if _, err := fmt.Fprintf(c.writer, "@%d\n", offset); err != nil {
+		return err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	c.Offset = offset
+	return c.file.Sync()
+}
+
+// Close closes the file, dropping the policies recorded since the last
+// Sync.
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,72 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnmappedCode is returned when the code map has no entry for a gender
+// or risk class code.
+var ErrUnmappedCode = errors.New("no mapping for code")
+
+// MapCodes translates admin system gender and risk class codes to the keys
+// of the rate tables using the code map table (Field, Code, Key, where Field
+// is Gender or Risk_Class). Codes pass through unchanged when the table does
+// not exist or has no rows for the field; otherwise an unlisted code returns
+// ErrUnmappedCode.
+func (s RateSource) MapCodes(gender string, riskClass string) (string, string, error) {
+	path := s.path(s.CodeMapFile, CodeMapFile)
+	codes, err := s.readCodeMap(path)
+	if err != nil {
+		return gender, riskClass, err
+	}
+	if gender, err = mapCode(path, codes, "Gender", gender); err != nil {
+		return gender, riskClass, err
+	}
+	riskClass, err = mapCode(path, codes, "Risk_Class", riskClass)
+	return gender, riskClass, err
+}
+
+// mapCode looks up code in the field's mapping.
+func mapCode(path string, codes map[string]map[string]string, field string, code string) (string, error) {
+	mapping, ok := codes[field]
+	if !ok {
+		return code, nil
+	}
+	key, ok := mapping[code]
+	if !ok {
+		return code, fmt.Errorf("%s: %w: %s %q", path, ErrUnmappedCode, field, code)
+	}
+	return key, nil
+}
+
+// readCodeMap reads the code map by field and code; a missing file is an
+// empty map.
+func (s RateSource) readCodeMap(path string) (map[string]map[string]string, error) {
+	codes := make(map[string]map[string]string)
+	t, err := s.openTable(path, codeMapSchema)
+	if errors.Is(err, os.ErrNotExist) {
+		return codes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	// the Field column names the field a code is of
+	nameField, codeField, keyField := t.field("Field"), t.field("Code"), t.field("Key")
+	for t.next() {
+		name, err := t.text(nameField)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return nil, t.fieldError(nameField, errInvalidOption)
+		}
+		if codes[name] == nil {
+			codes[name] = make(map[string]string)
+		}
+		codes[name][t.raw(codeField)] = t.raw(keyField)
+	}
+	return codes, t.err()
+}
@@ -0,0 +1,116 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIssueAgeNotInTarget is returned when the target premium table has no
+// row for the requested issue age.
+var ErrIssueAgeNotInTarget = errors.New("issue age not found in target premium table")
+
+// GetTargetPremiumRate reads the annual target premium per $1,000 of face
+// amount for the issue age from the target premium table, a CSV with the
+// columns Issue_Age and Rate.
+func (s RateSource) GetTargetPremiumRate(issueAge int) (float64, error) {
+	path := s.path(s.TargetPremiumFile, TargetPremiumFile)
+	t, err := s.openTable(path, targetPremiumSchema)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Close()
+	ageField, rateField := t.field("Issue_Age"), t.field("Rate")
+	for t.next() {
+		age, err := t.int(ageField)
+		if err != nil {
+			return 0, err
+		}
+		if age == issueAge {
+			return t.float(rateField)
+		}
+	}
+	if err := t.err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s: %w: %d", path, ErrIssueAgeNotInTarget, issueAge)
+}
+
+// SetTargetPremium sets the target premium of every policy year from an
+// annual rate per $1,000 of face amount.
+func (r *RateSet) SetTargetPremium(rate float64, faceAmount float64) {
+	r.TargetPremium = CreateVector(rate*faceAmount/1000, len(r.TargetPremium))
+}
+
+// CommissionSchedule is the compensation paid on premium, as rates of
+// premium up to and above the target premium.
+type CommissionSchedule struct {
+	// FirstYear is the rate on premium up to target in the first policy
+	// year, and Renewal the rate on premium up to target in the
+	// RenewalYears years after it.
+	FirstYear    float64 `json:"first_year"`
+	Renewal      float64 `json:"renewal"`
+	RenewalYears int     `json:"renewal_years"`
+	// Excess is the rate on premium above target in any year.
+	Excess float64 `json:"excess"`
+	// RollingYears, when above 1, rolls target premium not paid in the first
+	// year forward: premium up to target earns the first year rate until
+	// the premium paid within the first RollingYears years fills one
+	// target.
+	RollingYears int `json:"rolling_years,omitempty"`
+	// ChargebackMonths is the period after issue in which a lapse charges
+	// back the unearned share of the first year rate commission, pro rata
+	// to the months remaining in the period.
+	ChargebackMonths int `json:"chargeback_months,omitempty"`
+}
+
+// Commissions are the compensation on a projection.
+type Commissions struct {
+	// ByYear is the commission by policy year, net of any chargeback.
+	ByYear     []float64 `json:"by_year"`
+	FirstYear  float64   `json:"first_year"`
+	Renewal    float64   `json:"renewal"`
+	Excess     float64   `json:"excess"`
+	Chargeback float64   `json:"chargeback"`
+	Total      float64   `json:"total"`
+}
+
+// Commissions computes the commissions on the premiums of a monthly
+// ledger given the annual target premium. A ledger ending in lapse within
+// the chargeback period has the chargeback taken in the lapse year.
+func (c CommissionSchedule) Commissions(ledger Ledger, target float64) Commissions {
+	buffer := getLedger()
+	defer putLedger(buffer)
+	annual := ledger.appendAnnual(*buffer)
+	*buffer = annual
+	result := Commissions{ByYear: make([]float64, len(annual))}
+	// target premium left to earn the first year rate
+	rolling := target
+	for i, year := range annual {
+		targetPortion := min(year.Premium, target)
+		firstYear := 0.0
+		if year.PolicyYear == 1 || year.PolicyYear <= c.RollingYears {
+			firstYear = min(targetPortion, rolling)
+			rolling -= firstYear
+		}
+		renewal := 0.0
+		if year.PolicyYear > 1 && year.PolicyYear <= 1+c.RenewalYears {
+			renewal = targetPortion - firstYear
+		}
+		paid := firstYear*c.FirstYear + renewal*c.Renewal + (year.Premium-targetPortion)*c.Excess
+		result.FirstYear += firstYear * c.FirstYear
+		result.Renewal += renewal * c.Renewal
+		result.Excess += (year.Premium - targetPortion) * c.Excess
+		result.ByYear[i] = paid
+		result.Total += paid
+	}
+	if len(ledger) > 0 {
+		last := ledger[len(ledger)-1]
+		if last.Lapsed && last.PolicyMonth <= c.ChargebackMonths {
+			unearned := float64(c.ChargebackMonths-last.PolicyMonth+1) / float64(c.ChargebackMonths)
+			result.Chargeback = result.FirstYear * unearned
+			result.ByYear[len(result.ByYear)-1] -= result.Chargeback
+			result.Total -= result.Chargeback
+		}
+	}
+	return result
+}
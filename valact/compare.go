@@ -0,0 +1,273 @@
+package valact
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CompareTolerance is how far a ledger cell may be from the expected value
+// before it is reported: by more than both Absolute and Relative times the
+// expected value's magnitude. The zero value reports any difference.
+type CompareTolerance struct {
+	Absolute float64
+	Relative float64
+}
+
+// within reports whether actual is close enough to expected.
+func (t CompareTolerance) within(expected, actual float64) bool {
+	deviation := math.Abs(actual - expected)
+	return deviation <= t.Absolute || deviation <= t.Relative*math.Abs(expected)
+}
+
+// LedgerComparison is the result of comparing a ledger with an expected
+// one, e.g. exported from an administration system or written by a prior
+// release. Rows are matched on Key and the columns both ledgers have are
+// compared cell by cell.
+type LedgerComparison struct {
+	// Key is the column matching the rows: Policy_Month, or Policy_Year
+	// when the expected ledger has no months.
+	Key string
+	// Diffs are the cells beyond the tolerance, in the order of the
+	// expected ledger's rows and columns.
+	Diffs []LedgerDiff
+	// Columns are the deviations of each compared column, in the expected
+	// ledger's order.
+	Columns []ColumnDeviation
+	// MissingRows are the keys of expected rows the ledger lacks, and
+	// ExtraRows those of its rows not expected.
+	MissingRows []string
+	ExtraRows   []string
+	// MissingColumns are the expected columns the ledger lacks; they are
+	// not compared.
+	MissingColumns []string
+}
+
+// LedgerDiff is a cell differing from the expected value beyond the
+// tolerance. Deviation is the actual less the expected value, NaN when
+// either is not a number.
+type LedgerDiff struct {
+	Row       string
+	Column    string
+	Expected  string
+	Actual    string
+	Deviation float64
+}
+
+// ColumnDeviation summarizes the differences in one column: the number of
+// cells compared and beyond the tolerance, and the largest and mean
+// absolute deviation of the numeric cells.
+type ColumnDeviation struct {
+	Column        string
+	Cells         int
+	Differing     int
+	MaxDeviation  float64
+	MeanDeviation float64
+}
+
+// Differs reports whether the ledger differs from the expected one: a cell
+// beyond the tolerance or a row missing from either.
+func (c *LedgerComparison) Differs() bool {
+	return len(c.Diffs) > 0 || len(c.MissingRows) > 0 || len(c.ExtraRows) > 0
+}
+
+// ledgerTable is a ledger CSV read for comparison, its rows by key.
+type ledgerTable struct {
+	header []string
+	keys   []string
+	rows   map[string][]string
+}
+
+// readLedgerTable reads a ledger CSV keyed on the key column.
+func readLedgerTable(r io.Reader, name string, key string) (*ledgerTable, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: empty ledger", name)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	keyField := slices.Index(header, key)
+	if keyField < 0 {
+		return nil, fmt.Errorf("%s: no %s column", name, key)
+	}
+	t := &ledgerTable{header: header, rows: make(map[string][]string)}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("%s: line %d: %d fields, want %d", name, line, len(record), len(header))
+		}
+		k := strings.TrimSpace(record[keyField])
+		if _, ok := t.rows[k]; ok {
+			return nil, fmt.Errorf("%s: line %d: duplicate %s %s", name, line, key, k)
+		}
+		t.keys = append(t.keys, k)
+		t.rows[k] = record
+	}
+}
+
+// CompareLedgerCSV compares the ledger CSV read from actual with the
+// expected one, both with a header row, such as written by WriteLedgerCSV.
+// Blank numeric cells count as zero. The names are used in error messages.
+func CompareLedgerCSV(expected io.Reader, expectedName string, actual io.Reader, actualName string, tolerance CompareTolerance) (*LedgerComparison, error) {
+	// the key is decided by the expected header, read ahead of the rows
+	expectedData, err := io.ReadAll(expected)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", expectedName, err)
+	}
+	header, err := csv.NewReader(strings.NewReader(string(expectedData))).Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", expectedName, err)
+	}
+	c := &LedgerComparison{Key: "Policy_Month"}
+	if !slices.Contains(header, c.Key) {
+		c.Key = "Policy_Year"
+	}
+	want, err := readLedgerTable(strings.NewReader(string(expectedData)), expectedName, c.Key)
+	if err != nil {
+		return nil, err
+	}
+	got, err := readLedgerTable(actual, actualName, c.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// actual field of each expected column compared, -1 when missing
+	fields := make([]int, len(want.header))
+	for i, column := range want.header {
+		fields[i] = slices.Index(got.header, column)
+		switch {
+		case column == c.Key:
+			fields[i] = -1
+		case fields[i] < 0:
+			c.MissingColumns = append(c.MissingColumns, column)
+		default:
+			c.Columns = append(c.Columns, ColumnDeviation{Column: column})
+		}
+	}
+	// numeric cells of each column, for the mean deviation
+	numeric := make([]int, len(c.Columns))
+	for _, k := range want.keys {
+		row, ok := got.rows[k]
+		if !ok {
+			c.MissingRows = append(c.MissingRows, k)
+			continue
+		}
+		column := 0
+		for i, field := range fields {
+			if field < 0 {
+				continue
+			}
+			deviation := &c.Columns[column]
+			wantText, gotText := strings.TrimSpace(want.rows[k][i]), strings.TrimSpace(row[field])
+			deviation.Cells++
+			diff := LedgerDiff{Row: k, Column: want.header[i], Expected: wantText, Actual: gotText, Deviation: math.NaN()}
+			wantValue, wantErr := parseCompareCell(wantText)
+			gotValue, gotErr := parseCompareCell(gotText)
+			if wantErr == nil && gotErr == nil {
+				diff.Deviation = gotValue - wantValue
+				absolute := math.Abs(diff.Deviation)
+				deviation.MaxDeviation = max(deviation.MaxDeviation, absolute)
+				deviation.MeanDeviation += absolute
+				numeric[column]++
+				if !tolerance.within(wantValue, gotValue) {
+					deviation.Differing++
+					c.Diffs = append(c.Diffs, diff)
+				}
+			} else if wantText != gotText {
+				deviation.Differing++
+				c.Diffs = append(c.Diffs, diff)
+			}
+			column++
+		}
+	}
+	for i := range c.Columns {
+		if numeric[i] > 0 {
+			c.Columns[i].MeanDeviation /= float64(numeric[i])
+		}
+	}
+	for _, k := range got.keys {
+		if _, ok := want.rows[k]; !ok {
+			c.ExtraRows = append(c.ExtraRows, k)
+		}
+	}
+	return c, nil
+}
+
+// parseCompareCell parses a numeric cell, blank as zero.
+func parseCompareCell(text string) (float64, error) {
+	if text == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+// WriteDiffsCSV writes the differing cells as CSV: the row key, column,
+// expected and actual values, and the deviation (blank when not numeric).
+func (c *LedgerComparison) WriteDiffsCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{c.Key, "Column", "Expected", "Actual", "Deviation"}); err != nil {
+		return err
+	}
+	for _, diff := range c.Diffs {
+		deviation := ""
+		if !math.IsNaN(diff.Deviation) {
+			deviation = formatFloat(diff.Deviation)
+		}
+		if err := writer.Write([]string{diff.Row, diff.Column, diff.Expected, diff.Actual, deviation}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteSummary writes the comparison summary as text: the deviations of
+// each column with a difference, then the missing rows and columns.
+func (c *LedgerComparison) WriteSummary(w io.Writer) error {
+	cells, differing := 0, 0
+	for _, column := range c.Columns {
+		cells += column.Cells
+		differing += column.Differing
+	}
+	if _, err := fmt.Fprintf(w, "%d of %d cells differ in %d columns matched on %s\n", differing, cells, len(c.Columns), c.Key); err != nil {
+		return err
+	}
+	for _, column := range c.Columns {
+		if column.MaxDeviation == 0 && column.Differing == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s: %d differ, max deviation %g, mean %g\n", column.Column, column.Differing, column.MaxDeviation, column.MeanDeviation); err != nil {
+			return err
+		}
+	}
+	for _, list := range []struct {
+		name string
+		keys []string
+	}{
+		{"missing rows (" + c.Key + ")", c.MissingRows},
+		{"extra rows (" + c.Key + ")", c.ExtraRows},
+		{"missing columns", c.MissingColumns},
+	} {
+		if len(list.keys) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", list.name, strings.Join(list.keys, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
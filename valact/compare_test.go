@@ -0,0 +1,68 @@
+package valact
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareLedgerCSV(t *testing.T) {
+	expected := "Policy_Month,Premium,Value_End,Lapsed,Death_Benefit\n" +
+		"1,1000,900.5,false,100000\n" +
+		"2,,850.25,false,100000\n" +
+		"3,0,800,false,100000\n"
+	actual := "Policy_Month,Value_End,Premium,Lapsed\n" +
+		"1,900.5000001,1000,false\n" +
+		"2,851.25,0,true\n" +
+		"4,700,0,false\n"
+	c, err := CompareLedgerCSV(strings.NewReader(expected), "expected.csv", strings.NewReader(actual), "actual.csv", CompareTolerance{Absolute: 1e-6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Differs() || c.Key != "Policy_Month" {
+		t.Fatalf("comparison %+v, want differences matched on Policy_Month", c)
+	}
+	// the blank premium is zero, and month 1 within the tolerance
+	wantDiffs := []LedgerDiff{
+		{Row: "2", Column: "Value_End", Expected: "850.25", Actual: "851.25", Deviation: 1},
+		{Row: "2", Column: "Lapsed", Expected: "false", Actual: "true", Deviation: math.NaN()},
+	}
+	if len(c.Diffs) != len(wantDiffs) {
+		t.Fatalf("diffs %+v, want %+v", c.Diffs, wantDiffs)
+	}
+	for i, diff := range c.Diffs {
+		want := wantDiffs[i]
+		if diff.Row != want.Row || diff.Column != want.Column || diff.Expected != want.Expected || diff.Actual != want.Actual ||
+			(diff.Deviation != want.Deviation && !(math.IsNaN(diff.Deviation) && math.IsNaN(want.Deviation))) {
+			t.Errorf("diff %d = %+v, want %+v", i, diff, want)
+		}
+	}
+	if !reflect.DeepEqual(c.MissingRows, []string{"3"}) || !reflect.DeepEqual(c.ExtraRows, []string{"4"}) || !reflect.DeepEqual(c.MissingColumns, []string{"Death_Benefit"}) {
+		t.Errorf("missing rows %v, extra rows %v, missing columns %v, want [3], [4], [Death_Benefit]", c.MissingRows, c.ExtraRows, c.MissingColumns)
+	}
+	for _, column := range c.Columns {
+		if column.Column == "Value_End" && (column.Cells != 2 || column.Differing != 1 || column.MaxDeviation != 1) {
+			t.Errorf("Value_End deviation %+v, want 1 of 2 cells off by at most 1", column)
+		}
+	}
+
+	same, err := CompareLedgerCSV(strings.NewReader(expected), "expected.csv", strings.NewReader(expected), "expected.csv", CompareTolerance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.Differs() {
+		t.Errorf("a ledger differs from itself: %+v", same)
+	}
+}
+
+func TestCompareLedgerCSVPolicyYear(t *testing.T) {
+	annual := "Policy_Year,Value_End\n1,100\n2,200\n"
+	c, err := CompareLedgerCSV(strings.NewReader(annual), "expected.csv", strings.NewReader(annual), "actual.csv", CompareTolerance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Key != "Policy_Year" || c.Differs() {
+		t.Errorf("comparison %+v, want no differences matched on Policy_Year", c)
+	}
+}
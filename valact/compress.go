@@ -0,0 +1,192 @@
+package valact
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"approach1/valact/internal/zstd"
+)
+
+// Compressed file suffixes: tables, censuses, and outputs whose names end
+// in one are read and written through its codec. zstd is written in stored
+// blocks, uncompressed; see zstdWriter.
+const (
+	GzipSuffix = ".gz"
+	ZstdSuffix = ".zst"
+)
+
+// Decompress returns a reader of r decompressed by the codec of the name's
+// suffix, or r itself for other names. Closing it closes r.
+func Decompress(r io.ReadCloser, name string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, GzipSuffix):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return readCloser{gz, r}, nil
+	case strings.HasSuffix(name, ZstdSuffix):
+		return readCloser{zstd.NewReader(r), r}, nil
+	}
+	return r, nil
+}
+
+// Compress returns a writer to w compressing by the codec of the name's
+// suffix, or w itself for other names. Closing it ends the compressed
+// stream and closes w.
+func Compress(w io.WriteCloser, name string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(name, GzipSuffix):
+		return &writeCloser{gzip.NewWriter(w), w}, nil
+	case strings.HasSuffix(name, ZstdSuffix):
+		return &writeCloser{&zstdWriter{dest: w}, w}, nil
+	}
+	return w, nil
+}
+
+// OpenFile opens the file at the path for reading, decompressed, or as CSV
+// for an XLSX workbook or a Parquet file; see XLSXSuffix and ParquetSuffix.
+func OpenFile(path string) (io.ReadCloser, error) {
+	return openFile(nil, path)
+}
+
+// CreateFile creates the file at the path for writing, compressed by its
+// suffix.
+func CreateFile(path string) (io.WriteCloser, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return Compress(file, path)
+}
+
+// openCompressed opens a table, from fsys when not nil, decompressed. A
+// table missing under its name is looked for with each compressed suffix,
+// so coi.csv may be given as coi.csv.gz.
+func openCompressed(fsys fs.FS, path string) (io.ReadCloser, error) {
+	open := func(name string) (io.ReadCloser, error) {
+		if fsys != nil {
+			return fsys.Open(name)
+		}
+		return os.Open(name)
+	}
+	file, err := open(path)
+	if errors.Is(err, fs.ErrNotExist) && !compressed(path) {
+		for _, suffix := range []string{GzipSuffix, ZstdSuffix} {
+			if file, suffixErr := open(path + suffix); suffixErr == nil {
+				return Decompress(file, path+suffix)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(file, path)
+}
+
+// compressed reports whether the name has a compressed suffix.
+func compressed(name string) bool {
+	return strings.HasSuffix(name, GzipSuffix) || strings.HasSuffix(name, ZstdSuffix)
+}
+
+// readCloser reads decompressed data, closing the compressed source.
+type readCloser struct {
+	io.Reader
+	source io.Closer
+}
+
+func (r readCloser) Close() error {
+	return r.source.Close()
+}
+
+// writeCloser compresses to a destination, closing it after the
+// compressor.
+type writeCloser struct {
+	compressor io.WriteCloser
+	dest       io.Closer
+}
+
+func (w *writeCloser) Write(p []byte) (int, error) {
+	return w.compressor.Write(p)
+}
+
+func (w *writeCloser) Close() error {
+	err := w.compressor.Close()
+	if closeErr := w.dest.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// zstdBlockSize is the largest zstd block, and the window size declared by
+// the frames of zstdWriter.
+const zstdBlockSize = 128 << 10
+
+// zstdWriter writes a zstd frame (RFC 8878) of raw blocks, or RLE blocks
+// for runs of one byte: a stream any zstd reader decompresses, though no
+// smaller than its data otherwise, as there is no compressor here. Close
+// ends the frame without closing the destination.
+type zstdWriter struct {
+	dest    io.Writer
+	buf     []byte
+	started bool
+	err     error
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	z.buf = append(z.buf, p...)
+	// a full block is held back, so Close has one to end the frame with
+	for len(z.buf) > zstdBlockSize && z.err == nil {
+		z.block(z.buf[:zstdBlockSize], false)
+		z.buf = z.buf[zstdBlockSize:]
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	return len(p), nil
+}
+
+func (z *zstdWriter) Close() error {
+	if z.err == nil {
+		z.block(z.buf, true)
+		z.buf = nil
+	}
+	return z.err
+}
+
+// block writes the data as a block, after the frame header for the first:
+// the magic number, a descriptor of no content size, checksum, or
+// dictionary, and the window descriptor.
+func (z *zstdWriter) block(data []byte, last bool) {
+	if !z.started {
+		// window log 17 for 128 KiB, less 10, in the exponent bits
+		if _, z.err = z.dest.Write([]byte{0x28, 0xb5, 0x2f, 0xfd, 0, 7 << 3}); z.err != nil {
+			return
+		}
+		z.started = true
+	}
+	// the header: the last block flag, the type (0 raw, 1 RLE), and the
+	// size of the data, little endian in 3 bytes
+	header := uint32(len(data)) << 3
+	if last {
+		header |= 1
+	}
+	content := data
+	if len(data) > 1 && bytes.Count(data, data[:1]) == len(data) {
+		header |= 1 << 1
+		content = data[:1]
+	}
+	if _, z.err = z.dest.Write([]byte{byte(header), byte(header >> 8), byte(header >> 16)}); z.err == nil {
+		_, z.err = z.dest.Write(content)
+	}
+}
@@ -0,0 +1,112 @@
+package valact
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"out.csv", "out.csv.gz", "out.csv.zst"} {
+		path := filepath.Join(dir, name)
+		w, err := CreateFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, "Policy_ID\nA\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != "Policy_ID\nA\n" {
+			t.Errorf("%s read %q, %v", name, data, err)
+		}
+	}
+}
+
+// TestCreateFileZstd writes raw and RLE blocks over several frames, as
+// batch -checkpoint writes a frame per checkpoint, and reads them back as
+// one stream.
+func TestCreateFileZstd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv.zst")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := os.ReadFile(filepath.Join("testdata", "tables", "coi.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := [][]byte{
+		bytes.Repeat(table, 3),
+		bytes.Repeat([]byte{'0'}, 2*zstdBlockSize+1),
+		nil,
+		[]byte("Policy_ID\nA\n"),
+	}
+	for _, data := range frames {
+		w, err := Compress(nopWriteCloser{file}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(got, want) {
+		t.Errorf("read %d bytes, want the %d written", len(got), len(want))
+	}
+}
+
+// nopWriteCloser keeps a file open across the frames written to it.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// testdata/zst/coi.csv.zst was compressed by the zstd command line
+// tool from testdata/tables/coi.csv.
+func TestOpenFileZstd(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "tables", "coi.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the table is found under its name without the suffix
+	r, err := OpenFile(filepath.Join("testdata", "zst", "coi.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("decompressed %d bytes, want the %d of coi.csv", len(got), len(want))
+	}
+}
@@ -0,0 +1,24 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// fieldError wraps a bad value with the file, line, and column it came from,
+// e.g. `coi.csv line 1042: Rate "abc": not a number`.
+func fieldError(path string, line int, column string, value string, err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		err = numErr.Err
+	}
+	return fmt.Errorf("%s line %d: %s %q: %w", path, line, column, value, err)
+}
+
+// errInvalidOption is wrapped by fieldError for unrecognized option codes.
+var errInvalidOption = errors.New("invalid option")
+
+// errOutOfRange is wrapped by fieldError for keys that fall outside the
+// projection arrays.
+var errOutOfRange = errors.New("out of range")
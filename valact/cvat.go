@@ -0,0 +1,49 @@
+package valact
+
+import "math"
+
+// ComplianceTest is the IRC 7702 test a product qualifies under.
+type ComplianceTest string
+
+const (
+	// TestGPT is the guideline premium test with the cash value corridor
+	// of the corridor factor table; it is the default.
+	TestGPT ComplianceTest = "gpt"
+	// TestCVAT is the cash value accumulation test: the death benefit must
+	// be at least the account value divided by the net single premium.
+	TestCVAT ComplianceTest = "cvat"
+)
+
+// Valid reports whether the test is GPT, CVAT, or empty (GPT).
+func (t ComplianceTest) Valid() bool {
+	return t == "" || t == TestGPT || t == TestCVAT
+}
+
+// NetSinglePremiums returns the CVAT net single premium per $1 of death
+// benefit by policy year for the issue age over the years, e.g. those of
+// the policy's rates: curtate whole life to the basis maturity age, where
+// the benefit endows, on the basis mortality and level premium interest
+// rate. Years from maturity on are 1.
+func (b *GuidelineBasis) NetSinglePremiums(issueAge int, years int) []float64 {
+	nsp := CreateVector(1, years)
+	v := 1 / (1 + b.LevelInterest)
+	for year := min(b.MaturityAge-issueAge, len(nsp)) - 1; year >= 0; year-- {
+		q := min(1, b.Mortality[year]/1000)
+		next := 1.0
+		if year+1 < len(nsp) {
+			next = nsp[year+1]
+		}
+		nsp[year] = v * (q + (1-q)*next)
+	}
+	return nsp
+}
+
+// QualifyCVAT switches the rates to CVAT, replacing the corridor factors
+// with the reciprocal of the basis net single premiums.
+func (r *RateSet) QualifyCVAT(basis *GuidelineBasis, issueAge int) {
+	r.ComplianceTest = TestCVAT
+	nsp := basis.NetSinglePremiums(issueAge, len(r.CorridorFactors))
+	for i, premium := range nsp {
+		r.CorridorFactors[i] = math.Max(1, 1/premium)
+	}
+}
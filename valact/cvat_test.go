@@ -0,0 +1,37 @@
+package valact
+
+import (
+	"math"
+	"testing"
+)
+
+// flatBasis is a basis of 10 per 1,000 mortality at 4% maturing at 38.
+var flatBasis = &GuidelineBasis{Mortality: CreateVector(10, 5), LevelInterest: 0.04, MaturityAge: 38}
+
+func TestNetSinglePremiums(t *testing.T) {
+	v, q := 1/1.04, 0.01
+	third := v * (q + (1 - q))
+	second := v * (q + (1-q)*third)
+	first := v * (q + (1-q)*second)
+	want := []float64{first, second, third, 1, 1}
+	got := flatBasis.NetSinglePremiums(35, 5)
+	for year := range want {
+		if math.Abs(got[year]-want[year]) > 1e-12 {
+			t.Errorf("year %d net single premium %v, want %v", year+1, got[year], want[year])
+		}
+	}
+}
+
+func TestQualifyCVAT(t *testing.T) {
+	rates := &RateSet{CorridorFactors: CreateVector(2.5, 5)}
+	rates.QualifyCVAT(flatBasis, 35)
+	if rates.ComplianceTest != TestCVAT {
+		t.Errorf("compliance test %q, want %q", rates.ComplianceTest, TestCVAT)
+	}
+	nsp := flatBasis.NetSinglePremiums(35, 5)
+	for year, factor := range rates.CorridorFactors {
+		if want := math.Max(1, 1/nsp[year]); factor != want {
+			t.Errorf("year %d corridor factor %v, want %v", year+1, factor, want)
+		}
+	}
+}
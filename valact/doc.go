@@ -0,0 +1,7 @@
+// Package valact is a universal life illustration engine.
+//
+// Rates are sourced from CSV tables (COI, per unit loads, corridor factors,
+// annuity factors) by GetRates and fed to Illustrate, which rolls the account
+// value forward monthly to maturity. Solve finds the minimum level annual
+// premium that keeps the policy in force to maturity.
+package valact
@@ -0,0 +1,113 @@
+package valact
+
+import (
+	"fmt"
+	"io"
+)
+
+// Experience is the insurer's experience on a block of policies: the
+// earned rate, the decrements, and the expenses.
+type Experience struct {
+	// EarnedRate is the annual effective rate earned on the cash flows.
+	EarnedRate float64
+	// Mortality is the experience mortality as a multiple of the current
+	// COI rates, e.g. 0.8; zero means 1.
+	Mortality float64
+	// MortalityMultiples scale Mortality by policy year, the last
+	// continuing to maturity; none means 1.
+	MortalityMultiples []float64
+	// Lapses are the annual lapse rates by policy year, applied at the end
+	// of each year, the last continuing to maturity; none means no lapses.
+	Lapses []float64
+	// ExpensePerPolicy and ExpensePerThousand are annual expenses, per
+	// policy and per $1,000 of face, incurred monthly, and ExpensePremium
+	// the expense as a share of premium. IssueExpense and
+	// IssuePerThousand are acquisition expenses at issue.
+	ExpensePerPolicy   float64
+	ExpensePerThousand float64
+	ExpensePremium     float64
+	IssueExpense       float64
+	IssuePerThousand   float64
+}
+
+// expenses are the experience expenses of the month of a policy in force
+// at its start.
+func (e Experience) expenses(i int, row LedgerRow) float64 {
+	expenses := e.ExpensePremium*row.Premium + (e.ExpensePerPolicy+e.ExpensePerThousand*row.FaceAmount/1000)/12
+	if i == 0 {
+		expenses += e.IssueExpense + e.IssuePerThousand*row.FaceAmount/1000
+	}
+	return expenses
+}
+
+// deathRate is the experience mortality of a month of the policy year.
+func (e Experience) deathRate(rates *RateSet, policyYear int) float64 {
+	mortality := e.Mortality
+	if mortality == 0 {
+		mortality = 1
+	}
+	if n := len(e.MortalityMultiples); n > 0 {
+		mortality *= e.MortalityMultiples[min(policyYear, n)-1]
+	}
+	return min(1, mortality*rates.COI[policyYear-1]/12000)
+}
+
+// lapseRate is the experience lapse rate at the end of the policy year.
+func (e Experience) lapseRate(policyYear int) float64 {
+	if len(e.Lapses) == 0 {
+		return 0
+	}
+	return e.Lapses[min(policyYear, len(e.Lapses))-1]
+}
+
+// ReadDecrements sets the experience decrements from a CSV of assumptions
+// by policy year with the column Policy_Year and either or both of
+// Lapse_Rate, the annual lapse rate, and Mortality_Multiple, the multiple
+// of the experience mortality; their values replace Lapses and
+// MortalityMultiples. A rate holds until the next year given for its
+// column, the last to maturity; the first also covers any earlier years. A
+// blank value gives no rate for the year. name is used in error messages.
+func ReadDecrements(r io.Reader, name string, experience *Experience) error {
+	t, err := newTableReader(r, name, decrementSchema)
+	if err != nil {
+		return err
+	}
+	yearField := t.field("Policy_Year")
+	fields := []field{t.field("Lapse_Rate"), t.field("Mortality_Multiple")}
+	if !t.has(fields[0]) && !t.has(fields[1]) {
+		return fmt.Errorf("%s: missing column Lapse_Rate or Mortality_Multiple", name)
+	}
+	given := []map[int]float64{{}, {}}
+	for t.next() {
+		year, err := t.int(yearField)
+		if err != nil {
+			return err
+		}
+		for i, f := range fields {
+			if t.blank(f) {
+				continue
+			}
+			if given[i][year], err = t.float(f); err != nil {
+				return err
+			}
+		}
+	}
+	if err := t.err(); err != nil {
+		return err
+	}
+	// the last year given of each column continues to maturity
+	last := func(given map[int]float64) int {
+		years := 0
+		for year := range given {
+			years = max(years, year)
+		}
+		return years
+	}
+	if t.has(fields[0]) && len(given[0]) > 0 {
+		experience.Lapses = fillYears(given[0], last(given[0]))
+	}
+	if t.has(fields[1]) && len(given[1]) > 0 {
+		experience.MortalityMultiples = fillYears(given[1], last(given[1]))
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package valact
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// LedgerColumns is the column layout written by WriteLedgerCSV. The order is
+// part of the file format consumed downstream; append new columns at the end.
+var LedgerColumns = []string{
+	"Policy_Year",
+	"Policy_Month",
+	"Month_In_Policy_Year",
+	"Value_Start",
+	"Premium",
+	"Premium_Load",
+	"Expense_Charge",
+	"COI_Charge",
+	"Interest",
+	"Value_End",
+	"Death_Benefit",
+	"NAAR",
+	"Cash_Surrender_Value",
+	"Face_Amount",
+	"Loan_Advance",
+	"Loan_Repayment",
+	"Loan_Interest",
+	"Loan_Balance",
+	"Withdrawal",
+	"Withdrawal_Charge",
+	"Surrender_Charge",
+	"Lapsed",
+	"Guideline_Limit",
+	"Guideline_Excess",
+	"Seven_Pay_Premium",
+	"MEC",
+	"Shadow_Value",
+	"Guaranteed",
+	"Flat_Extra",
+	"Term_Rider_COI",
+	"Term_Rider_Charge",
+	"WP_Charge",
+	"ADB_Charge",
+	"Chronic_Charge",
+	"Chronic_Benefit",
+	"Index_Credit",
+	"Indexed_Value",
+	"Fund_Return",
+	"Fund_Value",
+	"Cumulative_Premium",
+	"Surrender_IRR",
+	"Death_Benefit_IRR",
+	"Terminal_Reserve",
+	"Mean_Reserve",
+}
+
+// WriteLedgerCSV streams the ledger to w as CSV with a LedgerColumns header.
+func WriteLedgerCSV(w io.Writer, ledger Ledger) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(LedgerColumns); err != nil {
+		return err
+	}
+	record := make([]string, len(LedgerColumns))
+	for _, row := range ledger {
+		if err := writer.Write(row.record(record)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// AnnuityPaymentColumn is the column WriteAnnuityLedgerCSV adds after
+// LedgerColumns.
+const AnnuityPaymentColumn = "Annuity_Payment"
+
+// WriteAnnuityLedgerCSV writes the ledger like WriteLedgerCSV with an
+// AnnuityPaymentColumn after the others, holding the payment of the annuity
+// bought with the maturity value (see RateSource.Annuitize) on the last row
+// and empty on the rest.
+func WriteAnnuityLedgerCSV(w io.Writer, ledger Ledger, payment float64) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(LedgerColumns[:len(LedgerColumns):len(LedgerColumns)], AnnuityPaymentColumn)); err != nil {
+		return err
+	}
+	record := make([]string, len(LedgerColumns)+1)
+	for i, row := range ledger {
+		record = append(row.record(record), "")
+		if i == len(ledger)-1 {
+			record[len(record)-1] = formatFloat(payment)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// record formats the row into buf in LedgerColumns order.
+func (row LedgerRow) record(buf []string) []string {
+	buf = buf[:0]
+	buf = append(buf,
+		strconv.Itoa(row.PolicyYear),
+		strconv.Itoa(row.PolicyMonth),
+		strconv.Itoa(row.MonthInPolicyYear),
+		formatFloat(row.ValueStart),
+		formatFloat(row.Premium),
+		formatFloat(row.PremiumLoad),
+		formatFloat(row.ExpenseCharge),
+		formatFloat(row.COICharge),
+		formatFloat(row.Interest),
+		formatFloat(row.ValueEnd),
+		formatFloat(row.DeathBenefit),
+		formatFloat(row.NAAR),
+		formatFloat(row.CashSurrenderValue),
+		formatFloat(row.FaceAmount),
+		formatFloat(row.LoanAdvance),
+		formatFloat(row.LoanRepayment),
+		formatFloat(row.LoanInterest),
+		formatFloat(row.LoanBalance),
+		formatFloat(row.Withdrawal),
+		formatFloat(row.WithdrawalCharge),
+		formatFloat(row.SurrenderCharge),
+		strconv.FormatBool(row.Lapsed),
+		formatFloat(row.GuidelineLimit),
+		formatFloat(row.GuidelineExcess),
+		formatFloat(row.SevenPayPremium),
+		strconv.FormatBool(row.MEC),
+		formatFloat(row.ShadowValue),
+		strconv.FormatBool(row.Guaranteed),
+		formatFloat(row.FlatExtra),
+		formatFloat(row.TermRiderCOI),
+		formatFloat(row.TermRiderCharge),
+		formatFloat(row.WaiverCharge),
+		formatFloat(row.ADBCharge),
+		formatFloat(row.ChronicCharge),
+		formatFloat(row.ChronicBenefit),
+		formatFloat(row.IndexCredit),
+		formatFloat(row.IndexedValue),
+		formatFloat(row.FundReturn),
+		formatFloat(row.FundValue),
+		formatFloat(row.CumulativePremium),
+		formatFloat(row.SurrenderIRR),
+		formatFloat(row.DeathBenefitIRR),
+		formatFloat(row.TerminalReserve),
+		formatFloat(row.MeanReserve),
+	)
+	return buf
+}
+
+// formatFloat writes full precision so exported values tie to the engine.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
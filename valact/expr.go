@@ -0,0 +1,334 @@
+package valact
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled formula over named variables, for product charges
+// given as formulas rather than tables. A formula has numbers, variables,
+// + - * / and ^ (right associative), parentheses, the comparisons
+// < <= > >= == != (1 when true, else 0), and the functions
+//
+//	min(a, b, ...)  max(a, b, ...)  abs(a)  floor(a)  ceil(a)  round(a)
+//	if(condition, then, else)
+//
+// e.g. "if(duration <= 10, 0.5 - 0.02 * (duration - 1), 0.3) * min(band, 3)".
+type Expr struct {
+	source string
+	eval   exprNode
+}
+
+// exprNode evaluates a formula part with the variables' values in the
+// order of their names.
+type exprNode func(values []float64) float64
+
+// ParseExpr compiles the formula over the variables of the names.
+func ParseExpr(source string, names ...string) (*Expr, error) {
+	p := &exprParser{source: source, names: names}
+	p.next()
+	node, err := p.comparison()
+	if err == nil && p.token != "" {
+		err = p.errorf("unexpected %q", p.token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("formula %q: %w", source, err)
+	}
+	return &Expr{source: source, eval: node}, nil
+}
+
+// Eval returns the formula's value with the values of the variables, in
+// the order of the names it was parsed with.
+func (e *Expr) Eval(values ...float64) float64 {
+	return e.eval(values)
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+// exprParser parses a formula by recursive descent, a token at a time.
+type exprParser struct {
+	source string
+	names  []string
+	pos    int
+	// token is the current token, "" at the end
+	token    string
+	tokenPos int
+}
+
+// next moves to the next token: a number, a name, a two character
+// comparison, or a single character.
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && (p.source[p.pos] == ' ' || p.source[p.pos] == '\t') {
+		p.pos++
+	}
+	p.tokenPos = p.pos
+	if p.pos == len(p.source) {
+		p.token = ""
+		return
+	}
+	start := p.pos
+	c := rune(p.source[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.source) && (unicode.IsDigit(rune(p.source[p.pos])) || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		// an exponent, as in 1e-3
+		if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.source) && unicode.IsDigit(rune(p.source[p.pos])) {
+				p.pos++
+			}
+		}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.source) && (unicode.IsLetter(rune(p.source[p.pos])) || unicode.IsDigit(rune(p.source[p.pos])) || p.source[p.pos] == '_') {
+			p.pos++
+		}
+	case strings.HasPrefix(p.source[p.pos:], "<=") || strings.HasPrefix(p.source[p.pos:], ">=") ||
+		strings.HasPrefix(p.source[p.pos:], "==") || strings.HasPrefix(p.source[p.pos:], "!="):
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	p.token = p.source[start:p.pos]
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.tokenPos+1, fmt.Sprintf(format, args...))
+}
+
+// expect consumes the token, failing when it is not the current one.
+func (p *exprParser) expect(token string) error {
+	if p.token != token {
+		if p.token == "" {
+			return p.errorf("expected %q at the end", token)
+		}
+		return p.errorf("expected %q, found %q", token, p.token)
+	}
+	p.next()
+	return nil
+}
+
+// comparison is a sum, or two compared.
+func (p *exprParser) comparison() (exprNode, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	compare := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+	}[p.token]
+	if compare == nil {
+		return left, nil
+	}
+	p.next()
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return func(v []float64) float64 {
+		if compare(left(v), right(v)) {
+			return 1
+		}
+		return 0
+	}, nil
+}
+
+// sum is terms added and subtracted.
+func (p *exprParser) sum() (exprNode, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "+" || p.token == "-" {
+		op := p.token
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		a := left
+		if op == "+" {
+			left = func(v []float64) float64 { return a(v) + right(v) }
+		} else {
+			left = func(v []float64) float64 { return a(v) - right(v) }
+		}
+	}
+	return left, nil
+}
+
+// term is factors multiplied and divided.
+func (p *exprParser) term() (exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "*" || p.token == "/" {
+		op := p.token
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		a := left
+		if op == "*" {
+			left = func(v []float64) float64 { return a(v) * right(v) }
+		} else {
+			left = func(v []float64) float64 { return a(v) / right(v) }
+		}
+	}
+	return left, nil
+}
+
+// unary is a power, possibly negated.
+func (p *exprParser) unary() (exprNode, error) {
+	if p.token == "-" || p.token == "+" {
+		negate := p.token == "-"
+		p.next()
+		operand, err := p.unary()
+		if err != nil || !negate {
+			return operand, err
+		}
+		return func(v []float64) float64 { return -operand(v) }, nil
+	}
+	return p.power()
+}
+
+// power is an operand, possibly raised to a power; -2^2 is -4 and 2^3^2
+// is 2^9.
+func (p *exprParser) power() (exprNode, error) {
+	base, err := p.operand()
+	if err != nil || p.token != "^" {
+		return base, err
+	}
+	p.next()
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(v []float64) float64 { return math.Pow(base(v), exponent(v)) }, nil
+}
+
+// operand is a number, a variable, a function call, or a parenthesized
+// formula.
+func (p *exprParser) operand() (exprNode, error) {
+	token := p.token
+	switch {
+	case token == "":
+		return nil, p.errorf("unexpected end of formula")
+	case token == "(":
+		p.next()
+		node, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		number, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", token)
+		}
+		p.next()
+		return func([]float64) float64 { return number }, nil
+	case unicode.IsLetter(rune(token[0])) || token[0] == '_':
+		namePos := p.tokenPos
+		p.next()
+		if p.token == "(" {
+			return p.call(token, namePos)
+		}
+		for i, name := range p.names {
+			if name == token {
+				return func(v []float64) float64 { return v[i] }, nil
+			}
+		}
+		p.tokenPos = namePos
+		return nil, p.errorf("unknown variable %q (have %s)", token, strings.Join(p.names, ", "))
+	}
+	return nil, p.errorf("unexpected %q", token)
+}
+
+// call is the call of the named function at namePos, at its opening
+// parenthesis.
+func (p *exprParser) call(name string, namePos int) (exprNode, error) {
+	p.next()
+	var args []exprNode
+	for p.token != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	// arity checks the number of arguments, n or more when variadic
+	arity := func(n int, variadic bool) error {
+		if len(args) == n || variadic && len(args) > n {
+			return nil
+		}
+		p.tokenPos = namePos
+		if variadic {
+			return p.errorf("%s takes %d or more arguments, found %d", name, n, len(args))
+		}
+		return p.errorf("%s takes %d arguments, found %d", name, n, len(args))
+	}
+	unary := map[string]func(float64) float64{
+		"abs":   math.Abs,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+	}
+	switch {
+	case unary[name] != nil:
+		if err := arity(1, false); err != nil {
+			return nil, err
+		}
+		f, a := unary[name], args[0]
+		return func(v []float64) float64 { return f(a(v)) }, nil
+	case name == "min" || name == "max":
+		if err := arity(1, true); err != nil {
+			return nil, err
+		}
+		pick := math.Min
+		if name == "max" {
+			pick = math.Max
+		}
+		return func(v []float64) float64 {
+			result := args[0](v)
+			for _, arg := range args[1:] {
+				result = pick(result, arg(v))
+			}
+			return result
+		}, nil
+	case name == "if":
+		if err := arity(3, false); err != nil {
+			return nil, err
+		}
+		condition, then, otherwise := args[0], args[1], args[2]
+		return func(v []float64) float64 {
+			if condition(v) != 0 {
+				return then(v)
+			}
+			return otherwise(v)
+		}, nil
+	}
+	p.tokenPos = namePos
+	return nil, p.errorf("unknown function %q", name)
+}
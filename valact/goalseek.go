@@ -0,0 +1,518 @@
+package valact
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+)
+
+// ErrNoSolution is returned when a goal seek cannot bracket a value of the
+// decision variable that meets its target.
+var ErrNoSolution = errors.New("no solution found")
+
+// VariableKind is the policy input a goal seek adjusts.
+type VariableKind int
+
+const (
+	// VaryPremium solves for the level annual premium (the smallest that
+	// meets the target).
+	VaryPremium VariableKind = iota
+	// VaryFace solves for the face amount (the largest that meets the
+	// target).
+	VaryFace
+	// VaryWithdrawal solves for a level annual withdrawal paid from FromYear
+	// through ToYear (the largest that meets the target).
+	VaryWithdrawal
+	// VarySinglePremium solves for a single premium paid at issue with no
+	// later premiums (the smallest that meets the target).
+	VarySinglePremium
+	// VaryCatchUp solves for a level annual premium paid in addition to
+	// the policy's premiums, first in the first month projected (the month
+	// after the valuation date of an inforce policy) and then at the start
+	// of each later policy year through ToYear, or to maturity when zero
+	// (the smallest that meets the target).
+	VaryCatchUp
+)
+
+// Variable is the decision variable of a goal seek.
+type Variable struct {
+	Kind VariableKind
+	// FromYear and ToYear bound the policy years of VaryWithdrawal; ToYear
+	// also bounds those of VaryCatchUp.
+	FromYear int
+	ToYear   int
+}
+
+// Apply returns the policy with the variable set to value; the rates give
+// the maturity of a VaryCatchUp without ToYear.
+func (v Variable) Apply(policy Policy, rates *RateSet, value float64) Policy {
+	switch v.Kind {
+	case VaryPremium:
+		policy.AnnualPremium = value
+	case VaryFace:
+		policy.FaceAmount = value
+	case VarySinglePremium:
+		policy.AnnualPremium = 0
+		policy.PremiumSchedule = []float64{value}
+	case VaryWithdrawal:
+		withdrawals := make([]ScheduledAmount, len(policy.Withdrawals), len(policy.Withdrawals)+v.ToYear-v.FromYear+1)
+		copy(withdrawals, policy.Withdrawals)
+		for year := v.FromYear; year <= v.ToYear; year++ {
+			withdrawals = append(withdrawals, ScheduledAmount{PolicyYear: year, Amount: value})
+		}
+		policy.Withdrawals = withdrawals
+	case VaryCatchUp:
+		start := policy.startMonth()
+		last := v.ToYear
+		if last == 0 {
+			last = rates.maturityAge() - policy.IssueAge
+		}
+		deposits := append(slices.Clone(policy.Deposits), Deposit{PolicyMonth: start, Amount: value})
+		for year := (start-1)/12 + 2; year <= last; year++ {
+			deposits = append(deposits, Deposit{PolicyMonth: 12*(year-1) + 1, Amount: value})
+		}
+		policy.Deposits = deposits
+	}
+	return policy
+}
+
+// increasing reports whether larger values of the variable help meet a
+// target.
+func (v Variable) increasing() bool {
+	return v.Kind == VaryPremium || v.Kind == VarySinglePremium || v.Kind == VaryCatchUp
+}
+
+// step is the default rounding increment of the solved value: cents for
+// money flows, dollars for face amounts.
+func (v Variable) step() float64 {
+	if v.Kind == VaryFace {
+		return 1.0
+	}
+	return 0.01
+}
+
+// initialGuess is the first upper bracket tried.
+func (v Variable) initialGuess(policy Policy) float64 {
+	switch v.Kind {
+	case VaryPremium, VaryCatchUp:
+		return policy.FaceAmount / 100.0
+	case VarySinglePremium:
+		return policy.FaceAmount / 10.0
+	case VaryFace:
+		return max(1000.0, policy.AnnualPremium*100.0)
+	}
+	return 1000.0
+}
+
+// Metric is the projected quantity a goal seek targets.
+type Metric int
+
+const (
+	// MetricMaturityValue is the value net of loans at maturity.
+	MetricMaturityValue Metric = iota
+	// MetricAccountValue is the account value at the end of the target
+	// policy year.
+	MetricAccountValue
+	// MetricCashValue is the cash surrender value at the end of the target
+	// policy year.
+	MetricCashValue
+	// MetricSevenPayMargin is the least margin of the 7-pay limit over
+	// premiums paid; it stays above a zero Value while the policy is not a
+	// MEC. Lapse does not fail it, and larger premiums work against it, so
+	// solving premium for it finds the maximum non-MEC premium.
+	MetricSevenPayMargin
+	// MetricShadowValue is the lowest no-lapse guarantee shadow account
+	// value net of loans through the target policy year; solving premium
+	// for it above zero finds the minimum premium holding the guarantee to
+	// that duration.
+	MetricShadowValue
+	// MetricEndowment is the value net of loans at maturity less the face
+	// amount then; solving premium for it above zero finds the minimum
+	// premium to endow the policy.
+	MetricEndowment
+)
+
+// limit reports whether the metric falls as premiums rise, reversing the
+// direction in which a variable helps meet it.
+func (m Metric) limit() bool {
+	return m == MetricSevenPayMargin
+}
+
+// Target is met when the policy is in force through the target duration
+// and the metric exceeds Value.
+type Target struct {
+	Metric Metric
+	// PolicyYear is the target year for year-based metrics.
+	PolicyYear int
+	// AttainedAge, when set, overrides PolicyYear with the policy year
+	// ending at that attained age.
+	AttainedAge int
+	Value       float64
+}
+
+// year returns the target policy year for the policy.
+func (t Target) year(policy Policy) int {
+	if t.AttainedAge > 0 {
+		return t.AttainedAge - policy.IssueAge
+	}
+	return t.PolicyYear
+}
+
+// met reports whether the projected policy meets the target.
+func (t Target) met(policy Policy, rates *RateSet) bool {
+	lapsed, excess := t.evaluate(policy, rates)
+	return !lapsed && excess > 0
+}
+
+// margin is a continuous stand-in for met used by Brent's method. A lapse
+// makes the metric jump, so the margin projects as if the policy never
+// lapsed and returns how far that metric exceeds Value; a shortfall then
+// compounds smoothly instead of stopping the projection.
+func (t Target) margin(policy Policy, rates *RateSet) float64 {
+	inforce := *rates
+	inforce.GracePeriodMonths = math.MaxInt
+	_, excess := t.evaluate(policy, &inforce)
+	return excess
+}
+
+// evaluate projects the policy and returns whether it lapsed before the
+// target duration and how far the metric exceeds Value.
+func (t Target) evaluate(policy Policy, rates *RateSet) (bool, float64) {
+	switch t.Metric {
+	case MetricMaturityValue:
+		outcome := IllustrateOutcome(policy, rates)
+		return outcome.Lapsed(), outcome.Value - t.Value
+	case MetricSevenPayMargin:
+		return false, IllustrateOutcome(policy, rates).SevenPayMargin - t.Value
+	}
+	year := t.year(policy)
+	monthly := getLedger()
+	defer putLedger(monthly)
+	project(policy, rates, monthly)
+	if t.Metric == MetricEndowment {
+		ledger := *monthly
+		if len(ledger) == 0 || ledger[len(ledger)-1].Lapsed {
+			return true, math.Inf(-1)
+		}
+		last := ledger[len(ledger)-1]
+		return false, last.ValueEnd - last.LoanBalance - last.FaceAmount - t.Value
+	}
+	if t.Metric == MetricShadowValue {
+		ledger := *monthly
+		if year < 1 || len(ledger) == 0 || ledger[len(ledger)-1].PolicyYear < year {
+			return true, math.Inf(-1)
+		}
+		lowest := math.Inf(1)
+		for _, row := range ledger {
+			if row.PolicyYear > year {
+				break
+			}
+			lowest = min(lowest, row.ShadowValue-row.LoanBalance)
+		}
+		return false, lowest - t.Value
+	}
+	buffer := getLedger()
+	defer putLedger(buffer)
+	annual := monthly.appendAnnual(*buffer)
+	*buffer = annual
+	if len(annual) == 0 {
+		return true, math.Inf(-1)
+	}
+	// an inforce ledger starts in the policy year of the valuation date
+	first := annual[0].PolicyYear
+	if year < first || year-first >= len(annual) || annual[year-first].Lapsed {
+		return true, math.Inf(-1)
+	}
+	row := annual[year-first]
+	if t.Metric == MetricCashValue {
+		return false, row.CashSurrenderValue - t.Value
+	}
+	return false, row.ValueEnd - t.Value
+}
+
+// SolveMethod selects the root finder used once a solution is bracketed.
+type SolveMethod int
+
+const (
+	// MethodBisection halves the bracket until it is within tolerance.
+	MethodBisection SolveMethod = iota
+	// MethodBrent uses Brent's method (secant and inverse quadratic
+	// interpolation steps with a bisection fallback). It needs about half
+	// the projections of bisection when the metric moves smoothly with the
+	// variable, but gains nothing where the solution sits on a lapse
+	// boundary, as minimum premiums to maturity usually do.
+	MethodBrent
+)
+
+// Rounding selects how a converged solution is rounded to the increment.
+type Rounding int
+
+const (
+	// RoundSufficient rounds to the increment and, if the rounded value
+	// misses the target, moves it one increment toward meeting it.
+	RoundSufficient Rounding = iota
+	// RoundNearest rounds to the nearest increment, which may fall just
+	// short of the target.
+	RoundNearest
+	// RoundConservative rounds the sufficient end of the converged bracket
+	// away from the solution (up for premiums, down for faces and
+	// withdrawals), so the result always meets the target.
+	RoundConservative
+)
+
+// SolveOptions control how a goal seek converges and rounds its solution.
+// The zero value bisects to half a cent (half a dollar for face amounts)
+// and rounds to sufficiency.
+type SolveOptions struct {
+	Method SolveMethod
+	// Tolerance is the bracket width at which the search stops; zero uses
+	// half the increment.
+	Tolerance float64
+	// Increment is the rounding increment of the solution; zero uses the
+	// variable's default, cents for money flows and dollars for faces.
+	Increment float64
+	Rounding  Rounding
+	// WarmStart, in batch, support, profit, and projection runs, starts
+	// each premium solve from the trend of the run's last two solutions for
+	// the same target, per dollar of face, which for a grid of neighboring
+	// cells brackets the solution in a few projections. Solutions may
+	// differ from those of a cold start within the tolerance.
+	WarmStart bool
+	// warm holds the last solutions of a run with WarmStart.
+	warm *warmStart
+}
+
+// GoalSeek finds the value of a decision variable at which a projected
+// metric reaches its target, by bracketing and then bisection or Brent's
+// method.
+type GoalSeek struct {
+	Variable Variable
+	Target   Target
+	SolveOptions
+	// guess, when positive, is a value near the solution, e.g. a related
+	// solve's, tried first in place of the variable's initial guess.
+	guess float64
+}
+
+// maxBracket bounds the bracketing search before giving up.
+const maxBracket = 1e12
+
+// Solve returns the solved value of the decision variable, rounded to the
+// increment as the options direct.
+func (g GoalSeek) Solve(policy Policy, rates *RateSet) (float64, error) {
+	return g.SolveContext(context.Background(), policy, rates)
+}
+
+// SolveContext is Solve, stopping with the context's error when the
+// context is done before the solve converges.
+func (g GoalSeek) SolveContext(ctx context.Context, policy Policy, rates *RateSet) (float64, error) {
+	value, _, err := g.seek(ctx, policy, rates)
+	return value, err
+}
+
+// seek implements SolveContext and also returns the number of projections
+// run. A premium solve of a warm started run starts from its last solution
+// for the target, when it has no guess of its own, and records its own.
+func (g GoalSeek) seek(ctx context.Context, policy Policy, rates *RateSet) (float64, int, error) {
+	warm := g.warm != nil && g.Variable.Kind == VaryPremium
+	if warm && g.guess <= 0 {
+		g.guess = g.warm.guess(g.Target, policy)
+	}
+	value, calls, err := g.search(ctx, policy, rates)
+	if warm && err == nil {
+		g.warm.record(g.Target, policy, value)
+	}
+	return value, calls, err
+}
+
+// search brackets and converges on the solution for seek.
+func (g GoalSeek) search(ctx context.Context, policy Policy, rates *RateSet) (float64, int, error) {
+	calls := 0
+	met := func(value float64) bool {
+		calls++
+		return g.Target.met(g.Variable.Apply(policy, rates, value), rates)
+	}
+	margin := func(value float64) float64 {
+		calls++
+		return g.Target.margin(g.Variable.Apply(policy, rates, value), rates)
+	}
+	// an increasing variable meets the target above the solution, a
+	// decreasing one below it
+	increasing := g.Variable.increasing() != g.Target.Metric.limit()
+	step := g.Increment
+	if step <= 0 {
+		step = g.Variable.step()
+	}
+	tolerance := g.Tolerance
+	if tolerance <= 0 {
+		tolerance = step / 2
+	}
+
+	guessLo := 0.0
+	guessHi := g.Variable.initialGuess(policy)
+	bracketed := false
+	// from a guess the bracket widens out from it, a tenth of a percent of
+	// it at first and doubling each time the solution lies beyond
+	width := 0.0
+	if g.guess > 0 {
+		width = g.guess / 1000
+		if met(g.guess) == increasing {
+			guessHi, bracketed = g.guess, true
+			for guessLo = max(0, guessHi-width); guessLo > 0 && met(guessLo) == increasing; guessLo = max(0, guessHi-width) {
+				guessHi = guessLo
+				width *= 2
+			}
+		} else {
+			guessLo, guessHi = g.guess, g.guess+width
+		}
+	}
+	if !increasing && guessLo == 0 && !met(guessLo) {
+		return 0, calls, ErrNoSolution
+	}
+	for !bracketed && met(guessHi) != increasing {
+		if err := ctx.Err(); err != nil {
+			return 0, calls, err
+		}
+		guessLo = guessHi
+		if width > 0 {
+			width *= 2
+			guessHi += width
+		} else {
+			guessHi *= 2
+		}
+		if guessHi > maxBracket {
+			return 0, calls, ErrNoSolution
+		}
+	}
+
+	if g.Method == MethodBrent {
+		// margin only stands in for met, so Brent narrows the bracket to
+		// a step either side of its root and bisection settles the rest
+		root := brent(margin, guessLo, guessHi, margin(guessLo), margin(guessHi), tolerance/5)
+		lo, hi := max(guessLo, root-step), min(guessHi, root+step)
+		switch {
+		case met(lo) == increasing:
+			guessHi = lo
+		case met(hi) != increasing:
+			guessLo = hi
+		default:
+			guessLo, guessHi = lo, hi
+		}
+	}
+
+	guessMd := guessHi
+	for (guessHi - guessLo) > tolerance {
+		if err := ctx.Err(); err != nil {
+			return 0, calls, err
+		}
+		guessMd = (guessLo + guessHi) / 2.0
+		if met(guessMd) == increasing {
+			guessHi = guessMd
+		} else {
+			guessLo = guessMd
+		}
+	}
+
+	switch {
+	case g.Rounding == RoundNearest:
+		return roundTo(guessMd, step, math.Round), calls, nil
+	case g.Rounding == RoundConservative && increasing:
+		return roundTo(guessHi, step, math.Ceil), calls, nil
+	case g.Rounding == RoundConservative:
+		return roundTo(guessLo, step, math.Floor), calls, nil
+	}
+	result := roundTo(guessMd, step, math.Round)
+	if met(result) {
+		return result, calls, nil
+	}
+	if increasing {
+		return roundTo(result+step, step, math.Round), calls, nil
+	}
+	return max(0, roundTo(result-step, step, math.Round)), calls, nil
+}
+
+// roundTo rounds value to a multiple of increment using round. Increments
+// that divide one are applied by division so that cents come out as the
+// nearest float64 to a whole number of cents.
+func roundTo(value, increment float64, round func(float64) float64) float64 {
+	if perUnit := 1 / increment; perUnit == math.Round(perUnit) {
+		return round(value*perUnit) / perUnit
+	}
+	return round(value/increment) * increment
+}
+
+// brentMaxIterations bounds Brent's method; it converges far sooner on any
+// bracket the goal seek produces.
+const brentMaxIterations = 100
+
+// epsilon is the float64 machine epsilon.
+const epsilon = 0x1p-52
+
+// brent finds a root of f in [a, b], where fa and fb have opposite signs (or
+// one is zero), to within tol using Brent's method.
+func brent(f func(float64) float64, a, b, fa, fb, tol float64) float64 {
+	if fa == 0 {
+		return a
+	}
+	if fb == 0 {
+		return b
+	}
+	c, fc := a, fa
+	d := b - a
+	e := d
+	for range brentMaxIterations {
+		if (fb > 0) == (fc > 0) {
+			c, fc = a, fa
+			d = b - a
+			e = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+		tol1 := 2*epsilon*math.Abs(b) + 0.5*tol
+		xm := 0.5 * (c - b)
+		if math.Abs(xm) <= tol1 || fb == 0 {
+			return b
+		}
+		if math.Abs(e) >= tol1 && math.Abs(fa) > math.Abs(fb) {
+			// attempt interpolation: secant when only two points are
+			// distinct, inverse quadratic otherwise
+			s := fb / fa
+			var p, q float64
+			if a == c {
+				p = 2 * xm * s
+				q = 1 - s
+			} else {
+				q = fa / fc
+				r := fb / fc
+				p = s * (2*xm*q*(q-r) - (b-a)*(r-1))
+				q = (q - 1) * (r - 1) * (s - 1)
+			}
+			if p > 0 {
+				q = -q
+			}
+			p = math.Abs(p)
+			if 2*p < min(3*xm*q-math.Abs(tol1*q), math.Abs(e*q)) {
+				e = d
+				d = p / q
+			} else {
+				// interpolation failed, fall back to bisection
+				d = xm
+				e = d
+			}
+		} else {
+			d = xm
+			e = d
+		}
+		a, fa = b, fb
+		if math.Abs(d) > tol1 {
+			b += d
+		} else {
+			b += math.Copysign(tol1, xm)
+		}
+		fb = f(b)
+	}
+	return b
+}
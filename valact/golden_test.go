@@ -0,0 +1,156 @@
+package valact
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden ledgers from the current code, after a change
+// meant to move them:
+//
+//	go test ./valact -run TestGoldenLedgers -update
+var update = flag.Bool("update", false, "rewrite the golden ledgers in testdata/golden")
+
+// sampleTables are the sample rate tables: the repository's tables cut to
+// the issue ages of the golden cells.
+//
+//go:embed testdata/tables
+var sampleTables embed.FS
+
+// goldenTolerance allows for floating point differences between platforms,
+// e.g. fused multiply-adds, and nothing more.
+var goldenTolerance = CompareTolerance{Absolute: 1e-6, Relative: 1e-9}
+
+// goldenCell is a representative policy illustrated on the sample tables
+// and compared with its ledger in testdata/golden/<name>.csv.
+type goldenCell struct {
+	name   string
+	policy Policy
+	// prepare, when set, adjusts the policy or its rates before the
+	// illustration.
+	prepare func(t *testing.T, source RateSource, policy *Policy, rates *RateSet)
+	// annual compares policy year totals instead of months.
+	annual bool
+}
+
+var goldenCells = []goldenCell{
+	{
+		name:   "base",
+		policy: Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 1255.03},
+	},
+	{
+		name:   "base_annual",
+		policy: Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 1255.03},
+		annual: true,
+	},
+	{
+		name: "smoker_option_b_monthly",
+		policy: Policy{IssueAge: 60, Gender: "F", RiskClass: "SM", FaceAmount: 250000, AnnualPremium: 8000,
+			PremiumMode: ModeMonthly, DBOption: DBOptionB, State: "NY"},
+	},
+	{
+		name: "rated_flat_extra",
+		policy: Policy{IssueAge: 45, Gender: "M", RiskClass: "NS", FaceAmount: 500000, AnnualPremium: 9000,
+			TableRating: 1.5, FlatExtras: []FlatExtra{{Rate: 5, Years: 5}}},
+	},
+	{
+		name: "riders",
+		policy: Policy{IssueAge: 45, Gender: "F", RiskClass: "NS", FaceAmount: 250000, AnnualPremium: 5000,
+			TermRider: &TermRider{FaceAmount: 50000}, Waiver: &WaiverRider{}, ADB: &ADBRider{FaceAmount: 25000},
+			Chronic: &ChronicRider{BenefitRate: 0.02}},
+	},
+	{
+		name: "loans_withdrawals",
+		policy: Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 250000, AnnualPremium: 6000,
+			Loans:          []ScheduledAmount{{PolicyYear: 20, Amount: 20000}},
+			LoanRepayments: []ScheduledAmount{{PolicyYear: 25, Amount: 5000}},
+			Withdrawals:    []ScheduledAmount{{PolicyYear: 30, Amount: 10000}}},
+	},
+	{
+		name:   "lapse",
+		policy: Policy{IssueAge: 70, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 3000},
+	},
+	{
+		name:   "mec",
+		policy: Policy{IssueAge: 35, Gender: "F", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 5000},
+		prepare: func(t *testing.T, source RateSource, policy *Policy, rates *RateSet) {
+			basis, err := source.GetGuidelineBasis(policy.Gender, policy.RiskClass, policy.IssueAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rates.ApplySevenPayTest(basis, policy.IssueAge)
+		},
+	},
+	{
+		name:   "solved_premium",
+		policy: Policy{IssueAge: 60, Gender: "M", RiskClass: "SM", FaceAmount: 100000, DBOption: DBOptionB},
+		prepare: func(t *testing.T, source RateSource, policy *Policy, rates *RateSet) {
+			premium, err := Solve(*policy, rates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy.AnnualPremium = premium
+		},
+	},
+}
+
+// TestGoldenLedgers illustrates the golden cells on the sample tables and
+// compares each full ledger with its golden file.
+func TestGoldenLedgers(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	for _, cell := range goldenCells {
+		t.Run(cell.name, func(t *testing.T) {
+			policy := cell.policy
+			rates, err := source.PolicyRates(policy, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cell.prepare != nil {
+				cell.prepare(t, source, &policy, rates)
+			}
+			ledger := IllustrateLedger(policy, rates)
+			if cell.annual {
+				ledger = ledger.Annual()
+			}
+			var got bytes.Buffer
+			if err := WriteLedgerCSV(&got, ledger); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", "golden", cell.name+".csv")
+			if *update {
+				if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to write it)", err)
+			}
+			defer want.Close()
+			comparison, err := CompareLedgerCSV(want, path, &got, "illustration", goldenTolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !comparison.Differs() && len(comparison.MissingColumns) == 0 {
+				return
+			}
+			var summary strings.Builder
+			comparison.WriteSummary(&summary)
+			for i, diff := range comparison.Diffs {
+				if i == 10 {
+					summary.WriteString("...\n")
+					break
+				}
+				summary.WriteString(diff.Column + " at " + comparison.Key + " " + diff.Row + ": " + diff.Expected + ", got " + diff.Actual + "\n")
+			}
+			t.Errorf("ledger differs from %s:\n%s", path, summary.String())
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package valact
+
+import "fmt"
+
+// GuidelineBasis holds the IRC 7702 assumptions for the guideline premiums
+// and the CVAT net single premiums.
+type GuidelineBasis struct {
+	// Mortality is the annual rate per $1,000 by policy year, no greater
+	// than the prescribed (CSO) table.
+	Mortality []float64
+	// SingleInterest and LevelInterest are the annual effective rates for
+	// the guideline single and level premiums (statutory minimums of 6% and
+	// 4%). CVAT net single premiums use LevelInterest.
+	SingleInterest float64
+	LevelInterest  float64
+	// MaturityAge is the deemed maturity age at which the premiums must
+	// endow the face amount.
+	MaturityAge int
+}
+
+// GetGuidelineBasis returns the 7702 basis for the insured: the guaranteed
+// COI rates as mortality, 6% and 4% interest, and deemed maturity at 100.
+func (s RateSource) GetGuidelineBasis(gender string, riskClass string, issueAge int) (*GuidelineBasis, error) {
+	mortality, err := s.GetGuaranteedCOIRates(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return &GuidelineBasis{
+		Mortality:      mortality,
+		SingleInterest: 0.06,
+		LevelInterest:  0.04,
+		MaturityAge:    100,
+	}, nil
+}
+
+// GuidelinePremiums are the guideline single and level annual premiums.
+type GuidelinePremiums struct {
+	Single float64 `json:"single"`
+	Level  float64 `json:"level"`
+}
+
+// Limit is the guideline premium limitation in a policy year: the greater
+// of the single premium and the level premiums to date.
+func (g GuidelinePremiums) Limit(policyYear int) float64 {
+	return max(g.Single, g.Level*float64(policyYear))
+}
+
+// GuidelineLimit applies the guideline premium test to a projection.
+type GuidelineLimit struct {
+	GuidelinePremiums
+	// Cap refuses premium above the limit; otherwise it is paid and only
+	// reported as guideline excess.
+	Cap bool `json:"cap,omitempty"`
+}
+
+// ComputeGuidelinePremiums returns the guideline premiums for the policy's
+// face amount: the single premium at issue and the level annual premium
+// that endow the face at the basis maturity age, projected with the
+// policy's expense charges and substandard ratings and the basis mortality
+// and interest. Death benefits are taken as level (Option A) as 7702
+// requires.
+func ComputeGuidelinePremiums(policy Policy, rates *RateSet, basis *GuidelineBasis) (GuidelinePremiums, error) {
+	var premiums GuidelinePremiums
+	if policy.IssueAge >= basis.MaturityAge {
+		return premiums, fmt.Errorf("issue age %d is not before the guideline maturity age %d", policy.IssueAge, basis.MaturityAge)
+	}
+	insured := Policy{
+		IssueAge:    policy.IssueAge,
+		Gender:      policy.Gender,
+		RiskClass:   policy.RiskClass,
+		FaceAmount:  policy.FaceAmount,
+		DBOption:    DBOptionA,
+		TableRating: policy.TableRating,
+		FlatExtras:  policy.FlatExtras,
+	}
+	target := Target{Metric: MetricAccountValue, AttainedAge: basis.MaturityAge, Value: policy.FaceAmount}
+	guideline := *rates
+	guideline.COI = basis.Mortality
+	guideline.COIBands = nil
+	guideline.ModalFactors.Annual = 1
+	guideline.MonthlyInterest = nil
+	guideline.GuaranteedCOI = nil
+	years := len(guideline.Interest)
+	guideline.MinimumInterest = make([]float64, years)
+	guideline.InterestBonus = make([]float64, years)
+
+	var err error
+	guideline.Interest = CreateVector(MonthlyRate(basis.SingleInterest), years)
+	single := GoalSeek{Variable: Variable{Kind: VarySinglePremium}, Target: target, SolveOptions: SolveOptions{Method: MethodBrent}}
+	if premiums.Single, err = single.Solve(insured, &guideline); err != nil {
+		return premiums, fmt.Errorf("guideline single premium: %w", err)
+	}
+	guideline.Interest = CreateVector(MonthlyRate(basis.LevelInterest), years)
+	level := GoalSeek{Variable: Variable{Kind: VaryPremium}, Target: target, SolveOptions: SolveOptions{Method: MethodBrent}}
+	if premiums.Level, err = level.Solve(insured, &guideline); err != nil {
+		return premiums, fmt.Errorf("guideline level premium: %w", err)
+	}
+	return premiums, nil
+}
@@ -0,0 +1,77 @@
+package valact
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGuidelinePremiums(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000}
+	rates := sampleRates(t, policy)
+	basis, err := source.GetGuidelineBasis(policy.Gender, policy.RiskClass, policy.IssueAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	premiums, err := ComputeGuidelinePremiums(policy, rates, basis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if premiums.Level <= 0 || premiums.Single <= premiums.Level || premiums.Single >= policy.FaceAmount {
+		t.Fatalf("guideline premiums %+v, want 0 < level < single < face", premiums)
+	}
+	if limit := premiums.Limit(1); limit != premiums.Single {
+		t.Errorf("year 1 limit %v, want the single premium %v", limit, premiums.Single)
+	}
+	if limit := premiums.Limit(60); limit != 60*premiums.Level {
+		t.Errorf("year 60 limit %v, want 60 level premiums %v", limit, 60*premiums.Level)
+	}
+
+	// premium over the limit is reported, and refused under a cap
+	policy.AnnualPremium = 2 * premiums.Single
+	policy.Guideline = &GuidelineLimit{GuidelinePremiums: premiums}
+	row := IllustrateLedger(policy, rates)[0]
+	if excess := policy.AnnualPremium - premiums.Single; math.Abs(row.GuidelineExcess-excess) > 1e-9 || row.Premium != policy.AnnualPremium {
+		t.Errorf("premium %v with excess %v, want %v paid with excess %v", row.Premium, row.GuidelineExcess, policy.AnnualPremium, excess)
+	}
+	if year := NewResult(policy, rates).GuidelineExcessYear; year != 1 {
+		t.Errorf("guideline excess year %d, want 1", year)
+	}
+	policy.Guideline.Cap = true
+	if row := IllustrateLedger(policy, rates)[0]; math.Abs(row.Premium-premiums.Single) > 1e-9 {
+		t.Errorf("capped premium %v, want the single premium %v", row.Premium, premiums.Single)
+	}
+
+	policy.IssueAge = basis.MaturityAge
+	if _, err := ComputeGuidelinePremiums(policy, rates, basis); err == nil {
+		t.Error("issue at the guideline maturity age computed premiums")
+	}
+}
+
+// TestGuidelinePremiumsBanded checks that banded current COI rates do not
+// replace the basis mortality of the guideline premiums.
+func TestGuidelinePremiumsBanded(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000}
+	rates := sampleRates(t, policy)
+	basis, err := source.GetGuidelineBasis(policy.Gender, policy.RiskClass, policy.IssueAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ComputeGuidelinePremiums(policy, rates, basis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	banded := *rates
+	banded.COIBands = []RateBand{
+		{MinFace: 0, Rates: CreateVector(50, len(rates.COI))},
+		{MinFace: 50000, Rates: CreateVector(40, len(rates.COI))},
+	}
+	got, err := ComputeGuidelinePremiums(policy, &banded, basis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("guideline premiums %+v on banded rates, want %+v on the basis mortality", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+package valact
+
+// ChargeCalculator computes a policy's premium load and expense charges
+// each month, for products whose charges the rate vectors cannot express,
+// such as tiered loads or asset-based charges. Set it as RateSet.Charges;
+// DefaultCharges is the behavior without one.
+type ChargeCalculator interface {
+	// PremiumLoad is the load on the month's premium.
+	PremiumLoad(m *Month) float64
+	// ExpenseCharge is the monthly policy fee and per unit charge for a
+	// full month; the projection prorates stub periods.
+	ExpenseCharge(m *Month) float64
+}
+
+// InterestCrediting computes the interest credited each month. Set it as
+// RateSet.Crediting; DefaultCrediting is the behavior without one.
+type InterestCrediting interface {
+	// Interest is the interest credited on the fixed account and loan
+	// collateral for the month, or the Fraction of it.
+	Interest(m *Month) float64
+}
+
+// Month is the state of a projection passed to the hooks. Value is the
+// account value as the hook's step applies: before the premium for
+// ChargeCalculator and at the interest step for InterestCrediting.
+type Month struct {
+	Policy *Policy
+	Rates  *RateSet
+	// PolicyMonth counts from 1 (0 for the stub period of a mid-month
+	// issue) and PolicyYear from 1.
+	PolicyMonth int
+	PolicyYear  int
+	// Fraction is the share of a full month in the period, below 1 in a
+	// stub period.
+	Fraction   float64
+	FaceAmount float64
+	Premium    float64
+	// PremiumYTD and LoadYTD are the premium and premium load of the
+	// policy year before this month's.
+	PremiumYTD float64
+	LoadYTD    float64
+	Value      float64
+	// FixedValue is the part of Value in the fixed account, the rest being
+	// in indexed segments and funds.
+	FixedValue  float64
+	LoanBalance float64
+}
+
+// DefaultCharges are the charges of the rate vectors: the premium load up
+// to target and above it, capped by the annual load cap, and the policy fee
+// with the per unit charge of the face amount's band.
+type DefaultCharges struct{}
+
+func (DefaultCharges) PremiumLoad(m *Month) float64 {
+	rates, year := m.Rates, m.PolicyYear-1
+	targetPortion := max(0, min(m.Premium, rates.TargetPremium[year]-m.PremiumYTD))
+	load := targetPortion*rates.PremiumLoad[year] + (m.Premium-targetPortion)*rates.PremiumLoadExcess[year]
+	return min(load, max(0, rates.PremiumLoadCap[year]-m.LoadYTD))
+}
+
+func (DefaultCharges) ExpenseCharge(m *Month) float64 {
+	rates := m.Rates
+	perUnit := rates.PerUnit[m.PolicyYear-1]
+	if rates.PerUnitBands != nil {
+		perUnit = bandRate(rates.PerUnitBands, m.FaceAmount, m.PolicyYear)
+	}
+	return (rates.PolicyFee[m.PolicyYear-1] + perUnit*m.FaceAmount/1000) / 12.0
+}
+
+// ChargeVariables are the variables of FormulaCharges formulas:
+//
+//	duration      policy year, from 1
+//	month         policy month since issue, from 1
+//	issue_age     issue age
+//	attained_age  issue age + duration - 1
+//	face          face amount
+//	band          face amount band of the per unit rates, from 1
+//	premium       the month's premium
+//	target        target premium for the policy year
+//	excess        for the premium load: 0 up to target, 1 above it
+var ChargeVariables = []string{"duration", "month", "issue_age", "attained_age", "face", "band", "premium", "target", "excess"}
+
+// FormulaCharges are charges given by formulas over ChargeVariables, each
+// replacing the rate vector's charge when set: PremiumLoadFormula is the
+// load rate on premium, evaluated up to target and above it and capped by
+// the annual load cap as DefaultCharges, PolicyFeeFormula the annual policy
+// fee, and PerUnitFormula the annual charge per $1,000 of face amount.
+type FormulaCharges struct {
+	PremiumLoadFormula *Expr
+	PolicyFeeFormula   *Expr
+	PerUnitFormula     *Expr
+}
+
+func (f FormulaCharges) PremiumLoad(m *Month) float64 {
+	if f.PremiumLoadFormula == nil {
+		return DefaultCharges{}.PremiumLoad(m)
+	}
+	rates, year := m.Rates, m.PolicyYear-1
+	targetPortion := max(0, min(m.Premium, rates.TargetPremium[year]-m.PremiumYTD))
+	vars := f.variables(m)
+	load := targetPortion * f.PremiumLoadFormula.Eval(vars[:]...)
+	if targetPortion < m.Premium {
+		vars[8] = 1
+		load += (m.Premium - targetPortion) * f.PremiumLoadFormula.Eval(vars[:]...)
+	}
+	return min(load, max(0, rates.PremiumLoadCap[year]-m.LoadYTD))
+}
+
+func (f FormulaCharges) ExpenseCharge(m *Month) float64 {
+	if f.PolicyFeeFormula == nil && f.PerUnitFormula == nil {
+		return DefaultCharges{}.ExpenseCharge(m)
+	}
+	rates := m.Rates
+	vars := f.variables(m)
+	fee := rates.PolicyFee[m.PolicyYear-1]
+	if f.PolicyFeeFormula != nil {
+		fee = f.PolicyFeeFormula.Eval(vars[:]...)
+	}
+	var perUnit float64
+	switch {
+	case f.PerUnitFormula != nil:
+		perUnit = f.PerUnitFormula.Eval(vars[:]...)
+	case rates.PerUnitBands != nil:
+		perUnit = bandRate(rates.PerUnitBands, m.FaceAmount, m.PolicyYear)
+	default:
+		perUnit = rates.PerUnit[m.PolicyYear-1]
+	}
+	return (fee + perUnit*m.FaceAmount/1000) / 12.0
+}
+
+// variables are the values of ChargeVariables for the month.
+func (f FormulaCharges) variables(m *Month) [9]float64 {
+	year := m.PolicyYear
+	return [9]float64{
+		float64(year),
+		float64(max(1, m.PolicyMonth)),
+		float64(m.Policy.IssueAge),
+		float64(m.Policy.IssueAge + year - 1),
+		m.FaceAmount,
+		float64(bandIndex(m.Rates.PerUnitBands, m.FaceAmount) + 1),
+		m.Premium,
+		m.Rates.TargetPremium[year-1],
+		0,
+	}
+}
+
+// DefaultCrediting credits the current rate, with any scenario, minimum,
+// and bonus, on the unloaned fixed account value and the loan crediting
+// rate on the loaned value.
+type DefaultCrediting struct{}
+
+func (DefaultCrediting) Interest(m *Month) float64 {
+	rates := m.Rates
+	unloaned := max(0, m.FixedValue-m.LoanBalance) * prorate(rates.interest(max(1, m.PolicyMonth), m.PolicyYear), m.Fraction)
+	loaned := min(m.LoanBalance, max(0, m.Value)) * prorate(rates.LoanCrediting[m.PolicyYear-1], m.Fraction)
+	return unloaned + loaned
+}
+
+// The hooks are passed hook, a copy of the month m carrying the policy, so
+// that projections without hooks keep the month on the stack.
+
+// premiumLoad is the month's premium load from Charges or by default.
+func (r *RateSet) premiumLoad(m *Month, hook *Month) float64 {
+	if r.Charges == nil {
+		return DefaultCharges{}.PremiumLoad(m)
+	}
+	return r.Charges.PremiumLoad(hook.copy(m))
+}
+
+// expenseCharge is the month's expense charge from Charges or by default.
+func (r *RateSet) expenseCharge(m *Month, hook *Month) float64 {
+	if r.Charges == nil {
+		return DefaultCharges{}.ExpenseCharge(m)
+	}
+	return r.Charges.ExpenseCharge(hook.copy(m))
+}
+
+// creditInterest is the month's interest from Crediting or by default.
+func (r *RateSet) creditInterest(m *Month, hook *Month) float64 {
+	if r.Crediting == nil {
+		return DefaultCrediting{}.Interest(m)
+	}
+	return r.Crediting.Interest(hook.copy(m))
+}
+
+// copy sets the month to m, keeping its policy, and returns it.
+func (hook *Month) copy(m *Month) *Month {
+	policy := hook.Policy
+	*hook = *m
+	hook.Policy = policy
+	return hook
+}
@@ -0,0 +1,513 @@
+package valact
+
+import "math"
+
+// Illustrate projects the policy's account value monthly from issue to
+// maturity and returns the account value at maturity net of any loan
+// balance. A policy that lapses returns its (non-positive) net value at
+// lapse.
+func Illustrate(policy Policy, rates *RateSet) float64 {
+	return project(policy, rates, nil).Value
+}
+
+// Outcome summarizes a projection without its ledger.
+type Outcome struct {
+	// Value is the account value net of loans at maturity, or at lapse.
+	Value float64 `json:"value"`
+	// LapseMonth is the policy month the policy lapsed in, 0 if it stayed
+	// in force to maturity.
+	LapseMonth int `json:"lapse_month,omitempty"`
+	// MECMonth is the policy month the policy became a modified endowment
+	// contract, 0 if it never did or was not tested.
+	MECMonth int `json:"mec_month,omitempty"`
+	// SevenPayMargin is the least amount by which the 7-pay limit exceeded
+	// premiums paid in any 7-pay period; negative once the policy is a MEC,
+	// +Inf when not tested.
+	SevenPayMargin float64 `json:"-"`
+}
+
+// Lapsed reports whether the policy lapsed before maturity.
+func (o Outcome) Lapsed() bool {
+	return o.LapseMonth > 0
+}
+
+// LapseYear is the policy year of the lapse, 0 if the policy did not lapse.
+func (o Outcome) LapseYear() int {
+	if o.LapseMonth == 0 {
+		return 0
+	}
+	return (o.LapseMonth-1)/12 + 1
+}
+
+// IllustrateOutcome projects the policy like Illustrate and also reports
+// when it lapsed.
+func IllustrateOutcome(policy Policy, rates *RateSet) Outcome {
+	return project(policy, rates, nil)
+}
+
+// IllustrateLedger projects the policy like Illustrate and returns the full
+// monthly ledger, ending with the lapse month if the policy lapses, with
+// the internal rates of return at each policy year end (from issue only). Use Ledger.Annual
+// for policy year totals. With a valuation basis, the reserves are set
+// alongside the rates of return.
+func IllustrateLedger(policy Policy, rates *RateSet) Ledger {
+	ledger := illustrateLedger(policy, rates)
+	if policy.Inforce == nil {
+		ledger.setReturns()
+		if rates.Valuation != nil {
+			ledger.setReserves(rates.Valuation)
+		}
+	}
+	return ledger
+}
+
+// illustrateLedger is IllustrateLedger without the rates of return, for
+// solvers.
+func illustrateLedger(policy Policy, rates *RateSet) Ledger {
+	ledger := make(Ledger, 0, 12*(rates.projectionEndAge()-policy.IssueAge)-policy.startMonth()+2)
+	project(policy, rates, &ledger)
+	return ledger
+}
+
+// project runs the monthly roll forward to maturity or lapse. Each month is
+// appended to ledger when it is non-nil.
+//
+// The policy enters the grace period at the end of any month with an account
+// value net of loans at or below zero, and lapses if the value is still not
+// positive after GracePeriodMonths further months.
+//
+// Loans are collateralized by the account value: the loaned portion equals
+// the loan balance and is credited at the loan crediting rate, the rest at
+// the regular rate. Loan interest is capitalized into the balance monthly.
+//
+// Withdrawals up to the free withdrawal fraction of the account value carry
+// no charge; the excess pays the surrender charge pro rata to the share of
+// the account value withdrawn. Under Option A the face amount is reduced in
+// the same proportion.
+//
+// Under a guideline limit, premiums paid to date (less withdrawals) are
+// tested against the limit as each premium is paid.
+//
+// When the rates carry 7-pay premiums, premiums paid in each 7-pay period
+// (less withdrawals) are tested against the 7-pay premiums to date, and the
+// policy becomes a MEC the first time they exceed them. A face increase is
+// a material change that starts a new 7-pay period, with the account value
+// at the change credited against the new 7-pay premium.
+//
+// With shadow rates, a shadow account runs alongside the account value. In
+// any month it holds the guarantee, the policy does not enter the grace
+// period and a negative account value is waived back to zero.
+//
+// A term rider adds its face amount to the death benefit while in force;
+// its expense charge is deducted with the base expense charge and its COI
+// with the base COI. The accidental death benefit and chronic illness
+// charges are deducted with the expense charges, and the waiver of premium charge, which may be a
+// share of all the other deductions, last.
+//
+// On a chronic illness claim, each month's accelerated benefit is paid at
+// the start of the month, before premium, reducing the face amount and,
+// pro rata, the account value and loan balance. The projection ends without
+// lapse in the month the payment exhausts the face amount.
+//
+// With indexed crediting or funds, the account value is split into buckets:
+// the allocated shares of each net premium start an index segment and go to
+// the funds, and the rest to the fixed account. Deductions, withdrawals,
+// and loan collateral are taken in the deduction order (by default the
+// fixed account first, then the other buckets pro rata). Only the fixed
+// account earns the monthly interest; funds earn their return net of fund
+// fees monthly, and segments their index credit at maturity.
+//
+// A policy issued after the first of a month starts with a stub period,
+// policy month 0, from the issue date to the first monthly processing date
+// on the first of the next month. The first premium is paid in the stub,
+// and its charges and interest are prorated to its share of the month.
+// Policy years then run from that processing date, so each anniversary is
+// processed on the first processing date after it.
+//
+// Past the rates' maturity age, an extension of maturity carries the
+// policy to the extended maturity age without premiums, charges, or
+// surrender charges; the account value earns interest and is the death
+// benefit.
+//
+// An inforce policy starts after its valuation month with the account
+// value, loan balance, premiums paid, and shadow account value given, and
+// with the surrender charges scaled to the remaining surrender charge. Its
+// account value is all in the fixed account and it is not tested for MEC
+// status.
+//
+// Each month, after any withdrawal, the premium, expense charges, COI, and
+// interest apply in the order of the rates' monthly steps; the death
+// benefit and net amount at risk are on the account value at the COI step,
+// and interest on the value at the interest step. The shadow account keeps
+// the default order.
+//
+// Under ArithmeticCents, each money amount is rounded to the cent as it is
+// computed, and the account value after each step; the rates' Rounding
+// rounds the amounts it has rules for by those instead.
+func project(policy Policy, rates *RateSet, ledger *Ledger) Outcome {
+	projectionYears := rates.projectionEndAge() - policy.IssueAge
+	// months after maturityMonth are in the extension of maturity
+	maturityMonth := 12 * (rates.maturityAge() - policy.IssueAge)
+
+	endValue := 0.0
+	policyYear := 0
+	faceAmount := policy.FaceAmount
+	dbOption := policy.DBOption
+	var startValue, premium, premiumLoad, expenseCharge, avForDB, db, naar, coi, flatExtra, interest float64
+	// premium and load dollars paid so far in the policy year, used for the
+	// target/excess breakpoint and the annual load cap
+	var premiumYTD, loadYTD float64
+	var loanBalance, loanAdvance, loanRepayment, loanInterest float64
+	var withdrawal, withdrawalCharge, surrenderCharge float64
+	var premiumsPaid, guidelineLimit, guidelineExcess, cumulativePremium float64
+	// 7-pay period start year, 7-pay premium, and premiums paid in the period
+	testSevenPay := rates.testsSevenPay() && policy.Inforce == nil
+	sevenPayStart, sevenPay, sevenPayPaid := 0, 0.0, 0.0
+	mecMonth, sevenPayMargin := 0, math.Inf(1)
+	var shadow *shadowAccount
+	if rates.Shadow != nil {
+		shadow = &shadowAccount{rates: rates.Shadow}
+	}
+	guaranteed := false
+	buckets := newAccounts(rates)
+	var indexCredit, fundReturn float64
+	// level monthly chronic illness benefit, set at claim, and this month's
+	// payment
+	var chronicBenefit, chronicPayment float64
+	// consecutive months ended without positive value, and the lapse month
+	graceMonths, lapseMonth := 0, 0
+	// months between modal premium payments and the modal payment factor
+	modeInterval := 12 / max(1, policy.PremiumMode.paymentsPerYear())
+	modalFactor := rates.ModalFactors.factor(policy.PremiumMode)
+	// a mid-month issue starts with a stub period, month 0, to the first
+	// monthly processing date
+	stub := 0.0
+	first := policy.startMonth()
+	if inforce := policy.Inforce; inforce != nil {
+		endValue = inforce.AccountValue
+		loanBalance = inforce.LoanBalance
+		premiumsPaid = inforce.PremiumsPaid
+		cumulativePremium = inforce.PremiumsPaid
+		if shadow != nil {
+			shadow.value = inforce.ShadowValue
+		}
+		// the year is under way unless the projection starts on an
+		// anniversary
+		policyYear = (first - 1) / 12
+		if first%12 != 1 {
+			policyYear++
+		}
+	} else if stub = policy.stubFraction(); stub > 0 {
+		first = 0
+	}
+	surrenderScale := policy.surrenderScale(rates)
+	// money rounds each money amount by the rates' rounding rules
+	money := rates.rounder()
+	month := Month{Rates: rates}
+	var hook *Month
+	if rates.Charges != nil || rates.Crediting != nil {
+		hookPolicy := policy
+		hook = &Month{Policy: &hookPolicy}
+	}
+	for i := first; i <= 12*projectionYears; i++ {
+		// share of a full month in the period
+		fraction := 1.0
+		if i == 0 {
+			fraction = stub
+		}
+		if i == 0 || i%12 == 1 && !(stub > 0 && i == 1) {
+			policyYear += 1
+			if len(policy.Changes) > 0 {
+				priorFace, priorOption := faceAmount, dbOption
+				faceAmount, dbOption = policy.applyChanges(policyYear, faceAmount, dbOption, endValue)
+				if testSevenPay && faceAmount > priorFace && dbOption == priorOption {
+					sevenPayStart = policyYear
+					sevenPay = rates.sevenPayPremium(policyYear, faceAmount, endValue-loanBalance)
+					sevenPayPaid = 0
+				}
+			}
+			if testSevenPay && policyYear == 1 {
+				sevenPayStart = 1
+				sevenPay = rates.sevenPayPremium(1, faceAmount, 0)
+			}
+			premiumYTD = 0.0
+			loadYTD = 0.0
+			loanRepayment = money.round(roundLoan, min(loanBalance, scheduledAmount(policy.LoanRepayments, policyYear)))
+			loanBalance = money.round(roundLoan, loanBalance-loanRepayment)
+			loanAdvance = money.round(roundLoan, min(max(0, endValue-loanBalance), scheduledAmount(policy.Loans, policyYear)))
+			loanBalance = money.round(roundLoan, loanBalance+loanAdvance)
+			withdrawal, withdrawalCharge = 0.0, 0.0
+			if requested := scheduledAmount(policy.Withdrawals, policyYear); requested > 0 && endValue > 0 {
+				surrenderCharge = money.round(roundSurrenderCharge, rates.SurrenderCharge[policyYear-1]*faceAmount/1000*surrenderScale)
+				withdrawal = money.round(roundWithdrawal, min(requested, max(0, endValue-surrenderCharge-loanBalance)))
+				share := withdrawal / endValue
+				excess := max(0, withdrawal-rates.FreeWithdrawal[policyYear-1]*endValue)
+				withdrawalCharge = money.round(roundWithdrawal, min(surrenderCharge*excess/endValue, max(0, endValue-withdrawal-loanBalance)))
+				if !dbOption.isB() {
+					faceAmount = money.round(roundFace, faceAmount*(1-share))
+				}
+				premiumsPaid = money.round(roundPremium, max(0, premiumsPaid-withdrawal))
+				sevenPayPaid = money.round(roundPremium, max(0, sevenPayPaid-withdrawal))
+			}
+		} else {
+			loanAdvance = 0.0
+			loanRepayment = 0.0
+			withdrawal = 0.0
+			withdrawalCharge = 0.0
+		}
+		chronicPayment = 0.0
+		if policy.Chronic.onClaim(i) && faceAmount > 0 {
+			if i == policy.Chronic.ClaimMonth {
+				chronicBenefit = money.round(roundDeathBenefit, policy.Chronic.BenefitRate*faceAmount)
+			}
+			chronicPayment = min(chronicBenefit, faceAmount)
+			share := chronicPayment / faceAmount
+			valueAtClaim := endValue
+			endValue = money.round(roundValue, endValue-max(0, endValue)*share)
+			buckets.scale(1 - share)
+			loanBalance = money.round(roundLoan, loanBalance-loanBalance*share)
+			faceAmount = money.round(roundFace, faceAmount-chronicPayment)
+			if faceAmount <= 0 {
+				// the final payment accelerates the whole policy
+				if ledger != nil {
+					*ledger = append(*ledger, LedgerRow{
+						PolicyMonth:       i,
+						PolicyYear:        policyYear,
+						MonthInPolicyYear: (i-1)%12 + 1,
+						ValueStart:        valueAtClaim,
+						ChronicBenefit:    chronicPayment,
+						CumulativePremium: cumulativePremium,
+					})
+				}
+				endValue, loanBalance = 0, 0
+				break
+			}
+		}
+		if i == 0 || (i-1)%modeInterval == 0 && !(stub > 0 && i == 1) {
+			premium = policy.annualPremium(policyYear) * modalFactor
+		} else {
+			premium = 0.0
+		}
+		if len(policy.Deposits) > 0 {
+			premium += policy.deposits(i)
+		}
+		premium = money.round(roundPremium, premium)
+		extended := i > maturityMonth
+		if extended {
+			premium = 0.0
+		}
+		if policy.Guideline != nil {
+			guidelineLimit = policy.Guideline.Limit(policyYear)
+			guidelineExcess = money.round(roundPremium, max(0, min(premium, premiumsPaid+premium-guidelineLimit)))
+			if policy.Guideline.Cap {
+				premium = money.round(roundPremium, premium-guidelineExcess)
+			}
+			premiumsPaid = money.round(roundPremium, premiumsPaid+premium)
+		}
+		if testSevenPay && policyYear < sevenPayStart+7 {
+			sevenPayPaid = money.round(roundPremium, sevenPayPaid+premium)
+			sevenPayMargin = min(sevenPayMargin, sevenPay*float64(policyYear-sevenPayStart+1)-sevenPayPaid)
+			if sevenPayMargin < 0 && mecMonth == 0 {
+				mecMonth = i
+			}
+		}
+		startValue = endValue
+		cumulativePremium = money.round(roundPremium, cumulativePremium+premium)
+		month.PolicyMonth, month.PolicyYear, month.Fraction = i, policyYear, fraction
+		month.FaceAmount, month.Premium, month.PremiumYTD, month.LoadYTD = faceAmount, premium, premiumYTD, loadYTD
+		month.Value = startValue - withdrawal - withdrawalCharge
+		month.FixedValue, month.LoanBalance = month.Value-buckets.value(), loanBalance
+		premiumLoad = money.round(roundPremiumLoad, rates.premiumLoad(&month, hook))
+		if rates.trace != nil {
+			rates.trace.premiumLoad(&month, premiumLoad)
+		}
+		premiumYTD = money.round(roundPremium, premiumYTD+premium)
+		loadYTD = money.round(roundPremiumLoad, loadYTD+premiumLoad)
+		expenseCharge = rates.expenseCharge(&month, hook)
+		riderFace, riderCOI, riderCharge := policy.termRider(rates, policyYear)
+		adbCharge := policy.adbCharge(rates, policyYear)
+		chronicCharge := policy.chronicCharge(rates, policyYear, i, faceAmount)
+		if extended {
+			expenseCharge, riderFace, riderCOI, riderCharge, adbCharge, chronicCharge = 0, 0, 0, 0, 0, 0
+		}
+		if fraction < 1 {
+			expenseCharge *= fraction
+			riderCOI *= fraction
+			riderCharge *= fraction
+			adbCharge *= fraction
+			chronicCharge *= fraction
+		}
+		expenseCharge, riderCOI, riderCharge = money.round(roundExpenses, expenseCharge), money.round(roundRiders, riderCOI), money.round(roundRiders, riderCharge)
+		adbCharge, chronicCharge = money.round(roundRiders, adbCharge), money.round(roundRiders, chronicCharge)
+		if rates.trace != nil && !extended {
+			rates.trace.expenseCharge(&month, expenseCharge)
+		}
+		// value is the account value as the month's steps apply, and
+		// outflow what has left it since the buckets were last sourced
+		value := startValue - withdrawal - withdrawalCharge
+		outflow := withdrawal + withdrawalCharge
+		var waiverCharge float64
+		indexCredit, fundReturn = 0.0, 0.0
+		for _, step := range rates.monthlySteps() {
+			switch step {
+			case StepPremium:
+				value = money.round(roundValue, value+(premium-premiumLoad))
+				if buckets != nil {
+					buckets.deposit(i, policyYear, premium-premiumLoad)
+				}
+			case StepExpenses:
+				expenses := expenseCharge + riderCharge + adbCharge + chronicCharge
+				value = money.round(roundValue, value-expenses)
+				outflow += expenses
+			case StepCOI:
+				avForDB = value
+				if extended {
+					// no insurance charges past maturity
+					db, naar, coi, flatExtra, waiverCharge = max(0, avForDB), 0, 0, 0, 0
+					break
+				}
+				db = money.round(roundDeathBenefit, dbOption.deathBenefit(faceAmount, avForDB, rates.CorridorFactors[policyYear-1]))
+				naar = max(0, db*rates.NAARDiscount[policyYear-1]-max(0, avForDB))
+				coiRate := rates.COI[policyYear-1]
+				if rates.COIBands != nil {
+					coiRate = bandRate(rates.COIBands, faceAmount, policyYear)
+				}
+				if rates.GuaranteedCOI != nil {
+					coiRate = min(coiRate, bandRate(rates.GuaranteedCOI, faceAmount, policyYear))
+				}
+				if survivor, ok := policy.survivorCOI(rates, policyYear); ok {
+					coiRate = survivor
+				}
+				coi = money.round(roundCOI, (naar/1000.0)*(policy.ratedCOI(coiRate)/12)*fraction)
+				if rates.trace != nil {
+					rates.trace.coi(&month, dbOption, avForDB, db, naar, coiRate, coi)
+				}
+				flatExtra = 0.0
+				if len(policy.FlatExtras) > 0 {
+					flatExtra = money.round(roundCOI, policy.flatExtra(policyYear)*faceAmount/1000/12*fraction)
+				}
+				waiverCharge = money.round(roundRiders, policy.waiverCharge(rates, policyYear, expenseCharge+riderCharge+adbCharge+chronicCharge+coi+flatExtra+riderCOI, faceAmount, fraction))
+				charges := coi + flatExtra + riderCOI + waiverCharge
+				value = money.round(roundValue, value-charges)
+				outflow += charges
+			case StepInterest:
+				if buckets != nil {
+					buckets.source(outflow, value, loanBalance)
+					outflow = 0
+				}
+				month.Value, month.FixedValue, month.LoanBalance = value, value-buckets.value(), loanBalance
+				interest = money.round(roundInterest, rates.creditInterest(&month, hook))
+				if rates.trace != nil {
+					rates.trace.interest(&month, interest)
+				}
+				if buckets != nil {
+					indexCredit, fundReturn = buckets.credit(i, fraction)
+					indexCredit, fundReturn = money.round(roundInterest, indexCredit), money.round(roundInterest, fundReturn)
+				}
+				value = money.round(roundValue, value+(interest+indexCredit+fundReturn))
+			}
+		}
+		if buckets != nil && outflow > 0 {
+			// deductions after interest
+			buckets.source(outflow, value, loanBalance)
+		}
+		endValue = value
+		loanInterest = money.round(roundLoan, loanBalance*rates.LoanInterest[policyYear-1])
+		loanBalance = money.round(roundLoan, loanBalance+loanInterest)
+		surrenderCharge = money.round(roundSurrenderCharge, rates.SurrenderCharge[policyYear-1]*faceAmount/1000*surrenderScale)
+		if extended {
+			surrenderCharge = 0
+		}
+		if shadow != nil && !extended {
+			shadow.roll(policy, policyYear, premium, withdrawal, faceAmount, dbOption, rates.NAARDiscount[policyYear-1])
+		}
+		guaranteed = shadow != nil && endValue-loanBalance <= 0 && shadow.holds(policy.IssueAge+policyYear-1, loanBalance)
+		if guaranteed {
+			endValue = max(endValue, 0)
+			graceMonths = 0
+		} else if endValue-loanBalance <= 0 {
+			graceMonths++
+			if graceMonths > rates.GracePeriodMonths {
+				lapseMonth = i
+			}
+		} else {
+			graceMonths = 0
+		}
+
+		if ledger != nil {
+			*ledger = append(*ledger, LedgerRow{
+				PolicyMonth:        i,
+				PolicyYear:         policyYear,
+				MonthInPolicyYear:  (i-1)%12 + 1,
+				FaceAmount:         faceAmount,
+				ValueStart:         startValue,
+				Premium:            premium,
+				PremiumLoad:        premiumLoad,
+				ExpenseCharge:      expenseCharge,
+				DeathBenefit:       db + riderFace,
+				NAAR:               naar,
+				COICharge:          coi,
+				FlatExtra:          flatExtra,
+				Interest:           interest,
+				ValueEnd:           endValue,
+				LoanAdvance:        loanAdvance,
+				LoanRepayment:      loanRepayment,
+				LoanInterest:       loanInterest,
+				LoanBalance:        loanBalance,
+				Withdrawal:         withdrawal,
+				WithdrawalCharge:   withdrawalCharge,
+				SurrenderCharge:    surrenderCharge,
+				CashSurrenderValue: max(0, endValue-surrenderCharge-loanBalance),
+				Lapsed:             lapseMonth > 0,
+				GuidelineLimit:     guidelineLimit,
+				GuidelineExcess:    guidelineExcess,
+				SevenPayPremium:    sevenPayPremiumInEffect(testSevenPay, policyYear, sevenPayStart, sevenPay),
+				MEC:                mecMonth > 0,
+				ShadowValue:        shadowValue(shadow),
+				Guaranteed:         guaranteed,
+				TermRiderCOI:       riderCOI,
+				TermRiderCharge:    riderCharge,
+				WaiverCharge:       waiverCharge,
+				ADBCharge:          adbCharge,
+				ChronicCharge:      chronicCharge,
+				ChronicBenefit:     chronicPayment,
+				IndexCredit:        indexCredit,
+				IndexedValue:       buckets.indexedValue(),
+				FundReturn:         fundReturn,
+				FundValue:          buckets.fundValue(),
+				CumulativePremium:  cumulativePremium,
+			})
+		}
+		if lapseMonth > 0 {
+			break
+		}
+	}
+
+	return Outcome{Value: money.round(roundValue, endValue-loanBalance), LapseMonth: lapseMonth, MECMonth: mecMonth, SevenPayMargin: sevenPayMargin}
+}
+
+// prorate is the effective rate for a fraction of the month at the monthly
+// effective rate.
+func prorate(rate float64, fraction float64) float64 {
+	if fraction == 1 {
+		return rate
+	}
+	return math.Pow(1+rate, fraction) - 1
+}
+
+// shadowValue is the shadow account value, 0 without a shadow account.
+func shadowValue(shadow *shadowAccount) float64 {
+	if shadow == nil {
+		return 0
+	}
+	return shadow.value
+}
+
+// sevenPayPremiumInEffect is the 7-pay premium reported for a policy year:
+// that of the 7-pay period covering it, or 0 outside one.
+func sevenPayPremiumInEffect(tested bool, policyYear int, start int, sevenPay float64) float64 {
+	if !tested || policyYear >= start+7 {
+		return 0
+	}
+	return sevenPay
+}
@@ -0,0 +1,164 @@
+package valact
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// sampleRates loads the rates of the policy from the sample tables.
+func sampleRates(t *testing.T, policy Policy) *RateSet {
+	t.Helper()
+	rates, err := RateSource{FS: sampleTables, Dir: "testdata/tables"}.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rates
+}
+
+// TestGracePeriodWithdrawal checks that a withdrawal requested on an
+// anniversary with no net value to pay it does not count toward the grace
+// period: the policy lapses in the same month as without the request.
+func TestGracePeriodWithdrawal(t *testing.T) {
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000,
+		PremiumSchedule: slices.Repeat([]float64{1255.03}, 9),
+		Loans:           []ScheduledAmount{{PolicyYear: 10, Amount: 1e9}}}
+	rates := sampleRates(t, policy)
+	want := IllustrateOutcome(policy, rates).LapseMonth
+	if want == 0 {
+		t.Fatal("policy did not lapse")
+	}
+	policy.Withdrawals = []ScheduledAmount{{PolicyYear: 10, Amount: 1}}
+	if got := IllustrateOutcome(policy, rates).LapseMonth; got != want {
+		t.Errorf("lapse month with a withdrawal request = %d, want %d", got, want)
+	}
+}
+
+// TestMaturityAfter121 checks that a product maturing after the default
+// maturity age projects, and charges a lifetime flat extra, to its own.
+func TestMaturityAfter121(t *testing.T) {
+	product := DefaultProduct()
+	product.MaturityAge = 125
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}.SelectProduct(product)
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 3000}
+	policy.FlatExtras = []FlatExtra{{Rate: 2.5, Years: -1}}
+	rates, err := source.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rates.CheckMaturity(policy.IssueAge); err != nil {
+		t.Fatal(err)
+	}
+	if len(rates.COI) != 125-35 {
+		t.Errorf("%d years of COI rates, want one a year to maturity at 125", len(rates.COI))
+	}
+	ledger := IllustrateLedger(policy, rates)
+	if len(ledger) != 12*(125-35) {
+		t.Fatalf("%d ledger months, want every month to maturity at 125", len(ledger))
+	}
+	if rate := policy.flatExtra(125 - 35); rate != 2.5 {
+		t.Errorf("flat extra %v in the last policy year, want 2.5 for life", rate)
+	}
+	rates.MaturityAge = 130
+	if err := rates.CheckMaturity(policy.IssueAge); err == nil {
+		t.Error("maturity at 130 beyond rates to 125 passed the check")
+	}
+	product.MaturityAge = 130
+	if _, err := source.SelectProduct(product).PolicyRates(policy, ""); !errors.Is(err, ErrMissingRate) {
+		t.Errorf("rates for maturity at 130 beyond the COI table to 125: %v, want ErrMissingRate", err)
+	}
+}
+
+// TestTargetPremiumLoads checks that the policy's target premium, in place
+// of the table's, splits the premium load between the target and excess
+// rates, and that the product's annual cap limits it.
+func TestTargetPremiumLoads(t *testing.T) {
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 3000, TargetPremium: 1000}
+	rates := sampleRates(t, policy)
+	if rates.TargetPremium[0] != 1000 {
+		t.Fatalf("target premium %v, want the policy's 1000", rates.TargetPremium[0])
+	}
+	rates.PremiumLoad = CreateVector(0.06, len(rates.PremiumLoad))
+	rates.PremiumLoadExcess = CreateVector(0.02, len(rates.PremiumLoadExcess))
+	if load := IllustrateLedger(policy, rates)[0].PremiumLoad; math.Abs(load-100) > 1e-9 {
+		t.Errorf("premium load %v, want 6%% of 1000 and 2%% of 2000", load)
+	}
+
+	product := DefaultProduct()
+	product.PremiumLoadCap = 90
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}.SelectProduct(product)
+	capped, err := source.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capped.PremiumLoad, capped.PremiumLoadExcess = rates.PremiumLoad, rates.PremiumLoadExcess
+	if load := IllustrateLedger(policy, capped)[0].PremiumLoad; load != 90 {
+		t.Errorf("premium load %v, want the cap of 90", load)
+	}
+}
+
+// TestLoans checks that a loan is advanced on its anniversary, limited to
+// the unloaned account value, that repayments reduce the balance, and that
+// loan interest is capitalized monthly.
+func TestLoans(t *testing.T) {
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 250000, AnnualPremium: 6000,
+		Loans:          []ScheduledAmount{{PolicyYear: 10, Amount: 20000}},
+		LoanRepayments: []ScheduledAmount{{PolicyYear: 12, Amount: 5000}}}
+	rates := sampleRates(t, policy)
+	ledger := IllustrateLedger(policy, rates)
+	if advance := ledger[9*12].LoanAdvance; advance != 20000 {
+		t.Errorf("loan advance %v in year 10, want 20000", advance)
+	}
+	if repayment := ledger[11*12].LoanRepayment; repayment != 5000 {
+		t.Errorf("loan repayment %v in year 12, want 5000", repayment)
+	}
+	balance := 0.0
+	for _, row := range ledger[:15*12] {
+		due := balance - row.LoanRepayment + row.LoanAdvance
+		interest := due * rates.LoanInterest[row.PolicyYear-1]
+		if math.Abs(row.LoanInterest-interest) > 1e-9 || math.Abs(row.LoanBalance-(due+interest)) > 1e-9 {
+			t.Fatalf("month %d: loan interest %v and balance %v, want %v and %v", row.PolicyMonth, row.LoanInterest, row.LoanBalance, interest, due+interest)
+		}
+		balance = row.LoanBalance
+	}
+
+	policy.Loans = []ScheduledAmount{{PolicyYear: 2, Amount: 1e9}}
+	policy.LoanRepayments = nil
+	ledger = IllustrateLedger(policy, rates)
+	if advance, value := ledger[12].LoanAdvance, ledger[11].ValueEnd; advance != value {
+		t.Errorf("loan advance %v, want the unloaned account value %v", advance, value)
+	}
+}
+
+// TestWithdrawals checks that a withdrawal reduces an Option A face amount
+// in proportion to the account value withdrawn, leaves an Option B face
+// alone, and is limited to the cash surrender value.
+func TestWithdrawals(t *testing.T) {
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 250000, AnnualPremium: 6000,
+		Withdrawals: []ScheduledAmount{{PolicyYear: 15, Amount: 10000}}}
+	rates := sampleRates(t, policy)
+	month := 14 * 12
+	ledger := IllustrateLedger(policy, rates)
+	before, row := ledger[month-1], ledger[month]
+	if row.Withdrawal != 10000 {
+		t.Fatalf("withdrawal %v in year 15, want 10000", row.Withdrawal)
+	}
+	if face := before.FaceAmount * (1 - 10000/before.ValueEnd); math.Abs(row.FaceAmount-face) > 1e-6 {
+		t.Errorf("Option A face %v after the withdrawal, want %v", row.FaceAmount, face)
+	}
+
+	policy.DBOption = DBOptionB
+	if face := IllustrateLedger(policy, rates)[month].FaceAmount; face != policy.FaceAmount {
+		t.Errorf("Option B face %v after the withdrawal, want %v", face, policy.FaceAmount)
+	}
+
+	policy.DBOption = DBOptionA
+	policy.Withdrawals = []ScheduledAmount{{PolicyYear: 3, Amount: 1e9}}
+	ledger = IllustrateLedger(policy, rates)
+	before, row = ledger[2*12-1], ledger[2*12]
+	// at the year 3 surrender charge
+	if csv := before.ValueEnd - rates.SurrenderCharge[2]*policy.FaceAmount/1000; math.Abs(row.Withdrawal-csv) > 1e-9 {
+		t.Errorf("withdrawal %v, want the cash surrender value %v", row.Withdrawal, csv)
+	}
+}
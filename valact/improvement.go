@@ -0,0 +1,181 @@
+package valact
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ImprovementTarget is the mortality a mortality improvement scale applies
+// to.
+type ImprovementTarget string
+
+const (
+	// ImproveCOI improves the current COI rates.
+	ImproveCOI ImprovementTarget = "coi"
+	// ImproveValuation improves the valuation mortality of the reserves.
+	ImproveValuation ImprovementTarget = "valuation"
+	// ImproveBoth improves both.
+	ImproveBoth ImprovementTarget = "both"
+)
+
+// Valid reports whether t is coi, valuation, both, or empty (coi).
+func (t ImprovementTarget) Valid() bool {
+	return t == "" || t == ImproveCOI || t == ImproveValuation || t == ImproveBoth
+}
+
+// MortalityImprovement configures the improvement of the mortality of a
+// run by the improvement scale table (see GetImprovementScale). The rates
+// of the tables are those of BaseYear, and each policy year's rate is
+// improved from there to the calendar year the policy year starts in,
+// counted from the year of the policy's issue date, or BaseYear without
+// one, at the insured's attained age. The guaranteed COI rates are not
+// improved.
+type MortalityImprovement struct {
+	BaseYear int
+	Target   ImprovementTarget
+}
+
+// ImprovementScale holds annual rates of mortality improvement, e.g. 0.01
+// for 1% a year, by attained age and calendar year.
+type ImprovementScale struct {
+	// FirstYear is the calendar year of Rates[age][0].
+	FirstYear int
+	// Rates are by attained age from 0, then by calendar year from
+	// FirstYear; the last year's rates continue after it and the first
+	// year's cover the years before it.
+	Rates [][]float64
+}
+
+// GetImprovementScale reads the mortality improvement scale table (see
+// ReadImprovementScale).
+func (s RateSource) GetImprovementScale() (*ImprovementScale, error) {
+	path := s.path(s.ImprovementScaleFile, ImprovementScaleFile)
+	file, err := s.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadImprovementScale(file, path)
+}
+
+// ReadImprovementScale reads a mortality improvement scale from a CSV with
+// the columns Attained_Age, Year (the calendar year), and Rate. An age's
+// rate holds until the next year given for it; the first also covers any
+// earlier years. Ages without rows are not improved. name is used in error
+// messages.
+func ReadImprovementScale(r io.Reader, name string) (*ImprovementScale, error) {
+	t, err := newTableReader(r, name, improvementSchema)
+	if err != nil {
+		return nil, err
+	}
+	ageField, yearField, rateField := t.field("Attained_Age"), t.field("Year"), t.field("Rate")
+	given := make([]map[int]float64, maxAge+1)
+	first, last := 0, 0
+	for t.next() {
+		age, err := t.int(ageField)
+		if err != nil {
+			return nil, err
+		}
+		year, err := t.int(yearField)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := t.float(rateField)
+		if err != nil {
+			return nil, err
+		}
+		if given[age] == nil {
+			given[age] = make(map[int]float64)
+		}
+		given[age][year] = rate
+		if first == 0 || year < first {
+			first = year
+		}
+		last = max(last, year)
+	}
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		return nil, fmt.Errorf("%s: no rows", name)
+	}
+
+	scale := &ImprovementScale{FirstYear: first, Rates: make([][]float64, maxAge+1)}
+	for age := range scale.Rates {
+		if given[age] == nil {
+			scale.Rates[age] = make([]float64, last-first+1)
+			continue
+		}
+		// fillYears counts years from 1
+		byYear := make(map[int]float64, len(given[age]))
+		for year, rate := range given[age] {
+			byYear[year-first+1] = rate
+		}
+		scale.Rates[age] = fillYears(byYear, last-first+1)
+	}
+	return scale, nil
+}
+
+// rate returns the improvement rate at the attained age in the calendar
+// year.
+func (s *ImprovementScale) rate(age int, year int) float64 {
+	rates := s.Rates[min(max(age, 0), len(s.Rates)-1)]
+	return rates[min(max(year-s.FirstYear, 0), len(rates)-1)]
+}
+
+// Factor returns the multiple of the mortality of baseYear at the attained
+// age giving that of the calendar year: the product of one less the
+// improvement rate of each year after baseYear through year, or its
+// inverse for a year before baseYear.
+func (s *ImprovementScale) Factor(age int, baseYear int, year int) float64 {
+	factor := 1.0
+	for y := baseYear + 1; y <= year; y++ {
+		factor *= 1 - s.rate(age, y)
+	}
+	for y := year + 1; y <= baseYear; y++ {
+		factor /= 1 - s.rate(age, y)
+	}
+	return factor
+}
+
+// ImproveRates improves the mortality of rates loaded for a policy by the
+// source's Improvement, if any: the current COI rates, including their
+// bands, or the valuation mortality, as Improvement.Target says.
+func (s RateSource) ImproveRates(rates *RateSet, issueAge int, issueDate time.Time) error {
+	if s.Improvement == nil {
+		return nil
+	}
+	scale, err := s.GetImprovementScale()
+	if err != nil {
+		return err
+	}
+	improvement := *s.Improvement
+	issueYear := improvement.BaseYear
+	if !issueDate.IsZero() {
+		issueYear = issueDate.Year()
+	}
+	// the vectors are replaced, not changed, as they may share their
+	// arrays with other tables' rates
+	improve := func(vector []float64) []float64 {
+		improved := make([]float64, len(vector))
+		for i, rate := range vector {
+			improved[i] = rate * scale.Factor(issueAge+i, improvement.BaseYear, issueYear+i)
+		}
+		return improved
+	}
+	if improvement.Target != ImproveValuation {
+		rates.COI = improve(rates.COI)
+		if rates.COIBands != nil {
+			bands := make([]RateBand, len(rates.COIBands))
+			for i, band := range rates.COIBands {
+				bands[i] = RateBand{MinFace: band.MinFace, Rates: improve(band.Rates)}
+			}
+			rates.COIBands = bands
+		}
+	}
+	if improvement.Target != ImproveCOI && improvement.Target != "" && rates.Valuation != nil {
+		rates.Valuation.Mortality = improve(rates.Valuation.Mortality)
+	}
+	return nil
+}
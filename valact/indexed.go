@@ -0,0 +1,119 @@
+package valact
+
+import "io"
+
+// IndexedCrediting configures indexed UL crediting. Net premium is split
+// between the fixed account, credited at RateSet.Interest, and index
+// segments, each credited once at maturity with the index return times the
+// participation rate, bounded by the floor and cap.
+type IndexedCrediting struct {
+	Cap           float64
+	Floor         float64
+	Participation float64
+	// SegmentMonths is the term of a segment; a matured segment renews into
+	// a new segment for the same term.
+	SegmentMonths int
+	// Allocation is the share of net premium swept into a new segment.
+	Allocation float64
+	// HypotheticalReturn is the index return of every segment unless
+	// Returns is set.
+	HypotheticalReturn float64
+	// Returns, when set, is a series of index returns applied by the
+	// policy year a segment starts, cycling from the start when exhausted.
+	Returns []float64
+}
+
+// creditRate is the index credit rate of a segment starting in the policy
+// year.
+func (c *IndexedCrediting) creditRate(policyYear int) float64 {
+	indexReturn := c.HypotheticalReturn
+	if len(c.Returns) > 0 {
+		indexReturn = c.Returns[(policyYear-1)%len(c.Returns)]
+	}
+	return min(c.Cap, max(c.Floor, c.Participation*indexReturn))
+}
+
+// ReadIndexReturns reads an index return series from a CSV with a Return
+// column (e.g. 0.085 for 8.5%), one row per year in order. name is used in
+// error messages.
+func ReadIndexReturns(r io.Reader, name string) ([]float64, error) {
+	t, err := newTableReader(r, name, indexReturnSchema)
+	if err != nil {
+		return nil, err
+	}
+	returnField := t.field("Return")
+	var returns []float64
+	for t.next() {
+		value, err := t.float(returnField)
+		if err != nil {
+			return nil, err
+		}
+		returns = append(returns, value)
+	}
+	return returns, t.err()
+}
+
+// segment is an index segment: its value and the policy month whose end it
+// matures at.
+type segment struct {
+	startYear int
+	maturity  int
+	value     float64
+}
+
+// indexedAccount holds the index segments of a projection. The fixed
+// account is the rest of the account value.
+type indexedAccount struct {
+	crediting *IndexedCrediting
+	segments  []segment
+}
+
+// value is the total value of the segments.
+func (a *indexedAccount) value() float64 {
+	if a == nil {
+		return 0
+	}
+	total := 0.0
+	for _, s := range a.segments {
+		total += s.value
+	}
+	return total
+}
+
+// deposit starts a segment in the policy month.
+func (a *indexedAccount) deposit(policyMonth int, policyYear int, amount float64) {
+	if amount <= 0 {
+		return
+	}
+	a.segments = append(a.segments, segment{startYear: policyYear, maturity: policyMonth + a.crediting.SegmentMonths - 1, value: amount})
+}
+
+// scale multiplies every segment by factor.
+func (a *indexedAccount) scale(factor float64) {
+	if a == nil {
+		return
+	}
+	for i := range a.segments {
+		a.segments[i].value *= factor
+	}
+}
+
+// mature credits the segments maturing at the end of the policy month and
+// renews them from the next month, returning the index credit.
+func (a *indexedAccount) mature(policyMonth int) float64 {
+	credit := 0.0
+	kept := a.segments[:0]
+	for _, s := range a.segments {
+		if s.value <= 0 {
+			continue
+		}
+		if s.maturity == policyMonth {
+			amount := s.value * a.crediting.creditRate(s.startYear)
+			credit += amount
+			s = segment{startYear: policyMonth/12 + 1, maturity: policyMonth + a.crediting.SegmentMonths, value: s.value + amount}
+		}
+		kept = append(kept, s)
+	}
+	a.segments = kept
+	return credit
+}
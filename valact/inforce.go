@@ -0,0 +1,42 @@
+package valact
+
+// Inforce holds the values of a policy in force at a valuation date, from
+// which an inforce projection starts instead of at issue.
+type Inforce struct {
+	// PolicyMonth is the last policy month completed; the projection
+	// starts with the next one.
+	PolicyMonth  int     `json:"policy_month"`
+	AccountValue float64 `json:"account_value"`
+	LoanBalance  float64 `json:"loan_balance,omitempty"`
+	// SurrenderCharge, when set, is the surrender charge remaining at the
+	// valuation date; the table's charges from then on are scaled to it.
+	SurrenderCharge *float64 `json:"surrender_charge,omitempty"`
+	// PremiumsPaid is the premium paid to date (less withdrawals), carried
+	// into the guideline premium test and cumulative premium.
+	PremiumsPaid float64 `json:"premiums_paid,omitempty"`
+	// ShadowValue is the no-lapse guarantee shadow account value.
+	ShadowValue float64 `json:"shadow_value,omitempty"`
+}
+
+// startMonth is the first policy month projected, after any inforce
+// valuation month.
+func (p Policy) startMonth() int {
+	if p.Inforce == nil {
+		return 1
+	}
+	return p.Inforce.PolicyMonth + 1
+}
+
+// surrenderScale is the factor applied to the surrender charge table so
+// that it matches the inforce remaining surrender charge, 1 from issue.
+func (p Policy) surrenderScale(rates *RateSet) float64 {
+	if p.Inforce == nil || p.Inforce.SurrenderCharge == nil {
+		return 1
+	}
+	year := (p.Inforce.PolicyMonth-1)/12 + 1
+	table := rates.SurrenderCharge[max(0, year-1)] * p.FaceAmount / 1000
+	if table <= 0 {
+		return 1
+	}
+	return *p.Inforce.SurrenderCharge / table
+}
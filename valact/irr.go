@@ -0,0 +1,57 @@
+package valact
+
+// setReturns sets the internal rates of return of a monthly ledger on the
+// last month of each policy year and on the final month. The cash flows
+// are premiums (paid at the start of the month) less withdrawals, loans
+// net of repayments, and accelerated benefits received, ending with the
+// cash surrender value or the death benefit net of loans at the end of the
+// month.
+func (l Ledger) setReturns() {
+	// cash paid in by the policyholder at the start of each month
+	flows := make([]float64, len(l))
+	for i, row := range l {
+		flows[i] = row.Premium - row.Withdrawal - row.LoanAdvance + row.LoanRepayment - row.ChronicBenefit
+		if row.MonthInPolicyYear != 12 && i != len(l)-1 {
+			continue
+		}
+		if row.CumulativePremium <= 0 {
+			continue
+		}
+		l[i].SurrenderIRR = irr(flows[:i+1], row.CashSurrenderValue)
+		l[i].DeathBenefitIRR = irr(flows[:i+1], max(0, row.DeathBenefit-row.LoanBalance))
+	}
+}
+
+// irr is the annual effective rate at which the payments, made at the
+// start of each month, accumulate to value at the end of the last month.
+// It is -1 when the value is not positive.
+func irr(payments []float64, value float64) float64 {
+	if value <= 0 {
+		return -1
+	}
+	// net future value at monthly rate r, by Horner's rule
+	excess := func(r float64) float64 {
+		accumulated := 0.0
+		for _, payment := range payments {
+			accumulated = (accumulated + payment) * (1 + r)
+		}
+		return value - accumulated
+	}
+	// accumulated payments grow with the rate, so the excess falls
+	low, high := -0.99, 1.0
+	for excess(high) > 0 && high < 1e6 {
+		high *= 2
+	}
+	for range 100 {
+		mid := (low + high) / 2
+		if excess(mid) > 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+		if high-low < 1e-12 {
+			break
+		}
+	}
+	return AnnualRate((low + high) / 2)
+}
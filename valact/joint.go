@@ -0,0 +1,129 @@
+package valact
+
+import "fmt"
+
+// Life is an insured life other than the policy's primary insured.
+type Life struct {
+	IssueAge  int    `json:"issue_age"`
+	Gender    string `json:"gender"`
+	RiskClass string `json:"risk_class"`
+	// TableRating multiplies the life's COI rates; zero means standard.
+	TableRating float64 `json:"table_rating,omitempty"`
+}
+
+// FirstDeath is the first death on a survivorship policy: Life (1 for the
+// primary insured, 2 for the second) dies during the year before
+// PolicyYear, so coverage continues on the survivor from that year.
+type FirstDeath struct {
+	Life       int `json:"life"`
+	PolicyYear int `json:"policy_year"`
+}
+
+// JointMethod selects how survivorship COI rates combine the two lives.
+type JointMethod string
+
+const (
+	// JointFrasier charges the Frasier rate while the status of the lives
+	// is not tracked: the probability that the second death falls in the
+	// year given that at least one life survives to it.
+	JointFrasier JointMethod = "frasier"
+	// JointExact tracks the lives: while both are alive the rate is the
+	// chance both die in the year, qx times qy.
+	JointExact JointMethod = "exact"
+)
+
+// Valid reports whether the method is known.
+func (m JointMethod) Valid() bool {
+	return m == JointFrasier || m == JointExact
+}
+
+// GetSurvivorshipRates assembles the rates of a survivorship (second-to-die)
+// policy on the policy's insured and its Second life. Charges other than COI
+// come from the primary insured's rates. The COI is the joint last survivor
+// rate from the two single-life COI tables (each with its life's table
+// rating), and LifeCOI keeps the single-life rates for continuation after a
+// first death. Face amount bands are not used.
+func (s RateSource) GetSurvivorshipRates(policy Policy, method JointMethod) (*RateSet, error) {
+	if policy.Second == nil {
+		return nil, fmt.Errorf("survivorship rates need a second life")
+	}
+	if !method.Valid() {
+		return nil, fmt.Errorf("unknown joint method %q", method)
+	}
+	rates, err := s.GetRates(policy.Gender, policy.RiskClass, policy.IssueAge)
+	if err != nil {
+		return nil, err
+	}
+	second := policy.Second
+	secondCOI, err := s.GetCOIRates(second.Gender, second.RiskClass, second.IssueAge)
+	if err != nil {
+		return nil, err
+	}
+	years := len(rates.COI)
+	rates.LifeCOI = [2][]float64{
+		lifeCOI(rates.COI, policy.IssueAge, policy.TableRating, years, rates.maturityAge()),
+		lifeCOI(secondCOI, second.IssueAge, second.TableRating, years, rates.maturityAge()),
+	}
+	rates.COI = JointRates(rates.LifeCOI[0], rates.LifeCOI[1], method)
+	rates.COIBands = nil
+	rates.Survivorship = method
+	return rates, nil
+}
+
+// lifeCOI returns single-life COI rates over the policy years with a table
+// rating applied, treating the life as dead (a rate of 1000) from the
+// maturity age on.
+func lifeCOI(coi []float64, issueAge int, rating float64, years int, maturityAge int) []float64 {
+	rated := Policy{TableRating: rating}
+	life := make([]float64, years)
+	for i := range life {
+		if issueAge+i >= maturityAge || i >= len(coi) {
+			life[i] = 1000
+			continue
+		}
+		life[i] = rated.ratedCOI(coi[i])
+	}
+	return life
+}
+
+// JointRates combines two single-life COI rate vectors, per $1,000 by policy
+// year, into joint last survivor rates by the method, assuming the lives are
+// independent. The joint rates run as long as the shorter vector.
+func JointRates(first []float64, second []float64, method JointMethod) []float64 {
+	joint := make([]float64, min(len(first), len(second)))
+	// probabilities that each life has died before the policy year
+	deadX, deadY := 0.0, 0.0
+	for i := range joint {
+		qx, qy := min(1, first[i]/1000), min(1, second[i]/1000)
+		if method == JointExact {
+			joint[i] = 1000 * qx * qy
+			continue
+		}
+		// the last survivor is alive at the start of the year unless both
+		// have died; the second death falls in the year when one life is
+		// already dead and the other dies, or both die
+		alive := 1 - deadX*deadY
+		if alive > 0 {
+			secondDeath := qx*(1-deadX)*deadY + qy*(1-deadY)*deadX + qx*qy*(1-deadX)*(1-deadY)
+			joint[i] = 1000 * min(1, secondDeath/alive)
+		} else {
+			joint[i] = 1000
+		}
+		deadX += (1 - deadX) * qx
+		deadY += (1 - deadY) * qy
+	}
+	return joint
+}
+
+// survivorCOI returns the single-life COI rate of the survivor after the
+// first death, and whether the first death has occurred by the policy year.
+func (p Policy) survivorCOI(rates *RateSet, policyYear int) (float64, bool) {
+	if p.Second == nil || p.FirstDeath == nil || rates.Survivorship == "" || policyYear < p.FirstDeath.PolicyYear {
+		return 0, false
+	}
+	survivor := 0
+	if p.FirstDeath.Life == 1 {
+		survivor = 1
+	}
+	return rates.LifeCOI[survivor][policyYear-1], true
+}
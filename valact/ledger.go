@@ -0,0 +1,158 @@
+package valact
+
+// LedgerRow holds the values for one projection period. Monthly rows come
+// from IllustrateLedger; Ledger.Annual folds them into policy years. The
+// stub period of a mid-month issue is policy month 0 of policy year 1.
+type LedgerRow struct {
+	PolicyMonth       int     `json:"policy_month"`
+	PolicyYear        int     `json:"policy_year"`
+	MonthInPolicyYear int     `json:"month_in_policy_year"`
+	FaceAmount        float64 `json:"face_amount"`
+	ValueStart        float64 `json:"value_start"`
+	Premium           float64 `json:"premium"`
+	PremiumLoad       float64 `json:"premium_load"`
+	ExpenseCharge     float64 `json:"expense_charge"`
+	DeathBenefit      float64 `json:"death_benefit"`
+	NAAR              float64 `json:"naar"`
+	COICharge         float64 `json:"coi_charge"`
+	// FlatExtra is the substandard flat extra charge.
+	FlatExtra float64 `json:"flat_extra,omitempty"`
+	Interest  float64 `json:"interest"`
+	ValueEnd  float64 `json:"value_end"`
+	// CashSurrenderValue is the end of period value available on surrender.
+	CashSurrenderValue float64 `json:"cash_surrender_value"`
+	LoanAdvance        float64 `json:"loan_advance"`
+	LoanRepayment      float64 `json:"loan_repayment"`
+	// LoanInterest is the loan interest charged and capitalized.
+	LoanInterest float64 `json:"loan_interest"`
+	// LoanBalance is the end of period indebtedness.
+	LoanBalance float64 `json:"loan_balance"`
+	Withdrawal  float64 `json:"withdrawal"`
+	// WithdrawalCharge is the partial surrender charge on a withdrawal.
+	WithdrawalCharge float64 `json:"withdrawal_charge"`
+	// SurrenderCharge is the charge on a full surrender at the end of the
+	// period.
+	SurrenderCharge float64 `json:"surrender_charge"`
+	// Lapsed marks the period in which the policy lapsed.
+	Lapsed bool `json:"lapsed,omitempty"`
+	// GuidelineLimit is the guideline premium limitation for the policy
+	// year, 0 when the policy is not tested.
+	GuidelineLimit float64 `json:"guideline_limit,omitempty"`
+	// GuidelineExcess is premium over the guideline limit: refused when the
+	// limit caps premiums, otherwise paid in violation of the test.
+	GuidelineExcess float64 `json:"guideline_excess,omitempty"`
+	// SevenPayPremium is the annual 7-pay premium of the 7-pay period
+	// covering the period, 0 outside one or when not tested.
+	SevenPayPremium float64 `json:"seven_pay_premium,omitempty"`
+	// MEC marks periods from the one in which the policy became a modified
+	// endowment contract.
+	MEC bool `json:"mec,omitempty"`
+	// ShadowValue is the end of period no-lapse guarantee shadow account,
+	// 0 without one.
+	ShadowValue float64 `json:"shadow_value,omitempty"`
+	// Guaranteed marks periods kept in force by the no-lapse guarantee.
+	Guaranteed bool `json:"guaranteed,omitempty"`
+	// TermRiderCOI and TermRiderCharge are the term rider's COI and
+	// expense charges. The death benefit includes the rider face amount.
+	TermRiderCOI    float64 `json:"term_rider_coi,omitempty"`
+	TermRiderCharge float64 `json:"term_rider_charge,omitempty"`
+	// WaiverCharge and ADBCharge are the waiver of premium and accidental
+	// death benefit rider charges.
+	WaiverCharge float64 `json:"waiver_charge,omitempty"`
+	ADBCharge    float64 `json:"adb_charge,omitempty"`
+	// ChronicCharge is the chronic illness rider charge and ChronicBenefit
+	// the accelerated benefit paid on claim.
+	ChronicCharge  float64 `json:"chronic_charge,omitempty"`
+	ChronicBenefit float64 `json:"chronic_benefit,omitempty"`
+	// IndexCredit is the index credit on maturing segments and
+	// IndexedValue the end of period value in index segments; the rest of
+	// the account value is the fixed account.
+	IndexCredit  float64 `json:"index_credit,omitempty"`
+	IndexedValue float64 `json:"indexed_value,omitempty"`
+	// FundReturn is the variable fund return net of fund fees and
+	// FundValue the end of period value in the funds.
+	FundReturn float64 `json:"fund_return,omitempty"`
+	FundValue  float64 `json:"fund_value,omitempty"`
+	// CumulativePremium is the premium paid to the end of the period.
+	CumulativePremium float64 `json:"cumulative_premium"`
+	// SurrenderIRR and DeathBenefitIRR are the annual internal rates of
+	// return on the cash surrender value and on the death benefit net of
+	// loans at the end of the period, -1 for a total loss. They are set on
+	// the last month of each policy year and the final month, once premium
+	// has been paid, for projections from issue.
+	SurrenderIRR    float64 `json:"surrender_irr,omitempty"`
+	DeathBenefitIRR float64 `json:"death_benefit_irr,omitempty"`
+	// TerminalReserve and MeanReserve are the statutory reserves of the
+	// policy year on the rates' valuation basis: at its end, and the mean
+	// of its initial reserve (the prior terminal reserve plus the net
+	// premium) and its terminal reserve. They are set like the rates of
+	// return when the rates have a valuation basis.
+	TerminalReserve float64 `json:"terminal_reserve,omitempty"`
+	MeanReserve     float64 `json:"mean_reserve,omitempty"`
+}
+
+// Ledger is a projection in time order.
+type Ledger []LedgerRow
+
+// Annual summarizes a monthly ledger by policy year. Cash flows (premium,
+// loads, charges, interest) are summed; the start value comes from the first
+// month and the end value, death benefit, and NAAR from the last month.
+func (l Ledger) Annual() Ledger {
+	return l.appendAnnual(nil)
+}
+
+// appendAnnual appends the policy year summary of Annual to annual.
+func (l Ledger) appendAnnual(annual Ledger) Ledger {
+	start := len(annual)
+	for _, row := range l {
+		n := len(annual)
+		if n == start || annual[n-1].PolicyYear != row.PolicyYear {
+			annual = append(annual, row)
+			continue
+		}
+		year := &annual[n-1]
+		year.PolicyMonth = row.PolicyMonth
+		year.MonthInPolicyYear = row.MonthInPolicyYear
+		year.Premium += row.Premium
+		year.PremiumLoad += row.PremiumLoad
+		year.ExpenseCharge += row.ExpenseCharge
+		year.FaceAmount = row.FaceAmount
+		year.DeathBenefit = row.DeathBenefit
+		year.NAAR = row.NAAR
+		year.COICharge += row.COICharge
+		year.FlatExtra += row.FlatExtra
+		year.Interest += row.Interest
+		year.ValueEnd = row.ValueEnd
+		year.CashSurrenderValue = row.CashSurrenderValue
+		year.LoanAdvance += row.LoanAdvance
+		year.LoanRepayment += row.LoanRepayment
+		year.LoanInterest += row.LoanInterest
+		year.LoanBalance = row.LoanBalance
+		year.Withdrawal += row.Withdrawal
+		year.WithdrawalCharge += row.WithdrawalCharge
+		year.SurrenderCharge = row.SurrenderCharge
+		year.Lapsed = row.Lapsed
+		year.GuidelineLimit = row.GuidelineLimit
+		year.GuidelineExcess += row.GuidelineExcess
+		year.SevenPayPremium = row.SevenPayPremium
+		year.MEC = row.MEC
+		year.ShadowValue = row.ShadowValue
+		year.Guaranteed = year.Guaranteed || row.Guaranteed
+		year.TermRiderCOI += row.TermRiderCOI
+		year.TermRiderCharge += row.TermRiderCharge
+		year.WaiverCharge += row.WaiverCharge
+		year.ADBCharge += row.ADBCharge
+		year.ChronicCharge += row.ChronicCharge
+		year.ChronicBenefit += row.ChronicBenefit
+		year.IndexCredit += row.IndexCredit
+		year.IndexedValue = row.IndexedValue
+		year.FundReturn += row.FundReturn
+		year.FundValue = row.FundValue
+		year.CumulativePremium = row.CumulativePremium
+		year.SurrenderIRR = row.SurrenderIRR
+		year.DeathBenefitIRR = row.DeathBenefitIRR
+		year.TerminalReserve = row.TerminalReserve
+		year.MeanReserve = row.MeanReserve
+	}
+	return annual
+}
@@ -0,0 +1,97 @@
+package valact
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Loads are the premium loads and annual policy fee by policy year.
+type Loads struct {
+	// PremiumLoad applies to premium up to the target premium and
+	// PremiumLoadExcess to premium above it.
+	PremiumLoad       []float64
+	PremiumLoadExcess []float64
+	PolicyFee         []float64
+}
+
+// DefaultLoads are the loads of the DefaultProduct, used when there is no
+// loads table: 6% of premium and a $120 policy fee in every one of the
+// years.
+func DefaultLoads(years int) Loads {
+	return DefaultProduct().loads(years)
+}
+
+// GetLoads reads the loads table, a CSV with the columns Policy_Year,
+// Premium_Load, and Policy_Fee, and optionally Premium_Load_Excess (the
+// load above target, Premium_Load when absent). A year's values hold until
+// the next year given, and the first year's also cover any earlier years,
+// so 1,0.08,120 and 11,0.04,60 rows load 8% and $120 in years 1-10 and 4%
+// and $60 after. The loads cover the years; rows after them are ignored.
+func (s RateSource) GetLoads(years int) (Loads, error) {
+	path := s.path(s.LoadsFile, LoadsFile)
+	var loads Loads
+	t, err := s.openTable(path, loadsSchema)
+	if err != nil {
+		return loads, err
+	}
+	defer t.Close()
+	yearField := t.field("Policy_Year")
+	fields := []field{t.field("Premium_Load"), t.field("Policy_Fee")}
+	if excess := t.field("Premium_Load_Excess"); t.has(excess) {
+		fields = append(fields, excess)
+	}
+
+	// values from each given policy year, by column
+	given := make([]map[int]float64, len(fields))
+	for i := range given {
+		given[i] = make(map[int]float64)
+	}
+	for t.next() {
+		year, err := t.int(yearField)
+		if err != nil {
+			return loads, err
+		}
+		if year < 1 {
+			return loads, t.fieldError(yearField, errOutOfRange)
+		}
+		for i, f := range fields {
+			value, err := t.float(f)
+			if err != nil {
+				return loads, err
+			}
+			given[i][year] = value
+		}
+	}
+	if err := t.err(); err != nil {
+		return loads, err
+	}
+	if len(given[0]) == 0 {
+		return loads, fmt.Errorf("%s: no rows", path)
+	}
+
+	loads.PremiumLoad = fillYears(given[0], years)
+	loads.PolicyFee = fillYears(given[1], years)
+	loads.PremiumLoadExcess = slices.Clone(loads.PremiumLoad)
+	if len(given) > 2 {
+		loads.PremiumLoadExcess = fillYears(given[2], years)
+	}
+	return loads, nil
+}
+
+// fillYears spreads values given from some policy years over the years.
+func fillYears(given map[int]float64, years int) []float64 {
+	values := make([]float64, years)
+	first := math.MaxInt
+	for year := range given {
+		first = min(first, year)
+	}
+	value := given[first]
+	for year := range values {
+		if v, ok := given[year+1]; ok {
+			value = v
+		}
+		values[year] = value
+	}
+	return values
+}
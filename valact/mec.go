@@ -0,0 +1,34 @@
+package valact
+
+import "math"
+
+// ApplySevenPayTest turns on IRC 7702A modified endowment contract testing:
+// it sets the 7-pay premium rates and annuity factors from the basis (net
+// single premium over a 7-year annuity due at LevelInterest).
+func (r *RateSet) ApplySevenPayTest(basis *GuidelineBasis, issueAge int) {
+	nsp := basis.NetSinglePremiums(issueAge, len(r.SevenPayRates))
+	v := 1 / (1 + basis.LevelInterest)
+	for start := range r.SevenPayRates {
+		// annuity due over the 7 years, or the years left to maturity
+		annuity, survival := 0.0, 1.0
+		for year := start; year < min(start+7, basis.MaturityAge-issueAge, len(nsp)); year++ {
+			annuity += survival * math.Pow(v, float64(year-start))
+			survival *= 1 - min(1, basis.Mortality[year]/1000)
+		}
+		annuity = max(1, annuity)
+		r.SevenPayRates[start] = 1000 * nsp[start] / annuity
+		r.SevenPayAnnuities[start] = annuity
+	}
+}
+
+// sevenPayPremium is the annual 7-pay premium for a 7-pay period starting in
+// the policy year, reduced by the account value rolled into it on a material
+// change.
+func (r *RateSet) sevenPayPremium(policyYear int, faceAmount float64, accountValue float64) float64 {
+	return max(0, r.SevenPayRates[policyYear-1]*faceAmount/1000-max(0, accountValue)/r.SevenPayAnnuities[policyYear-1])
+}
+
+// testsSevenPay reports whether the rates carry 7-pay premiums.
+func (r *RateSet) testsSevenPay() bool {
+	return len(r.SevenPayRates) > 0 && r.SevenPayRates[0] > 0
+}
@@ -0,0 +1,28 @@
+package valact
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApplySevenPayTest(t *testing.T) {
+	rates := &RateSet{SevenPayRates: make([]float64, 5), SevenPayAnnuities: make([]float64, 5)}
+	rates.ApplySevenPayTest(flatBasis, 35)
+	// the annuity due runs the three years to maturity at 38, not seven
+	v, p := 1/1.04, 0.99
+	annuity := 1 + v*p + v*v*p*p
+	if got := rates.SevenPayAnnuities[0]; math.Abs(got-annuity) > 1e-12 {
+		t.Errorf("year 1 annuity %v, want %v", got, annuity)
+	}
+	nsp := flatBasis.NetSinglePremiums(35, 5)
+	if got, want := rates.SevenPayRates[0], 1000*nsp[0]/annuity; math.Abs(got-want) > 1e-9 {
+		t.Errorf("year 1 7-pay rate %v, want %v", got, want)
+	}
+	// from maturity on the annuity is one payment of the endowment
+	if got := rates.SevenPayRates[4]; got != 1000 {
+		t.Errorf("year 5 7-pay rate %v, want 1000", got)
+	}
+	if premium := rates.sevenPayPremium(1, 100000, 0); math.Abs(premium-100*rates.SevenPayRates[0]) > 1e-9 {
+		t.Errorf("7-pay premium %v, want %v", premium, 100*rates.SevenPayRates[0])
+	}
+}
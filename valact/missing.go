@@ -0,0 +1,152 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrMissingRate is returned for a rate a table lacks under MissingStrict,
+// or that MissingCarry or MissingInterpolate have nothing to fill from.
+var ErrMissingRate = errors.New("missing rate")
+
+// MissingRate is how a table's loader fills the policy years it has no row
+// for.
+type MissingRate string
+
+const (
+	// MissingDefault leaves the rate 0, or 1 for corridor factors.
+	MissingDefault MissingRate = ""
+	// MissingStrict fails with ErrMissingRate for any policy year before
+	// the product's maturity age.
+	MissingStrict MissingRate = "strict"
+	// MissingCarry carries the last rate given forward, and the first back
+	// to earlier years.
+	MissingCarry MissingRate = "carry"
+	// MissingInterpolate interpolates linearly between the rates given,
+	// carrying the first and last beyond them.
+	MissingInterpolate MissingRate = "interpolate"
+)
+
+// Valid reports whether m is a known rule.
+func (m MissingRate) Valid() bool {
+	switch m {
+	case MissingDefault, MissingStrict, MissingCarry, MissingInterpolate:
+		return true
+	}
+	return false
+}
+
+// MissingRates are the rules for missing rates of the COI, issue age
+// (unit load, surrender charge, and rider), and corridor factor tables:
+// Tables by file name, e.g. COIFile, and Default for the others.
+type MissingRates struct {
+	Default MissingRate
+	Tables  map[string]MissingRate
+}
+
+// ParseMissingRates parses comma separated rules, each a table file name
+// and a rule, or a rule for every other table, e.g.
+// "strict,corridor_factors.csv=carry".
+func ParseMissingRates(spec string) (*MissingRates, error) {
+	rules := &MissingRates{Tables: make(map[string]MissingRate)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(item, "=")
+		if !ok {
+			name, text = "", item
+		}
+		rule := MissingRate(strings.TrimSpace(text))
+		if !rule.Valid() || rule == MissingDefault {
+			return nil, fmt.Errorf("missing rates %q: unknown rule %q (want strict, carry, or interpolate)", item, rule)
+		}
+		if name == "" {
+			rules.Default = rule
+		} else {
+			rules.Tables[strings.TrimSpace(name)] = rule
+		}
+	}
+	return rules, nil
+}
+
+// missing returns the rule for the table at the path.
+func (s RateSource) missing(tablePath string) MissingRate {
+	if s.Missing == nil {
+		return MissingDefault
+	}
+	if rule, ok := s.Missing.Tables[path.Base(strings.ReplaceAll(tablePath, `\`, "/"))]; ok {
+		return rule
+	}
+	return s.Missing.Default
+}
+
+// fill fills the rates of the years not given by the rule, checking the
+// first limit years under MissingStrict. It returns the index of the first
+// year it could not fill, or -1.
+func (m MissingRate) fill(rates []float64, given []bool, limit int) int {
+	first, last := -1, -1
+	for i, ok := range given {
+		if ok {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	switch m {
+	case MissingStrict:
+		for i := range min(limit, len(rates)) {
+			if !given[i] {
+				return i
+			}
+		}
+	case MissingCarry, MissingInterpolate:
+		if first < 0 {
+			return 0
+		}
+		prev := first
+		for i := range rates {
+			switch {
+			case given[i]:
+				prev = i
+			case i < first:
+				rates[i] = rates[first]
+			case i > last || m == MissingCarry:
+				rates[i] = rates[prev]
+			default:
+				next := i + 1
+				for !given[next] {
+					next++
+				}
+				weight := float64(i-prev) / float64(next-prev)
+				rates[i] = rates[prev] + weight*(rates[next]-rates[prev])
+			}
+		}
+	}
+	return -1
+}
+
+// fill fills the missing years of each band by the rule, returning
+// ErrMissingRate for the first that cannot be filled. key describes the
+// rates, e.g. "issue age 35".
+func (b *faceBands) fill(tablePath string, rule MissingRate, limit int, key string) error {
+	if rule == MissingDefault {
+		return nil
+	}
+	if len(b.bands) == 0 {
+		return fmt.Errorf("%s: %w: no rows for %s", tablePath, ErrMissingRate, key)
+	}
+	for band := range b.bands {
+		if year := rule.fill(b.bands[band].Rates, b.selected[band], limit); year >= 0 {
+			if len(b.bands) > 1 {
+				key = fmt.Sprintf("%s, %s %g", key, FaceBandColumn, b.bands[band].MinFace)
+			}
+			return fmt.Errorf("%s: %w: %s, policy year %d", tablePath, ErrMissingRate, key, year+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package valact
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ModelPoints groups the policies of a census sharing a rating cell (issue
+// age, gender, risk class, and face band, with the same death benefit
+// option, premium mode, table rating, and state) into model points, each
+// projected once as a representative policy: the first member with the
+// mean face amount and annual premium of the group. A member's values are
+// the representative's scaled by the ratio of its face amount to the
+// representative's, so the members' values add to the representative's
+// times the number of members. Policies with anything else set (riders,
+// schedules, dates, a second life, inforce values) are model points of
+// their own.
+type ModelPoints struct {
+	// Policies are the representative policies in order of their first
+	// member in the census.
+	Policies []Policy
+	members  map[string][]Policy
+}
+
+// CompressCensus groups the policies into model points by the face bands,
+// the smallest face amount of each band in ascending order (see
+// ParseFaceBands); no bands puts every face amount in one band.
+func CompressCensus(policies []Policy, bands []float64) *ModelPoints {
+	m := &ModelPoints{members: make(map[string][]Policy)}
+	// representative index by cell
+	cells := make(map[string]int)
+	var groups [][]Policy
+	for _, policy := range policies {
+		cell, ok := modelPointCell(policy, bands)
+		i, found := cells[cell]
+		if !ok || !found {
+			i = len(groups)
+			groups = append(groups, nil)
+			if ok {
+				cells[cell] = i
+			}
+		}
+		groups[i] = append(groups[i], policy)
+	}
+	for _, group := range groups {
+		point := group[0]
+		if len(group) > 1 {
+			face, premium := 0.0, 0.0
+			for _, member := range group {
+				face += member.FaceAmount
+				premium += member.AnnualPremium
+			}
+			point.FaceAmount = face / float64(len(group))
+			point.AnnualPremium = premium / float64(len(group))
+		}
+		m.Policies = append(m.Policies, point)
+		m.members[point.ID] = group
+	}
+	return m
+}
+
+// modelPointCell returns the rating cell of the policy, false when the
+// policy is not grouped.
+func modelPointCell(policy Policy, bands []float64) (string, bool) {
+	rest := policy
+	rest.ID, rest.FaceAmount, rest.AnnualPremium = "", 0, 0
+	rest.IssueAge, rest.Gender, rest.RiskClass = 0, "", ""
+	rest.DBOption, rest.PremiumMode, rest.TableRating, rest.State = "", "", 0, ""
+	if !reflect.ValueOf(rest).IsZero() {
+		return "", false
+	}
+	band := 0
+	for band < len(bands) && bands[band] <= policy.FaceAmount {
+		band++
+	}
+	return fmt.Sprint(policy.IssueAge, "|", policy.Gender, "|", policy.RiskClass, "|", band, "|",
+		policy.DBOption, "|", policy.PremiumMode, "|", policy.TableRating, "|", policy.State), true
+}
+
+// Members returns the census policies of the model point whose
+// representative is point, in census order.
+func (m *ModelPoints) Members(point Policy) []Policy {
+	return m.members[point.ID]
+}
+
+// Weight returns the number of policies the model point stands for.
+func (m *ModelPoints) Weight(point Policy) int {
+	return len(m.members[point.ID])
+}
+
+// scale returns the ratio of a member's face amount to the
+// representative's.
+func (m *ModelPoints) scale(point Policy, member Policy) float64 {
+	if point.FaceAmount == 0 {
+		return 1
+	}
+	return member.FaceAmount / point.FaceAmount
+}
+
+// ExpandBatch returns the results of the members of a model point from the
+// result of its representative, in census order.
+func (m *ModelPoints) ExpandBatch(result BatchResult) []BatchResult {
+	members := m.Members(result.Policy)
+	if len(members) == 1 {
+		return []BatchResult{result}
+	}
+	results := make([]BatchResult, len(members))
+	for i, member := range members {
+		scale := m.scale(result.Policy, member)
+		expanded := result
+		expanded.Policy = member
+		expanded.SolvedPremium *= scale
+		expanded.MaturityValue *= scale
+		expanded.TargetPremium *= scale
+		expanded.Solves = result.Solves.scale(scale)
+		if result.Commissions != nil {
+			commissions := *result.Commissions
+			commissions.ByYear = slices.Clone(commissions.ByYear)
+			for year := range commissions.ByYear {
+				commissions.ByYear[year] *= scale
+			}
+			commissions.FirstYear *= scale
+			commissions.Renewal *= scale
+			commissions.Excess *= scale
+			commissions.Chargeback *= scale
+			commissions.Total *= scale
+			expanded.Commissions = &commissions
+		}
+		results[i] = expanded
+	}
+	return results
+}
+
+// ParseFaceBands parses the smallest face amount of each band, e.g.
+// "0,100000,250000,1000000", in ascending order.
+func ParseFaceBands(spec string) ([]float64, error) {
+	var bands []float64
+	for _, text := range strings.Split(spec, ",") {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		band, err := strconv.ParseFloat(text, 64)
+		if err != nil || band < 0 {
+			return nil, fmt.Errorf("invalid face band %q", text)
+		}
+		if len(bands) > 0 && band <= bands[len(bands)-1] {
+			return nil, fmt.Errorf("face bands not in ascending order at %q", text)
+		}
+		bands = append(bands, band)
+	}
+	return bands, nil
+}
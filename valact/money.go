@@ -0,0 +1,39 @@
+package valact
+
+import "math"
+
+// Arithmetic is how a projection carries money values.
+type Arithmetic string
+
+const (
+	// ArithmeticFloat carries money in float64 at full precision, the fast
+	// default for pricing work.
+	ArithmeticFloat Arithmetic = "float"
+	// ArithmeticCents carries money in whole cents, as an administration
+	// system does for regulatory illustrations: each premium, charge,
+	// interest credit, loan and withdrawal amount is rounded to the cent,
+	// half away from zero, as it is computed, and the account value, loan
+	// balance, and premium totals are sums of whole cents. Rates stay at
+	// full precision. Index segments, funds, and the shadow account are
+	// carried as with ArithmeticFloat.
+	ArithmeticCents Arithmetic = "cents"
+)
+
+// Valid reports whether the arithmetic is float, cents, or empty (float).
+func (a Arithmetic) Valid() bool {
+	return a == "" || a == ArithmeticFloat || a == ArithmeticCents
+}
+
+// Cents is a money amount in whole cents.
+type Cents int64
+
+// ToCents returns the amount in dollars to the nearest cent, half away from
+// zero.
+func ToCents(dollars float64) Cents {
+	return Cents(math.Round(dollars * 100))
+}
+
+// Dollars returns the amount in dollars.
+func (c Cents) Dollars() float64 {
+	return float64(c) / 100
+}
@@ -0,0 +1,79 @@
+package valact
+
+import "math"
+
+// ShadowRates are the loads, charges, and interest of a no-lapse guarantee
+// shadow account, indexed by policy year like RateSet.
+type ShadowRates struct {
+	// COI is the annual shadow COI rate per $1,000 of shadow NAAR.
+	COI []float64
+	// PremiumLoad is the load percentage on premium.
+	PremiumLoad []float64
+	// PerUnit is the annual charge per $1,000 of face amount.
+	PerUnit []float64
+	// PolicyFee is the annual policy fee.
+	PolicyFee []float64
+	// Interest is the monthly effective rate credited on a positive shadow
+	// account.
+	Interest []float64
+	// GuaranteeAge is the attained age at which the guarantee ends.
+	GuaranteeAge int
+}
+
+// GetShadowRates reads the shadow COI table, in the same layout and with the
+// same code mapping as the COI table, and fills in the default shadow loads and interest: 10% premium
+// load, the base per unit rates and policy fee, 4% interest, and a lifetime
+// guarantee.
+func (s RateSource) GetShadowRates(gender string, riskClass string, issueAge int) (*ShadowRates, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	coiRates, err := s.readCOITable(s.path(s.ShadowCOIFile, ShadowCOIFile), gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	perUnitRates, err := s.GetPerUnitRates(issueAge)
+	if err != nil {
+		return nil, err
+	}
+	years := s.projectionYears(issueAge)
+	return &ShadowRates{
+		COI:          coiRates,
+		PremiumLoad:  CreateVector(0.10, years),
+		PerUnit:      perUnitRates,
+		PolicyFee:    CreateVector(120, years),
+		Interest:     CreateVector(math.Pow(1.04, 1/12.0)-1, years),
+		GuaranteeAge: s.product().maturityAge(),
+	}, nil
+}
+
+// shadowAccount is the running shadow account of a projection.
+type shadowAccount struct {
+	rates *ShadowRates
+	value float64
+}
+
+// roll advances the shadow account one month: premium net of load, less
+// the monthly expense, COI (rated like the policy), and flat extra charges
+// and any withdrawal, plus interest on a positive balance. The shadow death
+// benefit follows the policy's option without a corridor.
+func (a *shadowAccount) roll(policy Policy, policyYear int, premium float64, withdrawal float64, faceAmount float64, option DBOption, naarDiscount float64) {
+	r := a.rates
+	value := a.value + premium*(1-r.PremiumLoad[policyYear-1]) - withdrawal
+	value -= (r.PolicyFee[policyYear-1] + r.PerUnit[policyYear-1]*faceAmount/1000) / 12
+	db := faceAmount
+	if option.isB() {
+		db += max(0, value)
+	}
+	naar := max(0, db*naarDiscount-max(0, value))
+	value -= naar / 1000 * policy.ratedCOI(r.COI[policyYear-1]) / 12
+	value -= policy.flatExtra(policyYear) * faceAmount / 1000 / 12
+	a.value = value + max(0, value)*r.Interest[policyYear-1]
+}
+
+// holds reports whether the guarantee keeps the policy in force this month:
+// before the guarantee age with a shadow account above the loan balance.
+func (a *shadowAccount) holds(attainedAge int, loanBalance float64) bool {
+	return attainedAge < a.rates.GuaranteeAge && a.value-loanBalance > 0
+}
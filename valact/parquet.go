@@ -0,0 +1,1007 @@
+package valact
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"approach1/valact/internal/zstd"
+)
+
+// ParquetSuffix is the suffix of Apache Parquet files, read by OpenFile: a
+// census, or a table of any flat schema, with each column named as the CSV
+// file's. Rows are read a row group at a time, a census's values by their
+// Parquet types; read as CSV, values are as they would be written there:
+// DATE and timestamp columns as YYYY-MM-DD, decimals by their scale, and
+// nulls blank. Errors give a row's line as in that CSV, its row number
+// plus one. Pages may be uncompressed or snappy, gzip, or zstd compressed,
+// plain or dictionary encoded.
+const ParquetSuffix = ".parquet"
+
+var parquetMagic = []byte("PAR1")
+
+// Parquet physical types.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetInt96     = 3
+	parquetFloat     = 4
+	parquetDouble    = 5
+	parquetByteArray = 6
+	parquetFixed     = 7
+)
+
+// Parquet encodings, compression codecs, and page types used here.
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// errParquet is wrapped by the errors of files that are not Parquet or use
+// what is not supported.
+var errParquet = errors.New("parquet")
+
+// parquetColumn is a column of a flat Parquet schema.
+type parquetColumn struct {
+	name       string
+	physical   int64
+	typeLength int
+	optional   bool
+	// converted and logical are the column's type annotations, the legacy
+	// converted type (-1 for none) and the logical type union
+	converted int64
+	logical   thriftStruct
+	// scale is a decimal's
+	scale int
+}
+
+// parquetKind is how a column's values are held once decoded.
+type parquetKind int
+
+const (
+	parquetInts parquetKind = iota
+	parquetFloats
+	// parquetTexts are byte arrays, and decimals as their exact digits
+	parquetTexts
+	// parquetTimes are dates and timestamps
+	parquetTimes
+	parquetBools
+)
+
+// parquetValues are the decoded values of a column's row group, or of its
+// dictionary, in the slice of their kind. Nulls are zero there, and true in
+// nulls, which is empty for required columns.
+type parquetValues struct {
+	kind   parquetKind
+	nulls  []bool
+	ints   []int64
+	floats []float64
+	texts  []string
+	times  []time.Time
+	bools  []bool
+}
+
+func (v *parquetValues) len() int {
+	switch v.kind {
+	case parquetInts:
+		return len(v.ints)
+	case parquetFloats:
+		return len(v.floats)
+	case parquetTimes:
+		return len(v.times)
+	case parquetBools:
+		return len(v.bools)
+	}
+	return len(v.texts)
+}
+
+// reset empties the values, keeping their memory for the next row group.
+func (v *parquetValues) reset() {
+	v.nulls = v.nulls[:0]
+	v.ints = v.ints[:0]
+	v.floats = v.floats[:0]
+	v.texts = v.texts[:0]
+	v.times = v.times[:0]
+	v.bools = v.bools[:0]
+}
+
+// appendNull appends a null.
+func (v *parquetValues) appendNull() {
+	switch v.kind {
+	case parquetInts:
+		v.ints = append(v.ints, 0)
+	case parquetFloats:
+		v.floats = append(v.floats, 0)
+	case parquetTimes:
+		v.times = append(v.times, time.Time{})
+	case parquetBools:
+		v.bools = append(v.bools, false)
+	default:
+		v.texts = append(v.texts, "")
+	}
+}
+
+// appendFrom appends the value of from, of the same kind, at i.
+func (v *parquetValues) appendFrom(from *parquetValues, i int) {
+	switch v.kind {
+	case parquetInts:
+		v.ints = append(v.ints, from.ints[i])
+	case parquetFloats:
+		v.floats = append(v.floats, from.floats[i])
+	case parquetTimes:
+		v.times = append(v.times, from.times[i])
+	case parquetBools:
+		v.bools = append(v.bools, from.bools[i])
+	default:
+		v.texts = append(v.texts, from.texts[i])
+	}
+}
+
+func (v *parquetValues) null(row int) bool {
+	return row < len(v.nulls) && v.nulls[row]
+}
+
+// text returns the value at the row as it would be written in CSV, "" for
+// a null.
+func (v *parquetValues) text(row int) string {
+	if v.null(row) {
+		return ""
+	}
+	switch v.kind {
+	case parquetInts:
+		return strconv.FormatInt(v.ints[row], 10)
+	case parquetFloats:
+		return formatFloat(v.floats[row])
+	case parquetTimes:
+		return formatTimestamp(v.times[row])
+	case parquetBools:
+		return strconv.FormatBool(v.bools[row])
+	}
+	return v.texts[row]
+}
+
+// parquetTable reads the rows of a Parquet file a row group at a time,
+// reading each column chunk of the group from the file and decoding its
+// values by their type. A tableReader reads the typed values of its rows;
+// other readers read it as CSV, which Read writes a batch of rows at a
+// time.
+type parquetTable struct {
+	name    string
+	file    io.ReaderAt
+	size    int64
+	closer  io.Closer
+	columns []parquetColumn
+	groups  []thriftStruct
+	// group is the index of the next row group to read; values are the
+	// current one's, of rows rows, at row
+	group     int
+	values    []parquetValues
+	rows, row int
+	// line is the current row's line in the CSV, after its header
+	line int
+	err  error
+	// csv is CSV written by Read and not yet read
+	csv    bytes.Buffer
+	record []string
+	header bool
+}
+
+// parquetBatchRows is the number of rows Read writes as CSV at a time.
+const parquetBatchRows = 1 << 10
+
+// newParquetTable reads the footer of the Parquet file, from which it will
+// read the rows; closing the table closes the file. A file that cannot be
+// read at offsets, e.g. one being decompressed, is read into memory.
+func newParquetTable(file io.ReadCloser, name string) (*parquetTable, error) {
+	p := &parquetTable{name: name, closer: file, line: 1}
+	stat, ok := file.(interface{ Stat() (fs.FileInfo, error) })
+	if at, atOK := file.(io.ReaderAt); ok && atOK {
+		info, err := stat.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		p.file, p.size = at, info.Size()
+	} else {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		p.file, p.size = bytes.NewReader(data), int64(len(data))
+	}
+	meta, err := readParquetFooter(p.file, p.size)
+	if err == nil {
+		p.columns, err = parquetSchema(meta)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	p.groups = meta.structs(4)
+	p.values = make([]parquetValues, len(p.columns))
+	for i := range p.columns {
+		p.values[i].kind = p.columns[i].kind()
+	}
+	return p, nil
+}
+
+// names returns the column names, the CSV's header.
+func (p *parquetTable) names() []string {
+	names := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// next moves to the next row, reading the next row group at the end of the
+// current one. It returns false at the end of the file or on an error,
+// which err holds.
+func (p *parquetTable) next() bool {
+	p.row++
+	for p.row >= p.rows {
+		if p.err != nil || p.group >= len(p.groups) {
+			return false
+		}
+		if p.err = p.readGroup(p.groups[p.group]); p.err != nil {
+			p.err = fmt.Errorf("%s: %w", p.name, p.err)
+			return false
+		}
+		p.group++
+		p.row = 0
+	}
+	p.line++
+	return true
+}
+
+// readGroup reads the values of the row group's column chunks.
+func (p *parquetTable) readGroup(group thriftStruct) error {
+	chunks := group.structs(1)
+	if len(chunks) != len(p.columns) {
+		return fmt.Errorf("%w: row group of %d columns for %d", errParquet, len(chunks), len(p.columns))
+	}
+	rows := int(group.int(3))
+	for i := range p.columns {
+		p.values[i].reset()
+		if err := p.columns[i].read(p.file, p.size, chunks[i], rows, &p.values[i]); err != nil {
+			return fmt.Errorf("column %s: %w", p.columns[i].name, err)
+		}
+	}
+	p.rows = rows
+	return nil
+}
+
+// text returns the current row's value of the column as CSV text.
+func (p *parquetTable) text(column int) string {
+	return p.values[column].text(p.row)
+}
+
+// Read reads the table as CSV.
+func (p *parquetTable) Read(b []byte) (int, error) {
+	for p.csv.Len() == 0 {
+		if err := p.writeCSV(); err != nil {
+			return 0, err
+		}
+	}
+	return p.csv.Read(b)
+}
+
+// writeCSV writes the header, or the next batch of rows, as CSV, returning
+// io.EOF after the last row.
+func (p *parquetTable) writeCSV() error {
+	w := csv.NewWriter(&p.csv)
+	if !p.header {
+		p.header = true
+		w.Write(p.names())
+	}
+	for n := 0; n < parquetBatchRows && p.next(); n++ {
+		p.record = p.record[:0]
+		for i := range p.columns {
+			p.record = append(p.record, p.text(i))
+		}
+		w.Write(p.record)
+	}
+	w.Flush()
+	if p.err != nil {
+		return p.err
+	}
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if p.csv.Len() == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+func (p *parquetTable) Close() error {
+	return p.closer.Close()
+}
+
+// readParquetFooter reads the file metadata of the Parquet file of the
+// size, which ends with it, its length, and the magic number.
+func readParquetFooter(r io.ReaderAt, size int64) (thriftStruct, error) {
+	tail := make([]byte, 8)
+	if size < 12 {
+		return nil, fmt.Errorf("%w: not a Parquet file", errParquet)
+	}
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	length := int64(binary.LittleEndian.Uint32(tail))
+	if !bytes.Equal(tail[4:], parquetMagic) || length > size-12 {
+		return nil, fmt.Errorf("%w: not a Parquet file", errParquet)
+	}
+	footer := make([]byte, length)
+	if _, err := r.ReadAt(footer, size-8-length); err != nil {
+		return nil, err
+	}
+	meta, _, err := decodeThrift(footer)
+	return meta, err
+}
+
+// parquetSchema returns the columns of a flat schema.
+func parquetSchema(meta thriftStruct) ([]parquetColumn, error) {
+	elements := meta.structs(2)
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("%w: no schema", errParquet)
+	}
+	var columns []parquetColumn
+	for _, e := range elements[1:] {
+		name := e.string(4)
+		if e.int(5) > 0 || e.int(3) == 2 {
+			return nil, fmt.Errorf("%w: column %s: nested and repeated columns are not supported", errParquet, name)
+		}
+		c := parquetColumn{
+			name:       name,
+			physical:   e.int(1),
+			typeLength: int(e.int(2)),
+			optional:   e.int(3) == 1,
+			converted:  -1,
+			logical:    e.strct(10),
+		}
+		if e.has(6) {
+			c.converted = e.int(6)
+		}
+		c.scale = int(e.int(7))
+		if c.logical.has(5) {
+			c.scale = int(c.logical.strct(5).int(1))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// read appends the column's values in a row group's chunk, read from the
+// file of the size, to values.
+func (c *parquetColumn) read(file io.ReaderAt, size int64, chunk thriftStruct, rows int, values *parquetValues) error {
+	if chunk.string(1) != "" {
+		return fmt.Errorf("%w: column chunk in another file", errParquet)
+	}
+	meta := chunk.strct(3)
+	codec := meta.int(4)
+	start := meta.int(9)
+	if offset := meta.int(11); meta.has(11) && offset > 0 && offset < start {
+		start = offset
+	}
+	end := start + meta.int(7)
+	if start < 4 || end > size || end < start {
+		return fmt.Errorf("%w: column chunk out of the file", errParquet)
+	}
+	chunkData := make([]byte, end-start)
+	if _, err := file.ReadAt(chunkData, start); err != nil {
+		return err
+	}
+	var dictionary *parquetValues
+	for values.len() < rows {
+		header, n, err := decodeThrift(chunkData)
+		if err != nil {
+			return err
+		}
+		size := int(header.int(3))
+		if size < 0 || n+size > len(chunkData) {
+			return fmt.Errorf("%w: page out of its column chunk", errParquet)
+		}
+		page := chunkData[n : n+size]
+		chunkData = chunkData[n+size:]
+		switch header.int(1) {
+		case pageDictionary:
+			if page, err = decompressPage(codec, page, int(header.int(2))); err != nil {
+				return err
+			}
+			dictionary = &parquetValues{kind: values.kind}
+			if err = c.plain(page, int(header.strct(7).int(1)), dictionary); err != nil {
+				return err
+			}
+		case pageData:
+			if page, err = decompressPage(codec, page, int(header.int(2))); err != nil {
+				return err
+			}
+			h := header.strct(5)
+			count := int(h.int(1))
+			var levels []int
+			if c.optional {
+				if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+					return fmt.Errorf("%w: definition levels out of the page", errParquet)
+				}
+				length := int(binary.LittleEndian.Uint32(page))
+				if levels, err = decodeHybrid(page[4:4+length], 1, count); err != nil {
+					return err
+				}
+				page = page[4+length:]
+			}
+			if err = c.appendValues(values, page, h.int(2), count, levels, dictionary); err != nil {
+				return err
+			}
+		case pageDataV2:
+			h := header.strct(8)
+			count := int(h.int(1))
+			levelsLength, repetitionLength := int(h.int(5)), int(h.int(6))
+			if levelsLength < 0 || repetitionLength < 0 || repetitionLength+levelsLength > len(page) {
+				return fmt.Errorf("%w: levels out of the page", errParquet)
+			}
+			var levels []int
+			if c.optional {
+				if levels, err = decodeHybrid(page[repetitionLength:repetitionLength+levelsLength], 1, count); err != nil {
+					return err
+				}
+			}
+			page = page[repetitionLength+levelsLength:]
+			if h.bool(7, true) {
+				if page, err = decompressPage(codec, page, int(header.int(2))-repetitionLength-levelsLength); err != nil {
+					return err
+				}
+			}
+			if err = c.appendValues(values, page, h.int(4), count, levels, dictionary); err != nil {
+				return err
+			}
+		}
+		if len(chunkData) == 0 && values.len() < rows {
+			return fmt.Errorf("%w: %d values for %d rows", errParquet, values.len(), rows)
+		}
+	}
+	return nil
+}
+
+// appendValues appends a data page's count values, null where the
+// definition levels, when given, are 0.
+func (c *parquetColumn) appendValues(values *parquetValues, page []byte, encoding int64, count int, levels []int, dictionary *parquetValues) error {
+	defined := count
+	if levels != nil {
+		defined = 0
+		for _, level := range levels {
+			defined += level
+		}
+	}
+	decoded := &parquetValues{kind: values.kind}
+	switch encoding {
+	case encodingPlain:
+		if err := c.plain(page, defined, decoded); err != nil {
+			return err
+		}
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if dictionary == nil {
+			return fmt.Errorf("%w: dictionary encoded page without a dictionary", errParquet)
+		}
+		if len(page) == 0 {
+			if defined > 0 {
+				return fmt.Errorf("%w: empty page", errParquet)
+			}
+			break
+		}
+		indexes, err := decodeHybrid(page[1:], int(page[0]), defined)
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if index >= dictionary.len() {
+				return fmt.Errorf("%w: dictionary index %d of %d", errParquet, index, dictionary.len())
+			}
+			decoded.appendFrom(dictionary, index)
+		}
+	default:
+		return fmt.Errorf("%w: encoding %d is not supported", errParquet, encoding)
+	}
+	next := 0
+	for i := range count {
+		if levels != nil {
+			values.nulls = append(values.nulls, levels[i] == 0)
+			if levels[i] == 0 {
+				values.appendNull()
+				continue
+			}
+		}
+		values.appendFrom(decoded, next)
+		next++
+	}
+	return nil
+}
+
+// decompressPage decompresses a page by the column's codec.
+func decompressPage(codec int64, page []byte, size int) ([]byte, error) {
+	var r io.Reader
+	switch codec {
+	case codecUncompressed:
+		return page, nil
+	case codecSnappy:
+		return decodeSnappy(page)
+	case codecGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case codecZstd:
+		r = zstd.NewReader(bytes.NewReader(page))
+	default:
+		return nil, fmt.Errorf("%w: compression codec %d is not supported", errParquet, codec)
+	}
+	out := bytes.NewBuffer(make([]byte, 0, max(size, 0)))
+	if _, err := io.Copy(out, r); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decodeHybrid decodes count values of the bit width in the RLE and bit
+// packed hybrid encoding of definition levels and dictionary indexes.
+func decodeHybrid(data []byte, width int, count int) ([]int, error) {
+	if width > 32 {
+		return nil, fmt.Errorf("%w: bit width %d", errParquet, width)
+	}
+	values := make([]int, 0, count)
+	for len(values) < count {
+		header, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: truncated levels or indexes", errParquet)
+		}
+		data = data[n:]
+		if header&1 == 0 {
+			// a run of one value
+			size := (width + 7) / 8
+			if len(data) < size {
+				return nil, fmt.Errorf("%w: truncated levels or indexes", errParquet)
+			}
+			value := 0
+			for i := size - 1; i >= 0; i-- {
+				value = value<<8 | int(data[i])
+			}
+			data = data[size:]
+			for range min(int(header>>1), count-len(values)) {
+				values = append(values, value)
+			}
+			continue
+		}
+		// groups of 8 values packed least significant bit first
+		groups := int(header >> 1)
+		if groups*width > len(data) {
+			return nil, fmt.Errorf("%w: truncated levels or indexes", errParquet)
+		}
+		for i := 0; i < groups*8 && len(values) < count; i++ {
+			value := 0
+			for bit := range width {
+				at := i*width + bit
+				value |= int(data[at/8]>>(at%8)&1) << bit
+			}
+			values = append(values, value)
+		}
+		data = data[groups*width:]
+	}
+	return values, nil
+}
+
+// plain appends count plain encoded values to values.
+func (c *parquetColumn) plain(data []byte, count int, values *parquetValues) error {
+	truncated := fmt.Errorf("%w: truncated values", errParquet)
+	for i := range count {
+		switch c.physical {
+		case parquetBoolean:
+			if i/8 >= len(data) {
+				return truncated
+			}
+			values.bools = append(values.bools, data[i/8]>>(i%8)&1 == 1)
+		case parquetInt32:
+			if len(data) < 4 {
+				return truncated
+			}
+			c.appendInt(values, int64(int32(binary.LittleEndian.Uint32(data))))
+			data = data[4:]
+		case parquetInt64:
+			if len(data) < 8 {
+				return truncated
+			}
+			c.appendInt(values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case parquetInt96:
+			if len(data) < 12 {
+				return truncated
+			}
+			// nanoseconds of the day, then the Julian day
+			nanos := int64(binary.LittleEndian.Uint64(data))
+			day := int64(binary.LittleEndian.Uint32(data[8:]))
+			values.times = append(values.times, time.Unix((day-2440588)*86400, nanos).UTC())
+			data = data[12:]
+		case parquetFloat:
+			if len(data) < 4 {
+				return truncated
+			}
+			// the float's shortest decimal, e.g. 0.1 and not 0.100000001
+			f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+			value, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+			values.floats = append(values.floats, value)
+			data = data[4:]
+		case parquetDouble:
+			if len(data) < 8 {
+				return truncated
+			}
+			values.floats = append(values.floats, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case parquetByteArray:
+			if len(data) < 4 || int(binary.LittleEndian.Uint32(data)) > len(data)-4 {
+				return truncated
+			}
+			length := int(binary.LittleEndian.Uint32(data))
+			values.texts = append(values.texts, c.formatBytes(data[4:4+length]))
+			data = data[4+length:]
+		case parquetFixed:
+			if len(data) < c.typeLength {
+				return truncated
+			}
+			values.texts = append(values.texts, c.formatBytes(data[:c.typeLength]))
+			data = data[c.typeLength:]
+		default:
+			return fmt.Errorf("%w: physical type %d", errParquet, c.physical)
+		}
+	}
+	return nil
+}
+
+// kind returns how the column's values are held, by its physical type and
+// annotation.
+func (c *parquetColumn) kind() parquetKind {
+	switch {
+	case c.decimal():
+		return parquetTexts
+	case c.physical == parquetInt96 || c.physical == parquetInt32 && c.date() || c.physical == parquetInt64 && c.timestamp():
+		return parquetTimes
+	case c.physical == parquetBoolean:
+		return parquetBools
+	case c.physical == parquetInt32 || c.physical == parquetInt64:
+		return parquetInts
+	case c.physical == parquetFloat || c.physical == parquetDouble:
+		return parquetFloats
+	}
+	return parquetTexts
+}
+
+func (c *parquetColumn) date() bool {
+	return c.logical.has(6) || c.converted == 6
+}
+
+func (c *parquetColumn) timestamp() bool {
+	return c.logical.has(8) || c.converted == 9 || c.converted == 10
+}
+
+// appendInt appends an integer by the column's annotation: a decimal, a
+// date or timestamp, or else the integer.
+func (c *parquetColumn) appendInt(values *parquetValues, value int64) {
+	switch values.kind {
+	case parquetTexts:
+		values.texts = append(values.texts, c.formatDecimal(big.NewInt(value)))
+	case parquetTimes:
+		values.times = append(values.times, c.time(value))
+	default:
+		values.ints = append(values.ints, value)
+	}
+}
+
+// time returns the date or timestamp of an integer by the column's unit.
+func (c *parquetColumn) time(value int64) time.Time {
+	switch {
+	case c.date():
+		return time.Unix(value*86400, 0).UTC()
+	case c.logical.has(8):
+		unit := c.logical.strct(8).strct(2)
+		switch {
+		case unit.has(1):
+			return time.UnixMilli(value).UTC()
+		case unit.has(2):
+			return time.UnixMicro(value).UTC()
+		}
+		return time.Unix(0, value).UTC()
+	case c.converted == 9:
+		return time.UnixMilli(value).UTC()
+	}
+	return time.UnixMicro(value).UTC()
+}
+
+// formatBytes formats a byte array by the column's annotation: a decimal's
+// big endian two's complement, or else text.
+func (c *parquetColumn) formatBytes(value []byte) string {
+	if !c.decimal() {
+		return string(value)
+	}
+	unscaled := new(big.Int).SetBytes(value)
+	if len(value) > 0 && value[0]&0x80 != 0 {
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(value))))
+	}
+	return c.formatDecimal(unscaled)
+}
+
+func (c *parquetColumn) decimal() bool {
+	return c.logical.has(5) || c.converted == 5
+}
+
+// formatDecimal formats an unscaled decimal by the column's scale.
+func (c *parquetColumn) formatDecimal(unscaled *big.Int) string {
+	scale := c.scale
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits + strings.Repeat("0", -scale)
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// formatTimestamp formats a timestamp as a date at midnight, else with its
+// time.
+func formatTimestamp(t time.Time) string {
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format(DateLayout)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parquetWriter writes a Parquet file of a flat schema a row group at a
+// time, gzip compressing its pages. Each flush writes the footer after the
+// row groups so far, making the output a complete file; rows added after
+// it go into new row groups, and the next flush's footer supersedes it.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []parquetColumnWriter
+	// rows is the number of rows added since the last row group
+	rows      int
+	rowGroups []any
+	numRows   int64
+	// groupRows is the number of rows at which a row group is ended
+	groupRows int
+}
+
+// parquetColumnWriter is a column of a parquetWriter and the values of the
+// row group it is writing.
+type parquetColumnWriter struct {
+	parquetColumn
+	// values are the plain encoding of the values given; levels the
+	// definition levels of an optional column, 0 for null
+	values []byte
+	levels []byte
+}
+
+// parquetRowGroupRows is the number of rows at which a parquetWriter's row
+// groups are ended.
+const parquetRowGroupRows = 64 << 10
+
+// stringColumn, int32Column, and doubleColumn are column declarations for
+// newParquetWriter.
+func stringColumn(name string, optional bool) parquetColumn {
+	return parquetColumn{name: name, physical: parquetByteArray, optional: optional, converted: 0, logical: thriftStruct{1: thriftStruct{}}}
+}
+
+func int32Column(name string, optional bool) parquetColumn {
+	return parquetColumn{name: name, physical: parquetInt32, optional: optional, converted: -1}
+}
+
+func doubleColumn(name string, optional bool) parquetColumn {
+	return parquetColumn{name: name, physical: parquetDouble, optional: optional, converted: -1}
+}
+
+// newParquetWriter returns a writer of the columns to w, at the offset of
+// a file ending with the footer, whose row groups it keeps, or at 0 for a
+// new file.
+func newParquetWriter(w io.Writer, columns []parquetColumn, footer thriftStruct, offset int64) *parquetWriter {
+	p := &parquetWriter{w: w, offset: offset, groupRows: parquetRowGroupRows}
+	for _, c := range columns {
+		p.columns = append(p.columns, parquetColumnWriter{parquetColumn: c})
+	}
+	if footer != nil {
+		list, _ := footer[4].(thriftList)
+		p.rowGroups = list.items
+		p.numRows = footer.int(3)
+	}
+	return p
+}
+
+// add adds a row of values by column: string, int32, or float64 as the
+// column's type, or nil for null in an optional column.
+func (p *parquetWriter) add(values ...any) error {
+	for i := range p.columns {
+		c := &p.columns[i]
+		if c.optional {
+			level := byte(1)
+			if values[i] == nil {
+				level = 0
+			}
+			c.levels = append(c.levels, level)
+		}
+		switch v := values[i].(type) {
+		case nil:
+		case string:
+			c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(v)))
+			c.values = append(c.values, v...)
+		case int32:
+			c.values = binary.LittleEndian.AppendUint32(c.values, uint32(v))
+		case float64:
+			c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(v))
+		}
+	}
+	p.rows++
+	if p.rows >= p.groupRows {
+		return p.writeRowGroup()
+	}
+	return nil
+}
+
+// write writes data at the offset, after the magic number that starts a
+// new file.
+func (p *parquetWriter) write(data []byte) error {
+	if p.offset == 0 {
+		if _, err := p.w.Write(parquetMagic); err != nil {
+			return err
+		}
+		p.offset = int64(len(parquetMagic))
+	}
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// writeRowGroup writes the rows added as a row group, each column a chunk
+// of one data page.
+func (p *parquetWriter) writeRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+	var chunks []any
+	var total, totalCompressed int64
+	if err := p.write(nil); err != nil {
+		return err
+	}
+	start := p.offset
+	for i := range p.columns {
+		c := &p.columns[i]
+		var page []byte
+		if c.optional {
+			levels := encodeLevels(c.levels)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, c.values...)
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		header := encodeThrift(nil, thriftStruct{
+			1: int32(pageData),
+			2: int32(len(page)),
+			3: int32(compressed.Len()),
+			5: thriftStruct{
+				1: int32(p.rows),
+				2: int32(encodingPlain),
+				3: int32(encodingRLE),
+				4: int32(encodingRLE),
+			},
+		})
+		offset := p.offset
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(compressed.Bytes()); err != nil {
+			return err
+		}
+		size := int64(len(header) + len(page))
+		compressedSize := int64(len(header) + compressed.Len())
+		total += size
+		totalCompressed += compressedSize
+		chunks = append(chunks, thriftStruct{
+			2: offset,
+			3: thriftStruct{
+				1: int32(c.physical),
+				2: thriftList{elem: compactI32, items: []any{int32(encodingPlain), int32(encodingRLE)}},
+				3: thriftList{elem: compactBinary, items: []any{c.name}},
+				4: int32(codecGzip),
+				5: int64(p.rows),
+				6: size,
+				7: compressedSize,
+				9: offset,
+			},
+		})
+		c.values, c.levels = c.values[:0], c.levels[:0]
+	}
+	p.rowGroups = append(p.rowGroups, thriftStruct{
+		1: thriftList{elem: compactStruct, items: chunks},
+		2: total,
+		3: int64(p.rows),
+		5: start,
+		6: totalCompressed,
+	})
+	p.numRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// flush writes the rows added as a row group, then the footer.
+func (p *parquetWriter) flush() error {
+	if err := p.writeRowGroup(); err != nil {
+		return err
+	}
+	schema := []any{thriftStruct{4: "schema", 5: int32(len(p.columns))}}
+	for _, c := range p.columns {
+		element := thriftStruct{1: int32(c.physical), 3: int32(0), 4: c.name}
+		if c.optional {
+			element[3] = int32(1)
+		}
+		if c.converted >= 0 {
+			element[6] = int32(c.converted)
+		}
+		if c.logical != nil {
+			element[10] = c.logical
+		}
+		schema = append(schema, element)
+	}
+	footer := encodeThrift(nil, thriftStruct{
+		1: int32(1),
+		2: thriftList{elem: compactStruct, items: schema},
+		3: p.numRows,
+		4: thriftList{elem: compactStruct, items: p.rowGroups},
+		6: "valact",
+	})
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return p.write(append(footer, parquetMagic...))
+}
+
+// encodeLevels encodes definition levels of 0 and 1 as RLE runs.
+func encodeLevels(levels []byte) []byte {
+	var out []byte
+	for len(levels) > 0 {
+		run := 1
+		for run < len(levels) && levels[run] == levels[0] {
+			run++
+		}
+		out = binary.AppendUvarint(out, uint64(run)<<1)
+		out = append(out, levels[0])
+		levels = levels[run:]
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+package valact
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The files in testdata/parquet were written by Apache Arrow's Go Parquet
+// writer (github.com/apache/arrow-go/v18 pqarrow): the same census of five
+// policies with a decimal face amount, float32 rating, int64 inforce month,
+// DATE columns, and nulls, as census_arrow_snappy.parquet with snappy and
+// dictionary encoded pages in row groups of two rows, and as
+// census_arrow_zstd_v2.parquet with zstd compressed plain data pages v2.
+func TestReadParquetReference(t *testing.T) {
+	for _, name := range []string{"census_arrow_snappy.parquet", "census_arrow_zstd_v2.parquet"} {
+		t.Run(name, func(t *testing.T) {
+			file, err := OpenFile(filepath.Join("testdata", "parquet", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			policies, err := ReadCensus(file, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(policies) != 5 {
+				t.Fatalf("read %d policies, want 5", len(policies))
+			}
+			p1, p2, p3, p5 := policies[0], policies[1], policies[2], policies[4]
+			if p1.ID != "P1" || p1.IssueAge != 35 || p1.Gender != "M" || p1.RiskClass != "NS" || p1.FaceAmount != 100000 || p1.AnnualPremium != 1255.03 || p1.DBOption != DBOptionA || p1.PremiumMode != ModeAnnual {
+				t.Errorf("P1 = %+v", p1)
+			}
+			if p2.IssueAge != 60 || p2.RiskClass != "SM" || p2.DBOption != DBOptionB || p2.PremiumMode != ModeMonthly || p2.TableRating != 1.5 || p2.Waiver == nil || p2.State != "NY" {
+				t.Errorf("P2 = %+v", p2)
+			}
+			birth := time.Date(1980, 6, 15, 0, 0, 0, 0, time.UTC)
+			issue := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			if !p3.BirthDate.Equal(birth) || !p3.IssueDate.Equal(issue) || p3.IssueAge != 45 || p3.FaceAmount != 500000.50 || p3.AnnualPremium != 0 {
+				t.Errorf("P3 = %+v", p3)
+			}
+			if policies[3].PremiumMode != ModeQuarterly || policies[3].Waiver != nil {
+				t.Errorf("P4 = %+v", policies[3])
+			}
+			if p5.Inforce == nil || p5.Inforce.PolicyMonth != 24 || p5.Inforce.AccountValue != 4321.5 || p5.AnnualPremium != 3000.1 {
+				t.Errorf("P5 = %+v, inforce %+v", p5, p5.Inforce)
+			}
+		})
+	}
+}
+
+// writeParquet writes the rows to a Parquet file in row groups of two rows,
+// returning its path.
+func writeParquet(t *testing.T, columns []parquetColumn, rows [][]any) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "census.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := newParquetWriter(file, columns, nil, 0)
+	w.groupRows = 2
+	for _, row := range rows {
+		if err := w.add(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var parquetCensusColumns = []parquetColumn{
+	stringColumn("Policy_ID", false),
+	int32Column("Issue_Age", false),
+	stringColumn("Gender", false),
+	stringColumn("Risk_Class", false),
+	doubleColumn("Face_Amount", false),
+	doubleColumn("Annual_Premium", true),
+	stringColumn("State", true),
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	path := writeParquet(t, parquetCensusColumns, [][]any{
+		{"A", int32(35), "M", "NS", 100000.0, 1255.03, nil},
+		{"B", int32(45), "F", "SM", 250000.0, nil, "NY"},
+		{"C", int32(55), "M", "NS", 0.1, 2000.0, ""},
+		{"D", int32(65), "F", "NS", 1e6, nil, nil},
+		{"E", int32(0), "M", "NS", 50000.0, 1.0 / 3, "TX"},
+	})
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := ReadCensus(file, path)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		id      string
+		age     int
+		face    float64
+		premium float64
+		state   string
+	}
+	var got []row
+	for _, p := range policies {
+		got = append(got, row{p.ID, p.IssueAge, p.FaceAmount, p.AnnualPremium, p.State})
+	}
+	want := []row{
+		{"A", 35, 100000, 1255.03, ""},
+		{"B", 45, 250000, 0, "NY"},
+		{"C", 55, 0.1, 2000, ""},
+		{"D", 65, 1e6, 0, ""},
+		{"E", 0, 50000, 1.0 / 3, "TX"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+
+	// read as CSV, nulls are blank and numbers as written in CSV
+	file, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "Policy_ID,Issue_Age,Gender,Risk_Class,Face_Amount,Annual_Premium,State\n" +
+		"A,35,M,NS,100000,1255.03,\n" +
+		"B,45,F,SM,250000,,NY\n" +
+		"C,55,M,NS,0.1,2000,\n" +
+		"D,65,F,NS,1000000,,\n" +
+		"E,0,M,NS,50000,0.3333333333333333,TX\n"
+	if string(data) != wantCSV {
+		t.Errorf("CSV:\n%s\nwant:\n%s", data, wantCSV)
+	}
+}
+
+func TestParquetFieldError(t *testing.T) {
+	columns := append([]parquetColumn{}, parquetCensusColumns...)
+	columns[1] = stringColumn("Issue_Age", false)
+	path := writeParquet(t, columns, [][]any{
+		{"A", "35", "M", "NS", 100000.0, nil, nil},
+		{"B", "45", "F", "NS", 100000.0, nil, nil},
+		{"C", "x", "M", "NS", 100000.0, nil, nil},
+	})
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = ReadCensus(file, "census.parquet")
+	if !errors.Is(err, errNotWholeNumber) || !strings.Contains(err.Error(), "census.parquet line 4: Issue_Age \"x\"") {
+		t.Errorf("error %v, want Issue_Age \"x\" not a whole number at line 4", err)
+	}
+}
+
+func TestParquetNotParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "census.parquet")
+	if err := os.WriteFile(path, []byte("Policy_ID,Issue_Age\nA,35\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(path); !errors.Is(err, errParquet) {
+		t.Errorf("error %v, want %v", err, errParquet)
+	}
+}
+
+func TestDecodeSnappy(t *testing.T) {
+	// a literal "abcd", then a copy of 8 bytes at offset 4, overlapping it
+	block := []byte{12, 3 << 2, 'a', 'b', 'c', 'd', 1 | (8-4)<<2, 4}
+	got, err := decodeSnappy(block)
+	if err != nil || string(got) != "abcdabcdabcd" {
+		t.Errorf("decodeSnappy = %q, %v, want abcdabcdabcd", got, err)
+	}
+	for _, bad := range [][]byte{
+		{12, 3 << 2, 'a', 'b'},                  // literal past the end
+		{12, 1 | (8-4)<<2, 4},                   // copy before any output
+		{5, 3 << 2, 'a', 'b', 'c', 'd'},         // shorter than its length
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1}, // length too large
+	} {
+		if _, err := decodeSnappy(bad); !errors.Is(err, errSnappy) {
+			t.Errorf("decodeSnappy(%v) error %v, want %v", bad, err, errSnappy)
+		}
+	}
+}
+
+func TestThriftRoundTrip(t *testing.T) {
+	s := thriftStruct{
+		1:  int32(-7),
+		2:  []byte("schema"),
+		3:  int64(1) << 40,
+		4:  true,
+		5:  false,
+		6:  2.5,
+		20: thriftList{elem: compactStruct, items: []any{thriftStruct{1: int32(1)}, thriftStruct{1: int32(2), 4: []byte("x")}}},
+		21: thriftStruct{8: thriftStruct{1: thriftStruct{}}},
+	}
+	data := encodeThrift(nil, s)
+	got, n, err := decodeThrift(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("decoded %d bytes of %d", n, len(data))
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("decoded %v, want %v", got, s)
+	}
+	if _, _, err := decodeThrift(data[:len(data)-3]); !errors.Is(err, errThrift) {
+		t.Errorf("truncated: error %v, want %v", err, errThrift)
+	}
+}
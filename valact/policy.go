@@ -0,0 +1,294 @@
+package valact
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy describes the insured and the coverage being illustrated.
+type Policy struct {
+	// ID identifies the policy in batch input and output.
+	ID         string  `json:"id,omitempty"`
+	IssueAge   int     `json:"issue_age"`
+	Gender     string  `json:"gender"`
+	RiskClass  string  `json:"risk_class"`
+	FaceAmount float64 `json:"face_amount"`
+	// BirthDate and IssueDate, when set, are the insured's date of birth
+	// and the policy date, from which SetIssueAge computes IssueAge on
+	// AgeBasis (empty means age nearest birthday).
+	BirthDate time.Time `json:"birth_date,omitzero"`
+	IssueDate time.Time `json:"issue_date,omitzero"`
+	AgeBasis  AgeBasis  `json:"age_basis,omitempty"`
+	// AnnualPremium is paid at the start of each policy year not covered by
+	// PremiumSchedule.
+	AnnualPremium float64 `json:"annual_premium"`
+	// TargetPremium, when set, is the annual target premium, the breakpoint
+	// between the target and excess premium loads, in place of the target
+	// premium table's.
+	TargetPremium float64 `json:"target_premium,omitempty"`
+	// PremiumSchedule is the annual premium by policy year (index 0 is
+	// policy year 1), e.g. with zero years for premium holidays.
+	PremiumSchedule []float64 `json:"premium_schedule,omitempty"`
+	// PremiumMode is how often the annual premium is paid; empty means
+	// annual. Each modal payment is the annual premium times the mode's
+	// modal factor.
+	PremiumMode PremiumMode `json:"premium_mode,omitempty"`
+	// Deposits are unscheduled premiums (dump-ins, 1035 rollovers) paid at
+	// the start of a policy month in addition to the annual premium.
+	Deposits []Deposit `json:"deposits,omitempty"`
+	// DBOption selects the death benefit pattern; empty means Option A.
+	DBOption DBOption `json:"db_option,omitempty"`
+	// Changes schedules face amount and death benefit option changes.
+	Changes []PolicyChange `json:"changes,omitempty"`
+	// Loans are new loans taken at the start of the policy year, limited to
+	// the unloaned account value.
+	Loans []ScheduledAmount `json:"loans,omitempty"`
+	// LoanRepayments repay loan balance at the start of the policy year.
+	LoanRepayments []ScheduledAmount `json:"loan_repayments,omitempty"`
+	// Withdrawals are partial withdrawals at the start of the policy year,
+	// limited to the cash surrender value.
+	Withdrawals []ScheduledAmount `json:"withdrawals,omitempty"`
+	// Guideline, when set, tests premiums against the 7702 guideline
+	// premium limit.
+	Guideline *GuidelineLimit `json:"guideline,omitempty"`
+	// State is the state of issue, whose premium tax and surrender charge
+	// cap apply when set; see GetStateVariation.
+	State string `json:"state,omitempty"`
+	// TableRating multiplies the COI rates of a substandard risk, e.g. 1.5
+	// for 150%; zero means standard.
+	TableRating float64 `json:"table_rating,omitempty"`
+	// FlatExtras are extra charges per $1,000 of face amount for a limited
+	// number of policy years.
+	FlatExtras []FlatExtra `json:"flat_extras,omitempty"`
+	// Second, when set, is the second life of a survivorship (second to
+	// die) policy, projected with GetSurvivorshipRates. The primary
+	// insured's issue age sets the maturity date.
+	Second *Life `json:"second,omitempty"`
+	// FirstDeath, when set on a survivorship policy, continues coverage on
+	// the surviving life's single-life COI rates from then on.
+	FirstDeath *FirstDeath `json:"first_death,omitempty"`
+	// TermRider, when set, adds term coverage on the insured, charged at
+	// the RateSet.TermRider rates.
+	TermRider *TermRider `json:"term_rider,omitempty"`
+	// Waiver and ADB, when set, add the waiver of premium and accidental
+	// death benefit riders, charged at the RateSet.Waiver and RateSet.ADB
+	// rates.
+	Waiver *WaiverRider `json:"waiver,omitempty"`
+	ADB    *ADBRider    `json:"adb,omitempty"`
+	// Chronic, when set, adds the chronic illness acceleration rider,
+	// charged at the RateSet.Chronic rates, and projects its claim.
+	Chronic *ChronicRider `json:"chronic,omitempty"`
+	// Inforce, when set, projects from the policy's values at a valuation
+	// date instead of from issue, with FaceAmount the face in force.
+	Inforce *Inforce `json:"inforce,omitempty"`
+}
+
+// Check reports an unknown death benefit option or premium mode in a policy
+// read from JSON and sets the issue age from the dates when it has a birth
+// date.
+func (p *Policy) Check() error {
+	if !p.DBOption.Valid() {
+		return fmt.Errorf("unknown death benefit option %q", p.DBOption)
+	}
+	if !p.PremiumMode.Valid() {
+		return fmt.Errorf("unknown premium mode %q", p.PremiumMode)
+	}
+	if !p.BirthDate.IsZero() {
+		return p.SetIssueAge()
+	}
+	return nil
+}
+
+// FlatExtra is an annual charge per $1,000 of face amount, deducted monthly
+// with the COI, for Years policy years from FromYear (year 1 when zero), or
+// to maturity when Years is negative.
+type FlatExtra struct {
+	Rate     float64 `json:"rate"`
+	FromYear int     `json:"from_year,omitempty"`
+	Years    int     `json:"years"`
+}
+
+// ratedCOI applies the table rating to a COI rate, capped at the whole
+// $1,000. Survivorship rates already carry each life's rating.
+func (p Policy) ratedCOI(rate float64) float64 {
+	if p.TableRating == 0 || p.Second != nil {
+		return rate
+	}
+	return min(1000, rate*p.TableRating)
+}
+
+// flatExtra returns the annual flat extra rate per $1,000 of face amount in
+// force in the policy year.
+func (p Policy) flatExtra(policyYear int) float64 {
+	rate := 0.0
+	for _, extra := range p.FlatExtras {
+		from := max(1, extra.FromYear)
+		if policyYear >= from && (extra.Years < 0 || policyYear < from+extra.Years) {
+			rate += extra.Rate
+		}
+	}
+	return rate
+}
+
+// ScheduledAmount is a dollar amount transacted in a policy year.
+type ScheduledAmount struct {
+	PolicyYear int     `json:"policy_year"`
+	Amount     float64 `json:"amount"`
+}
+
+// PremiumMode is the premium payment frequency.
+type PremiumMode string
+
+const (
+	ModeAnnual     PremiumMode = "annual"
+	ModeSemiannual PremiumMode = "semiannual"
+	ModeQuarterly  PremiumMode = "quarterly"
+	ModeMonthly    PremiumMode = "monthly"
+)
+
+// paymentsPerYear returns the number of modal payments in a policy year, or
+// 0 for an unknown mode.
+func (m PremiumMode) paymentsPerYear() int {
+	switch m {
+	case "", ModeAnnual:
+		return 1
+	case ModeSemiannual:
+		return 2
+	case ModeQuarterly:
+		return 4
+	case ModeMonthly:
+		return 12
+	}
+	return 0
+}
+
+// Valid reports whether m is a supported mode (empty counts as annual).
+func (m PremiumMode) Valid() bool {
+	return m.paymentsPerYear() > 0
+}
+
+// ModalFactors convert an annual premium into the payment for each mode.
+type ModalFactors struct {
+	Annual     float64
+	Semiannual float64
+	Quarterly  float64
+	Monthly    float64
+}
+
+// factor returns the modal factor for the mode.
+func (f ModalFactors) factor(m PremiumMode) float64 {
+	switch m {
+	case ModeSemiannual:
+		return f.Semiannual
+	case ModeQuarterly:
+		return f.Quarterly
+	case ModeMonthly:
+		return f.Monthly
+	}
+	return f.Annual
+}
+
+// Deposit is a premium paid at the start of PolicyMonth (1 is the first
+// month of policy year 1).
+type Deposit struct {
+	PolicyMonth int     `json:"policy_month"`
+	Amount      float64 `json:"amount"`
+}
+
+// annualPremium is the premium due at the start of the policy year.
+func (p Policy) annualPremium(policyYear int) float64 {
+	if policyYear <= len(p.PremiumSchedule) {
+		return p.PremiumSchedule[policyYear-1]
+	}
+	return p.AnnualPremium
+}
+
+// deposits totals the deposits paid in the policy month.
+func (p Policy) deposits(policyMonth int) float64 {
+	total := 0.0
+	for _, deposit := range p.Deposits {
+		if deposit.PolicyMonth == policyMonth {
+			total += deposit.Amount
+		}
+	}
+	return total
+}
+
+// scheduledAmount totals the schedule entries for the policy year.
+func scheduledAmount(schedule []ScheduledAmount, policyYear int) float64 {
+	total := 0.0
+	for _, entry := range schedule {
+		if entry.PolicyYear == policyYear {
+			total += entry.Amount
+		}
+	}
+	return total
+}
+
+// PolicyChange changes the coverage from the start of PolicyYear.
+//
+// A death benefit option switch without an explicit FaceAmount keeps the
+// death benefit level at the switch: A to B reduces the face by the account
+// value and B to A increases it by the account value.
+type PolicyChange struct {
+	PolicyYear int `json:"policy_year"`
+	// FaceAmount is the new face amount; 0 leaves the face unchanged.
+	FaceAmount float64 `json:"face_amount,omitempty"`
+	// DBOption is the new death benefit option; empty leaves it unchanged.
+	DBOption DBOption `json:"db_option,omitempty"`
+}
+
+// applyChanges returns the face amount and option in force for the policy
+// year given those in force before it and the account value at the change.
+func (p Policy) applyChanges(policyYear int, faceAmount float64, option DBOption, accountValue float64) (float64, DBOption) {
+	for _, change := range p.Changes {
+		if change.PolicyYear != policyYear {
+			continue
+		}
+		if change.DBOption != "" && change.DBOption.isB() != option.isB() {
+			if change.FaceAmount == 0 {
+				if change.DBOption.isB() {
+					faceAmount = max(0, faceAmount-max(0, accountValue))
+				} else {
+					faceAmount += max(0, accountValue)
+				}
+			}
+			option = change.DBOption
+		}
+		if change.FaceAmount != 0 {
+			faceAmount = change.FaceAmount
+		}
+	}
+	return faceAmount, option
+}
+
+// DBOption is the death benefit option of a policy.
+type DBOption string
+
+const (
+	// DBOptionA is a level death benefit: the greater of the face amount and
+	// the corridor factor times the account value.
+	DBOptionA DBOption = "A"
+	// DBOptionB is an increasing death benefit: the greater of the face
+	// amount plus the account value and the corridor factor times the
+	// account value.
+	DBOptionB DBOption = "B"
+)
+
+// deathBenefit returns the death benefit for the account value under the
+// option, before NAAR discounting.
+func (o DBOption) deathBenefit(faceAmount float64, accountValue float64, corridorFactor float64) float64 {
+	if o == DBOptionB {
+		return max(faceAmount+max(0, accountValue), corridorFactor*accountValue)
+	}
+	return max(faceAmount, corridorFactor*accountValue)
+}
+
+func (o DBOption) isB() bool {
+	return o == DBOptionB
+}
+
+// Valid reports whether o is a supported option (empty counts as Option A).
+func (o DBOption) Valid() bool {
+	return o == "" || o == DBOptionA || o == DBOptionB
+}
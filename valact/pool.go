@@ -0,0 +1,20 @@
+package valact
+
+import "sync"
+
+// ledgerPool holds ledger buffers for projections whose ledgers do not
+// outlive the call, such as the solver's cash value and account value
+// targets, so repeated solves do not allocate them.
+var ledgerPool = sync.Pool{New: func() any { return new(Ledger) }}
+
+// getLedger returns an empty ledger buffer from the pool.
+func getLedger() *Ledger {
+	ledger := ledgerPool.Get().(*Ledger)
+	*ledger = (*ledger)[:0]
+	return ledger
+}
+
+// putLedger returns a ledger buffer to the pool; it must not be used after.
+func putLedger(ledger *Ledger) {
+	ledgerPool.Put(ledger)
+}
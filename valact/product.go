@@ -0,0 +1,397 @@
+package valact
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Product is a product definition: the charges, credited rates, and rules
+// that apply where there is no rate table for them. Rates are annual.
+type Product struct {
+	Code string
+	Name string
+	// DataDir is the directory of the product's rate tables, relative to
+	// the source's Dir; empty means Dir itself.
+	DataDir string
+	// PremiumLoad and PolicyFee apply when there is no loads table, with
+	// PremiumLoadExcess above target (PremiumLoad when unset).
+	PremiumLoad       float64
+	PremiumLoadExcess float64
+	PolicyFee         float64
+	// PremiumLoadCap caps the premium load dollars charged in a policy
+	// year; zero means no cap.
+	PremiumLoadCap float64
+	// MaximumPremiumLoad and MaximumPolicyFee are the guaranteed maximum
+	// premium load and annual policy fee of the guaranteed basis.
+	MaximumPremiumLoad float64
+	MaximumPolicyFee   float64
+	Interest           float64
+	MinimumInterest    float64
+	// NAARDiscount is the annual rate at which the net amount at risk is
+	// discounted for a month.
+	NAARDiscount   float64
+	LoanInterest   float64
+	LoanCrediting  float64
+	FreeWithdrawal float64
+	// MaturityAge and ExtendedMaturityAge are as in RateSet.
+	MaturityAge         int
+	ExtendedMaturityAge int
+	GracePeriodMonths   int
+	ModalFactors        ModalFactors
+	// Formulas, when any is set, replace the tables' charges; see
+	// FormulaCharges.
+	Formulas FormulaCharges
+	// Arithmetic and Rounding are as in RateSet.
+	Arithmetic Arithmetic
+	Rounding   *RoundingRules
+	// RateBases are the bases the interest rates are given in; nil means
+	// all annual effective.
+	RateBases *RateBases
+}
+
+// DefaultProduct is the product used when none is selected.
+func DefaultProduct() Product {
+	return Product{
+		PremiumLoad:        0.06,
+		PremiumLoadExcess:  0.06,
+		PolicyFee:          120,
+		MaximumPremiumLoad: 0.08,
+		MaximumPolicyFee:   180,
+		Interest:           0.03,
+		MinimumInterest:    0.02,
+		NAARDiscount:       0.01,
+		LoanInterest:       0.05,
+		LoanCrediting:      0.04,
+		FreeWithdrawal:     0.10,
+		MaturityAge:        MaturityAge,
+		GracePeriodMonths:  2,
+		ModalFactors: ModalFactors{
+			Annual:     1.0,
+			Semiannual: 0.51,
+			Quarterly:  0.26,
+			Monthly:    0.0875,
+		},
+	}
+}
+
+// loads are the product's loads in every one of the years.
+func (p Product) loads(years int) Loads {
+	return Loads{
+		PremiumLoad:       CreateVector(p.PremiumLoad, years),
+		PremiumLoadExcess: CreateVector(p.PremiumLoadExcess, years),
+		PolicyFee:         CreateVector(p.PolicyFee, years),
+	}
+}
+
+// loadCap is the product's annual premium load cap, infinite without one.
+func (p Product) loadCap() float64 {
+	if p.PremiumLoadCap == 0 {
+		return math.Inf(1)
+	}
+	return p.PremiumLoadCap
+}
+
+// charges are the product's formula charges, nil without formulas.
+func (p Product) charges() ChargeCalculator {
+	if p.Formulas == (FormulaCharges{}) {
+		return nil
+	}
+	return p.Formulas
+}
+
+// maturityAge is the attained age at which the product matures.
+func (p Product) maturityAge() int {
+	if p.MaturityAge == 0 {
+		return MaturityAge
+	}
+	return p.MaturityAge
+}
+
+// projectionEndAge is the attained age at which the product's projections
+// end: the extended maturity age when later than the maturity age.
+func (p Product) projectionEndAge() int {
+	return max(p.maturityAge(), p.ExtendedMaturityAge)
+}
+
+// ProjectionEndAge is the attained age at which projections of the source's
+// product end, its maturity age or its extended maturity age when later.
+func (s RateSource) ProjectionEndAge() int {
+	return s.product().projectionEndAge()
+}
+
+// product is the source's product, or the default.
+func (s RateSource) product() Product {
+	if s.Product == nil {
+		return DefaultProduct()
+	}
+	return *s.Product
+}
+
+// Products are product definitions by code.
+type Products map[string]Product
+
+// Codes returns the product codes in order.
+func (p Products) Codes() []string {
+	codes := make([]string, 0, len(p))
+	for code := range p {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// GetProducts reads the product file, in a subset of TOML: a [CODE] table
+// per product whose keys override the DefaultProduct values, e.g.
+//
+//	# Flexible premium UL, 2025 series
+//	[UL25]
+//	name = "Flexible UL 2025"
+//	data_dir = "ul25"
+//	premium_load = 0.08
+//	premium_load_excess = 0.04
+//	policy_fee = 90
+//	premium_load_cap = 2500
+//	maximum_premium_load = 0.10
+//	maximum_policy_fee = 150
+//	interest = 0.0325
+//	minimum_interest = 0.01
+//	naar_discount = 0.01
+//	loan_interest = 0.05
+//	loan_crediting = 0.045
+//	free_withdrawal = 0.10
+//	maturity_age = 121
+//	extended_maturity_age = 0
+//	arithmetic = "cents"
+//	grace_period_months = 2
+//	modal_semiannual = 0.51
+//	modal_quarterly = 0.26
+//	modal_monthly = 0.0875
+//	per_unit_formula = "if(duration <= 10, 0.6 - 0.04 * (duration - 1), 0) / band"
+//	policy_fee_formula = "if(face < 100000, 120, 90)"
+//	premium_load_formula = "if(excess, 0.04, 0.08)"
+//
+// Values are numbers or double quoted strings; # starts a comment. The
+// formulas are those of ParseExpr over ChargeVariables.
+func (s RateSource) GetProducts() (Products, error) {
+	path := s.path(s.ProductsFile, ProductsFile)
+	file, err := s.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadProducts(file, path)
+}
+
+// ReadProducts reads product definitions in the GetProducts format. name is
+// used in error messages.
+func ReadProducts(r io.Reader, name string) (Products, error) {
+	products := make(Products)
+	var product *Product
+	// finish checks and stores the product read so far
+	finish := func() error {
+		if product == nil {
+			return nil
+		}
+		if math.IsNaN(product.PremiumLoadExcess) {
+			product.PremiumLoadExcess = product.PremiumLoad
+		}
+		if product.MaturityAge < 1 || product.ExtendedMaturityAge < 0 || product.projectionEndAge() > maxAge {
+			return fmt.Errorf("%s: product %s: maturity age must be from 1 to %d", name, product.Code, maxAge)
+		}
+		if product.PremiumLoadCap < 0 {
+			return fmt.Errorf("%s: product %s: premium load cap must not be negative", name, product.Code)
+		}
+		if !product.Arithmetic.Valid() {
+			return fmt.Errorf("%s: product %s: unknown arithmetic %q (want float or cents)", name, product.Code, product.Arithmetic)
+		}
+		products[product.Code] = *product
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			code, ok := strings.CutSuffix(text[1:], "]")
+			code = strings.TrimSpace(code)
+			if !ok || code == "" {
+				return nil, fmt.Errorf("%s line %d: invalid table %q", name, line, text)
+			}
+			if _, ok := products[code]; ok {
+				return nil, fmt.Errorf("%s line %d: product %s defined twice", name, line, code)
+			}
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			defaults := DefaultProduct()
+			product = &defaults
+			product.Code = code
+			// unset until the end of the table, then PremiumLoad
+			product.PremiumLoadExcess = math.NaN()
+			products[code] = *product
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s line %d: expected key = value", name, line)
+		}
+		if product == nil {
+			return nil, fmt.Errorf("%s line %d: %s is outside a [product] table", name, line, strings.TrimSpace(key))
+		}
+		if err := product.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// stripComment removes a # comment outside a quoted string.
+func stripComment(line string) string {
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '#' && !quoted:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// set sets the product setting of the key from its value.
+func (p *Product) set(key string, value string) error {
+	texts := map[string]*string{
+		"name":       &p.Name,
+		"data_dir":   &p.DataDir,
+		"arithmetic": (*string)(&p.Arithmetic),
+	}
+	floats := map[string]*float64{
+		"premium_load":         &p.PremiumLoad,
+		"premium_load_excess":  &p.PremiumLoadExcess,
+		"policy_fee":           &p.PolicyFee,
+		"premium_load_cap":     &p.PremiumLoadCap,
+		"maximum_premium_load": &p.MaximumPremiumLoad,
+		"maximum_policy_fee":   &p.MaximumPolicyFee,
+		"interest":             &p.Interest,
+		"minimum_interest":     &p.MinimumInterest,
+		"naar_discount":        &p.NAARDiscount,
+		"loan_interest":        &p.LoanInterest,
+		"loan_crediting":       &p.LoanCrediting,
+		"free_withdrawal":      &p.FreeWithdrawal,
+		"modal_annual":         &p.ModalFactors.Annual,
+		"modal_semiannual":     &p.ModalFactors.Semiannual,
+		"modal_quarterly":      &p.ModalFactors.Quarterly,
+		"modal_monthly":        &p.ModalFactors.Monthly,
+	}
+	ints := map[string]*int{
+		"maturity_age":          &p.MaturityAge,
+		"extended_maturity_age": &p.ExtendedMaturityAge,
+		"grace_period_months":   &p.GracePeriodMonths,
+	}
+	formulas := map[string]**Expr{
+		"premium_load_formula": &p.Formulas.PremiumLoadFormula,
+		"policy_fee_formula":   &p.Formulas.PolicyFeeFormula,
+		"per_unit_formula":     &p.Formulas.PerUnitFormula,
+	}
+	if field, ok := formulas[key]; ok {
+		source, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: expected a quoted formula", key, value)
+		}
+		formula, err := ParseExpr(source, ChargeVariables...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*field = formula
+		return nil
+	}
+	if key == "rate_basis" {
+		spec, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: expected quoted rate bases", key, value)
+		}
+		if p.RateBases, err = ParseRateBases(spec); err != nil {
+			return err
+		}
+		return nil
+	}
+	if key == "rounding" {
+		spec, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: expected quoted rounding rules", key, value)
+		}
+		if p.Rounding, err = ParseRoundingRules(spec); err != nil {
+			return err
+		}
+		return nil
+	}
+	if field, ok := texts[key]; ok {
+		text, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: expected a quoted string", key, value)
+		}
+		*field = text
+		return nil
+	}
+	if field, ok := floats[key]; ok {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", key, value, err)
+		}
+		*field = number
+		return nil
+	}
+	if field, ok := ints[key]; ok {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", key, value, err)
+		}
+		*field = number
+		return nil
+	}
+	return fmt.Errorf("unknown key %s", key)
+}
+
+// WithProduct returns the source selecting the product of the code from
+// the product file.
+func (s RateSource) WithProduct(code string) (RateSource, error) {
+	products, err := s.GetProducts()
+	if err != nil {
+		return s, err
+	}
+	product, ok := products[code]
+	if !ok {
+		return s, fmt.Errorf("%s: unknown product %q (have %s)", s.path(s.ProductsFile, ProductsFile), code, strings.Join(products.Codes(), ", "))
+	}
+	return s.SelectProduct(product), nil
+}
+
+// SelectProduct returns the source with the product, reading its tables
+// from its data directory.
+func (s RateSource) SelectProduct(product Product) RateSource {
+	s.Product = &product
+	if product.DataDir != "" {
+		if s.FS != nil {
+			s.Dir = path.Join(s.Dir, product.DataDir)
+		} else {
+			s.Dir = filepath.Join(s.Dir, product.DataDir)
+		}
+	}
+	return s
+}
@@ -0,0 +1,283 @@
+package valact
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+// ProfitTest prices every policy of a census, each a cell, over the batch
+// worker pool. Each cell is illustrated on the current scale and its
+// monthly cash flows layered with the experience expenses and decrements
+// and the commissions: the distributable earnings of each month are the
+// premiums, less expenses, commissions, withdrawals, and net loan
+// advances, plus interest at the earned rate on them and the reserve held,
+// less death claims net of loans, cash surrender values paid to lapses,
+// and the increase in the reserve. The reserve held is the account value
+// net of loans, no less than zero, of the policies in force.
+type ProfitTest struct {
+	Source RateSource
+	// Mode is BatchIllustrate to illustrate each cell at its annual
+	// premium, BatchSolve at its minimum premium to maturity, or
+	// BatchEndow at its minimum premium to endow.
+	Mode BatchMode
+	// Workers is the number of worker goroutines; zero means one per CPU.
+	Workers int
+	// Ordered emits results in the order of the policies instead of as
+	// they complete.
+	Ordered bool
+	// Progress, when set, is called from the calling goroutine as each
+	// policy completes.
+	Progress func(Progress)
+	// WaiverBasis is the rate basis of waiver of premium riders.
+	WaiverBasis WaiverBasis
+	// SolveOptions configure the premium solve of BatchSolve and BatchEndow.
+	SolveOptions
+	Experience
+	// Commission is the compensation paid on the premiums, pro rata to
+	// each month's share of the policy year's premium.
+	Commission CommissionSchedule
+	// HurdleRate is the annual effective rate the earnings are discounted
+	// at.
+	HurdleRate float64
+}
+
+// ProfitResult is the profit test of one cell, per policy issued. Err is
+// set, and the values are zero, when the policy's rates could not be
+// loaded or its premium could not be solved.
+type ProfitResult struct {
+	Policy Policy
+	// SolvedPremium is the premium tested under BatchSolve or BatchEndow.
+	SolvedPremium float64
+	// Earnings are the distributable earnings by policy year.
+	Earnings []float64
+	// NPV is the present value of the monthly earnings at the hurdle rate,
+	// and PVPremium that of the premiums.
+	NPV       float64
+	PVPremium float64
+	// IRR is the annual effective rate at which the earnings have no
+	// present value, nil when there is none.
+	IRR *float64
+	// ProfitMargin is NPV as a share of PVPremium.
+	ProfitMargin float64
+	// BreakevenYear is the policy year from which the present value of the
+	// earnings to date stays positive, 0 when it never does.
+	BreakevenYear int
+	Err           error
+}
+
+func (r ProfitResult) withErr(err error) ProfitResult {
+	r.Err = err
+	return r
+}
+
+// Run tests every policy and passes each result to emit, in completion
+// order (policy order when Ordered), from the calling goroutine. Run stops
+// at the first error returned by emit.
+func (t ProfitTest) Run(policies []Policy, emit func(ProfitResult) error) error {
+	return t.RunContext(context.Background(), policies, emit)
+}
+
+// RunContext is Run, stopping when the context is done like
+// Batch.RunContext.
+func (t ProfitTest) RunContext(ctx context.Context, policies []Policy, emit func(ProfitResult) error) error {
+	t.SolveOptions = t.SolveOptions.forRun()
+	return runPool(ctx, pool{workers: t.Workers, ordered: t.Ordered, progress: t.Progress}, policies, t.runPolicy, emit)
+}
+
+func (t ProfitTest) runPolicy(ctx context.Context, policy Policy) (ProfitResult, error) {
+	result := ProfitResult{Policy: policy}
+	rates, err := t.Source.PolicyRates(policy, t.WaiverBasis)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	if target, ok := t.Mode.target(); ok {
+		if result.SolvedPremium, _, err = solvePremium(ctx, policy, rates, target, t.SolveOptions, 0); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			result.Err = err
+			return result, nil
+		}
+		policy.AnnualPremium = result.SolvedPremium
+	}
+	ledger := IllustrateLedger(policy, rates)
+	if len(ledger) == 0 {
+		return result, nil
+	}
+	earnings, premiums := t.earnings(ledger, rates)
+	t.measure(&result, ledger, earnings, premiums)
+	return result, nil
+}
+
+// earnings returns the distributable earnings and the premiums received of
+// each month of the ledger per policy issued, with the experience and
+// commissions.
+func (t ProfitTest) earnings(ledger Ledger, rates *RateSet) (earnings, premiums []float64) {
+	commissions := t.Commission.Commissions(ledger, rates.TargetPremium[0]).ByYear
+	yearPremium := make([]float64, len(commissions))
+	// index of each policy year's row of the commissions
+	first := ledger[0].PolicyYear
+	for _, row := range ledger {
+		yearPremium[row.PolicyYear-first] += row.Premium
+	}
+	earned := MonthlyRate(t.EarnedRate)
+	earnings, premiums = make([]float64, len(ledger)), make([]float64, len(ledger))
+	reserve, inForce := 0.0, 1.0
+	for i, row := range ledger {
+		year := row.PolicyYear - first
+		commission := 0.0
+		switch {
+		case yearPremium[year] != 0:
+			commission = commissions[year] * row.Premium / yearPremium[year]
+		case i == 0 || row.PolicyYear != ledger[i-1].PolicyYear:
+			commission = commissions[year]
+		}
+		premiums[i] = inForce * row.Premium
+		flow := inForce * (row.Premium + row.LoanRepayment - row.Withdrawal - row.LoanAdvance - t.expenses(i, row) - commission)
+		interest := (reserve + flow) * earned
+		deaths := inForce * t.deathRate(rates, row.PolicyYear)
+		claims := deaths * (row.DeathBenefit - row.LoanBalance)
+		inForce -= deaths
+		surrenders := 0.0
+		if row.MonthInPolicyYear == 12 && i != len(ledger)-1 {
+			lapsed := inForce * t.lapseRate(row.PolicyYear)
+			surrenders = lapsed * row.CashSurrenderValue
+			inForce -= lapsed
+		}
+		held := inForce * max(0, row.ValueEnd-row.LoanBalance)
+		if i == len(ledger)-1 {
+			// the policy matures or lapses, releasing the reserve to the
+			// value paid out
+			surrenders += inForce * max(0, row.CashSurrenderValue)
+			held = 0
+		}
+		earnings[i] = flow + interest - claims - surrenders - (held - reserve)
+		reserve = held
+	}
+	return earnings, premiums
+}
+
+// measure sets the earnings by policy year and the profit measures of the
+// monthly earnings on the result.
+func (t ProfitTest) measure(result *ProfitResult, ledger Ledger, earnings, premiums []float64) {
+	hurdle := MonthlyRate(t.HurdleRate)
+	// premiums are received at the start of the month and earnings emerge
+	// at its end
+	discount, cumulative := 1.0, 0.0
+	for i, row := range ledger {
+		if i == 0 || row.PolicyYear != ledger[i-1].PolicyYear {
+			result.Earnings = append(result.Earnings, 0)
+		}
+		result.Earnings[len(result.Earnings)-1] += earnings[i]
+		result.PVPremium += discount * premiums[i]
+		discount /= 1 + hurdle
+		cumulative += discount * earnings[i]
+		if row.MonthInPolicyYear == 12 || i == len(ledger)-1 {
+			if cumulative < 0 {
+				result.BreakevenYear = 0
+			} else if result.BreakevenYear == 0 {
+				result.BreakevenYear = row.PolicyYear
+			}
+		}
+	}
+	result.NPV = cumulative
+	if result.PVPremium != 0 {
+		result.ProfitMargin = result.NPV / result.PVPremium
+	}
+	if rate, ok := earningsIRR(earnings); ok {
+		result.IRR = &rate
+	}
+}
+
+// earningsIRR is the annual effective rate at which the monthly earnings,
+// emerging at the end of each month, have no present value. It reports
+// false when the present value does not change sign between -99% and
+// 10,000% a year.
+func earningsIRR(earnings []float64) (float64, bool) {
+	presentValue := func(annual float64) float64 {
+		v := 1 / (1 + MonthlyRate(annual))
+		value := 0.0
+		for i := len(earnings) - 1; i >= 0; i-- {
+			value = (value + earnings[i]) * v
+		}
+		return value
+	}
+	low, high := -0.99, 100.0
+	lowValue := presentValue(low)
+	if lowValue == 0 || math.Signbit(lowValue) == math.Signbit(presentValue(high)) {
+		return 0, false
+	}
+	for range 200 {
+		mid := (low + high) / 2
+		if math.Signbit(presentValue(mid)) == math.Signbit(lowValue) {
+			low = mid
+		} else {
+			high = mid
+		}
+		if high-low < 1e-12 {
+			break
+		}
+	}
+	return (low + high) / 2, true
+}
+
+// ProfitColumns is the column layout written by ProfitWriter.
+var ProfitColumns = []string{
+	"Policy_ID",
+	"Solved_Premium",
+	"NPV",
+	"PV_Premium",
+	"IRR",
+	"Profit_Margin",
+	"Breakeven_Year",
+	"Error",
+}
+
+// ProfitWriter writes profit test results as CSV, one row per cell.
+type ProfitWriter struct {
+	writer *csv.Writer
+}
+
+// NewProfitWriter writes the ProfitColumns header to w and returns a
+// writer for the result rows.
+func NewProfitWriter(w io.Writer) (*ProfitWriter, error) {
+	writer := csv.NewWriter(bufio.NewWriterSize(w, sinkBufferSize))
+	if err := writer.Write(ProfitColumns); err != nil {
+		return nil, err
+	}
+	return &ProfitWriter{writer: writer}, nil
+}
+
+// Write writes one result row; the values are blank for failed policies,
+// and the IRR where there is none.
+func (w *ProfitWriter) Write(result ProfitResult) error {
+	record := []string{result.Policy.ID}
+	if result.Err != nil {
+		record = append(record, make([]string, len(ProfitColumns)-2)...)
+		return w.writer.Write(append(record, result.Err.Error()))
+	}
+	irr := ""
+	if result.IRR != nil {
+		irr = formatFloat(*result.IRR)
+	}
+	return w.writer.Write(append(record,
+		formatFloat(result.SolvedPremium),
+		formatFloat(result.NPV),
+		formatFloat(result.PVPremium),
+		irr,
+		formatFloat(result.ProfitMargin),
+		strconv.Itoa(result.BreakevenYear),
+		"",
+	))
+}
+
+// Flush writes any buffered rows and reports any write error.
+func (w *ProfitWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,44 @@
+package valact
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress is how far a batch or stochastic run has come, passed to its
+// Progress callback as each policy completes.
+type Progress struct {
+	// Done counts the policies completed, including those that failed,
+	// out of Total, which is 0 when the policies are read as the run goes
+	// (see Batch.RunSeq).
+	Done    int
+	Total   int
+	Elapsed time.Duration
+}
+
+// Rate is the number of policies completed per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Done) / p.Elapsed.Seconds()
+}
+
+// Remaining estimates the time to finish at the rate so far; it is 0 until
+// a policy completes, and without a Total.
+func (p Progress) Remaining() time.Duration {
+	if p.Done == 0 || p.Total == 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * float64(p.Total-p.Done) / float64(p.Done))
+}
+
+// String reports the progress as, e.g., "1200/300000 policies (0.4%),
+// 850.2/s, ETA 5m51s", or "1200 policies, 850.2/s" without a Total.
+func (p Progress) String() string {
+	if p.Total == 0 {
+		return fmt.Sprintf("%d policies, %.1f/s", p.Done, p.Rate())
+	}
+	percent := 100 * float64(p.Done) / float64(p.Total)
+	return fmt.Sprintf("%d/%d policies (%.1f%%), %.1f/s, ETA %v", p.Done, p.Total, percent, p.Rate(), p.Remaining().Round(time.Second))
+}
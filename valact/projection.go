@@ -0,0 +1,233 @@
+package valact
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Projection projects every policy of a census on the current scale,
+// weighting each month by the probability the policy is still in force
+// under the experience decrements, over the batch worker pool. The
+// expected values of the policies add to the aggregate projection of the
+// block; see ProjectionTotals.
+type Projection struct {
+	Source RateSource
+	// Mode is BatchIllustrate to project each policy at its annual
+	// premium, BatchSolve at its minimum premium to maturity, or BatchEndow
+	// at its minimum premium to endow.
+	Mode BatchMode
+	// Workers is the number of worker goroutines; zero means one per CPU.
+	Workers int
+	// Ordered emits results in the order of the policies instead of as
+	// they complete.
+	Ordered bool
+	// Progress, when set, is called from the calling goroutine as each
+	// policy completes.
+	Progress func(Progress)
+	// WaiverBasis is the rate basis of waiver of premium riders.
+	WaiverBasis WaiverBasis
+	// SolveOptions configure the premium solve of BatchSolve and BatchEndow.
+	SolveOptions
+	// Experience gives the decrements; its earned rate and expenses are
+	// not used.
+	Experience
+}
+
+// ProjectionYear holds the expected values of a year of the projection,
+// from the start of the ledger. InForce is the number of policies in force
+// at the start of the year; Deaths and Lapses the numbers leaving during
+// it, Lapses including policies lapsing for want of value; the amounts are
+// the year's cash flows, Claims net of loans; and AccountValue, LoanBalance,
+// and FaceAmount are those in force at its end.
+type ProjectionYear struct {
+	Year         int     `json:"year"`
+	InForce      float64 `json:"in_force"`
+	Deaths       float64 `json:"deaths"`
+	Lapses       float64 `json:"lapses"`
+	Premiums     float64 `json:"premiums"`
+	Withdrawals  float64 `json:"withdrawals"`
+	Claims       float64 `json:"claims"`
+	Surrenders   float64 `json:"surrenders"`
+	AccountValue float64 `json:"account_value"`
+	LoanBalance  float64 `json:"loan_balance"`
+	FaceAmount   float64 `json:"face_amount"`
+}
+
+// add adds the values of y times weight to p.
+func (p *ProjectionYear) add(y ProjectionYear, weight float64) {
+	p.InForce += weight * y.InForce
+	p.Deaths += weight * y.Deaths
+	p.Lapses += weight * y.Lapses
+	p.Premiums += weight * y.Premiums
+	p.Withdrawals += weight * y.Withdrawals
+	p.Claims += weight * y.Claims
+	p.Surrenders += weight * y.Surrenders
+	p.AccountValue += weight * y.AccountValue
+	p.LoanBalance += weight * y.LoanBalance
+	p.FaceAmount += weight * y.FaceAmount
+}
+
+// ProjectionResult is the expected projection of one policy issued. Err is
+// set, and Years empty, when the policy's rates could not be loaded or its
+// premium could not be solved.
+type ProjectionResult struct {
+	Policy Policy
+	// SolvedPremium is the premium projected under BatchSolve or BatchEndow.
+	SolvedPremium float64
+	Years         []ProjectionYear
+	Err           error
+}
+
+func (r ProjectionResult) withErr(err error) ProjectionResult {
+	r.Err = err
+	return r
+}
+
+// Run projects every policy and passes each result to emit, in completion
+// order (policy order when Ordered), from the calling goroutine. Run stops
+// at the first error returned by emit.
+func (p Projection) Run(policies []Policy, emit func(ProjectionResult) error) error {
+	return p.RunContext(context.Background(), policies, emit)
+}
+
+// RunContext is Run, stopping when the context is done like
+// Batch.RunContext.
+func (p Projection) RunContext(ctx context.Context, policies []Policy, emit func(ProjectionResult) error) error {
+	p.SolveOptions = p.SolveOptions.forRun()
+	return runPool(ctx, pool{workers: p.Workers, ordered: p.Ordered, progress: p.Progress}, policies, p.runPolicy, emit)
+}
+
+func (p Projection) runPolicy(ctx context.Context, policy Policy) (ProjectionResult, error) {
+	result := ProjectionResult{Policy: policy}
+	rates, err := p.Source.PolicyRates(policy, p.WaiverBasis)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	if target, ok := p.Mode.target(); ok {
+		if result.SolvedPremium, _, err = solvePremium(ctx, policy, rates, target, p.SolveOptions, 0); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			result.Err = err
+			return result, nil
+		}
+		policy.AnnualPremium = result.SolvedPremium
+	}
+	result.Years = p.project(IllustrateLedger(policy, rates), rates)
+	return result, nil
+}
+
+// project weights the values of the monthly ledger by the share of the
+// policies issued still in force and sums them by year.
+func (p Projection) project(ledger Ledger, rates *RateSet) []ProjectionYear {
+	var years []ProjectionYear
+	inForce := 1.0
+	for i, row := range ledger {
+		if i == 0 || row.PolicyYear != ledger[i-1].PolicyYear {
+			years = append(years, ProjectionYear{Year: len(years) + 1, InForce: inForce})
+		}
+		year := &years[len(years)-1]
+		year.Premiums += inForce * row.Premium
+		year.Withdrawals += inForce * row.Withdrawal
+		deaths := inForce * p.deathRate(rates, row.PolicyYear)
+		year.Deaths += deaths
+		year.Claims += deaths * (row.DeathBenefit - row.LoanBalance)
+		inForce -= deaths
+		last := i == len(ledger)-1
+		switch {
+		case last && row.Lapsed:
+			year.Lapses += inForce
+			inForce = 0
+		case row.MonthInPolicyYear == 12 && !last:
+			lapsed := inForce * p.lapseRate(row.PolicyYear)
+			year.Lapses += lapsed
+			year.Surrenders += lapsed * row.CashSurrenderValue
+			inForce -= lapsed
+		}
+		year.AccountValue = inForce * row.ValueEnd
+		year.LoanBalance = inForce * row.LoanBalance
+		year.FaceAmount = inForce * row.FaceAmount
+	}
+	return years
+}
+
+// ProjectionTotals adds the expected projections of the policies of a
+// block by year.
+type ProjectionTotals struct {
+	// Policies is the number of policies added and Failed the number of
+	// them whose rates could not be loaded, which add nothing to Years.
+	Policies int
+	Failed   int
+	Years    []ProjectionYear
+}
+
+// Add adds a policy's projection to the totals.
+func (t *ProjectionTotals) Add(result ProjectionResult) {
+	t.AddWeighted(result, 1)
+}
+
+// AddWeighted adds the projection of a policy standing for weight
+// policies, such as a model point's representative (see
+// ModelPoints.Weight), to the totals.
+func (t *ProjectionTotals) AddWeighted(result ProjectionResult, weight int) {
+	t.Policies += weight
+	if result.Err != nil {
+		t.Failed += weight
+		return
+	}
+	for i, year := range result.Years {
+		if i == len(t.Years) {
+			t.Years = append(t.Years, ProjectionYear{Year: year.Year})
+		}
+		t.Years[i].add(year, float64(weight))
+	}
+}
+
+// ProjectionColumns is the column layout written by ProjectionWriter.
+var ProjectionColumns = []string{
+	"Year",
+	"In_Force",
+	"Deaths",
+	"Lapses",
+	"Premiums",
+	"Withdrawals",
+	"Claims",
+	"Surrenders",
+	"Account_Value",
+	"Loan_Balance",
+	"Face_Amount",
+}
+
+// ProjectionWriter writes projection years as CSV, one row per year.
+type ProjectionWriter struct {
+	writer *csv.Writer
+}
+
+// NewProjectionWriter writes the ProjectionColumns header to w and returns
+// a writer for the year rows.
+func NewProjectionWriter(w io.Writer) (*ProjectionWriter, error) {
+	writer := csv.NewWriter(bufio.NewWriterSize(w, sinkBufferSize))
+	if err := writer.Write(ProjectionColumns); err != nil {
+		return nil, err
+	}
+	return &ProjectionWriter{writer: writer}, nil
+}
+
+// Write writes one year row.
+func (w *ProjectionWriter) Write(year ProjectionYear) error {
+	record := []string{strconv.Itoa(year.Year)}
+	for _, v := range []float64{year.InForce, year.Deaths, year.Lapses, year.Premiums, year.Withdrawals, year.Claims, year.Surrenders, year.AccountValue, year.LoanBalance, year.FaceAmount} {
+		record = append(record, formatFloat(v))
+	}
+	return w.writer.Write(record)
+}
+
+// Flush writes any buffered rows and reports any write error.
+func (w *ProjectionWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,128 @@
+package valact
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// protoFile is the gRPC schema whose messages mirror the JSON of the
+// library's types; see TestProtoMatchesJSON.
+const protoFile = "../proto/valact/v1/valact.proto"
+
+// protoMessages are the messages of protoFile by the type whose JSON each
+// mirrors. The request messages have no counterpart.
+var protoMessages = map[string]reflect.Type{
+	"Policy":          reflect.TypeFor[Policy](),
+	"Deposit":         reflect.TypeFor[Deposit](),
+	"PolicyChange":    reflect.TypeFor[PolicyChange](),
+	"ScheduledAmount": reflect.TypeFor[ScheduledAmount](),
+	"FlatExtra":       reflect.TypeFor[FlatExtra](),
+	"TermRider":       reflect.TypeFor[TermRider](),
+	"WaiverRider":     reflect.TypeFor[WaiverRider](),
+	"ADBRider":        reflect.TypeFor[ADBRider](),
+	"ChronicRider":    reflect.TypeFor[ChronicRider](),
+	"Inforce":         reflect.TypeFor[Inforce](),
+	"Result":          reflect.TypeFor[Result](),
+	"Diagnostics":     reflect.TypeFor[Diagnostics](),
+	"LedgerRow":       reflect.TypeFor[LedgerRow](),
+	"BatchResult":     reflect.TypeFor[batchRecord](),
+	"Commissions":     reflect.TypeFor[Commissions](),
+	"GuidelineLimit":  reflect.TypeFor[GuidelineLimit](),
+	"Life":            reflect.TypeFor[Life](),
+	"FirstDeath":      reflect.TypeFor[FirstDeath](),
+	"PremiumSolves":   reflect.TypeFor[PremiumSolves](),
+}
+
+var (
+	protoMessage = regexp.MustCompile(`(?m)^message (\w+) \{$`)
+	protoField   = regexp.MustCompile(`^\s*(?:repeated |optional )?(?:map<\w+, \w+>|[\w.]+) (\w+) = (\d+);`)
+)
+
+// readProto returns the field numbers by name of each top level message of
+// the schema.
+func readProto(t *testing.T, path string) map[string]map[string]int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string]map[string]int)
+	var fields map[string]int
+	depth := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if match := protoMessage.FindStringSubmatch(line); match != nil {
+			fields = make(map[string]int)
+			messages[match[1]] = fields
+		}
+		// the fields of nested enums and messages are skipped
+		if match := protoField.FindStringSubmatch(line); match != nil && depth == 1 && fields != nil {
+			number, _ := strconv.Atoi(match[2])
+			fields[match[1]] = number
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth == 0 {
+			fields = nil
+		}
+	}
+	return messages
+}
+
+// jsonFields returns the JSON names of the fields of the struct type,
+// including those of embedded structs.
+func jsonFields(typ reflect.Type) []string {
+	var names []string
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		switch {
+		case name == "-" || !field.IsExported():
+		case field.Anonymous && tag == "":
+			names = append(names, jsonFields(field.Type)...)
+		case name == "":
+			names = append(names, field.Name)
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TestProtoMatchesJSON checks the messages of the gRPC schema against the
+// JSON of the types they mirror: a field for every JSON field, by the same
+// name, and none besides, numbered uniquely from 1 without gaps, so a field
+// added to a type is added to its message with the next number.
+func TestProtoMatchesJSON(t *testing.T) {
+	messages := readProto(t, protoFile)
+	for message, typ := range protoMessages {
+		fields, ok := messages[message]
+		if !ok {
+			t.Errorf("%s: no message %s for %v", protoFile, message, typ)
+			continue
+		}
+		names := jsonFields(typ)
+		for _, name := range names {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("message %s has no field %s for the JSON of %v", message, name, typ)
+			}
+		}
+		numbers := make([]int, 0, len(fields))
+		for name, number := range fields {
+			if !slices.Contains(names, name) {
+				t.Errorf("message %s field %s is not in the JSON of %v", message, name, typ)
+			}
+			numbers = append(numbers, number)
+		}
+		slices.Sort(numbers)
+		for i, number := range numbers {
+			if number != i+1 {
+				t.Errorf("message %s fields are numbered %v, want 1 to %d", message, numbers, len(numbers))
+				break
+			}
+		}
+	}
+}
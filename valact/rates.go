@@ -0,0 +1,580 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrIssueAgeNotInCOI is returned when coi.csv has no rows at all for the
+// requested issue age, as opposed to rows that exist but carry zero rates.
+var ErrIssueAgeNotInCOI = errors.New("issue age not found in COI table")
+
+// MaturityAge is the attained age at which policies mature by default.
+const MaturityAge = 121
+
+// maxAge is the oldest attained age of the tables, and so the latest a
+// product can mature.
+const maxAge = 150
+
+// projectionYears is the length of the source's rate vectors for the issue
+// age: the policy years to the product's maturity, or to its extended
+// maturity when later.
+func (s RateSource) projectionYears(issueAge int) int {
+	return max(0, s.product().projectionEndAge()-issueAge)
+}
+
+// RateSet holds every rate vector used by Illustrate, indexed by policy year
+// (index 0 is policy year 1) and sized by projectionYears.
+type RateSet struct {
+	// COI is the annual COI rate per $1,000 of NAAR.
+	COI []float64
+	// PerUnit is the annual expense charge per $1,000 of face amount.
+	PerUnit []float64
+	// COIBands and PerUnitBands, when set, replace COI and PerUnit with
+	// rates banded by the face amount in force.
+	COIBands     []RateBand
+	PerUnitBands []RateBand
+	// GuaranteedCOI, when set, holds the guaranteed maximum COI rates
+	// (banded like COIBands, or a single band); the projection never
+	// charges a current COI rate above them.
+	GuaranteedCOI []RateBand
+	// CorridorFactors is the minimum ratio of death benefit to account value.
+	CorridorFactors []float64
+	// PremiumLoad is the load percentage on premium up to the target premium.
+	PremiumLoad []float64
+	// PremiumLoadExcess is the load percentage on premium above target.
+	PremiumLoadExcess []float64
+	// TargetPremium is the annual breakpoint between the target and excess
+	// load bands.
+	TargetPremium []float64
+	// PremiumLoadCap caps the premium load dollars charged in a policy year.
+	PremiumLoadCap []float64
+	// PolicyFee is the annual policy fee.
+	PolicyFee []float64
+	// MaximumPremiumLoad and MaximumPolicyFee are the guaranteed maximum
+	// premium load, up to and above target, and annual policy fee, which
+	// the guaranteed basis charges; see GetGuaranteedRates.
+	MaximumPremiumLoad []float64
+	MaximumPolicyFee   []float64
+	// NAARDiscount is the monthly discount applied to the death benefit when
+	// computing NAAR.
+	NAARDiscount []float64
+	// Interest is the monthly effective crediting rate.
+	Interest []float64
+	// MonthlyInterest, when set, overrides Interest with a monthly
+	// effective crediting rate by policy month, e.g. a scenario from
+	// GetInterestScenario; its last rate holds to maturity.
+	MonthlyInterest []float64
+	// MinimumInterest is the guaranteed minimum monthly effective
+	// crediting rate, a floor under Interest and MonthlyInterest.
+	MinimumInterest []float64
+	// InterestBonus is the annual persistency or interest bonus added to
+	// the credited rate by policy year, e.g. 0.0025 from year 11; see
+	// AddInterestBonus.
+	InterestBonus []float64
+	// LoanInterest is the monthly effective rate charged on the loan
+	// balance. A constant vector is a fixed loan rate, a varying one a
+	// variable rate.
+	LoanInterest []float64
+	// LoanCrediting is the monthly effective rate credited on the loaned
+	// (collateral) portion of the account value.
+	LoanCrediting []float64
+	// SurrenderCharge is the surrender charge per $1,000 of face amount.
+	SurrenderCharge []float64
+	// FreeWithdrawal is the fraction of the account value that can be
+	// withdrawn each policy year without a partial surrender charge.
+	FreeWithdrawal []float64
+	// ModalFactors convert the annual premium into modal payments.
+	ModalFactors ModalFactors
+	// GracePeriodMonths is how many months a policy may stay at or below
+	// zero net value before it lapses.
+	GracePeriodMonths int
+	// ComplianceTest is the 7702 test the product qualifies under; empty
+	// means GPT. Use QualifyCVAT to switch to CVAT.
+	ComplianceTest ComplianceTest
+	// SevenPayRates is the annual 7-pay premium per $1,000 of face amount
+	// for a 7-pay period starting in the policy year, and SevenPayAnnuities
+	// the 7-year annuity due factor from that year. All zero means the
+	// policy is not tested for MEC status; see ApplySevenPayTest.
+	SevenPayRates     []float64
+	SevenPayAnnuities []float64
+	// Shadow, when set, is the no-lapse guarantee shadow account; see
+	// GetShadowRates.
+	Shadow *ShadowRates
+	// Survivorship is the joint method of survivorship rates, whose COI is
+	// the joint last survivor rate and LifeCOI the rated single-life rates
+	// of the two lives; see GetSurvivorshipRates.
+	Survivorship JointMethod
+	LifeCOI      [2][]float64
+	// TermRider, when set, carries the charges of the policy's term rider;
+	// see GetTermRiderRates.
+	TermRider *TermRiderRates
+	// Waiver and ADB, when set, carry the waiver of premium and accidental
+	// death benefit rider rates; see GetWaiverRates and GetADBRates.
+	Waiver *WaiverRates
+	ADB    []float64
+	// Chronic, when set, carries the chronic illness rider rates; see
+	// GetChronicRates.
+	Chronic []float64
+	// Indexed, when set, credits indexed UL segments alongside the fixed
+	// account.
+	Indexed *IndexedCrediting
+	// Funds, when set, are variable subaccounts receiving their allocation
+	// of net premium alongside the fixed account.
+	Funds []Fund
+	// DeductionOrder lists the buckets (FixedBucket, IndexedBucket, or fund
+	// names) that deductions are taken from, in order; empty means the
+	// fixed account first, then the other buckets pro rata. See
+	// CheckAllocations.
+	DeductionOrder []string
+	// MonthlySteps is the order of the monthly processing waterfall; empty
+	// means DefaultMonthlySteps. See CheckMonthlySteps.
+	MonthlySteps []MonthlyStep
+	// Charges and Crediting, when set, replace the premium load and
+	// expense charges and the interest credited each month; see
+	// ChargeCalculator and InterestCrediting.
+	Charges   ChargeCalculator
+	Crediting InterestCrediting
+	// MaturityAge is the attained age at which the product matures; zero
+	// means the MaturityAge constant. ExtendedMaturityAge, when later,
+	// extends coverage past maturity to that age with no premiums or
+	// charges: the account value earns interest and is the death benefit.
+	// See CheckMaturity.
+	MaturityAge         int
+	ExtendedMaturityAge int
+	// Arithmetic is how the projection carries money values; empty means
+	// ArithmeticFloat.
+	Arithmetic Arithmetic
+	// Rounding, when set, rounds the money amounts it has rules for by
+	// those, in place of Arithmetic.
+	Rounding *RoundingRules
+	// Valuation, when set, is the basis of the reserves IllustrateLedger
+	// sets on the ledger.
+	Valuation *ValuationBasis
+	// trace, when set, records the projection's intermediate quantities;
+	// see TraceLedger.
+	trace *tracer
+}
+
+// maturityAge is the attained age at which the product matures.
+func (r *RateSet) maturityAge() int {
+	if r.MaturityAge == 0 {
+		return MaturityAge
+	}
+	return r.MaturityAge
+}
+
+// projectionEndAge is the attained age at which projections end: the
+// extended maturity age when later than the maturity age.
+func (r *RateSet) projectionEndAge() int {
+	return max(r.maturityAge(), r.ExtendedMaturityAge)
+}
+
+// CheckMaturity reports an error unless the maturity age is after the issue
+// age, and it and any extended maturity age are within the rate vectors.
+func (r *RateSet) CheckMaturity(issueAge int) error {
+	if r.MaturityAge < 0 || r.ExtendedMaturityAge < 0 {
+		return fmt.Errorf("maturity ages %d and %d must not be negative", r.MaturityAge, r.ExtendedMaturityAge)
+	}
+	if r.maturityAge() <= issueAge {
+		return fmt.Errorf("maturity age %d is not after issue age %d", r.maturityAge(), issueAge)
+	}
+	if end := r.projectionEndAge(); end-issueAge > len(r.COI) {
+		return fmt.Errorf("maturity age %d is after the rates, which run to age %d", end, issueAge+len(r.COI))
+	}
+	return nil
+}
+
+// CreateVector returns a rate vector of the years with every policy year
+// set to value.
+func CreateVector(value float64, years int) []float64 {
+	vector := make([]float64, years)
+	for i := range vector {
+		vector[i] = value
+	}
+	return vector
+}
+
+// GetPerUnitRates reads per $1,000 of face amount rates from the unit load table
+// by policy year for the issue age. Missing years default to 0, or follow the
+// source's MissingRates. A table banded by face amount returns its lowest
+// band.
+func (s RateSource) GetPerUnitRates(issueAge int) ([]float64, error) {
+	return s.readIssueAgeTable(s.path(s.UnitLoadFile, UnitLoadFile), issueAge)
+}
+
+// GetPerUnitBands reads the unit load table like GetPerUnitRates, returning
+// every face amount band.
+func (s RateSource) GetPerUnitBands(issueAge int) ([]RateBand, error) {
+	return s.readIssueAgeBands(s.path(s.UnitLoadFile, UnitLoadFile), issueAge)
+}
+
+// GetSurrenderCharges reads surrender charges per $1,000 of face amount from
+// the surrender charge table by policy year for the issue age. Missing years
+// default to 0.
+func (s RateSource) GetSurrenderCharges(issueAge int) ([]float64, error) {
+	return s.readIssueAgeTable(s.path(s.SurrenderChargesFile, SurrenderChargesFile), issueAge)
+}
+
+// readIssueAgeTable reads an Issue_Age, Policy_Year, Rate table into rates by
+// policy year for the issue age, from the lowest face amount band. Missing
+// years default to 0, or follow the source's MissingRates.
+func (s RateSource) readIssueAgeTable(path string, issueAge int) ([]float64, error) {
+	bands, err := s.readIssueAgeBands(path, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return bands[0].Rates, nil
+}
+
+// readIssueAgeBands reads an Issue_Age, Policy_Year, Rate table, optionally
+// banded by FaceBandColumn, into rates by policy year for the issue age.
+func (s RateSource) readIssueAgeBands(path string, issueAge int) ([]RateBand, error) {
+	t, err := s.openTableRows(path, issueAgeSchema, &rowFilter{column: "Issue_Age", value: issueAge})
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	ageField, yearField, rateField := t.field("Issue_Age"), t.field("Policy_Year"), t.field("Rate")
+	bands := newFaceBands(t, s.projectionYears(issueAge))
+
+	for t.next() {
+		fileAge, err := t.int(ageField)
+		if err != nil {
+			return nil, err
+		}
+		if fileAge != issueAge {
+			continue
+		}
+		fileRate, err := t.float(rateField)
+		if err != nil {
+			return nil, err
+		}
+		fileYear, err := t.int(yearField)
+		if err != nil {
+			return nil, err
+		}
+		if fileYear < 1 {
+			return nil, t.fieldError(yearField, errOutOfRange)
+		}
+		band, err := bands.band()
+		if err != nil {
+			return nil, err
+		}
+		// years past maturity are never projected
+		if fileYear <= len(bands.bands[band].Rates) {
+			bands.bands[band].Rates[fileYear-1] = fileRate
+			bands.selected[band][fileYear-1] = true
+		}
+	}
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+	if err := bands.fill(path, s.missing(path), s.product().maturityAge()-issueAge, fmt.Sprintf("issue age %d", issueAge)); err != nil {
+		return nil, err
+	}
+	return bands.result(), nil
+}
+
+// GetCOIRates reads annual per $1,000 COI rates from the COI table by policy year
+// for the gender, risk class, and issue age, after mapping the gender and risk
+// class codes with MapCodes. The table may be select, attained
+// age, or select and ultimate (see readCOITable). Missing years default to 0,
+// or follow the source's MissingRates; an issue age with no rows at all
+// returns ErrIssueAgeNotInCOI.
+func (s RateSource) GetCOIRates(gender string, riskClass string, issueAge int) ([]float64, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	return s.readCOITable(s.path(s.COIFile, COIFile), gender, riskClass, issueAge)
+}
+
+// GetCOIBands reads the COI table like GetCOIRates, returning every face
+// amount band.
+func (s RateSource) GetCOIBands(gender string, riskClass string, issueAge int) ([]RateBand, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	return s.readCOIBands(s.path(s.COIFile, COIFile), gender, riskClass, issueAge)
+}
+
+// readCOITable reads a COI table into rates by policy year. The header
+// selects the lookup mode:
+//
+//   - Issue_Age and Policy_Year: select rates by issue age and duration.
+//   - Attained_Age: attained age rates, looked up at the issue age plus the
+//     policy year less one.
+//   - all three: select and ultimate. Rows with an Issue_Age and Policy_Year
+//     are the select rates; rows leaving them empty and giving an
+//     Attained_Age are the ultimate rates, used for every policy year past
+//     the issue age's select period.
+//
+// Every table also keys on Gender and Risk_Class, and may be banded by face
+// amount with FaceBandColumn; readCOITable returns the lowest band.
+func (s RateSource) readCOITable(path string, gender string, riskClass string, issueAge int) ([]float64, error) {
+	bands, err := s.readCOIBands(path, gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return bands[0].Rates, nil
+}
+
+// readCOIBands implements readCOITable, returning every face amount band.
+func (s RateSource) readCOIBands(path string, gender string, riskClass string, issueAge int) ([]RateBand, error) {
+	columns, err := s.readCOIColumns(path, gender, riskClass, issueAge, 0, "Rate")
+	if err != nil {
+		return nil, err
+	}
+	return columns[0], nil
+}
+
+// readCOIColumns reads the bands of several rate columns of a COI table in
+// one pass, in the order of the column names. Under MissingDefault, rates
+// that end before the policy year through fail with ErrMissingRate rather
+// than leave the years after them 0; through is 0 for tables, such as a
+// term rider's, that need not run to maturity.
+func (s RateSource) readCOIColumns(path string, gender string, riskClass string, issueAge int, through int, rateColumns ...string) ([][]RateBand, error) {
+	// ultimate rates by rate column, band minimum face, and attained age
+	ultimate := make([]map[float64]map[int]float64, len(rateColumns))
+	ageFound := false
+
+	// the issue age's select rows, and every ultimate row
+	t, err := s.openTableRows(path, coiSchema, &rowFilter{column: "Issue_Age", value: issueAge, orNull: true})
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	ageField, yearField, attainedField := t.field("Issue_Age"), t.field("Policy_Year"), t.field("Attained_Age")
+	genderField, classField := t.field("Gender"), t.field("Risk_Class")
+	rateFields := make([]field, len(rateColumns))
+	for c, name := range rateColumns {
+		if rateFields[c] = t.field(name); !t.has(rateFields[c]) {
+			return nil, fmt.Errorf("%s: missing column %s", path, name)
+		}
+	}
+	if !t.has(attainedField) || t.has(ageField) != t.has(yearField) {
+		for _, f := range []field{ageField, yearField} {
+			if !t.has(f) {
+				return nil, fmt.Errorf("%s: missing column %s", path, f.column.name)
+			}
+		}
+	}
+	fileRates := make([]float64, len(rateColumns))
+	bands := make([]*faceBands, len(rateColumns))
+	for c := range bands {
+		bands[c] = newFaceBands(t, s.projectionYears(issueAge))
+		ultimate[c] = make(map[float64]map[int]float64)
+	}
+
+	for t.next() {
+		if t.raw(genderField) != gender || t.raw(classField) != riskClass {
+			if !t.blank(ageField) {
+				fileAge, err := t.int(ageField)
+				if err != nil {
+					return nil, err
+				}
+				ageFound = ageFound || fileAge == issueAge
+			}
+			continue
+		}
+		for c, f := range rateFields {
+			if fileRates[c], err = t.float(f); err != nil {
+				return nil, err
+			}
+		}
+		band, err := bands[0].band()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bands[1:] {
+			b.band()
+		}
+		if t.blank(ageField) {
+			// ultimate (attained age) row
+			if !t.has(attainedField) {
+				return nil, t.fieldError(ageField, errNotWholeNumber)
+			}
+			fileAge, err := t.int(attainedField)
+			if err != nil {
+				return nil, err
+			}
+			minFace := bands[0].bands[band].MinFace
+			for c := range rateColumns {
+				if ultimate[c][minFace] == nil {
+					ultimate[c][minFace] = make(map[int]float64)
+				}
+				ultimate[c][minFace][fileAge] = fileRates[c]
+			}
+			continue
+		}
+		fileAge, err := t.int(ageField)
+		if err != nil {
+			return nil, err
+		}
+		if fileAge != issueAge {
+			continue
+		}
+		ageFound = true
+		fileYear, err := t.int(yearField)
+		if err != nil {
+			return nil, err
+		}
+		if fileYear < 1 {
+			return nil, t.fieldError(yearField, errOutOfRange)
+		}
+		if fileYear > s.projectionYears(issueAge) {
+			continue
+		}
+		for c, b := range bands {
+			b.bands[band].Rates[fileYear-1] = fileRates[c]
+			b.selected[band][fileYear-1] = true
+		}
+	}
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+	for c, b := range bands {
+		for band := range b.bands {
+			for i := range b.bands[band].Rates {
+				if rate, ok := ultimate[c][b.bands[band].MinFace][issueAge+i]; ok && !b.selected[band][i] {
+					b.bands[band].Rates[i] = rate
+					b.selected[band][i] = true
+					ageFound = true
+				}
+			}
+		}
+	}
+	if !ageFound {
+		return nil, fmt.Errorf("%w: %d", ErrIssueAgeNotInCOI, issueAge)
+	}
+	results := make([][]RateBand, len(rateColumns))
+	key := fmt.Sprintf("Gender %s, Risk_Class %s, issue age %d", gender, riskClass, issueAge)
+	for c, b := range bands {
+		if given := b.givenThrough(); s.missing(path) == MissingDefault && given < through {
+			return nil, fmt.Errorf("%s: %w: %s, rates end at age %d before maturity at %d", path, ErrMissingRate, key, issueAge+given, issueAge+through)
+		}
+		if err := b.fill(path, s.missing(path), s.product().maturityAge()-issueAge, key); err != nil {
+			return nil, err
+		}
+		results[c] = b.result()
+	}
+	return results, nil
+}
+
+// GetCorridorFactors reads corridor factors from the corridor factor table by
+// attained age and returns them by policy year for the issue age. Missing
+// years default to 1, or follow the source's MissingRates.
+func (s RateSource) GetCorridorFactors(issueAge int) ([]float64, error) {
+	rates := CreateVector(1.0, s.projectionYears(issueAge))
+	given := make([]bool, len(rates))
+
+	path := s.path(s.CorridorFactorsFile, CorridorFactorsFile)
+	t, err := s.openTable(path, corridorSchema)
+	if err != nil {
+		return rates, err
+	}
+	defer t.Close()
+	ageField, rateField := t.field("Attained_Age"), t.field("Rate")
+
+	for t.next() {
+		fileAge, err := t.int(ageField)
+		if err != nil {
+			return rates, err
+		}
+		if fileAge >= issueAge && fileAge-issueAge < len(rates) {
+			if rates[fileAge-issueAge], err = t.float(rateField); err != nil {
+				return rates, err
+			}
+			given[fileAge-issueAge] = true
+		}
+	}
+	if err := t.err(); err != nil {
+		return rates, err
+	}
+	if year := s.missing(path).fill(rates, given, s.product().maturityAge()-issueAge); year >= 0 {
+		return rates, fmt.Errorf("%s: %w: attained age %d", path, ErrMissingRate, issueAge+year)
+	}
+	return rates, nil
+}
+
+// GetRates assembles every rate vector needed by Illustrate from the
+// DefaultRateSource.
+func GetRates(gender string, riskClass string, issueAge int) (*RateSet, error) {
+	return DefaultRateSource().GetRates(gender, riskClass, issueAge)
+}
+
+// GetRates assembles every rate vector needed by Illustrate. Premium loads
+// and the policy fee come from the loads table, or DefaultLoads without
+// one. A source with a Cache returns a copy of the cached rates.
+func (s RateSource) GetRates(gender string, riskClass string, issueAge int) (*RateSet, error) {
+	if s.Cache != nil {
+		return s.Cache.getRates(s, gender, riskClass, issueAge)
+	}
+	return s.loadRates(gender, riskClass, issueAge)
+}
+
+// loadRates implements GetRates, reading the tables.
+func (s RateSource) loadRates(gender string, riskClass string, issueAge int) (*RateSet, error) {
+	coiBands, guaranteedCOI, err := s.GetCOIScaleBands(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	perUnitBands, err := s.GetPerUnitBands(issueAge)
+	if err != nil {
+		return nil, err
+	}
+	corridorFactors, err := s.GetCorridorFactors(issueAge)
+	if err != nil {
+		return nil, err
+	}
+	surrenderCharges, err := s.GetSurrenderCharges(issueAge)
+	if err != nil {
+		return nil, err
+	}
+	years := s.projectionYears(issueAge)
+	product := s.product()
+	loads, err := s.GetLoads(years)
+	if errors.Is(err, fs.ErrNotExist) {
+		loads = product.loads(years)
+	} else if err != nil {
+		return nil, err
+	}
+	bases := product.RateBases
+	rates := &RateSet{
+		COI:               coiBands[0].Rates,
+		PerUnit:           perUnitBands[0].Rates,
+		COIBands:          banded(coiBands),
+		GuaranteedCOI:     guaranteedCOI,
+		PerUnitBands:      banded(perUnitBands),
+		CorridorFactors:   corridorFactors,
+		PremiumLoad:       loads.PremiumLoad,
+		PremiumLoadExcess: loads.PremiumLoadExcess,
+		// set from the policy or the target premium table by PolicyRates
+		TargetPremium:       make([]float64, years),
+		PremiumLoadCap:      CreateVector(product.loadCap(), years),
+		PolicyFee:           loads.PolicyFee,
+		MaximumPremiumLoad:  CreateVector(product.MaximumPremiumLoad, years),
+		MaximumPolicyFee:    CreateVector(product.MaximumPolicyFee, years),
+		NAARDiscount:        CreateVector(bases.basis(RateNAARDiscount).discount(product.NAARDiscount), years),
+		Interest:            CreateVector(bases.basis(RateInterest).Monthly(product.Interest), years),
+		MinimumInterest:     CreateVector(bases.basis(RateMinimumInterest).Monthly(product.MinimumInterest), years),
+		InterestBonus:       make([]float64, years),
+		LoanInterest:        CreateVector(bases.basis(RateLoanInterest).Monthly(product.LoanInterest), years),
+		LoanCrediting:       CreateVector(bases.basis(RateLoanCrediting).Monthly(product.LoanCrediting), years),
+		SurrenderCharge:     surrenderCharges,
+		FreeWithdrawal:      CreateVector(product.FreeWithdrawal, years),
+		SevenPayRates:       make([]float64, years),
+		SevenPayAnnuities:   make([]float64, years),
+		ModalFactors:        product.ModalFactors,
+		GracePeriodMonths:   product.GracePeriodMonths,
+		MaturityAge:         product.MaturityAge,
+		ExtendedMaturityAge: product.ExtendedMaturityAge,
+		Charges:             product.charges(),
+		Arithmetic:          product.Arithmetic,
+		Rounding:            product.Rounding,
+	}
+	return rates, nil
+}
@@ -0,0 +1,127 @@
+package valact
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ReserveMethod is how the net premiums of a reserve are set.
+type ReserveMethod string
+
+const (
+	// ReserveNLP is the net level premium reserve: a level net premium
+	// each year.
+	ReserveNLP ReserveMethod = "nlp"
+	// ReserveCRVM is the Commissioners Reserve Valuation Method: full
+	// preliminary term, a first year net premium of the one year term
+	// cost and a level renewal net premium, with the expense allowance
+	// limited to that of a 19 payment life plan issued a year later.
+	ReserveCRVM ReserveMethod = "crvm"
+)
+
+// Valid reports whether m is nlp, crvm, or empty (nlp).
+func (m ReserveMethod) Valid() bool {
+	return m == "" || m == ReserveNLP || m == ReserveCRVM
+}
+
+// ValuationBasis holds the statutory valuation assumptions of the reserves
+// set on a ledger.
+type ValuationBasis struct {
+	// Mortality is the valuation mortality, the annual rate per $1,000 by
+	// policy year.
+	Mortality []float64
+	// Interest is the annual effective valuation rate.
+	Interest float64
+	Method   ReserveMethod
+}
+
+// GetValuationBasis returns the valuation basis for the insured: the
+// valuation mortality table, or the guaranteed COI rates without one, at
+// 3.5% interest by the net level premium method.
+func (s RateSource) GetValuationBasis(gender string, riskClass string, issueAge int) (*ValuationBasis, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	mortality, err := s.readCOITable(s.path(s.ValuationMortalityFile, ValuationMortalityFile), gender, riskClass, issueAge)
+	if errors.Is(err, fs.ErrNotExist) {
+		mortality, err = s.GetGuaranteedCOIRates(gender, riskClass, issueAge)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ValuationBasis{Mortality: mortality, Interest: 0.035, Method: ReserveNLP}, nil
+}
+
+// setReserves sets the terminal and mean reserves of a monthly ledger from
+// issue on the last month of each policy year and on the final month. The
+// benefit of each policy year is the face amount at its start, paid at the
+// end of the year of death, and the face amount at the end of the ledger is
+// paid as an endowment unless the policy lapses; the net premiums are paid
+// at the start of each year to the end of the ledger. Terminal reserves are
+// no less than zero.
+func (l Ledger) setReserves(basis *ValuationBasis) {
+	if len(l) == 0 {
+		return
+	}
+	years := l[len(l)-1].PolicyYear
+	benefits := make([]float64, years+1)
+	for i := len(l) - 1; i >= 0; i-- {
+		benefits[l[i].PolicyYear] = l[i].FaceAmount
+	}
+	mortality := func(year int) float64 {
+		if year > len(basis.Mortality) {
+			return 1
+		}
+		return min(1, basis.Mortality[year-1]/1000)
+	}
+	v := 1 / (1 + basis.Interest)
+
+	// insurance[t] and annuity[t] are the present values at the end of
+	// policy year t, per survivor, of the benefits and of 1 a year due
+	insurance := make([]float64, years+1)
+	annuity := make([]float64, years+1)
+	if !l[len(l)-1].Lapsed {
+		insurance[years] = benefits[years]
+	}
+	for t := years - 1; t >= 0; t-- {
+		q := mortality(t + 1)
+		insurance[t] = v * (q*benefits[t+1] + (1-q)*insurance[t+1])
+		annuity[t] = 1 + v*(1-q)*annuity[t+1]
+	}
+	first := insurance[0] / annuity[0]
+	renewal := first
+	if basis.Method == ReserveCRVM && years > 1 {
+		first = v * mortality(1) * benefits[1]
+		renewal = (insurance[0] - first) / (annuity[0] - 1)
+		// the 19 payment life net premium at the next age, on the same
+		// benefits
+		due, survival := 0.0, 1.0
+		for t := 1; t < min(years, 20); t++ {
+			due += survival
+			survival *= v * (1 - mortality(t+1))
+		}
+		if nineteenPay := insurance[1] / due; renewal > nineteenPay {
+			allowance := nineteenPay - first
+			renewal = insurance[0]/annuity[0] + allowance/annuity[0]
+			first = renewal - allowance
+		}
+	}
+
+	reserves := make([]float64, years+1)
+	for t := 1; t <= years; t++ {
+		reserves[t] = max(0, insurance[t]-renewal*annuity[t])
+	}
+	for i, row := range l {
+		if row.MonthInPolicyYear != 12 && i != len(l)-1 {
+			continue
+		}
+		t := row.PolicyYear
+		premium := renewal
+		if t == 1 {
+			premium = first
+		}
+		l[i].TerminalReserve = reserves[t]
+		l[i].MeanReserve = (reserves[t-1] + premium + reserves[t]) / 2
+	}
+}
@@ -0,0 +1,112 @@
+package valact
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Result is the structured output of an illustration or premium solve,
+// intended for JSON consumers.
+type Result struct {
+	// Policy echoes the inputs, including the solved premium when solved.
+	Policy Policy `json:"policy"`
+	// SolvedPremium is set only for solve results.
+	SolvedPremium *float64 `json:"solved_premium,omitempty"`
+	// GuaranteedPremium is the premium solved for on the guaranteed basis,
+	// set when asked for alongside SolvedPremium.
+	GuaranteedPremium *float64 `json:"guaranteed_premium,omitempty"`
+	// AnnuityPayment is the periodic payment of an annuity bought with the
+	// maturity value, set when asked for; see RateSource.Annuitize.
+	AnnuityPayment *float64 `json:"annuity_payment,omitempty"`
+	// MaturityValue is the value net of loans at maturity, or at lapse.
+	MaturityValue float64 `json:"maturity_value"`
+	// LapseYear and LapseMonth are set when the policy lapses.
+	LapseYear  int `json:"lapse_year,omitempty"`
+	LapseMonth int `json:"lapse_month,omitempty"`
+	// GuidelineExcessYear is the first policy year with premium over the
+	// guideline premium limit, 0 if none or the policy is not tested.
+	GuidelineExcessYear int `json:"guideline_excess_year,omitempty"`
+	// MECYear is the policy year the policy became a modified endowment
+	// contract, 0 if it never did or was not tested.
+	MECYear     int         `json:"mec_year,omitempty"`
+	Annual      Ledger      `json:"annual"`
+	Diagnostics Diagnostics `json:"diagnostics"`
+}
+
+// Diagnostics reports how a result was produced.
+type Diagnostics struct {
+	// Months is the number of months projected.
+	Months int `json:"months"`
+	// IllustrateCalls counts the projections run, including solver iterations.
+	IllustrateCalls int `json:"illustrate_calls"`
+	// FirstNegativeMonth is the first policy month ending without a positive
+	// value net of loans (entering the grace period), or 0 if it never did.
+	FirstNegativeMonth int `json:"first_negative_month"`
+}
+
+// NewResult illustrates the policy at its annual premium.
+func NewResult(policy Policy, rates *RateSet) Result {
+	result := newResult(policy, rates)
+	result.Diagnostics.IllustrateCalls = 1
+	return result
+}
+
+// NewSolveResult solves for the minimum premium and illustrates the policy at
+// that premium. The error is that of Solve.
+func NewSolveResult(policy Policy, rates *RateSet) (Result, error) {
+	premium, calls, err := solvePremium(context.Background(), policy, rates, Target{Metric: MetricMaturityValue}, SolveOptions{}, 0)
+	if err != nil {
+		return Result{}, err
+	}
+	policy.AnnualPremium = premium
+	result := newResult(policy, rates)
+	result.SolvedPremium = &premium
+	result.Diagnostics.IllustrateCalls = calls + 1
+	return result, nil
+}
+
+func newResult(policy Policy, rates *RateSet) Result {
+	ledger := IllustrateLedger(policy, rates)
+	result := Result{
+		Policy: policy,
+		Annual: ledger.Annual(),
+		Diagnostics: Diagnostics{
+			Months: len(ledger),
+		},
+	}
+	if len(ledger) > 0 {
+		last := ledger[len(ledger)-1]
+		result.MaturityValue = last.ValueEnd - last.LoanBalance
+		if last.Lapsed {
+			result.LapseYear = last.PolicyYear
+			result.LapseMonth = last.PolicyMonth
+		}
+	}
+	for _, row := range ledger {
+		if row.ValueEnd-row.LoanBalance <= 0 {
+			result.Diagnostics.FirstNegativeMonth = row.PolicyMonth
+			break
+		}
+	}
+	for _, row := range ledger {
+		if row.GuidelineExcess > 0 {
+			result.GuidelineExcessYear = row.PolicyYear
+			break
+		}
+	}
+	for _, row := range ledger {
+		if row.MEC {
+			result.MECYear = row.PolicyYear
+			break
+		}
+	}
+	return result
+}
+
+// WriteJSON writes the result to w as indented JSON.
+func WriteJSON(w io.Writer, result Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,185 @@
+package valact
+
+import "fmt"
+
+// TermRider is level term coverage on the base insured, added to the death
+// benefit until the expiry age.
+type TermRider struct {
+	FaceAmount float64 `json:"face_amount"`
+	// ExpiryAge is the attained age at which the rider ends; zero means it
+	// runs to maturity.
+	ExpiryAge int `json:"expiry_age,omitempty"`
+}
+
+// inForce reports whether the rider covers the attained age.
+func (t *TermRider) inForce(attainedAge int) bool {
+	return t != nil && !riderExpired(t.ExpiryAge, attainedAge)
+}
+
+// TermRiderRates are the term rider's charges by policy year.
+type TermRiderRates struct {
+	// COI is the annual COI rate per $1,000 of rider face amount.
+	COI []float64
+	// PerUnit is the annual expense charge per $1,000 of rider face amount.
+	PerUnit []float64
+}
+
+// GetTermRiderRates reads the term rider COI table, in the same layout and
+// with the same code mapping as the COI table, and the term rider unit load
+// table, in the layout of the unit load table.
+func (s RateSource) GetTermRiderRates(gender string, riskClass string, issueAge int) (*TermRiderRates, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	coiRates, err := s.readCOITable(s.path(s.TermCOIFile, TermCOIFile), gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	perUnitRates, err := s.readIssueAgeTable(s.path(s.TermUnitLoadFile, TermUnitLoadFile), issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return &TermRiderRates{COI: coiRates, PerUnit: perUnitRates}, nil
+}
+
+// termRider returns the term rider face amount in force in the policy year
+// and its monthly COI and expense charges. The rider's NAAR is its whole
+// discounted face, rated like the base coverage; without a rider or rider
+// rates all three are 0.
+func (p Policy) termRider(rates *RateSet, policyYear int) (faceAmount float64, coi float64, charge float64) {
+	if rates.TermRider == nil || !p.TermRider.inForce(p.IssueAge+policyYear-1) {
+		return 0, 0, 0
+	}
+	faceAmount = p.TermRider.FaceAmount
+	coi = faceAmount * rates.NAARDiscount[policyYear-1] / 1000 * p.ratedCOI(rates.TermRider.COI[policyYear-1]) / 12
+	charge = rates.TermRider.PerUnit[policyYear-1] * faceAmount / 1000 / 12
+	return faceAmount, coi, charge
+}
+
+// WaiverBasis is how the waiver of premium rate is applied.
+type WaiverBasis string
+
+const (
+	// WaiverDeduction charges the rate as a fraction of the other monthly
+	// deductions.
+	WaiverDeduction WaiverBasis = "deduction"
+	// WaiverPerUnit charges the rate annually per $1,000 of face amount.
+	WaiverPerUnit WaiverBasis = "per-unit"
+)
+
+// Valid reports whether the basis is deduction, per-unit, or empty
+// (deduction).
+func (b WaiverBasis) Valid() bool {
+	return b == "" || b == WaiverDeduction || b == WaiverPerUnit
+}
+
+// WaiverRider waives the monthly deductions on disability; only its charge
+// is projected.
+type WaiverRider struct {
+	// ExpiryAge is the attained age at which the rider ends; zero means it
+	// runs to maturity.
+	ExpiryAge int `json:"expiry_age,omitempty"`
+}
+
+// WaiverRates are the waiver of premium rates by policy year, applied on
+// Basis.
+type WaiverRates struct {
+	Rate  []float64
+	Basis WaiverBasis
+}
+
+// GetWaiverRates reads the waiver of premium table, in the layout of the
+// unit load table, for rates on the basis (deduction when empty).
+func (s RateSource) GetWaiverRates(issueAge int, basis WaiverBasis) (*WaiverRates, error) {
+	if !basis.Valid() {
+		return nil, fmt.Errorf("unknown waiver basis %q", basis)
+	}
+	rates, err := s.readIssueAgeTable(s.path(s.WaiverFile, WaiverFile), issueAge)
+	if err != nil {
+		return nil, err
+	}
+	if basis == "" {
+		basis = WaiverDeduction
+	}
+	return &WaiverRates{Rate: rates, Basis: basis}, nil
+}
+
+// ADBRider pays an additional death benefit on accidental death; only its
+// charge is projected, and the benefit is not part of the death benefit.
+type ADBRider struct {
+	FaceAmount float64 `json:"face_amount"`
+	// ExpiryAge is the attained age at which the rider ends; zero means it
+	// runs to maturity.
+	ExpiryAge int `json:"expiry_age,omitempty"`
+}
+
+// GetADBRates reads the annual accidental death benefit rates per $1,000
+// of rider face amount, in the layout of the unit load table.
+func (s RateSource) GetADBRates(issueAge int) ([]float64, error) {
+	return s.readIssueAgeTable(s.path(s.ADBFile, ADBFile), issueAge)
+}
+
+// riderExpired reports whether a rider with the expiry age (zero for
+// maturity) has ended by the attained age.
+func riderExpired(expiryAge int, attainedAge int) bool {
+	return expiryAge > 0 && attainedAge >= expiryAge
+}
+
+// adbCharge returns the monthly accidental death benefit charge, 0 without
+// the rider or its rates.
+func (p Policy) adbCharge(rates *RateSet, policyYear int) float64 {
+	if p.ADB == nil || rates.ADB == nil || riderExpired(p.ADB.ExpiryAge, p.IssueAge+policyYear-1) {
+		return 0
+	}
+	return rates.ADB[policyYear-1] * p.ADB.FaceAmount / 1000 / 12
+}
+
+// waiverCharge returns the monthly waiver of premium charge on the other
+// monthly deductions or the face amount, 0 without the rider or its rates.
+// A per unit charge is prorated to the fraction of a full month; the
+// deductions already are.
+func (p Policy) waiverCharge(rates *RateSet, policyYear int, deduction float64, faceAmount float64, fraction float64) float64 {
+	if p.Waiver == nil || rates.Waiver == nil || riderExpired(p.Waiver.ExpiryAge, p.IssueAge+policyYear-1) {
+		return 0
+	}
+	rate := rates.Waiver.Rate[policyYear-1]
+	if rates.Waiver.Basis == WaiverPerUnit {
+		return rate * faceAmount / 1000 / 12 * fraction
+	}
+	return rate * deduction
+}
+
+// ChronicRider accelerates the death benefit on chronic illness: from the
+// claim month it pays a level monthly benefit, reducing the face amount by
+// the benefit and the account value and loan balance in the same
+// proportion, until the face amount is exhausted. Rider charges are waived
+// while on claim.
+type ChronicRider struct {
+	// BenefitRate is the monthly benefit as a share of the face amount at
+	// claim, e.g. 0.02 for 2%.
+	BenefitRate float64 `json:"benefit_rate"`
+	// ClaimMonth is the policy month the claim starts; zero projects the
+	// rider charges without a claim.
+	ClaimMonth int `json:"claim_month,omitempty"`
+}
+
+// onClaim reports whether the policy month falls in the claim.
+func (c *ChronicRider) onClaim(policyMonth int) bool {
+	return c != nil && c.ClaimMonth > 0 && policyMonth >= c.ClaimMonth
+}
+
+// GetChronicRates reads the annual chronic illness rider rates per $1,000
+// of face amount, in the layout of the unit load table.
+func (s RateSource) GetChronicRates(issueAge int) ([]float64, error) {
+	return s.readIssueAgeTable(s.path(s.ChronicFile, ChronicFile), issueAge)
+}
+
+// chronicCharge returns the monthly chronic illness rider charge on the
+// face amount, 0 without the rider or its rates or while on claim.
+func (p Policy) chronicCharge(rates *RateSet, policyYear int, policyMonth int, faceAmount float64) float64 {
+	if p.Chronic == nil || rates.Chronic == nil || p.Chronic.onClaim(policyMonth) {
+		return 0
+	}
+	return rates.Chronic[policyYear-1] * faceAmount / 1000 / 12
+}
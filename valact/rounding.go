@@ -0,0 +1,237 @@
+package valact
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoundingAmount names the money amounts of the monthly calculation that a
+// rounding rule applies to.
+type RoundingAmount string
+
+const (
+	// RoundPremium rounds the modal premium paid and the premium totals.
+	RoundPremium RoundingAmount = "premium"
+	// RoundPremiumLoad rounds the premium load.
+	RoundPremiumLoad RoundingAmount = "premium_load"
+	// RoundExpenses rounds the policy fee and per unit expense charge.
+	RoundExpenses RoundingAmount = "expenses"
+	// RoundCOI rounds the COI charge and the flat extra.
+	RoundCOI RoundingAmount = "coi"
+	// RoundRiders rounds each rider charge: the term rider COI and expense
+	// charge, and the waiver of premium, accidental death benefit, and
+	// chronic illness charges.
+	RoundRiders RoundingAmount = "riders"
+	// RoundInterest rounds the interest credited, fund returns, and index
+	// credits.
+	RoundInterest RoundingAmount = "interest"
+	// RoundValue rounds the account value after each monthly step.
+	RoundValue RoundingAmount = "value"
+	// RoundLoan rounds loan advances, repayments, and interest, and the
+	// loan balance.
+	RoundLoan RoundingAmount = "loan"
+	// RoundWithdrawal rounds withdrawals and their charges.
+	RoundWithdrawal RoundingAmount = "withdrawal"
+	// RoundSurrenderCharge rounds the surrender charge.
+	RoundSurrenderCharge RoundingAmount = "surrender_charge"
+	// RoundDeathBenefit rounds the death benefit and accelerated chronic
+	// illness benefits.
+	RoundDeathBenefit RoundingAmount = "death_benefit"
+	// RoundFace rounds the face amount as withdrawals and claims reduce it.
+	RoundFace RoundingAmount = "face"
+)
+
+// roundingAmounts are the amounts in the order of their rules in a
+// rounder.
+var roundingAmounts = []RoundingAmount{
+	RoundPremium, RoundPremiumLoad, RoundExpenses, RoundCOI, RoundRiders, RoundInterest,
+	RoundValue, RoundLoan, RoundWithdrawal, RoundSurrenderCharge, RoundDeathBenefit, RoundFace,
+}
+
+// Indexes of the amounts in roundingAmounts.
+const (
+	roundPremium = iota
+	roundPremiumLoad
+	roundExpenses
+	roundCOI
+	roundRiders
+	roundInterest
+	roundValue
+	roundLoan
+	roundWithdrawal
+	roundSurrenderCharge
+	roundDeathBenefit
+	roundFace
+)
+
+// RoundingMethod is how a rule rounds an amount to its places.
+type RoundingMethod string
+
+const (
+	// RoundingNone leaves the amount unrounded.
+	RoundingNone RoundingMethod = ""
+	// RoundingNearest rounds to the nearest, half away from zero.
+	RoundingNearest RoundingMethod = "nearest"
+	// RoundingHalfEven rounds to the nearest, half to even (banker's
+	// rounding).
+	RoundingHalfEven RoundingMethod = "half-even"
+	// RoundingDown truncates toward zero.
+	RoundingDown RoundingMethod = "down"
+	// RoundingUp rounds away from zero.
+	RoundingUp RoundingMethod = "up"
+)
+
+// RoundingRule rounds an amount to Places decimal places, e.g. 2 for
+// cents, by Method.
+type RoundingRule struct {
+	Places int
+	Method RoundingMethod
+}
+
+// RoundingRules are the rules that round the money amounts of a projection,
+// for it to tie to an administration system penny for penny: Amounts by
+// amount, and Default for the others. Amounts without a rule follow the
+// rates' Arithmetic.
+type RoundingRules struct {
+	Default RoundingRule
+	Amounts map[RoundingAmount]RoundingRule
+}
+
+// ParseRoundingRules parses comma separated rules, each an amount and a rule,
+// or a rule for every other amount, where a rule is the decimal places and
+// optionally a method (nearest by default), or none, e.g.
+// "coi=2,interest=2:down,value=2:half-even,premium=none".
+func ParseRoundingRules(spec string) (*RoundingRules, error) {
+	rounding := &RoundingRules{Amounts: make(map[RoundingAmount]RoundingRule)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(item, "=")
+		if !ok {
+			name, text = "", item
+		}
+		rule, err := parseRoundingRule(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("rounding %q: %w", item, err)
+		}
+		amount := RoundingAmount(strings.TrimSpace(name))
+		switch {
+		case amount == "":
+			rounding.Default = rule
+		case roundingIndex(amount) < 0:
+			return nil, fmt.Errorf("rounding %q: unknown amount %q (want %s)", item, amount, joinAmounts())
+		default:
+			rounding.Amounts[amount] = rule
+		}
+	}
+	return rounding, nil
+}
+
+// parseRoundingRule parses PLACES[:METHOD], or none.
+func parseRoundingRule(text string) (RoundingRule, error) {
+	if text == "none" {
+		return RoundingRule{}, nil
+	}
+	placesText, method, _ := strings.Cut(text, ":")
+	places, err := strconv.Atoi(placesText)
+	if err != nil || places < 0 || places > 10 {
+		return RoundingRule{}, fmt.Errorf("invalid decimal places %q (want 0 to 10, or none)", placesText)
+	}
+	rule := RoundingRule{Places: places, Method: RoundingMethod(method)}
+	switch rule.Method {
+	case RoundingNone:
+		rule.Method = RoundingNearest
+	case RoundingNearest, RoundingHalfEven, RoundingDown, RoundingUp:
+	default:
+		return RoundingRule{}, fmt.Errorf("unknown method %q (want nearest, half-even, down, or up)", method)
+	}
+	return rule, nil
+}
+
+func roundingIndex(amount RoundingAmount) int {
+	for i, a := range roundingAmounts {
+		if a == amount {
+			return i
+		}
+	}
+	return -1
+}
+
+func joinAmounts() string {
+	names := make([]string, len(roundingAmounts))
+	for i, amount := range roundingAmounts {
+		names[i] = string(amount)
+	}
+	return strings.Join(names, ", ")
+}
+
+// rounder rounds the money amounts of a projection by their rules; nil
+// rounds none.
+type rounder struct {
+	rules [roundFace + 1]RoundingRule
+}
+
+// rounder returns the rounder of the rates' rounding rules and arithmetic,
+// nil when no amount is rounded.
+func (r *RateSet) rounder() *rounder {
+	if r.Rounding == nil && r.Arithmetic != ArithmeticCents {
+		return nil
+	}
+	rounder := new(rounder)
+	for i, amount := range roundingAmounts {
+		rule := RoundingRule{}
+		if r.Arithmetic == ArithmeticCents {
+			rule = RoundingRule{Places: 2, Method: RoundingNearest}
+		}
+		if r.Rounding != nil {
+			if r.Rounding.Default.Method != RoundingNone {
+				rule = r.Rounding.Default
+			}
+			if amountRule, ok := r.Rounding.Amounts[amount]; ok {
+				rule = amountRule
+			}
+		}
+		rounder.rules[i] = rule
+	}
+	return rounder
+}
+
+// round rounds the amount by the rule of its index in roundingAmounts.
+func (r *rounder) round(amount int, value float64) float64 {
+	if r == nil {
+		return value
+	}
+	return r.rules[amount].round(value)
+}
+
+// round rounds the value by the rule. Values within a millionth of a unit
+// of the last place of a whole one, as sums of rounded amounts are, are
+// taken as that whole one, so that down and up do not move them.
+func (rule RoundingRule) round(value float64) float64 {
+	scale := math.Pow10(rule.Places)
+	scaled := value * scale
+	if whole := math.Round(scaled); math.Abs(scaled-whole) < 1e-6 {
+		scaled = whole
+	}
+	switch rule.Method {
+	case RoundingNearest:
+		scaled = math.Round(scaled)
+	case RoundingHalfEven:
+		scaled = math.RoundToEven(scaled)
+	case RoundingDown:
+		scaled = math.Trunc(scaled)
+	case RoundingUp:
+		if scaled < 0 {
+			scaled = math.Floor(scaled)
+		} else {
+			scaled = math.Ceil(scaled)
+		}
+	default:
+		return value
+	}
+	return scaled / scale
+}
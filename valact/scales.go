@@ -0,0 +1,314 @@
+package valact
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+)
+
+// Scales holds the rate sets for the three illustration scales.
+type Scales struct {
+	Current    *RateSet
+	Guaranteed *RateSet
+	Midpoint   *RateSet
+}
+
+// GuaranteedRateColumn is the optional COI table column holding the
+// guaranteed maximum rate next to the current Rate. A COI table with it
+// supplies both scales and the guaranteed COI table is not read.
+const GuaranteedRateColumn = "Guaranteed_Rate"
+
+// GetGuaranteedCOIRates reads guaranteed maximum COI rates from the
+// GuaranteedRateColumn of the COI table, or else from the guaranteed COI
+// table in the same layout as GetCOIRates.
+func (s RateSource) GetGuaranteedCOIRates(gender string, riskClass string, issueAge int) ([]float64, error) {
+	bands, err := s.GetGuaranteedCOIBands(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return bands[0].Rates, nil
+}
+
+// GetGuaranteedCOIBands reads the guaranteed COI table like
+// GetGuaranteedCOIRates, returning every face amount band.
+func (s RateSource) GetGuaranteedCOIBands(gender string, riskClass string, issueAge int) ([]RateBand, error) {
+	gender, riskClass, err := s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, err
+	}
+	path := s.path(s.COIFile, COIFile)
+	if combined, err := s.hasColumn(path, GuaranteedRateColumn); err != nil {
+		return nil, err
+	} else if combined {
+		columns, err := s.readCOIColumns(path, gender, riskClass, issueAge, 0, GuaranteedRateColumn)
+		if err != nil {
+			return nil, err
+		}
+		return columns[0], nil
+	}
+	return s.readCOIBands(s.path(s.GuaranteedCOIFile, GuaranteedCOIFile), gender, riskClass, issueAge)
+}
+
+// GetCOIScaleBands reads the current and guaranteed COI bands: in one pass
+// from a COI table with a GuaranteedRateColumn, or else from the COI and
+// guaranteed COI tables. guaranteed is nil when the COI table has no
+// guaranteed column and the guaranteed COI table does not exist. The
+// current rates must run to the product's maturity, or its extended
+// maturity, unless the table's MissingRate fills them.
+func (s RateSource) GetCOIScaleBands(gender string, riskClass string, issueAge int) (current []RateBand, guaranteed []RateBand, err error) {
+	gender, riskClass, err = s.MapCodes(gender, riskClass)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := s.path(s.COIFile, COIFile)
+	combined, err := s.hasColumn(path, GuaranteedRateColumn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if combined {
+		columns, err := s.readCOIColumns(path, gender, riskClass, issueAge, s.projectionYears(issueAge), "Rate", GuaranteedRateColumn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return columns[0], columns[1], nil
+	}
+	columns, err := s.readCOIColumns(path, gender, riskClass, issueAge, s.projectionYears(issueAge), "Rate")
+	if err != nil {
+		return nil, nil, err
+	}
+	current = columns[0]
+	guaranteed, err = s.readCOIBands(s.path(s.GuaranteedCOIFile, GuaranteedCOIFile), gender, riskClass, issueAge)
+	if errors.Is(err, fs.ErrNotExist) {
+		return current, nil, nil
+	}
+	return current, guaranteed, err
+}
+
+// hasColumn reports whether the CSV file's header has the column.
+func (s RateSource) hasColumn(path string, column string) (bool, error) {
+	path, err := s.version(path)
+	if err != nil {
+		return false, err
+	}
+	if s.Store != nil {
+		if columns := s.Store.tableColumns(s.Store.table(path)); columns != nil {
+			return slices.Contains(columns, column), nil
+		}
+	}
+	file, err := s.openPath(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return slices.Contains(header, column), nil
+}
+
+// GetGuaranteedRates returns the current rates with the guaranteed elements
+// substituted: maximum COI, the product's minimum crediting interest, and
+// its maximum premium loads and policy fee.
+func (s RateSource) GetGuaranteedRates(gender string, riskClass string, issueAge int) (*RateSet, error) {
+	rates, err := s.GetRates(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	coiBands, err := s.GetGuaranteedCOIBands(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	rates.guarantee(coiBands)
+	return rates, nil
+}
+
+// GuaranteedBasis returns a copy of rates loaded for the insured, e.g. by
+// PolicyRates, with the guaranteed elements of GetGuaranteedRates in place
+// of the current ones. Everything else, such as riders, state variations,
+// and the 7-pay and guideline tests, is kept, so a solve on it gives the
+// guaranteed counterpart of a solve on rates. The COI of a second life is
+// not changed.
+func (s RateSource) GuaranteedBasis(rates *RateSet, gender string, riskClass string, issueAge int) (*RateSet, error) {
+	coiBands, err := s.GetGuaranteedCOIBands(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	guaranteed := rates.clone()
+	guaranteed.guarantee(coiBands)
+	return guaranteed, nil
+}
+
+// guarantee substitutes the guaranteed elements into r: the maximum COI
+// bands, MinimumInterest for the crediting interest, and MaximumPremiumLoad
+// and MaximumPolicyFee for the loads and fee. Rates without maximum loads
+// keep their current ones.
+func (r *RateSet) guarantee(coiBands []RateBand) {
+	r.COI = coiBands[0].Rates
+	r.COIBands = banded(coiBands)
+	r.GuaranteedCOI = coiBands
+	r.Interest = slices.Clone(r.MinimumInterest)
+	r.MonthlyInterest = nil
+	if r.MaximumPremiumLoad != nil {
+		r.PremiumLoad = slices.Clone(r.MaximumPremiumLoad)
+		r.PremiumLoadExcess = slices.Clone(r.MaximumPremiumLoad)
+	}
+	if r.MaximumPolicyFee != nil {
+		r.PolicyFee = slices.Clone(r.MaximumPolicyFee)
+	}
+}
+
+// GetScales loads the current and guaranteed rates and derives the
+// midpoint scale.
+func (s RateSource) GetScales(gender string, riskClass string, issueAge int) (*Scales, error) {
+	current, err := s.GetRates(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	guaranteed, err := s.GetGuaranteedRates(gender, riskClass, issueAge)
+	if err != nil {
+		return nil, err
+	}
+	return &Scales{
+		Current:    current,
+		Guaranteed: guaranteed,
+		Midpoint:   MidpointRates(current, guaranteed),
+	}, nil
+}
+
+// MidpointRates returns the NAIC midpoint scale: COI rates and crediting
+// interest (by month under a current interest scenario) halfway between
+// current and guaranteed, other charges current.
+// Banded COI rates are averaged band by band when both scales band alike;
+// otherwise the midpoint uses the averaged lowest bands.
+func MidpointRates(current *RateSet, guaranteed *RateSet) *RateSet {
+	midpoint := *current
+	midpoint.COI = slices.Clone(current.COI)
+	midpoint.Interest = slices.Clone(current.Interest)
+	for i := range midpoint.COI {
+		midpoint.COI[i] = (current.COI[i] + guaranteed.COI[i]) / 2
+		midpoint.Interest[i] = (current.Interest[i] + guaranteed.Interest[i]) / 2
+	}
+	if current.MonthlyInterest != nil {
+		midpoint.MonthlyInterest = make([]float64, len(current.MonthlyInterest))
+		for i, rate := range current.MonthlyInterest {
+			midpoint.MonthlyInterest[i] = (rate + guaranteed.interest(i+1, i/12+1)) / 2
+		}
+	}
+	midpoint.COIBands = nil
+	if sameBands(current.COIBands, guaranteed.COIBands) && current.COIBands != nil {
+		midpoint.COIBands = make([]RateBand, len(current.COIBands))
+		for b, band := range current.COIBands {
+			midpoint.COIBands[b].MinFace = band.MinFace
+			midpoint.COIBands[b].Rates = make([]float64, len(band.Rates))
+			for i := range band.Rates {
+				midpoint.COIBands[b].Rates[i] = (band.Rates[i] + guaranteed.COIBands[b].Rates[i]) / 2
+			}
+		}
+	}
+	return &midpoint
+}
+
+// sameBands reports whether two band lists have the same minimum faces.
+func sameBands(a []RateBand, b []RateBand) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].MinFace != b[i].MinFace {
+			return false
+		}
+	}
+	return true
+}
+
+// ScaleColumns are the values reported for each scale in a ScaleRow.
+type ScaleColumns struct {
+	AccountValue       float64 `json:"account_value"`
+	CashSurrenderValue float64 `json:"cash_surrender_value"`
+	DeathBenefit       float64 `json:"death_benefit"`
+	// Lapsed is set from the lapse year onwards; values are then zero.
+	Lapsed bool `json:"lapsed,omitempty"`
+}
+
+// ScaleRow is one policy year of a side by side illustration.
+type ScaleRow struct {
+	PolicyYear int          `json:"policy_year"`
+	Premium    float64      `json:"premium"`
+	Guaranteed ScaleColumns `json:"guaranteed"`
+	Midpoint   ScaleColumns `json:"midpoint"`
+	Current    ScaleColumns `json:"current"`
+}
+
+// IllustrateScales projects the policy on each scale and returns the annual
+// values side by side, one row per policy year to maturity.
+func IllustrateScales(policy Policy, scales *Scales) []ScaleRow {
+	years := scales.Current.projectionEndAge() - policy.IssueAge
+	rows := make([]ScaleRow, years)
+	for i := range rows {
+		rows[i].PolicyYear = i + 1
+	}
+	fill := func(rates *RateSet, column func(*ScaleRow) *ScaleColumns) {
+		annual := IllustrateLedger(policy, rates).Annual()
+		for i := range rows {
+			if i >= len(annual) {
+				column(&rows[i]).Lapsed = true
+				continue
+			}
+			year := annual[i]
+			rows[i].Premium = max(rows[i].Premium, year.Premium)
+			*column(&rows[i]) = ScaleColumns{
+				AccountValue:       year.ValueEnd,
+				CashSurrenderValue: year.CashSurrenderValue,
+				DeathBenefit:       year.DeathBenefit,
+				Lapsed:             year.Lapsed,
+			}
+		}
+	}
+	fill(scales.Guaranteed, func(row *ScaleRow) *ScaleColumns { return &row.Guaranteed })
+	fill(scales.Midpoint, func(row *ScaleRow) *ScaleColumns { return &row.Midpoint })
+	fill(scales.Current, func(row *ScaleRow) *ScaleColumns { return &row.Current })
+	return rows
+}
+
+// ScaleLedgerColumns is the column layout written by WriteScaleLedgerCSV.
+var ScaleLedgerColumns = []string{
+	"Policy_Year",
+	"Premium",
+	"Guaranteed_Value",
+	"Guaranteed_Cash_Surrender_Value",
+	"Guaranteed_Death_Benefit",
+	"Midpoint_Value",
+	"Midpoint_Cash_Surrender_Value",
+	"Midpoint_Death_Benefit",
+	"Current_Value",
+	"Current_Cash_Surrender_Value",
+	"Current_Death_Benefit",
+}
+
+// WriteScaleLedgerCSV writes a side by side illustration as CSV.
+func WriteScaleLedgerCSV(w io.Writer, rows []ScaleRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ScaleLedgerColumns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := []string{strconv.Itoa(row.PolicyYear), formatFloat(row.Premium)}
+		for _, columns := range []ScaleColumns{row.Guaranteed, row.Midpoint, row.Current} {
+			record = append(record,
+				formatFloat(columns.AccountValue),
+				formatFloat(columns.CashSurrenderValue),
+				formatFloat(columns.DeathBenefit),
+			)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
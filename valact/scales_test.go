@@ -0,0 +1,60 @@
+package valact
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestGuaranteedBasisProduct checks that the guaranteed basis credits the
+// product's minimum interest and charges its maximum loads and fee.
+func TestGuaranteedBasisProduct(t *testing.T) {
+	product := DefaultProduct()
+	product.MinimumInterest = 0.01
+	product.MaximumPremiumLoad = 0.10
+	product.MaximumPolicyFee = 150
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables", Product: &product}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, State: "NY"}
+	rates, err := source.PolicyRates(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guaranteed, err := source.GuaranteedBasis(rates, policy.Gender, policy.RiskClass, policy.IssueAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variation, err := source.GetStateVariation(policy.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tax := variation.PremiumTax
+	for year := range guaranteed.Interest {
+		if want := math.Pow(1.01, 1/12.0) - 1; math.Abs(guaranteed.Interest[year]-want) > 1e-15 {
+			t.Fatalf("year %d interest %g, want %g", year+1, guaranteed.Interest[year], want)
+		}
+		if want := 0.10 + tax; math.Abs(guaranteed.PremiumLoad[year]-want) > 1e-15 || math.Abs(guaranteed.PremiumLoadExcess[year]-want) > 1e-15 {
+			t.Fatalf("year %d premium loads %g and %g, want %g", year+1, guaranteed.PremiumLoad[year], guaranteed.PremiumLoadExcess[year], want)
+		}
+		if guaranteed.PolicyFee[year] != 150 {
+			t.Fatalf("year %d policy fee %g, want 150", year+1, guaranteed.PolicyFee[year])
+		}
+	}
+	if rates.Interest[0] == guaranteed.Interest[0] || rates.PolicyFee[0] != 120 {
+		t.Error("the guaranteed basis changed the current rates")
+	}
+}
+
+// TestReadProductsMaximumCharges checks the maximum charge keys of the
+// product file and their defaults.
+func TestReadProductsMaximumCharges(t *testing.T) {
+	products, err := ReadProducts(strings.NewReader("[A]\nmaximum_premium_load = 0.1\nmaximum_policy_fee = 150\n[B]\n"), "products.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := products["A"]; a.MaximumPremiumLoad != 0.1 || a.MaximumPolicyFee != 150 {
+		t.Errorf("A maximum charges %g and %g, want 0.1 and 150", a.MaximumPremiumLoad, a.MaximumPolicyFee)
+	}
+	if b := products["B"]; b.MaximumPremiumLoad != 0.08 || b.MaximumPolicyFee != 180 {
+		t.Errorf("B maximum charges %g and %g, want the defaults 0.08 and 180", b.MaximumPremiumLoad, b.MaximumPolicyFee)
+	}
+}
@@ -0,0 +1,145 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrUnknownScenario is returned when a scenario is not in the scenario
+// table.
+var ErrUnknownScenario = errors.New("unknown scenario")
+
+// Scenario is a crediting rate scenario: monthly effective rates by policy
+// month for RateSet.MonthlyInterest.
+type Scenario struct {
+	Name     string
+	Interest []float64
+}
+
+// GetInterestScenario reads the named crediting rate scenario from the
+// interest scenario table (see ReadScenarios) and returns its monthly
+// effective rates by policy month.
+func (s RateSource) GetInterestScenario(name string) ([]float64, error) {
+	path := s.path(s.InterestScenarioFile, InterestScenarioFile)
+	file, err := s.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scenarios, err := ReadScenarios(file, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, scenario := range scenarios {
+		if scenario.Name == name {
+			return scenario.Interest, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w %q", path, ErrUnknownScenario, name)
+}
+
+// ReadScenarios reads crediting rate scenarios, in order of first
+// appearance, from a CSV with the columns Scenario, Rate, and either
+// Policy_Year or Policy_Month, and optionally Basis, the RateBasis of the
+// row's rate (annual effective when blank or absent). A rate holds until the next
+// period given for its scenario, and the last one to maturity (see
+// RateSet.MonthlyInterest); the first also covers any earlier months. name
+// is used in error messages.
+func ReadScenarios(r io.Reader, name string) ([]Scenario, error) {
+	t, err := newTableReader(r, name, scenarioSchema)
+	if err != nil {
+		return nil, err
+	}
+	scenarioField, rateField, basisField := t.field("Scenario"), t.field("Rate"), t.field("Basis")
+	periodField, periodMonths := t.field("Policy_Year"), 12
+	if !t.has(periodField) {
+		periodField, periodMonths = t.field("Policy_Month"), 1
+	}
+	if !t.has(periodField) {
+		return nil, fmt.Errorf("%s: missing column Policy_Year or Policy_Month", name)
+	}
+
+	// monthly rate from the first month of each given period, by scenario
+	var names []string
+	given := make(map[string]map[int]float64)
+	for t.next() {
+		period, err := t.int(periodField)
+		if err != nil {
+			return nil, err
+		}
+		month := (period-1)*periodMonths + 1
+		if period < 1 {
+			return nil, t.fieldError(periodField, errOutOfRange)
+		}
+		rate, err := t.float(rateField)
+		if err != nil {
+			return nil, err
+		}
+		scenario := t.raw(scenarioField)
+		if given[scenario] == nil {
+			names = append(names, scenario)
+			given[scenario] = make(map[int]float64)
+		}
+		basis, err := t.text(basisField)
+		if err != nil {
+			return nil, err
+		}
+		given[scenario][month] = RateBasis(basis).Monthly(rate)
+	}
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+
+	scenarios := make([]Scenario, len(names))
+	for i, scenario := range names {
+		scenarios[i] = Scenario{Name: scenario, Interest: fillMonths(given[scenario])}
+	}
+	return scenarios, nil
+}
+
+// fillMonths spreads rates given from some policy months over every month
+// to the last given.
+func fillMonths(given map[int]float64) []float64 {
+	first, last := math.MaxInt, 0
+	for month := range given {
+		first, last = min(first, month), max(last, month)
+	}
+	rates := make([]float64, last)
+	rate := given[first]
+	for month := range rates {
+		if r, ok := given[month+1]; ok {
+			rate = r
+		}
+		rates[month] = rate
+	}
+	return rates
+}
+
+// interest is the monthly effective crediting rate in the policy month: the
+// scenario or current rate, no less than the guaranteed minimum, plus any
+// interest bonus.
+func (r *RateSet) interest(policyMonth int, policyYear int) float64 {
+	rate := r.Interest[policyYear-1]
+	if n := len(r.MonthlyInterest); n > 0 {
+		rate = r.MonthlyInterest[min(policyMonth, n)-1]
+	}
+	rate = max(rate, r.MinimumInterest[policyYear-1])
+	if bonus := r.InterestBonus[policyYear-1]; bonus != 0 {
+		rate = math.Pow(math.Pow(1+rate, 12)+bonus, 1/12.0) - 1
+	}
+	return rate
+}
+
+// AddInterestBonus adds an annual interest bonus, e.g. 0.0025 for 25bp,
+// to the policy years from fromYear through toYear (to maturity when
+// toYear is zero).
+func (r *RateSet) AddInterestBonus(bonus float64, fromYear int, toYear int) {
+	if toYear == 0 {
+		toYear = len(r.InterestBonus)
+	}
+	for year := max(1, fromYear); year <= min(toYear, len(r.InterestBonus)); year++ {
+		r.InterestBonus[year-1] += bonus
+	}
+}
@@ -0,0 +1,158 @@
+package valact
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Shock is a parameterized change to a rate set for sensitivity testing.
+type Shock struct {
+	Name string `json:"name"`
+	// COI scales the COI rates, e.g. 0.10 for +10%, capped at $1,000.
+	COI float64 `json:"coi,omitempty"`
+	// Interest shifts the annual effective crediting rate, e.g. -0.01 for
+	// -100bp.
+	Interest float64 `json:"interest,omitempty"`
+	// Loads scales the premium loads, policy fee, and per unit charges.
+	Loads float64 `json:"loads,omitempty"`
+}
+
+// StandardShocks returns the base case followed by COI, interest, and load
+// shocks up and down by the given sizes; a zero size skips that pair.
+func StandardShocks(coi float64, interest float64, loads float64) []Shock {
+	shocks := []Shock{{Name: "base"}}
+	if coi != 0 {
+		shocks = append(shocks,
+			Shock{Name: fmt.Sprintf("coi +%g%%", 100*coi), COI: coi},
+			Shock{Name: fmt.Sprintf("coi -%g%%", 100*coi), COI: -coi})
+	}
+	if interest != 0 {
+		shocks = append(shocks,
+			Shock{Name: fmt.Sprintf("interest +%gbp", 10000*interest), Interest: interest},
+			Shock{Name: fmt.Sprintf("interest -%gbp", 10000*interest), Interest: -interest})
+	}
+	if loads != 0 {
+		shocks = append(shocks,
+			Shock{Name: fmt.Sprintf("loads +%g%%", 100*loads), Loads: loads},
+			Shock{Name: fmt.Sprintf("loads -%g%%", 100*loads), Loads: -loads})
+	}
+	return shocks
+}
+
+// Apply returns a copy of the rates with the shock applied.
+func (s Shock) Apply(rates *RateSet) *RateSet {
+	shocked := *rates
+	shocked.COI = slices.Clone(rates.COI)
+	shocked.Interest = slices.Clone(rates.Interest)
+	shocked.PremiumLoad = slices.Clone(rates.PremiumLoad)
+	shocked.PremiumLoadExcess = slices.Clone(rates.PremiumLoadExcess)
+	shocked.PolicyFee = slices.Clone(rates.PolicyFee)
+	shocked.PerUnit = slices.Clone(rates.PerUnit)
+	coi := func(rate float64) float64 { return min(1000, rate*(1+s.COI)) }
+	shiftInterest := func(monthly float64) float64 {
+		return math.Pow(math.Pow(1+monthly, 12)+s.Interest, 1/12.0) - 1
+	}
+	for i := range shocked.COI {
+		shocked.COI[i] = coi(shocked.COI[i])
+		shocked.Interest[i] = shiftInterest(shocked.Interest[i])
+		shocked.PremiumLoad[i] *= 1 + s.Loads
+		shocked.PremiumLoadExcess[i] *= 1 + s.Loads
+		shocked.PolicyFee[i] *= 1 + s.Loads
+		shocked.PerUnit[i] *= 1 + s.Loads
+	}
+	shocked.COIBands = scaleBands(rates.COIBands, coi)
+	shocked.PerUnitBands = scaleBands(rates.PerUnitBands, func(rate float64) float64 { return rate * (1 + s.Loads) })
+	if rates.MonthlyInterest != nil {
+		shocked.MonthlyInterest = slices.Clone(rates.MonthlyInterest)
+		for i, rate := range shocked.MonthlyInterest {
+			shocked.MonthlyInterest[i] = shiftInterest(rate)
+		}
+	}
+	return &shocked
+}
+
+// scaleBands returns a copy of the bands with f applied to every rate.
+func scaleBands(bands []RateBand, f func(float64) float64) []RateBand {
+	if bands == nil {
+		return nil
+	}
+	scaled := slices.Clone(bands)
+	for b := range scaled {
+		scaled[b].Rates = slices.Clone(scaled[b].Rates)
+		for i, rate := range scaled[b].Rates {
+			scaled[b].Rates[i] = f(rate)
+		}
+	}
+	return scaled
+}
+
+// SensitivityResult is the outcome of a policy under one shock: the
+// premium solved to maturity and the projection at the policy's premium.
+// Err is set when the premium could not be solved.
+type SensitivityResult struct {
+	Shock         Shock   `json:"shock"`
+	SolvedPremium float64 `json:"solved_premium"`
+	MaturityValue float64 `json:"maturity_value"`
+	LapseMonth    int     `json:"lapse_month,omitempty"`
+	Err           error   `json:"-"`
+}
+
+// RunSensitivity solves and projects the policy under each shock.
+func RunSensitivity(policy Policy, rates *RateSet, shocks []Shock, options SolveOptions) []SensitivityResult {
+	results := make([]SensitivityResult, len(shocks))
+	for i, shock := range shocks {
+		shocked := shock.Apply(rates)
+		results[i].Shock = shock
+		seek := GoalSeek{Variable: Variable{Kind: VaryPremium}, Target: Target{Metric: MetricMaturityValue}, SolveOptions: options}
+		results[i].SolvedPremium, results[i].Err = seek.Solve(policy, shocked)
+		outcome := IllustrateOutcome(policy, shocked)
+		results[i].MaturityValue = outcome.Value
+		results[i].LapseMonth = outcome.LapseMonth
+	}
+	return results
+}
+
+// SensitivityColumns is the column layout written by WriteSensitivityCSV.
+var SensitivityColumns = []string{
+	"Shock",
+	"Solved_Premium",
+	"Premium_Change",
+	"Maturity_Value",
+	"Maturity_Value_Change",
+	"Lapse_Year",
+	"Error",
+}
+
+// WriteSensitivityCSV writes the results as a comparison table, with the
+// changes measured from the first result (the base case).
+func WriteSensitivityCSV(w io.Writer, results []SensitivityResult) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(SensitivityColumns); err != nil {
+		return err
+	}
+	for _, result := range results {
+		base := results[0]
+		record := []string{result.Shock.Name, "", "", formatFloat(result.MaturityValue), formatFloat(result.MaturityValue - base.MaturityValue), "", ""}
+		if result.Err != nil {
+			record[6] = result.Err.Error()
+		} else {
+			record[1] = formatFloat(result.SolvedPremium)
+			if base.Err == nil {
+				// premiums are quoted in cents
+				record[2] = formatFloat(math.Round(100*(result.SolvedPremium-base.SolvedPremium)) / 100)
+			}
+		}
+		if outcome := (Outcome{LapseMonth: result.LapseMonth}); outcome.Lapsed() {
+			record[5] = strconv.Itoa(outcome.LapseYear())
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
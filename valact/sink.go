@@ -0,0 +1,276 @@
+package valact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ResultSink receives the results of a batch or stochastic run as they are
+// emitted and writes them out, so no run holds its results in memory.
+// BatchWriter, BatchParquetWriter, StochasticWriter, and JSONLinesWriter
+// are sinks.
+type ResultSink[T any] interface {
+	Write(result T) error
+	// Flush writes any buffered results and reports write errors.
+	Flush() error
+}
+
+// sinkBufferSize is the size of the chunks sinks write to their output.
+const sinkBufferSize = 64 << 10
+
+// JSONLinesWriter writes results as JSON lines, one object per policy.
+type JSONLinesWriter[T any] struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	record  func(T) any
+}
+
+// NewBatchJSONWriter returns a sink writing batch results to w as JSON
+// lines. The solved premium, lapse, commissions, and solve targets are
+// omitted when not set, and the values of failed policies are zero.
+func NewBatchJSONWriter(w io.Writer) *JSONLinesWriter[BatchResult] {
+	return newJSONLinesWriter(w, func(result BatchResult) any {
+		record := batchRecord{
+			Policy:        result.Policy,
+			SolvedPremium: result.SolvedPremium,
+			MaturityValue: result.MaturityValue,
+			TargetPremium: result.TargetPremium,
+			Commissions:   result.Commissions,
+			Solves:        result.Solves,
+		}
+		if outcome := (Outcome{LapseMonth: result.LapseMonth}); outcome.Lapsed() {
+			record.LapseYear = outcome.LapseYear()
+			record.LapseMonth = outcome.LapseMonth
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		return record
+	})
+}
+
+// NewStochasticJSONWriter returns a sink writing stochastic results to w as
+// JSON lines; the distributions are omitted for failed policies.
+func NewStochasticJSONWriter(w io.Writer) *JSONLinesWriter[StochasticResult] {
+	return newJSONLinesWriter(w, func(result StochasticResult) any {
+		record := stochasticRecord{PolicyID: result.Policy.ID}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+			return record
+		}
+		record.MaturityValue = &result.MaturityValue
+		record.LapseYear = &result.LapseYear
+		record.LapseRate = result.LapseRate
+		return record
+	})
+}
+
+// NewSupportJSONWriter returns a sink writing support test results to w as
+// JSON lines; the tests are omitted for failed policies.
+func NewSupportJSONWriter(w io.Writer) *JSONLinesWriter[SupportResult] {
+	return newJSONLinesWriter(w, func(result SupportResult) any {
+		record := supportRecord{PolicyID: result.Policy.ID, SolvedPremium: result.SolvedPremium}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+			return record
+		}
+		record.SelfSupport = &result.SelfSupport
+		record.LapseSupport = &result.LapseSupport
+		return record
+	})
+}
+
+// NewProfitJSONWriter returns a sink writing profit test results to w as
+// JSON lines, with the earnings by policy year; the measures are omitted
+// for failed policies.
+func NewProfitJSONWriter(w io.Writer) *JSONLinesWriter[ProfitResult] {
+	return newJSONLinesWriter(w, func(result ProfitResult) any {
+		record := profitRecord{PolicyID: result.Policy.ID, SolvedPremium: result.SolvedPremium}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+			return record
+		}
+		record.Earnings = result.Earnings
+		record.NPV = &result.NPV
+		record.PVPremium = result.PVPremium
+		record.IRR = result.IRR
+		record.ProfitMargin = result.ProfitMargin
+		record.BreakevenYear = result.BreakevenYear
+		return record
+	})
+}
+
+// NewProjectionJSONWriter returns a sink writing projection years to w as
+// JSON lines.
+func NewProjectionJSONWriter(w io.Writer) *JSONLinesWriter[ProjectionYear] {
+	return newJSONLinesWriter(w, func(year ProjectionYear) any { return year })
+}
+
+func newJSONLinesWriter[T any](w io.Writer, record func(T) any) *JSONLinesWriter[T] {
+	writer := bufio.NewWriterSize(w, sinkBufferSize)
+	return &JSONLinesWriter[T]{writer: writer, encoder: json.NewEncoder(writer), record: record}
+}
+
+// Write writes one result line.
+func (w *JSONLinesWriter[T]) Write(result T) error {
+	return w.encoder.Encode(w.record(result))
+}
+
+// Flush writes any buffered lines and reports write errors.
+func (w *JSONLinesWriter[T]) Flush() error {
+	return w.writer.Flush()
+}
+
+// BatchParquetWriter writes batch results as a Parquet file of the
+// BatchColumns, typed: Issue_Age, Lapse_Year, and Lapse_Month INT32, the
+// amounts DOUBLE, and the rest strings, with nulls where BatchWriter leaves
+// a value blank. The rows are held until a row group is full or Flush,
+// which also writes the footer, so the output is a complete file after
+// each Flush.
+type BatchParquetWriter struct {
+	file *parquetWriter
+	row  []any
+}
+
+// batchParquetColumns are the columns of BatchParquetWriter.
+var batchParquetColumns = []parquetColumn{
+	stringColumn("Policy_ID", false),
+	int32Column("Issue_Age", false),
+	stringColumn("Gender", false),
+	stringColumn("Risk_Class", false),
+	doubleColumn("Face_Amount", false),
+	doubleColumn("Annual_Premium", false),
+	doubleColumn("Solved_Premium", true),
+	doubleColumn("Maturity_Value", true),
+	int32Column("Lapse_Year", true),
+	int32Column("Lapse_Month", true),
+	doubleColumn("Target_Premium", true),
+	doubleColumn("First_Year_Commission", true),
+	doubleColumn("Renewal_Commission", true),
+	doubleColumn("Excess_Commission", true),
+	doubleColumn("Commission_Chargeback", true),
+	doubleColumn("Total_Commission", true),
+	doubleColumn("Minimum_Premium", true),
+	doubleColumn("Endow_Premium", true),
+	doubleColumn("Max_Non_MEC_Premium", true),
+	stringColumn("Error", true),
+}
+
+// NewBatchParquetWriter returns a writer of a new Parquet file to w.
+func NewBatchParquetWriter(w io.Writer) *BatchParquetWriter {
+	return &BatchParquetWriter{file: newParquetWriter(w, batchParquetColumns, nil, 0)}
+}
+
+// ResumeBatchParquetWriter returns a writer appending to w the rows after
+// those of the BatchParquetWriter output of the size, which w writes after,
+// as when resuming from a Checkpoint.
+func ResumeBatchParquetWriter(w io.Writer, output io.ReaderAt, size int64) (*BatchParquetWriter, error) {
+	footer, err := readParquetFooter(output, size)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := parquetSchema(footer)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.EqualFunc(columns, batchParquetColumns, func(a, b parquetColumn) bool {
+		return a.name == b.name && a.physical == b.physical && a.optional == b.optional
+	}) {
+		return nil, fmt.Errorf("%w: not batch results", errParquet)
+	}
+	return &BatchParquetWriter{file: newParquetWriter(w, batchParquetColumns, footer, size)}, nil
+}
+
+// Write adds one result row.
+func (w *BatchParquetWriter) Write(result BatchResult) error {
+	policy := result.Policy
+	w.row = append(w.row[:0],
+		policy.ID,
+		int32(policy.IssueAge),
+		policy.Gender,
+		policy.RiskClass,
+		policy.FaceAmount,
+		policy.AnnualPremium,
+	)
+	w.row = append(w.row, make([]any, len(batchParquetColumns)-len(w.row))...)
+	if result.Err != nil {
+		w.row[19] = result.Err.Error()
+		return w.file.add(w.row...)
+	}
+	if result.SolvedPremium != 0 {
+		w.row[6] = result.SolvedPremium
+	}
+	w.row[7] = result.MaturityValue
+	if outcome := (Outcome{LapseMonth: result.LapseMonth}); outcome.Lapsed() {
+		w.row[8] = int32(outcome.LapseYear())
+		w.row[9] = int32(outcome.LapseMonth)
+	}
+	w.row[10] = result.TargetPremium
+	if c := result.Commissions; c != nil {
+		w.row[11] = c.FirstYear
+		w.row[12] = c.Renewal
+		w.row[13] = c.Excess
+		w.row[14] = c.Chargeback
+		w.row[15] = c.Total
+	}
+	if s := result.Solves; s != nil {
+		for i, premium := range []*float64{s.Minimum, s.Endow, s.MaxNonMEC} {
+			if premium != nil {
+				w.row[16+i] = *premium
+			}
+		}
+	}
+	return w.file.add(w.row...)
+}
+
+// Flush writes the rows held as a row group and the footer.
+func (w *BatchParquetWriter) Flush() error {
+	return w.file.flush()
+}
+
+// batchRecord is the JSON line of a batch result.
+type batchRecord struct {
+	Policy        Policy         `json:"policy"`
+	SolvedPremium float64        `json:"solved_premium,omitempty"`
+	MaturityValue float64        `json:"maturity_value"`
+	LapseYear     int            `json:"lapse_year,omitempty"`
+	LapseMonth    int            `json:"lapse_month,omitempty"`
+	TargetPremium float64        `json:"target_premium"`
+	Commissions   *Commissions   `json:"commissions,omitempty"`
+	Solves        *PremiumSolves `json:"solves,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// stochasticRecord is the JSON line of a stochastic result.
+type stochasticRecord struct {
+	PolicyID      string        `json:"policy_id"`
+	MaturityValue *Distribution `json:"maturity_value,omitempty"`
+	LapseYear     *Distribution `json:"lapse_year,omitempty"`
+	LapseRate     float64       `json:"lapse_rate"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// profitRecord is the JSON line of a profit test result.
+type profitRecord struct {
+	PolicyID      string    `json:"policy_id"`
+	SolvedPremium float64   `json:"solved_premium,omitempty"`
+	Earnings      []float64 `json:"earnings,omitempty"`
+	NPV           *float64  `json:"npv,omitempty"`
+	PVPremium     float64   `json:"pv_premium,omitempty"`
+	IRR           *float64  `json:"irr,omitempty"`
+	ProfitMargin  float64   `json:"profit_margin,omitempty"`
+	BreakevenYear int       `json:"breakeven_year,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// supportRecord is the JSON line of a support test result.
+type supportRecord struct {
+	PolicyID      string       `json:"policy_id"`
+	SolvedPremium float64      `json:"solved_premium,omitempty"`
+	SelfSupport   *SupportTest `json:"self_support,omitempty"`
+	LapseSupport  *SupportTest `json:"lapse_support,omitempty"`
+	Error         string       `json:"error,omitempty"`
+}
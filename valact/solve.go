@@ -0,0 +1,120 @@
+package valact
+
+import (
+	"context"
+	"sync"
+)
+
+// Solve returns the minimum level annual premium, rounded up to the cent,
+// that leaves a positive account value at maturity. The policy's
+// AnnualPremium is ignored; PremiumSchedule years and Deposits are held
+// fixed and the solved premium is paid in the remaining years. The error is
+// ErrNoSolution when no premium does.
+func Solve(policy Policy, rates *RateSet) (float64, error) {
+	premium, _, err := solvePremium(context.Background(), policy, rates, Target{Metric: MetricMaturityValue}, SolveOptions{}, 0)
+	return premium, err
+}
+
+// SolveEndowment returns the minimum level annual premium, rounded up to
+// the cent, whose value net of loans at maturity reaches the face amount,
+// endowing the policy. Premiums and errors are treated as in Solve.
+func SolveEndowment(policy Policy, rates *RateSet) (float64, error) {
+	premium, _, err := solvePremium(context.Background(), policy, rates, Target{Metric: MetricEndowment}, SolveOptions{}, 0)
+	return premium, err
+}
+
+// solvePremium implements Solve for the target with the given options and
+// also returns the number of projections it ran, starting from guess when
+// positive. The error is the context's, when it ends before the solve does,
+// or else the search's, such as ErrNoSolution.
+func solvePremium(ctx context.Context, policy Policy, rates *RateSet, target Target, options SolveOptions, guess float64) (float64, int, error) {
+	seek := GoalSeek{
+		Variable:     Variable{Kind: VaryPremium},
+		Target:       target,
+		SolveOptions: options,
+		guess:        guess,
+	}
+	premium, calls, err := seek.seek(ctx, policy, rates)
+	if err != nil {
+		return 0, calls, err
+	}
+	return premium, calls, nil
+}
+
+// SolveCatchUp returns the smallest level annual premium, rounded up to the
+// cent, that paid in addition to the policy's premiums from the first month
+// projected, and then at the start of each later policy year, keeps the
+// policy in force with a positive account value through the policy year
+// ending at the attained age (to maturity from the rates' maturity age on).
+// It is 0 when the policy's premiums already do. For an inforce policy the
+// premium starts the month after the valuation date.
+func SolveCatchUp(policy Policy, rates *RateSet, targetAge int) (float64, error) {
+	seek := GoalSeek{
+		Variable: Variable{Kind: VaryCatchUp, ToYear: targetAge - policy.IssueAge},
+		Target:   Target{Metric: MetricAccountValue, AttainedAge: targetAge},
+	}
+	if targetAge >= rates.maturityAge() {
+		seek.Variable.ToYear = 0
+		seek.Target = Target{Metric: MetricMaturityValue}
+	}
+	if seek.Target.met(policy, rates) {
+		return 0, nil
+	}
+	return seek.Solve(policy, rates)
+}
+
+// SolveFace returns the maximum face amount, rounded down to the dollar, that
+// the policy's premiums sustain to maturity with a positive account value.
+// The policy's FaceAmount is ignored. The error is ErrNoSolution when no
+// face amount is.
+func SolveFace(policy Policy, rates *RateSet) (float64, error) {
+	seek := GoalSeek{
+		Variable: Variable{Kind: VaryFace},
+		Target:   Target{Metric: MetricMaturityValue},
+	}
+	return seek.Solve(policy, rates)
+}
+
+// warmStart holds the last two premiums solved per dollar of face for
+// each target of a run with WarmStart, shared by its workers.
+type warmStart struct {
+	mu    sync.Mutex
+	rates map[Target][2]float64
+}
+
+// forRun returns the options for one run over many policies, with an empty
+// warm start when WarmStart is set.
+func (o SolveOptions) forRun() SolveOptions {
+	if o.WarmStart {
+		o.warm = &warmStart{rates: make(map[Target][2]float64)}
+	}
+	return o
+}
+
+// guess returns the next solution for the target, scaled to the policy's
+// face amount, on the trend of the last two, 0 when there is none. Cells
+// of a grid step evenly, so the trend usually lands within a fraction of
+// a percent.
+func (w *warmStart) guess(target Target, policy Policy) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	last := w.rates[target]
+	rate := last[1]
+	if last[0] > 0 {
+		if trend := 2*last[1] - last[0]; trend > 0 {
+			rate = trend
+		}
+	}
+	return rate * policy.FaceAmount
+}
+
+// record adds the solution for the target.
+func (w *warmStart) record(target Target, policy Policy, premium float64) {
+	if premium <= 0 || policy.FaceAmount <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	last := w.rates[target]
+	w.rates[target] = [2]float64{last[1], premium / policy.FaceAmount}
+}
@@ -0,0 +1,86 @@
+package valact
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSolveCatchUpMaturityAge(t *testing.T) {
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 500}
+	rates := sampleRates(t, policy)
+	rates.MaturityAge = 95
+	catchUp, err := SolveCatchUp(policy, rates, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catchUp <= 0 {
+		t.Fatalf("catch-up premium %v, want one for an underfunded policy", catchUp)
+	}
+	funded := Variable{Kind: VaryCatchUp}.Apply(policy, rates, catchUp)
+	if n := len(funded.Deposits); n != 95-35 {
+		t.Errorf("%d catch-up premiums, want one a year to maturity at 95", n)
+	}
+	if outcome := IllustrateOutcome(funded, rates); outcome.Lapsed() || outcome.Value <= 0 {
+		t.Errorf("with the catch-up premium the policy ends %+v, want in force to maturity", outcome)
+	}
+	short := Variable{Kind: VaryCatchUp}.Apply(policy, rates, catchUp-0.01)
+	if outcome := IllustrateOutcome(short, rates); !outcome.Lapsed() && outcome.Value > 0 {
+		t.Errorf("a cent less still ends %+v, want the smallest catch-up premium", outcome)
+	}
+}
+
+func TestSolve(t *testing.T) {
+	policy := Policy{IssueAge: 45, Gender: "F", RiskClass: "NS", FaceAmount: 250000}
+	rates := sampleRates(t, policy)
+	premium, err := Solve(policy, rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if premium <= 0 || premium != math.Round(premium*100)/100 {
+		t.Fatalf("solved premium %v, want a positive amount in cents", premium)
+	}
+	policy.AnnualPremium = premium
+	if value := Illustrate(policy, rates); value <= 0 {
+		t.Errorf("at the solved premium the maturity value is %v, want positive", value)
+	}
+	policy.AnnualPremium = premium - 0.01
+	if value := Illustrate(policy, rates); value > 0 {
+		t.Errorf("a cent less still matures with %v, want the minimum premium", value)
+	}
+
+	policy.AnnualPremium = 0
+	endowment, err := SolveEndowment(policy, rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.AnnualPremium = endowment
+	if value := Illustrate(policy, rates); endowment <= premium || value < policy.FaceAmount {
+		t.Errorf("endowment premium %v matures with %v, want above %v reaching the face", endowment, value, premium)
+	}
+}
+
+func TestSolveFace(t *testing.T) {
+	policy := Policy{IssueAge: 45, Gender: "F", RiskClass: "NS", AnnualPremium: 3000}
+	rates := sampleRates(t, Policy{IssueAge: 45, Gender: "F", RiskClass: "NS", FaceAmount: 100000})
+	face, err := SolveFace(policy, rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if face <= 0 || face != math.Floor(face) {
+		t.Fatalf("solved face %v, want a positive whole dollar amount", face)
+	}
+	policy.FaceAmount = face
+	if value := Illustrate(policy, rates); value <= 0 {
+		t.Errorf("at the solved face the maturity value is %v, want positive", value)
+	}
+	policy.FaceAmount = face + 1
+	if value := Illustrate(policy, rates); value > 0 {
+		t.Errorf("a dollar more still matures with %v, want the maximum face", value)
+	}
+
+	policy.AnnualPremium = 0
+	if face, err := SolveFace(policy, rates); !errors.Is(err, ErrNoSolution) {
+		t.Errorf("without premiums solved face %v, %v, want ErrNoSolution", face, err)
+	}
+}
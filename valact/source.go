@@ -0,0 +1,124 @@
+package valact
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DataDirEnv names the environment variable that DefaultRateSource reads the
+// rate table directory from.
+const DataDirEnv = "VALACT_DATA_DIR"
+
+// Default rate table file names, resolved against RateSource.Dir.
+const (
+	COIFile                = "coi.csv"
+	UnitLoadFile           = "unit_load.csv"
+	CorridorFactorsFile    = "corridor_factors.csv"
+	AnnuityFactorsFile     = "annuity_factors.csv"
+	SurrenderChargesFile   = "surrender_charges.csv"
+	GuaranteedCOIFile      = "coi_guaranteed.csv"
+	ShadowCOIFile          = "shadow_coi.csv"
+	CodeMapFile            = "code_map.csv"
+	TermCOIFile            = "term_coi.csv"
+	TermUnitLoadFile       = "term_unit_load.csv"
+	WaiverFile             = "wp_rates.csv"
+	ADBFile                = "adb_rates.csv"
+	ChronicFile            = "chronic_rates.csv"
+	InterestScenarioFile   = "interest_scenarios.csv"
+	LoadsFile              = "loads.csv"
+	TargetPremiumFile      = "target_premium.csv"
+	StateVariationsFile    = "state_variations.csv"
+	ProductsFile           = "products.toml"
+	TableVersionsFile      = "table_versions.csv"
+	ValuationMortalityFile = "valuation_mortality.csv"
+	ImprovementScaleFile   = "mortality_improvement.csv"
+)
+
+// RateSource locates the rate tables read by the loaders. Dir is the
+// directory holding the tables (the working directory when empty); any
+// explicit file path overrides the default file name in Dir. With a Cache,
+// tables and rates are read once and then served from memory. With an FS,
+// e.g. a TableFS, the tables are read from it instead of the disk, with
+// slash separated paths. With a Store, the tables it has are read from its
+// database instead. With Defaults, e.g. tables embedded in the binary, a
+// table missing from Dir or FS is read from Defaults by its file name, so
+// the tables present override the defaults one by one.
+type RateSource struct {
+	FS                     fs.FS
+	Defaults               fs.FS
+	Dir                    string
+	COIFile                string
+	UnitLoadFile           string
+	CorridorFactorsFile    string
+	AnnuityFactorsFile     string
+	SurrenderChargesFile   string
+	GuaranteedCOIFile      string
+	ShadowCOIFile          string
+	CodeMapFile            string
+	TermCOIFile            string
+	TermUnitLoadFile       string
+	WaiverFile             string
+	ADBFile                string
+	ChronicFile            string
+	InterestScenarioFile   string
+	LoadsFile              string
+	TargetPremiumFile      string
+	StateVariationsFile    string
+	ProductsFile           string
+	TableVersionsFile      string
+	ValuationMortalityFile string
+	ImprovementScaleFile   string
+	// AsOf, when set, reads the versions of the tables in effect on the
+	// date from the table versions file; see AtDate. VersionsAtIssue reads
+	// those in effect at each policy's issue date instead, where
+	// PolicyRates is given one.
+	AsOf            time.Time
+	VersionsAtIssue bool
+	// Product, when set, is the product whose charges and rules apply
+	// where there is no rate table; see WithProduct.
+	Product *Product
+	// Missing, when set, are the rules for rates missing from the tables;
+	// see MissingRates.
+	Missing *MissingRates
+	// Improvement, when set, improves the mortality of the rates
+	// PolicyRates loads; see ImproveRates.
+	Improvement *MortalityImprovement
+	// Joint is how PolicyRates combines the COI rates of the two lives of
+	// a survivorship policy; empty means JointFrasier.
+	Joint JointMethod
+	// NoLapseGuarantee has PolicyRates load the shadow account rates of
+	// the no-lapse guarantee; see GetShadowRates.
+	NoLapseGuarantee bool
+	// Reserves, when set, has PolicyRates load the valuation basis, with
+	// reserves by the method; see GetValuationBasis.
+	Reserves ReserveMethod
+	Store    *SQLStore
+	Cache    *RateCache
+}
+
+// DefaultRateSource returns a RateSource rooted at $VALACT_DATA_DIR, or the
+// working directory when it is unset.
+func DefaultRateSource() RateSource {
+	return RateSource{Dir: os.Getenv(DataDirEnv)}
+}
+
+// path resolves a table path: an explicit override wins, otherwise the
+// default name is joined to Dir.
+func (s RateSource) path(override string, name string) string {
+	if override != "" {
+		return override
+	}
+	if s.FS != nil {
+		return path.Join(s.Dir, name)
+	}
+	return filepath.Join(s.Dir, name)
+}
+
+// baseName returns the file name of a table path with either separator.
+func baseName(filePath string) string {
+	return path.Base(strings.ReplaceAll(filePath, `\`, "/"))
+}
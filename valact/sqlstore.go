@@ -0,0 +1,167 @@
+package valact
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLStore serves rate tables from a database through any database/sql
+// driver, for a RateSource.Store. Each table is the database table named
+// after its file without the .csv suffix, e.g. coi for coi.csv, with the
+// CSV file's columns; NULL is a blank value. Tables the database does not
+// have are read from the files as before, as are products.toml and files
+// other than CSV.
+//
+// The COI and issue age tables are queried for the issue age's rows
+// (Issue_Age = ?, and the ultimate rows leaving it NULL), so an index on
+// Issue_Age makes each insured's load an indexed lookup; the others are
+// read whole, in the order the database returns their rows. Name the
+// columns as in the CSV files, quoting them where the database would fold
+// their case.
+type SQLStore struct {
+	db          *sql.DB
+	placeholder func(n int) string
+	mu          sync.Mutex
+	// columns are the columns of each table by name, nil for tables the
+	// database does not have
+	columns map[string][]string
+}
+
+// NewSQLStore returns a store reading from the database, checking it can
+// be reached. placeholder returns the driver's placeholder for the nth
+// query argument, counting from 1, e.g. "$1" for PostgreSQL; nil is "?".
+func NewSQLStore(db *sql.DB, placeholder func(n int) string) (*SQLStore, error) {
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("rate store: %w", err)
+	}
+	if placeholder == nil {
+		placeholder = func(int) string { return "?" }
+	}
+	return &SQLStore{db: db, placeholder: placeholder, columns: make(map[string][]string)}, nil
+}
+
+// rowFilter selects the rows of a table that a loader reads, for a store
+// to query: the column equal to the value, or NULL as well with orNull. A
+// table without the column is read whole. Loaders check the rows they are
+// given either way, so files are read whole.
+type rowFilter struct {
+	column string
+	value  any
+	orNull bool
+}
+
+// table returns the table name of the CSV file at the path, "" for other
+// files.
+func (st *SQLStore) table(filePath string) string {
+	name, ok := strings.CutSuffix(baseName(filePath), ".csv")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// tableColumns returns the table's columns, nil when the database does not
+// have it. A table is looked up once, by selecting none of its rows.
+func (st *SQLStore) tableColumns(table string) []string {
+	if table == "" {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	columns, ok := st.columns[table]
+	if !ok {
+		if rows, err := st.db.Query("SELECT * FROM " + quoteIdent(table) + " WHERE 1 = 0"); err == nil {
+			columns, _ = rows.Columns()
+			rows.Close()
+		}
+		st.columns[table] = columns
+	}
+	return columns
+}
+
+// open returns the CSV of the table of the file at the path, with the rows
+// of the filter, reporting false when the database does not have it.
+func (st *SQLStore) open(filePath string, filter *rowFilter) (io.ReadCloser, bool, error) {
+	table := st.table(filePath)
+	columns := st.tableColumns(table)
+	if columns == nil {
+		return nil, false, nil
+	}
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = quoteIdent(name)
+	}
+	query := "SELECT " + strings.Join(quoted, ", ") + " FROM " + quoteIdent(table)
+	var args []any
+	if filter != nil && slices.Contains(columns, filter.column) {
+		query += " WHERE " + quoteIdent(filter.column) + " = " + st.placeholder(1)
+		if filter.orNull {
+			query += " OR " + quoteIdent(filter.column) + " IS NULL"
+		}
+		args = append(args, filter.value)
+	}
+	rows, err := st.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write(columns)
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, true, fmt.Errorf("%s: %w", table, err)
+		}
+		for i, value := range values {
+			record[i] = sqlText(value)
+		}
+		w.Write(record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, true, fmt.Errorf("%s: %w", table, err)
+	}
+	w.Flush()
+	return io.NopCloser(&out), true, w.Error()
+}
+
+// sqlText returns a database value as it would be written in a CSV file.
+func sqlText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(DateLayout)
+	}
+	return fmt.Sprint(value)
+}
+
+// quoteIdent quotes a table or column name as an SQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,67 @@
+package valact
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnknownState is returned when a state is not in the state variations
+// table.
+var ErrUnknownState = errors.New("unknown state")
+
+// StateVariation holds the parameters that vary by the state a policy is
+// issued in.
+type StateVariation struct {
+	State string
+	// PremiumTax is the premium tax rate, added to the premium loads.
+	PremiumTax float64
+	// SurrenderChargeCap is the maximum surrender charge per $1,000 of face
+	// amount, +Inf when the state has no cap.
+	SurrenderChargeCap float64
+}
+
+// GetStateVariation reads the state's parameters from the state variations
+// table, a CSV with the columns State, Premium_Tax, and
+// Surrender_Charge_Cap (per $1,000 of face, blank for no cap).
+func (s RateSource) GetStateVariation(state string) (StateVariation, error) {
+	path := s.path(s.StateVariationsFile, StateVariationsFile)
+	variation := StateVariation{State: state, SurrenderChargeCap: math.Inf(1)}
+	t, err := s.openTable(path, stateSchema)
+	if err != nil {
+		return variation, err
+	}
+	defer t.Close()
+	stateField, taxField, capField := t.field("State"), t.field("Premium_Tax"), t.field("Surrender_Charge_Cap")
+	for t.next() {
+		if t.raw(stateField) != state {
+			continue
+		}
+		if variation.PremiumTax, err = t.float(taxField); err != nil {
+			return variation, err
+		}
+		if !t.blank(capField) {
+			if variation.SurrenderChargeCap, err = t.float(capField); err != nil {
+				return variation, err
+			}
+		}
+		return variation, nil
+	}
+	if err := t.err(); err != nil {
+		return variation, err
+	}
+	return variation, fmt.Errorf("%s: %w %q", path, ErrUnknownState, state)
+}
+
+// Apply folds the premium tax into the premium loads, current and maximum,
+// and caps the surrender charges.
+func (v StateVariation) Apply(rates *RateSet) {
+	for i := range rates.PremiumLoad {
+		rates.PremiumLoad[i] += v.PremiumTax
+		rates.PremiumLoadExcess[i] += v.PremiumTax
+		if i < len(rates.MaximumPremiumLoad) {
+			rates.MaximumPremiumLoad[i] += v.PremiumTax
+		}
+		rates.SurrenderCharge[i] = min(rates.SurrenderCharge[i], v.SurrenderChargeCap)
+	}
+}
@@ -0,0 +1,62 @@
+package valact
+
+import "fmt"
+
+// MonthlyStep is one step of the monthly processing waterfall.
+type MonthlyStep string
+
+const (
+	// StepPremium adds the month's premium net of premium load.
+	StepPremium MonthlyStep = "premium"
+	// StepExpenses deducts the policy fee, per unit charge, and the term
+	// rider, accidental death benefit, and chronic illness expense charges.
+	StepExpenses MonthlyStep = "expenses"
+	// StepCOI computes the death benefit and net amount at risk on the
+	// account value at that point and deducts the COI, flat extra, term
+	// rider COI, and waiver of premium charge.
+	StepCOI MonthlyStep = "coi"
+	// StepInterest credits interest, fund returns, and maturing index
+	// segments on the account value at that point.
+	StepInterest MonthlyStep = "interest"
+)
+
+// DefaultMonthlySteps is the monthly waterfall used when RateSet.MonthlySteps
+// is empty: premium, then expense charges, COI, and interest.
+var DefaultMonthlySteps = []MonthlyStep{StepPremium, StepExpenses, StepCOI, StepInterest}
+
+// Valid reports whether the step is premium, expenses, coi, or interest.
+func (s MonthlyStep) Valid() bool {
+	return s == StepPremium || s == StepExpenses || s == StepCOI || s == StepInterest
+}
+
+// CheckMonthlySteps reports an error unless the monthly steps are empty or
+// list every step exactly once.
+func (r *RateSet) CheckMonthlySteps() error {
+	if len(r.MonthlySteps) == 0 {
+		return nil
+	}
+	seen := make(map[MonthlyStep]bool)
+	for _, step := range r.MonthlySteps {
+		if !step.Valid() {
+			return fmt.Errorf("monthly steps: unknown step %q", step)
+		}
+		if seen[step] {
+			return fmt.Errorf("monthly steps: step %q listed twice", step)
+		}
+		seen[step] = true
+	}
+	for _, step := range DefaultMonthlySteps {
+		if !seen[step] {
+			return fmt.Errorf("monthly steps: missing step %q", step)
+		}
+	}
+	return nil
+}
+
+// monthlySteps is the monthly waterfall of the rates.
+func (r *RateSet) monthlySteps() []MonthlyStep {
+	if len(r.MonthlySteps) == 0 {
+		return DefaultMonthlySteps
+	}
+	return r.MonthlySteps
+}
@@ -0,0 +1,223 @@
+package valact
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+)
+
+// LognormalScenarios generates crediting rate scenarios in which the annual
+// rate follows a lognormal random walk from the initial rate, bounded by
+// the floor and, when positive, the cap.
+type LognormalScenarios struct {
+	Initial    float64
+	Volatility float64
+	Floor      float64
+	Cap        float64
+	// Seed makes the scenarios reproducible.
+	Seed uint64
+	// Years is the number of policy years the scenarios run, e.g. the
+	// source's ProjectionEndAge to cover issue at age 0; zero means
+	// MaturityAge.
+	Years int
+}
+
+// Generate returns n scenarios named by number from 1.
+func (g LognormalScenarios) Generate(n int) []Scenario {
+	random := rand.New(rand.NewPCG(g.Seed, 0))
+	scenarios := make([]Scenario, n)
+	for s := range scenarios {
+		given := make(map[int]float64)
+		rate := g.Initial
+		years := g.Years
+		if years == 0 {
+			years = MaturityAge
+		}
+		for year := 1; year <= years; year++ {
+			credited := max(g.Floor, rate)
+			if g.Cap > 0 {
+				credited = min(g.Cap, credited)
+			}
+			given[12*(year-1)+1] = MonthlyRate(credited)
+			rate *= math.Exp(g.Volatility*random.NormFloat64() - g.Volatility*g.Volatility/2)
+		}
+		scenarios[s] = Scenario{Name: strconv.Itoa(s + 1), Interest: fillMonths(given)}
+	}
+	return scenarios
+}
+
+// Distribution summarizes a value across scenarios.
+type Distribution struct {
+	Mean float64 `json:"mean"`
+	// Percentiles are at the levels of Stochastic.Percentiles.
+	Percentiles []float64 `json:"percentiles"`
+	// CTE is the conditional tail expectation: the mean of the lowest
+	// 1 - level share of the values.
+	CTE float64 `json:"cte"`
+}
+
+// Summarize returns the mean, the percentiles at the levels (0 to 1, by
+// nearest rank), and the CTE at cteLevel of the values.
+func Summarize(values []float64, levels []float64, cteLevel float64) Distribution {
+	var d Distribution
+	if len(values) == 0 {
+		d.Percentiles = make([]float64, len(levels))
+		return d
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	for _, v := range sorted {
+		d.Mean += v
+	}
+	d.Mean /= float64(len(sorted))
+	for _, level := range levels {
+		rank := int(math.Ceil(level*float64(len(sorted)))) - 1
+		d.Percentiles = append(d.Percentiles, sorted[min(len(sorted)-1, max(0, rank))])
+	}
+	tail := sorted[:max(1, int(math.Round((1-cteLevel)*float64(len(sorted)))))]
+	for _, v := range tail {
+		d.CTE += v
+	}
+	d.CTE /= float64(len(tail))
+	return d
+}
+
+// Stochastic projects every policy across a set of crediting rate
+// scenarios over the batch worker pool.
+type Stochastic struct {
+	Source RateSource
+	// Workers is the number of worker goroutines; zero means one per CPU.
+	Workers int
+	// Ordered emits results in the order of the policies instead of as
+	// they complete.
+	Ordered bool
+	// Progress, when set, is called from the calling goroutine as each
+	// policy completes.
+	Progress func(Progress)
+	// WaiverBasis is the rate basis of waiver of premium riders.
+	WaiverBasis WaiverBasis
+	Scenarios   []Scenario
+	// Percentiles are the levels reported, e.g. 0.05, 0.5, 0.95, and
+	// CTELevel the CTE level, e.g. 0.7 for CTE70.
+	Percentiles []float64
+	CTELevel    float64
+}
+
+// StochasticResult is the distribution of one policy's outcomes across the
+// scenarios. Err is set, and the values are zero, when the policy's rates
+// could not be loaded.
+type StochasticResult struct {
+	Policy Policy
+	// MaturityValue is the account value net of loans at maturity, or at
+	// lapse.
+	MaturityValue Distribution
+	// LapseYear is the policy year of lapse, counting scenarios that stay
+	// in force as lapsing in the year after maturity.
+	LapseYear Distribution
+	// LapseRate is the share of scenarios in which the policy lapses.
+	LapseRate float64
+	Err       error
+}
+
+func (r StochasticResult) withErr(err error) StochasticResult {
+	r.Err = err
+	return r
+}
+
+// Run projects every policy across the scenarios and passes each result to
+// emit, in completion order (policy order when Ordered), from the calling
+// goroutine. Run stops at the first error returned by emit.
+func (s Stochastic) Run(policies []Policy, emit func(StochasticResult) error) error {
+	return s.RunContext(context.Background(), policies, emit)
+}
+
+// RunContext is Run, stopping when the context is done like
+// Batch.RunContext.
+func (s Stochastic) RunContext(ctx context.Context, policies []Policy, emit func(StochasticResult) error) error {
+	return runPool(ctx, pool{workers: s.Workers, ordered: s.Ordered, progress: s.Progress}, policies, s.runPolicy, emit)
+}
+
+func (s Stochastic) runPolicy(ctx context.Context, policy Policy) (StochasticResult, error) {
+	result := StochasticResult{Policy: policy}
+	rates, err := s.Source.PolicyRates(policy, s.WaiverBasis)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	values := make([]float64, len(s.Scenarios))
+	lapseYears := make([]float64, len(s.Scenarios))
+	lapses := 0
+	for i, scenario := range s.Scenarios {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rates.MonthlyInterest = scenario.Interest
+		outcome := IllustrateOutcome(policy, rates)
+		values[i] = outcome.Value
+		lapseYears[i] = float64(rates.projectionEndAge() - policy.IssueAge + 1)
+		if outcome.Lapsed() {
+			lapseYears[i] = float64(outcome.LapseYear())
+			lapses++
+		}
+	}
+	result.MaturityValue = Summarize(values, s.Percentiles, s.CTELevel)
+	result.LapseYear = Summarize(lapseYears, s.Percentiles, s.CTELevel)
+	if len(s.Scenarios) > 0 {
+		result.LapseRate = float64(lapses) / float64(len(s.Scenarios))
+	}
+	return result, nil
+}
+
+// StochasticWriter writes stochastic results as CSV, one row per policy.
+type StochasticWriter struct {
+	writer *csv.Writer
+	width  int
+}
+
+// NewStochasticWriter writes the header for the percentile levels and CTE
+// level to w and returns a writer for the result rows.
+func NewStochasticWriter(w io.Writer, levels []float64, cteLevel float64) (*StochasticWriter, error) {
+	header := []string{"Policy_ID"}
+	for _, prefix := range []string{"Maturity_Value", "Lapse_Year"} {
+		header = append(header, prefix+"_Mean")
+		for _, level := range levels {
+			header = append(header, fmt.Sprintf("%s_P%g", prefix, 100*level))
+		}
+		header = append(header, fmt.Sprintf("%s_CTE%g", prefix, 100*cteLevel))
+	}
+	header = append(header, "Lapse_Rate", "Error")
+	writer := csv.NewWriter(bufio.NewWriterSize(w, sinkBufferSize))
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &StochasticWriter{writer: writer, width: len(header)}, nil
+}
+
+// Write writes one result row; the values are blank for failed policies.
+func (w *StochasticWriter) Write(result StochasticResult) error {
+	record := []string{result.Policy.ID}
+	if result.Err != nil {
+		record = append(record, make([]string, w.width-2)...)
+		return w.writer.Write(append(record, result.Err.Error()))
+	}
+	for _, d := range []Distribution{result.MaturityValue, result.LapseYear} {
+		record = append(record, formatFloat(d.Mean))
+		for _, p := range d.Percentiles {
+			record = append(record, formatFloat(p))
+		}
+		record = append(record, formatFloat(d.CTE))
+	}
+	return w.writer.Write(append(record, formatFloat(result.LapseRate), ""))
+}
+
+// Flush writes any buffered rows and reports write errors.
+func (w *StochasticWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,222 @@
+package valact
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BatchSummary aggregates batch results into summary statistics by issue
+// age band and risk class as they are added, so a run can report its
+// distribution without the row-level output being post-processed. It is not
+// safe for concurrent use; add results from the emit of a run.
+type BatchSummary struct {
+	// AgeBands are the issue ages starting each band after the first, which
+	// starts at 0, in ascending order (see ParseAgeBands); no bands puts
+	// every age in one band.
+	AgeBands []int
+	// Percentiles are the levels of the premium percentiles reported, e.g.
+	// 0.05, 0.25, 0.75, 0.95.
+	Percentiles []float64
+	groups      map[summaryKey]*summaryGroup
+}
+
+// summaryKey identifies a group of a summary: an index into the age bands
+// and a risk class.
+type summaryKey struct {
+	band      int
+	riskClass string
+}
+
+// summaryGroup accumulates the results of a group.
+type summaryGroup struct {
+	policies, failed, lapsed int
+	faceAmount               float64
+	premiums                 []float64
+}
+
+// SummaryRow is the summary of one group of a batch, or of all of it, with
+// AgeBand and RiskClass "All".
+type SummaryRow struct {
+	// AgeBand is the issue ages of the band, e.g. "30-39" or "70+".
+	AgeBand   string `json:"age_band"`
+	RiskClass string `json:"risk_class"`
+	Policies  int    `json:"policies"`
+	// Failed counts the policies whose rates could not be loaded; they are
+	// left out of the other values.
+	Failed int `json:"failed"`
+	// Lapsed counts the policies that lapse before maturity.
+	Lapsed     int     `json:"lapsed"`
+	FaceAmount float64 `json:"face_amount"`
+	// Premium summarizes the solved premiums, or the annual premiums of
+	// policies not solved for.
+	Premium PremiumStats `json:"premium"`
+}
+
+// PremiumStats summarizes the premiums of a group.
+type PremiumStats struct {
+	Total  float64 `json:"total"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	// Percentiles are at the levels of BatchSummary.Percentiles.
+	Percentiles []float64 `json:"percentiles"`
+}
+
+// Add adds a result to its group.
+func (s *BatchSummary) Add(result BatchResult) {
+	if s.groups == nil {
+		s.groups = make(map[summaryKey]*summaryGroup)
+	}
+	policy := result.Policy
+	band := 0
+	for band < len(s.AgeBands) && s.AgeBands[band] <= policy.IssueAge {
+		band++
+	}
+	key := summaryKey{band: band, riskClass: policy.RiskClass}
+	group := s.groups[key]
+	if group == nil {
+		group = &summaryGroup{}
+		s.groups[key] = group
+	}
+	group.policies++
+	if result.Err != nil {
+		group.failed++
+		return
+	}
+	if result.LapseMonth > 0 {
+		group.lapsed++
+	}
+	group.faceAmount += policy.FaceAmount
+	premium := result.SolvedPremium
+	if premium == 0 {
+		premium = policy.AnnualPremium
+	}
+	group.premiums = append(group.premiums, premium)
+}
+
+// Rows returns the summary of each group, by age band and then risk class,
+// followed by that of all the results.
+func (s *BatchSummary) Rows() []SummaryRow {
+	keys := make([]summaryKey, 0, len(s.groups))
+	all := &summaryGroup{}
+	for key, group := range s.groups {
+		keys = append(keys, key)
+		all.policies += group.policies
+		all.failed += group.failed
+		all.lapsed += group.lapsed
+		all.faceAmount += group.faceAmount
+		all.premiums = append(all.premiums, group.premiums...)
+	}
+	slices.SortFunc(keys, func(a, b summaryKey) int {
+		return cmp.Or(cmp.Compare(a.band, b.band), strings.Compare(a.riskClass, b.riskClass))
+	})
+	rows := make([]SummaryRow, 0, len(keys)+1)
+	for _, key := range keys {
+		rows = append(rows, s.row(s.bandName(key.band), key.riskClass, s.groups[key]))
+	}
+	return append(rows, s.row("All", "All", all))
+}
+
+// row summarizes a group.
+func (s *BatchSummary) row(ageBand string, riskClass string, group *summaryGroup) SummaryRow {
+	row := SummaryRow{
+		AgeBand:    ageBand,
+		RiskClass:  riskClass,
+		Policies:   group.policies,
+		Failed:     group.failed,
+		Lapsed:     group.lapsed,
+		FaceAmount: group.faceAmount,
+	}
+	levels := append([]float64{0.5}, s.Percentiles...)
+	d := Summarize(group.premiums, levels, 0)
+	row.Premium = PremiumStats{Mean: d.Mean, Median: d.Percentiles[0], Percentiles: d.Percentiles[1:]}
+	for _, premium := range group.premiums {
+		row.Premium.Total += premium
+	}
+	return row
+}
+
+// bandName returns the issue ages of the band.
+func (s *BatchSummary) bandName(band int) string {
+	switch {
+	case len(s.AgeBands) == 0:
+		return "All"
+	case band == 0:
+		return fmt.Sprintf("0-%d", s.AgeBands[0]-1)
+	case band == len(s.AgeBands):
+		return fmt.Sprintf("%d+", s.AgeBands[band-1])
+	}
+	return fmt.Sprintf("%d-%d", s.AgeBands[band-1], s.AgeBands[band]-1)
+}
+
+// WriteCSV writes the summary rows as CSV, with a premium percentile
+// column for each level.
+func (s *BatchSummary) WriteCSV(w io.Writer) error {
+	header := []string{"Age_Band", "Risk_Class", "Policies", "Failed", "Lapsed", "Face_Amount", "Premium_Total", "Premium_Mean", "Premium_Median"}
+	for _, level := range s.Percentiles {
+		header = append(header, fmt.Sprintf("Premium_P%g", 100*level))
+	}
+	buffered := bufio.NewWriterSize(w, sinkBufferSize)
+	writer := csv.NewWriter(buffered)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range s.Rows() {
+		record := []string{
+			row.AgeBand,
+			row.RiskClass,
+			strconv.Itoa(row.Policies),
+			strconv.Itoa(row.Failed),
+			strconv.Itoa(row.Lapsed),
+			formatFloat(row.FaceAmount),
+			formatFloat(row.Premium.Total),
+			formatFloat(row.Premium.Mean),
+			formatFloat(row.Premium.Median),
+		}
+		for _, p := range row.Premium.Percentiles {
+			record = append(record, formatFloat(p))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// WriteJSON writes the summary rows as an indented JSON array.
+func (s *BatchSummary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.Rows())
+}
+
+// ParseAgeBands parses the issue ages starting each band after the first,
+// e.g. "30,40,50,60,70" for under 30, 30-39, ..., and 70 and over, in
+// ascending order.
+func ParseAgeBands(spec string) ([]int, error) {
+	var bands []int
+	for _, text := range strings.Split(spec, ",") {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		band, err := strconv.Atoi(text)
+		if err != nil || band <= 0 {
+			return nil, fmt.Errorf("invalid age band %q", text)
+		}
+		if len(bands) > 0 && band <= bands[len(bands)-1] {
+			return nil, fmt.Errorf("age bands not in ascending order at %q", text)
+		}
+		bands = append(bands, band)
+	}
+	return bands, nil
+}
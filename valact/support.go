@@ -0,0 +1,225 @@
+package valact
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+// SupportTests runs the self-support and lapse-support tests of the
+// illustration regulation on every policy of a census, each a cell of the
+// test grid, over the batch worker pool. Each cell is illustrated on the
+// current scale, and the insurer's cash flows on it are accumulated under
+// the experience of the disciplined current scale: premiums, less
+// expenses, withdrawals, and net loan advances, at the earned rate, less
+// death claims net of loans at the experience mortality and cash surrender
+// values paid to lapses. A cell is self-supporting when the accumulated
+// cash flows cover the cash surrender values of the policies still in
+// force at each test year, and not lapse-supported when they do so with no
+// lapses.
+type SupportTests struct {
+	Source RateSource
+	// Mode is BatchIllustrate to illustrate each cell at its annual
+	// premium, BatchSolve at its minimum premium to maturity, or
+	// BatchEndow at its minimum premium to endow.
+	Mode BatchMode
+	// Workers is the number of worker goroutines; zero means one per CPU.
+	Workers int
+	// Ordered emits results in the order of the policies instead of as
+	// they complete.
+	Ordered bool
+	// Progress, when set, is called from the calling goroutine as each
+	// policy completes.
+	Progress func(Progress)
+	// WaiverBasis is the rate basis of waiver of premium riders.
+	WaiverBasis WaiverBasis
+	// SolveOptions configure the premium solve of BatchSolve and BatchEndow.
+	SolveOptions
+	SupportBasis
+}
+
+// SupportBasis is the experience of the disciplined current scale and the
+// years the tests apply at.
+type SupportBasis struct {
+	Experience
+	// FirstYear is the first test year, then every Interval years and the
+	// last year illustrated; zero means 15 and 5.
+	FirstYear int
+	Interval  int
+}
+
+// SupportTest is the outcome of one test of a cell. Margin is the least
+// excess, per policy issued, of the accumulated cash flows over the cash
+// surrender values of the policies in force at a test year, at MarginYear;
+// FailYear is the first test year the excess is negative, 0 when the test
+// passes.
+type SupportTest struct {
+	Passed     bool    `json:"passed"`
+	FailYear   int     `json:"fail_year,omitempty"`
+	Margin     float64 `json:"margin"`
+	MarginYear int     `json:"margin_year"`
+}
+
+// SupportResult is the outcome of the tests for one cell. Err is set, and
+// the values are zero, when the policy's rates could not be loaded or its
+// premium could not be solved.
+type SupportResult struct {
+	Policy Policy
+	// SolvedPremium is the premium tested under BatchSolve or BatchEndow.
+	SolvedPremium float64
+	// SelfSupport is the test with the experience lapses and LapseSupport
+	// the test with none, passing when the cell is not lapse-supported.
+	SelfSupport  SupportTest
+	LapseSupport SupportTest
+	Err          error
+}
+
+func (r SupportResult) withErr(err error) SupportResult {
+	r.Err = err
+	return r
+}
+
+// Run tests every policy and passes each result to emit, in completion
+// order (policy order when Ordered), from the calling goroutine. Run stops
+// at the first error returned by emit.
+func (t SupportTests) Run(policies []Policy, emit func(SupportResult) error) error {
+	return t.RunContext(context.Background(), policies, emit)
+}
+
+// RunContext is Run, stopping when the context is done like
+// Batch.RunContext.
+func (t SupportTests) RunContext(ctx context.Context, policies []Policy, emit func(SupportResult) error) error {
+	t.SolveOptions = t.SolveOptions.forRun()
+	return runPool(ctx, pool{workers: t.Workers, ordered: t.Ordered, progress: t.Progress}, policies, t.runPolicy, emit)
+}
+
+func (t SupportTests) runPolicy(ctx context.Context, policy Policy) (SupportResult, error) {
+	result := SupportResult{Policy: policy}
+	rates, err := t.Source.PolicyRates(policy, t.WaiverBasis)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	if target, ok := t.Mode.target(); ok {
+		if result.SolvedPremium, _, err = solvePremium(ctx, policy, rates, target, t.SolveOptions, 0); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			result.Err = err
+			return result, nil
+		}
+		policy.AnnualPremium = result.SolvedPremium
+	}
+	ledger := IllustrateLedger(policy, rates)
+	result.SelfSupport = t.test(ledger, rates, t.Experience)
+	noLapses := t.Experience
+	noLapses.Lapses = nil
+	result.LapseSupport = t.test(ledger, rates, noLapses)
+	return result, nil
+}
+
+// test accumulates the insurer's cash flows on the monthly ledger under the
+// experience and checks them at the basis's test years.
+func (b SupportBasis) test(ledger Ledger, rates *RateSet, experience Experience) SupportTest {
+	first, interval := b.FirstYear, b.Interval
+	if first == 0 {
+		first = 15
+	}
+	if interval == 0 {
+		interval = 5
+	}
+	earned := MonthlyRate(experience.EarnedRate)
+	result := SupportTest{Passed: true, Margin: math.Inf(1)}
+	// fund is the accumulated cash flows and inForce the share of the
+	// policies issued still in force, both per policy issued
+	fund, inForce := 0.0, 1.0
+	for i, row := range ledger {
+		fund += inForce * (row.Premium + row.LoanRepayment - row.Withdrawal - row.LoanAdvance - experience.expenses(i, row))
+		fund *= 1 + earned
+		deaths := inForce * experience.deathRate(rates, row.PolicyYear)
+		fund -= deaths * (row.DeathBenefit - row.LoanBalance)
+		inForce -= deaths
+		last := i == len(ledger)-1
+		if row.MonthInPolicyYear != 12 && !last {
+			continue
+		}
+		if !last {
+			lapsed := inForce * experience.lapseRate(row.PolicyYear)
+			fund -= lapsed * row.CashSurrenderValue
+			inForce -= lapsed
+		}
+		year := row.PolicyYear
+		if !last && (year < first || (year-first)%interval != 0) {
+			continue
+		}
+		margin := fund - inForce*row.CashSurrenderValue
+		if margin < result.Margin {
+			result.Margin, result.MarginYear = margin, year
+		}
+		if margin < 0 && result.Passed {
+			result.Passed, result.FailYear = false, year
+		}
+	}
+	if math.IsInf(result.Margin, 1) {
+		result.Margin = 0
+	}
+	return result
+}
+
+// SupportColumns is the column layout written by SupportWriter.
+var SupportColumns = []string{
+	"Policy_ID",
+	"Solved_Premium",
+	"Self_Support_Pass",
+	"Self_Support_Fail_Year",
+	"Self_Support_Margin",
+	"Self_Support_Margin_Year",
+	"Lapse_Support_Pass",
+	"Lapse_Support_Fail_Year",
+	"Lapse_Support_Margin",
+	"Lapse_Support_Margin_Year",
+	"Error",
+}
+
+// SupportWriter writes support test results as CSV, one row per cell.
+type SupportWriter struct {
+	writer *csv.Writer
+}
+
+// NewSupportWriter writes the SupportColumns header to w and returns a
+// writer for the result rows.
+func NewSupportWriter(w io.Writer) (*SupportWriter, error) {
+	writer := csv.NewWriter(bufio.NewWriterSize(w, sinkBufferSize))
+	if err := writer.Write(SupportColumns); err != nil {
+		return nil, err
+	}
+	return &SupportWriter{writer: writer}, nil
+}
+
+// Write writes one result row; the values are blank for failed policies.
+func (w *SupportWriter) Write(result SupportResult) error {
+	record := []string{result.Policy.ID}
+	if result.Err != nil {
+		record = append(record, make([]string, len(SupportColumns)-2)...)
+		return w.writer.Write(append(record, result.Err.Error()))
+	}
+	record = append(record, formatFloat(result.SolvedPremium))
+	for _, test := range []SupportTest{result.SelfSupport, result.LapseSupport} {
+		record = append(record,
+			strconv.FormatBool(test.Passed),
+			strconv.Itoa(test.FailYear),
+			formatFloat(test.Margin),
+			strconv.Itoa(test.MarginYear),
+		)
+	}
+	return w.writer.Write(append(record, ""))
+}
+
+// Flush writes any buffered rows and reports any write error.
+func (w *SupportWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,440 @@
+package valact
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnKind is the type of a column's values.
+type columnKind int
+
+const (
+	textColumn columnKind = iota
+	intColumn
+	floatColumn
+	boolColumn
+	dateColumn
+)
+
+// column declares a column of a table schema.
+type column struct {
+	name string
+	kind columnKind
+	// required columns must be in the header
+	required bool
+	// values, when set, are the values a text column allows besides blank
+	values []string
+	// blank columns may be left empty in any row
+	blank bool
+	// min and max bound a number column's values when max > min; loaders
+	// take any value, and ValidateTables reports those outside
+	min, max float64
+}
+
+// Column constructors, for required columns and their optional variants.
+func textCol(name string, values ...string) column {
+	return column{name: name, kind: textColumn, required: true, values: values}
+}
+
+func intCol(name string, min, max int) column {
+	return column{name: name, kind: intColumn, required: true, min: float64(min), max: float64(max)}
+}
+
+func floatCol(name string, min, max float64) column {
+	return column{name: name, kind: floatColumn, required: true, min: min, max: max}
+}
+
+func optional(c column) column {
+	c.required = false
+	return c
+}
+
+func orBlank(c column) column {
+	c.blank = true
+	return c
+}
+
+// Table schemas: the columns of every table the loaders read.
+var (
+	// coiSchema has select rows (Issue_Age, Policy_Year) and ultimate rows
+	// (Attained_Age); see readCOITable.
+	coiSchema = []column{
+		textCol("Gender"),
+		textCol("Risk_Class"),
+		optional(intCol("Issue_Age", 0, maxAge-1)),
+		optional(intCol("Policy_Year", 1, maxAge)),
+		optional(intCol("Attained_Age", 0, maxAge)),
+		floatCol("Rate", 0, 1000),
+		optional(floatCol(GuaranteedRateColumn, 0, 1000)),
+		optional(floatCol(FaceBandColumn, 0, math.Inf(1))),
+	}
+	// issueAgeSchema is the layout of the unit load, surrender charge, and
+	// rider tables.
+	issueAgeSchema = []column{
+		intCol("Issue_Age", 0, maxAge-1),
+		intCol("Policy_Year", 1, maxAge),
+		floatCol("Rate", 0, 1000),
+		optional(floatCol(FaceBandColumn, 0, math.Inf(1))),
+	}
+	corridorSchema = []column{
+		intCol("Attained_Age", 0, maxAge),
+		floatCol("Rate", 1, 100),
+	}
+	annuitySchema = []column{
+		intCol("Attained_Age", 0, maxAge),
+		floatCol("Rate", 0, 100),
+	}
+	targetPremiumSchema = []column{
+		intCol("Issue_Age", 0, maxAge-1),
+		floatCol("Rate", 0, 1000),
+	}
+	loadsSchema = []column{
+		intCol("Policy_Year", 1, maxAge),
+		floatCol("Premium_Load", 0, 1),
+		optional(floatCol("Premium_Load_Excess", 0, 1)),
+		floatCol("Policy_Fee", 0, math.Inf(1)),
+	}
+	// scenarioSchema has either Policy_Year or Policy_Month.
+	scenarioSchema = []column{
+		textCol("Scenario"),
+		optional(intCol("Policy_Year", 1, maxAge)),
+		optional(intCol("Policy_Month", 1, projectionMonths)),
+		floatCol("Rate", -1, 1),
+		optional(orBlank(textCol("Basis", rateBases...))),
+	}
+	// decrementSchema has Lapse_Rate, Mortality_Multiple, or both; see
+	// ReadDecrements.
+	decrementSchema = []column{
+		intCol("Policy_Year", 1, maxAge),
+		optional(orBlank(floatCol("Lapse_Rate", 0, 1))),
+		optional(orBlank(floatCol("Mortality_Multiple", 0, 100))),
+	}
+	improvementSchema = []column{
+		intCol("Attained_Age", 0, maxAge),
+		intCol("Year", 1900, 2200),
+		floatCol("Rate", -1, 1),
+	}
+	stateSchema = []column{
+		textCol("State"),
+		floatCol("Premium_Tax", 0, 1),
+		orBlank(floatCol("Surrender_Charge_Cap", 0, math.Inf(1))),
+	}
+	tableVersionsSchema = []column{
+		textCol("Table"),
+		{name: "Effective_Date", kind: dateColumn, required: true},
+		textCol("File"),
+	}
+	codeMapSchema = []column{
+		textCol("Field", "Gender", "Risk_Class"),
+		textCol("Code"),
+		textCol("Key"),
+	}
+	fundSchema = []column{
+		textCol("Fund"),
+		floatCol("Return", -1, 1),
+		floatCol("Fee", 0, 1),
+		floatCol("Allocation", 0, 1),
+	}
+	indexReturnSchema = []column{
+		floatCol("Return", -1, math.Inf(1)),
+	}
+	// censusSchema has Issue_Age, or Birth_Date and Issue_Date; see
+	// ReadCensus.
+	censusSchema = []column{
+		textCol("Policy_ID"),
+		optional(intCol("Issue_Age", 0, maxAge-1)),
+		textCol("Gender"),
+		textCol("Risk_Class"),
+		floatCol("Face_Amount", 0, math.Inf(1)),
+		optional(floatCol("Annual_Premium", 0, math.Inf(1))),
+		optional(floatCol("Target_Premium", 0, math.Inf(1))),
+		optional(textCol("DB_Option", string(DBOptionA), string(DBOptionB))),
+		optional(textCol("Premium_Mode", string(ModeAnnual), string(ModeSemiannual), string(ModeQuarterly), string(ModeMonthly))),
+		optional(floatCol("Table_Rating", 0, math.Inf(1))),
+		optional(floatCol("Flat_Extra", 0, math.Inf(1))),
+		optional(intCol("Flat_Extra_Years", 0, maxAge)),
+		optional(floatCol("Term_Rider_Face", 0, math.Inf(1))),
+		optional(column{name: "Waiver", kind: boolColumn}),
+		optional(floatCol("ADB_Face", 0, math.Inf(1))),
+		optional(column{name: "Chronic", kind: boolColumn}),
+		optional(textCol("State")),
+		optional(column{name: "Birth_Date", kind: dateColumn}),
+		optional(column{name: "Issue_Date", kind: dateColumn}),
+		optional(textCol("Age_Basis", string(AgeNearest), string(AgeLastBirthday))),
+		optional(intCol("Inforce_Month", 0, projectionMonths)),
+		optional(floatCol("Account_Value", math.Inf(-1), math.Inf(1))),
+		optional(floatCol("Loan_Balance", 0, math.Inf(1))),
+		optional(floatCol("Surrender_Charge", 0, math.Inf(1))),
+		optional(floatCol("Premiums_Paid", 0, math.Inf(1))),
+	}
+)
+
+// projectionMonths is the longest projection to maxAge, from issue at
+// age 0, bounding the policy months ValidateTables takes.
+const projectionMonths = 12 * maxAge
+
+// Errors wrapped by fieldError for values not of their column's type.
+var (
+	errNotNumber      = errors.New("not a number")
+	errNotWholeNumber = errors.New("not a whole number")
+	errNotBool        = errors.New("not true or false")
+	errNotDate        = errors.New("not a date (YYYY-MM-DD)")
+)
+
+// tableReader reads the rows of a CSV table whose header has been checked
+// against a schema, parsing values by their column's type, e.g.
+//
+//	t, err := newTableReader(r, name, issueAgeSchema)
+//	...
+//	age := t.field("Issue_Age")
+//	for t.next() {
+//		issueAge, err := t.int(age)
+//		...
+//	}
+//	if err := t.err(); err != nil {
+type tableReader struct {
+	name    string
+	reader  *csv.Reader
+	schema  []column
+	header  []string
+	row     []string
+	closer  io.Closer
+	readErr error
+	// parquet, when the table is a Parquet file, is read in place of
+	// reader, its rows' values typed
+	parquet *parquetTable
+}
+
+// field is a schema column of a table, at index in its rows, or -1 when
+// the header does not have it.
+type field struct {
+	index  int
+	column *column
+}
+
+// newTableReader reads the table's header, checking it has the schema's
+// required columns. name is used in error messages.
+func newTableReader(r io.Reader, name string, schema []column) (*tableReader, error) {
+	t := &tableReader{name: name, schema: schema}
+	if p, ok := r.(*parquetTable); ok {
+		t.parquet = p
+		t.header = p.names()
+	} else {
+		t.reader = csv.NewReader(r)
+		header, err := t.reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		t.header = header
+	}
+	for _, c := range schema {
+		if c.required && !t.has(t.field(c.name)) {
+			return nil, fmt.Errorf("%s: missing column %s", name, c.name)
+		}
+	}
+	return t, nil
+}
+
+// openTable opens the source's table at the path for reading by the
+// schema; the caller closes it.
+func (s RateSource) openTable(path string, schema []column) (*tableReader, error) {
+	return s.openTableRows(path, schema, nil)
+}
+
+// openTableRows opens the table like openTable, with the filter's rows
+// queried from a store; they are not cached, as the rates loaded from them
+// are.
+func (s RateSource) openTableRows(path string, schema []column, filter *rowFilter) (*tableReader, error) {
+	path, err := s.version(path)
+	if err != nil {
+		return nil, err
+	}
+	var file io.ReadCloser
+	if s.Store != nil && filter != nil {
+		file, err = s.openRows(path, filter)
+	} else {
+		file, err = s.openPath(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTableReader(file, path, schema)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	t.closer = file
+	return t, nil
+}
+
+func (t *tableReader) Close() error {
+	if t.closer == nil {
+		return nil
+	}
+	return t.closer.Close()
+}
+
+// field returns the schema column of the name; asking for a column not
+// in the schema is a bug.
+func (t *tableReader) field(name string) field {
+	for i := range t.schema {
+		if t.schema[i].name == name {
+			f := field{index: -1, column: &t.schema[i]}
+			for idx, val := range t.header {
+				if val == name {
+					f.index = idx
+				}
+			}
+			return f
+		}
+	}
+	panic(fmt.Sprintf("valact: column %s is not in the schema of %s", name, t.name))
+}
+
+// has reports whether the table has the column.
+func (t *tableReader) has(f field) bool {
+	return f.index >= 0
+}
+
+// next reads the next row, returning false at the end of the table or on
+// an error, which err returns.
+func (t *tableReader) next() bool {
+	if t.parquet != nil {
+		if !t.parquet.next() {
+			t.readErr = t.parquet.err
+			return false
+		}
+		return true
+	}
+	row, err := t.reader.Read()
+	if err != nil {
+		if err != io.EOF {
+			t.readErr = fmt.Errorf("%s: %w", t.name, err)
+		}
+		return false
+	}
+	t.row = row
+	return true
+}
+
+// err returns the error that ended next, if any.
+func (t *tableReader) err() error {
+	return t.readErr
+}
+
+// line is the line of the current row.
+func (t *tableReader) line() int {
+	if t.parquet != nil {
+		return t.parquet.line
+	}
+	line, _ := t.reader.FieldPos(0)
+	return line
+}
+
+// raw returns the row's value of the column as is, "" when absent.
+func (t *tableReader) raw(f field) string {
+	if f.index < 0 {
+		return ""
+	}
+	if t.parquet != nil {
+		return t.parquet.text(f.index)
+	}
+	return t.row[f.index]
+}
+
+// blank reports whether the row leaves the column empty or the table does
+// not have it.
+func (t *tableReader) blank(f field) bool {
+	return t.raw(f) == ""
+}
+
+// text returns the row's value of a text column, checking it is one of the
+// column's values.
+func (t *tableReader) text(f field) (string, error) {
+	value := t.raw(f)
+	if value != "" && len(f.column.values) > 0 && !slices.Contains(f.column.values, value) {
+		return value, t.fieldError(f, fmt.Errorf("%w (want %s)", errInvalidOption, strings.Join(f.column.values, ", ")))
+	}
+	return value, nil
+}
+
+func (t *tableReader) int(f field) (int, error) {
+	if v := t.typed(f, parquetInts); v != nil {
+		return int(v.ints[t.parquet.row]), nil
+	}
+	value, err := strconv.Atoi(t.raw(f))
+	if err != nil {
+		return 0, t.fieldError(f, numberError(err, errNotWholeNumber))
+	}
+	return value, nil
+}
+
+func (t *tableReader) float(f field) (float64, error) {
+	if v := t.typed(f, parquetFloats); v != nil {
+		return v.floats[t.parquet.row], nil
+	}
+	if v := t.typed(f, parquetInts); v != nil {
+		return float64(v.ints[t.parquet.row]), nil
+	}
+	value, err := strconv.ParseFloat(t.raw(f), 64)
+	if err != nil {
+		return 0, t.fieldError(f, numberError(err, errNotNumber))
+	}
+	return value, nil
+}
+
+func (t *tableReader) bool(f field) (bool, error) {
+	if v := t.typed(f, parquetBools); v != nil {
+		return v.bools[t.parquet.row], nil
+	}
+	value, err := strconv.ParseBool(t.raw(f))
+	if err != nil {
+		return false, t.fieldError(f, errNotBool)
+	}
+	return value, nil
+}
+
+func (t *tableReader) date(f field) (time.Time, error) {
+	if v := t.typed(f, parquetTimes); v != nil {
+		return v.times[t.parquet.row], nil
+	}
+	value, err := time.Parse(DateLayout, t.raw(f))
+	if err != nil {
+		return value, t.fieldError(f, errNotDate)
+	}
+	return value, nil
+}
+
+// fieldError is a fieldError for the row's value of the column.
+func (t *tableReader) fieldError(f field, err error) error {
+	return fieldError(t.name, t.line(), f.column.name, t.raw(f), err)
+}
+
+// typed returns the Parquet values of the column when they are of the kind
+// and the row's is not null, or else nil, for the value to be parsed from
+// its text.
+func (t *tableReader) typed(f field, kind parquetKind) *parquetValues {
+	if t.parquet == nil || f.index < 0 {
+		return nil
+	}
+	v := &t.parquet.values[f.index]
+	if v.kind != kind || v.null(t.parquet.row) {
+		return nil
+	}
+	return v
+}
+
+// numberError is notNumber, or errOutOfRange for a number too large.
+func numberError(err error, notNumber error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errOutOfRange
+	}
+	return notNumber
+}
@@ -0,0 +1,41 @@
+package valact
+
+import (
+	"bytes"
+	"io/fs"
+	"time"
+)
+
+// TableFS is an in-memory file system of rate tables keyed by file name,
+// e.g. "coi.csv", for a RateSource.FS where there is no disk to read, as in
+// a browser.
+type TableFS map[string][]byte
+
+// Open opens the named table.
+func (t TableFS) Open(name string) (fs.File, error) {
+	data, ok := t[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tableFile{Reader: bytes.NewReader(data), name: name, size: int64(len(data))}, nil
+}
+
+// tableFile is an open TableFS table.
+type tableFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (f *tableFile) Stat() (fs.FileInfo, error) { return tableInfo{f}, nil }
+func (f *tableFile) Close() error               { return nil }
+
+// tableInfo describes a TableFS table as a read-only file.
+type tableInfo struct{ f *tableFile }
+
+func (i tableInfo) Name() string       { return i.f.name }
+func (i tableInfo) Size() int64        { return i.f.size }
+func (i tableInfo) Mode() fs.FileMode  { return 0o444 }
+func (i tableInfo) ModTime() time.Time { return time.Time{} }
+func (i tableInfo) IsDir() bool        { return false }
+func (i tableInfo) Sys() any           { return nil }
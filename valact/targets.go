@@ -0,0 +1,142 @@
+package valact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SolveTarget is a premium solve a batch runs for each policy besides its
+// mode (see Batch.Targets).
+type SolveTarget string
+
+const (
+	// TargetMinimum is the minimum premium to maturity.
+	TargetMinimum SolveTarget = "minimum"
+	// TargetEndow is the minimum premium to endow at maturity.
+	TargetEndow SolveTarget = "endow"
+	// TargetMaxNonMEC is the largest premium that does not make the policy
+	// a modified endowment contract.
+	TargetMaxNonMEC SolveTarget = "max-non-mec"
+)
+
+// Valid reports whether t is minimum, endow, or max-non-mec.
+func (t SolveTarget) Valid() bool {
+	return t == TargetMinimum || t == TargetEndow || t == TargetMaxNonMEC
+}
+
+// ParseSolveTargets parses a comma-separated list of solve targets, e.g.
+// "minimum,endow,max-non-mec".
+func ParseSolveTargets(spec string) ([]SolveTarget, error) {
+	var targets []SolveTarget
+	for _, text := range strings.Split(spec, ",") {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		target := SolveTarget(text)
+		if !target.Valid() {
+			return nil, fmt.Errorf("invalid solve target %q", text)
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// PremiumSolves are the premiums a batch solved a policy for. A premium is
+// nil when its target was not requested or has no solution.
+type PremiumSolves struct {
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Endow     *float64 `json:"endow,omitempty"`
+	MaxNonMEC *float64 `json:"max_non_mec,omitempty"`
+}
+
+// premium returns the solved premium of the mode, false when it was not
+// solved for.
+func (s *PremiumSolves) premium(mode BatchMode) (float64, bool) {
+	var premium *float64
+	if s != nil {
+		switch mode {
+		case BatchSolve:
+			premium = s.Minimum
+		case BatchEndow:
+			premium = s.Endow
+		}
+	}
+	if premium == nil {
+		return 0, false
+	}
+	return *premium, true
+}
+
+// scale returns the solves multiplied by factor.
+func (s *PremiumSolves) scale(factor float64) *PremiumSolves {
+	if s == nil {
+		return nil
+	}
+	scaled := *s
+	for _, premium := range []**float64{&scaled.Minimum, &scaled.Endow, &scaled.MaxNonMEC} {
+		if *premium != nil {
+			value := **premium * factor
+			*premium = &value
+		}
+	}
+	return &scaled
+}
+
+// solveTargets solves the policy for each of the batch's targets on the
+// one set of rates. The minimum premium, solved first, is the starting
+// guess of the others, which narrows their brackets, unless the batch is
+// warm started from an earlier policy's solution. The maximum non-MEC
+// premium is solved on a copy of the rates with the 7-pay test applied.
+func (b Batch) solveTargets(ctx context.Context, policy Policy, rates *RateSet) (*PremiumSolves, error) {
+	solves := &PremiumSolves{}
+	guess := 0.0
+	solve := func(rates *RateSet, target Target) (*float64, error) {
+		seek := GoalSeek{
+			Variable:     Variable{Kind: VaryPremium},
+			Target:       target,
+			SolveOptions: b.SolveOptions,
+		}
+		if b.warm == nil || b.warm.guess(target, policy) == 0 {
+			seek.guess = guess
+		}
+		premium, _, err := seek.seek(ctx, policy, rates)
+		if errors.Is(err, ErrNoSolution) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &premium, nil
+	}
+	var err error
+	if slices.Contains(b.Targets, TargetMinimum) {
+		if solves.Minimum, err = solve(rates, Target{Metric: MetricMaturityValue}); err != nil {
+			return nil, err
+		}
+		if solves.Minimum != nil {
+			guess = *solves.Minimum
+		}
+	}
+	if slices.Contains(b.Targets, TargetEndow) {
+		if solves.Endow, err = solve(rates, Target{Metric: MetricEndowment}); err != nil {
+			return nil, err
+		}
+	}
+	if slices.Contains(b.Targets, TargetMaxNonMEC) {
+		basis, err := b.Source.GetGuidelineBasis(policy.Gender, policy.RiskClass, policy.IssueAge)
+		if err != nil {
+			return nil, err
+		}
+		mec := rates.clone()
+		mec.ApplySevenPayTest(basis, policy.IssueAge)
+		if solves.MaxNonMEC, err = solve(mec, Target{Metric: MetricSevenPayMargin}); err != nil {
+			return nil, err
+		}
+	}
+	return solves, nil
+}
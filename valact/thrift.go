@@ -0,0 +1,347 @@
+package valact
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Parquet metadata is Thrift structs in the compact protocol. thriftStruct
+// holds a struct's fields by id, decoded to bool, int8, int16, int32, int64,
+// float64, []byte, thriftStruct, or thriftList; encoding writes each by its
+// Go type, so a field must be given the type its definition has.
+type thriftStruct map[int16]any
+
+// thriftList is a list or set of elements of one Thrift type.
+type thriftList struct {
+	elem  byte
+	items []any
+}
+
+// Compact protocol type ids.
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactByte   = 3
+	compactI16    = 4
+	compactI32    = 5
+	compactI64    = 6
+	compactDouble = 7
+	compactBinary = 8
+	compactList   = 9
+	compactSet    = 10
+	compactMap    = 11
+	compactStruct = 12
+)
+
+var errThrift = errors.New("invalid thrift metadata")
+
+// int returns an integer field, or 0 when absent.
+func (s thriftStruct) int(id int16) int64 {
+	switch v := s[id].(type) {
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+func (s thriftStruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s thriftStruct) bool(id int16, absent bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return absent
+}
+
+func (s thriftStruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStruct) strct(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+// structs returns a list field's structs.
+func (s thriftStruct) structs(id int16) []thriftStruct {
+	list, _ := s[id].(thriftList)
+	var structs []thriftStruct
+	for _, item := range list.items {
+		if v, ok := item.(thriftStruct); ok {
+			structs = append(structs, v)
+		}
+	}
+	return structs
+}
+
+// thriftDecoder decodes compact protocol data.
+type thriftDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeThrift decodes a struct from the data, returning its length.
+func decodeThrift(data []byte) (thriftStruct, int, error) {
+	d := &thriftDecoder{data: data}
+	s, err := d.strct(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, d.pos, nil
+}
+
+func (d *thriftDecoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("%w: truncated", errThrift)
+	}
+	d.pos++
+	return d.data[d.pos-1], nil
+}
+
+func (d *thriftDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: bad varint", errThrift)
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *thriftDecoder) varint() (int64, error) {
+	v, err := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// strct decodes a struct's fields up to its stop byte; depth guards
+// against nesting without end in corrupt data.
+func (d *thriftDecoder) strct(depth int) (thriftStruct, error) {
+	if depth > 64 {
+		return nil, fmt.Errorf("%w: nested too deeply", errThrift)
+	}
+	s := make(thriftStruct)
+	var id int16
+	for {
+		header, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return s, nil
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := d.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if s[id], err = d.value(header&0x0f, depth); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// value decodes a value of the type.
+func (d *thriftDecoder) value(kind byte, depth int) (any, error) {
+	switch kind {
+	case compactTrue:
+		return true, nil
+	case compactFalse:
+		return false, nil
+	case compactByte:
+		b, err := d.byte()
+		return int8(b), err
+	case compactI16:
+		v, err := d.varint()
+		return int16(v), err
+	case compactI32:
+		v, err := d.varint()
+		return int32(v), err
+	case compactI64:
+		return d.varint()
+	case compactDouble:
+		if d.pos+8 > len(d.data) {
+			return nil, fmt.Errorf("%w: truncated", errThrift)
+		}
+		d.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(d.data[d.pos-8:])), nil
+	case compactBinary:
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: truncated", errThrift)
+		}
+		d.pos += int(n)
+		return d.data[d.pos-int(n) : d.pos], nil
+	case compactList, compactSet:
+		header, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = d.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: list of %d", errThrift, size)
+		}
+		list := thriftList{elem: header & 0x0f, items: make([]any, size)}
+		for i := range list.items {
+			if list.items[i], err = d.element(list.elem, depth); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case compactMap:
+		size, err := d.uvarint()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		if size > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: map of %d", errThrift, size)
+		}
+		types, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		// maps are not used by Parquet metadata; decoded to be skipped
+		for range size {
+			if _, err := d.element(types>>4, depth); err != nil {
+				return nil, err
+			}
+			if _, err := d.element(types&0x0f, depth); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case compactStruct:
+		return d.strct(depth + 1)
+	}
+	return nil, fmt.Errorf("%w: type %d", errThrift, kind)
+}
+
+// element decodes an element of a list, set, or map, where booleans are a
+// byte each.
+func (d *thriftDecoder) element(kind byte, depth int) (any, error) {
+	if kind == compactTrue || kind == compactFalse {
+		b, err := d.byte()
+		return b == compactTrue, err
+	}
+	return d.value(kind, depth+1)
+}
+
+// encodeThrift appends the struct in the compact protocol.
+func encodeThrift(buf []byte, s thriftStruct) []byte {
+	ids := make([]int16, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	var last int16
+	for _, id := range ids {
+		value := s[id]
+		kind := thriftKind(value)
+		if kind == compactTrue && !value.(bool) {
+			kind = compactFalse
+		}
+		if delta := id - last; delta > 0 && delta <= 15 {
+			buf = append(buf, byte(delta)<<4|kind)
+		} else {
+			buf = append(buf, kind)
+			buf = binary.AppendUvarint(buf, zigzag(int64(id)))
+		}
+		last = id
+		if kind != compactTrue && kind != compactFalse {
+			buf = appendThriftValue(buf, value)
+		}
+	}
+	return append(buf, 0)
+}
+
+// thriftKind is the compact type of a Go value, compactTrue for booleans.
+func thriftKind(value any) byte {
+	switch value.(type) {
+	case bool:
+		return compactTrue
+	case int8:
+		return compactByte
+	case int16:
+		return compactI16
+	case int32:
+		return compactI32
+	case int64:
+		return compactI64
+	case float64:
+		return compactDouble
+	case []byte, string:
+		return compactBinary
+	case thriftList:
+		return compactList
+	case thriftStruct:
+		return compactStruct
+	}
+	panic(fmt.Sprintf("valact: no thrift type for %T", value))
+}
+
+func appendThriftValue(buf []byte, value any) []byte {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return append(buf, compactTrue)
+		}
+		return append(buf, compactFalse)
+	case int8:
+		return append(buf, byte(v))
+	case int16:
+		return binary.AppendUvarint(buf, zigzag(int64(v)))
+	case int32:
+		return binary.AppendUvarint(buf, zigzag(int64(v)))
+	case int64:
+		return binary.AppendUvarint(buf, zigzag(v))
+	case float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	case []byte:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...)
+	case string:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...)
+	case thriftList:
+		if len(v.items) < 15 {
+			buf = append(buf, byte(len(v.items))<<4|v.elem)
+		} else {
+			buf = append(buf, 0xf0|v.elem)
+			buf = binary.AppendUvarint(buf, uint64(len(v.items)))
+		}
+		for _, item := range v.items {
+			buf = appendThriftValue(buf, item)
+		}
+		return buf
+	case thriftStruct:
+		return encodeThrift(buf, v)
+	}
+	panic(fmt.Sprintf("valact: no thrift type for %T", value))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
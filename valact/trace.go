@@ -0,0 +1,398 @@
+package valact
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strconv"
+)
+
+// Traced quantities, one TraceEntry each per month.
+const (
+	TracePremiumLoad   = "premium_load"
+	TraceExpenseCharge = "expense_charge"
+	TraceNAAR          = "naar"
+	TraceCOI           = "coi"
+	TraceInterest      = "interest"
+)
+
+// TraceEntry is one intermediate quantity of a projection month: its
+// amount, the values it was computed from, and the rates applied with
+// where each came from.
+type TraceEntry struct {
+	PolicyMonth int     `json:"policy_month"`
+	PolicyYear  int     `json:"policy_year"`
+	Quantity    string  `json:"quantity"`
+	Amount      float64 `json:"amount"`
+	// Inputs are the amounts of the month the rates apply to, e.g. the
+	// premium for the premium load.
+	Inputs []TraceValue `json:"inputs"`
+	Rates  []TraceRate  `json:"rates"`
+}
+
+// TraceValue is a named amount a quantity was computed from.
+type TraceValue struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// TraceRate is a rate a quantity was computed from, with its source: the
+// table, column, and row key it was read from, the product, or the
+// adjustment that set it, e.g.
+// "coi.csv Rate: Gender M, Risk_Class NS, Issue_Age 35, Policy_Year 12".
+type TraceRate struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Source string  `json:"source"`
+}
+
+// TraceSources are where the rates of a traced projection came from (see
+// RateSource.TraceSources). Tables are the paths read, after any table
+// versions; the descriptions of rates not read from tables, such as
+// Interest, may be replaced by a caller that set the rates itself.
+type TraceSources struct {
+	// COI and GuaranteedCOI are the current and guaranteed COI tables and
+	// GuaranteedColumn the latter's rate column, keyed by Gender and
+	// RiskClass after any code mapping.
+	COI              string
+	GuaranteedCOI    string
+	GuaranteedColumn string
+	Gender           string
+	RiskClass        string
+	PerUnit          string
+	Corridor         string
+	// Loads is the loads table, empty when the loads are the product's,
+	// and TargetPremium the target premium table, empty without one.
+	Loads         string
+	TargetPremium string
+	// Product describes the product whose charges and rates apply where
+	// there is no table.
+	Product string
+	// Interest, MinimumInterest, and InterestBonus describe the credited
+	// rates, and InterestScenario is the interest scenario table, and the
+	// scenario, of MonthlyInterest.
+	Interest         string
+	MinimumInterest  string
+	InterestBonus    string
+	InterestScenario string
+	// State is the state variations table and the policy's state, and
+	// Improvement the mortality improvement scale table, each empty when
+	// not applied.
+	State       string
+	Improvement string
+}
+
+// TraceSources returns the sources of the rates PolicyRates loads for the
+// policy.
+func (s RateSource) TraceSources(policy Policy) (TraceSources, error) {
+	if s.VersionsAtIssue && !policy.IssueDate.IsZero() {
+		var err error
+		if s, err = s.AtDate(policy.IssueDate); err != nil {
+			return TraceSources{}, err
+		}
+	}
+	gender, riskClass, err := s.MapCodes(policy.Gender, policy.RiskClass)
+	if err != nil {
+		return TraceSources{}, err
+	}
+	product := s.product()
+	name := "default product"
+	if product.Code != "" {
+		name = "product " + product.Code
+	}
+	sources := TraceSources{
+		COI:              s.path(s.COIFile, COIFile),
+		GuaranteedCOI:    s.path(s.GuaranteedCOIFile, GuaranteedCOIFile),
+		GuaranteedColumn: "Rate",
+		Gender:           gender,
+		RiskClass:        riskClass,
+		PerUnit:          s.path(s.UnitLoadFile, UnitLoadFile),
+		Corridor:         s.path(s.CorridorFactorsFile, CorridorFactorsFile),
+		Loads:            s.path(s.LoadsFile, LoadsFile),
+		TargetPremium:    s.path(s.TargetPremiumFile, TargetPremiumFile),
+		Product:          name,
+		Interest:         name + " Interest",
+		MinimumInterest:  name + " MinimumInterest",
+		InterestBonus:    "interest bonus",
+		InterestScenario: s.path(s.InterestScenarioFile, InterestScenarioFile),
+	}
+	if combined, err := s.hasColumn(sources.COI, GuaranteedRateColumn); err != nil {
+		return TraceSources{}, err
+	} else if combined {
+		sources.GuaranteedCOI, sources.GuaranteedColumn = sources.COI, GuaranteedRateColumn
+	}
+	if _, err := s.GetLoads(1); errors.Is(err, fs.ErrNotExist) {
+		sources.Loads = ""
+	} else if err != nil {
+		return TraceSources{}, err
+	}
+	if _, err := s.GetTargetPremiumRate(policy.IssueAge); errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrIssueAgeNotInTarget) {
+		sources.TargetPremium = ""
+	} else if err != nil {
+		return TraceSources{}, err
+	}
+	for _, table := range []*string{&sources.COI, &sources.GuaranteedCOI, &sources.PerUnit, &sources.Corridor, &sources.Loads, &sources.TargetPremium} {
+		if *table == "" {
+			continue
+		}
+		if *table, err = s.version(*table); err != nil {
+			return TraceSources{}, err
+		}
+	}
+	if policy.State != "" {
+		sources.State = fmt.Sprintf("%s: State %s", s.path(s.StateVariationsFile, StateVariationsFile), policy.State)
+	}
+	if s.Improvement != nil && s.Improvement.Target != ImproveValuation {
+		sources.Improvement = s.path(s.ImprovementScaleFile, ImprovementScaleFile)
+	}
+	return sources, nil
+}
+
+// TraceLedger illustrates the policy like IllustrateLedger and traces every
+// month's premium load, expense charge, net amount at risk, COI, and
+// interest with the rates applied, their sources given by sources.
+func TraceLedger(policy Policy, rates *RateSet, sources TraceSources) (Ledger, []TraceEntry) {
+	t := &tracer{policy: policy, sources: sources}
+	traced := *rates
+	traced.trace = t
+	ledger := IllustrateLedger(policy, &traced)
+	return ledger, t.entries
+}
+
+// tracer records the trace of a projection, called by project at each
+// traced quantity when the rates carry one.
+type tracer struct {
+	policy  Policy
+	sources TraceSources
+	entries []TraceEntry
+}
+
+// add appends an entry for the month.
+func (t *tracer) add(m *Month, quantity string, amount float64, inputs []TraceValue, rates []TraceRate) {
+	t.entries = append(t.entries, TraceEntry{
+		PolicyMonth: m.PolicyMonth,
+		PolicyYear:  m.PolicyYear,
+		Quantity:    quantity,
+		Amount:      amount,
+		Inputs:      inputs,
+		Rates:       rates,
+	})
+}
+
+// yearKey is the row key of an Issue_Age, Policy_Year table, with the face
+// amount band when banded.
+func (t *tracer) yearKey(bands []RateBand, faceAmount float64, policyYear int) string {
+	key := fmt.Sprintf("Issue_Age %d, Policy_Year %d", t.policy.IssueAge, policyYear)
+	if len(bands) > 1 {
+		key += ", " + FaceBandColumn + " " + formatFloat(bands[bandIndex(bands, faceAmount)].MinFace)
+	}
+	return key
+}
+
+// loadsSource is the source of a loads table column, or of the product's
+// value without a loads table.
+func (t *tracer) loadsSource(column string, field string, policyYear int) string {
+	source := t.sources.Product + " " + field
+	if t.sources.Loads != "" {
+		source = fmt.Sprintf("%s %s: Policy_Year %d", t.sources.Loads, column, policyYear)
+	}
+	return source
+}
+
+// hookSource is the source of rates replaced by a charge or crediting
+// hook: the formula, when a FormulaCharges one sets it, or else the hook's
+// type.
+func hookSource(hook any, formula *Expr) string {
+	if formula != nil {
+		return "formula " + formula.String()
+	}
+	return fmt.Sprintf("%T", hook)
+}
+
+// premiumLoad traces the month's premium load.
+func (t *tracer) premiumLoad(m *Month, load float64) {
+	rates, year := m.Rates, m.PolicyYear-1
+	inputs := []TraceValue{
+		{"premium", m.Premium},
+		{"premium_ytd", m.PremiumYTD},
+		{"load_ytd", m.LoadYTD},
+	}
+	target := TraceRate{"target_premium", rates.TargetPremium[year], "none"}
+	if t.policy.TargetPremium != 0 {
+		target.Source = "policy TargetPremium"
+	} else if t.sources.TargetPremium != "" {
+		target.Source = fmt.Sprintf("%s Rate: Issue_Age %d, per $1,000 of face amount %s", t.sources.TargetPremium, t.policy.IssueAge, formatFloat(t.policy.FaceAmount))
+	}
+	loadSource := t.loadsSource("Premium_Load", "PremiumLoad", m.PolicyYear)
+	excessSource := t.loadsSource("Premium_Load_Excess", "PremiumLoadExcess", m.PolicyYear)
+	if t.sources.State != "" {
+		loadSource += ", plus Premium_Tax from " + t.sources.State
+		excessSource += ", plus Premium_Tax from " + t.sources.State
+	}
+	if formulas, ok := rates.Charges.(FormulaCharges); rates.Charges != nil && (!ok || formulas.PremiumLoadFormula != nil) {
+		loadSource = hookSource(rates.Charges, formulas.PremiumLoadFormula)
+		excessSource = loadSource
+	}
+	list := []TraceRate{
+		{"premium_load", rates.PremiumLoad[year], loadSource},
+		{"premium_load_excess", rates.PremiumLoadExcess[year], excessSource},
+		target,
+	}
+	if limit := rates.PremiumLoadCap[year]; !math.IsInf(limit, 1) {
+		list = append(list, TraceRate{"premium_load_cap", limit, t.sources.Product + " PremiumLoadCap"})
+	}
+	t.add(m, TracePremiumLoad, load, inputs, list)
+}
+
+// expenseCharge traces the month's expense charge, after any proration.
+func (t *tracer) expenseCharge(m *Month, charge float64) {
+	rates, year := m.Rates, m.PolicyYear-1
+	inputs := []TraceValue{{"face_amount", m.FaceAmount}, {"fraction", m.Fraction}}
+	perUnit := rates.PerUnit[year]
+	if rates.PerUnitBands != nil {
+		perUnit = bandRate(rates.PerUnitBands, m.FaceAmount, m.PolicyYear)
+	}
+	feeSource := t.loadsSource("Policy_Fee", "PolicyFee", m.PolicyYear)
+	perUnitSource := fmt.Sprintf("%s Rate: %s", t.sources.PerUnit, t.yearKey(rates.PerUnitBands, m.FaceAmount, m.PolicyYear))
+	if formulas, ok := rates.Charges.(FormulaCharges); rates.Charges != nil {
+		if !ok || formulas.PolicyFeeFormula != nil {
+			feeSource = hookSource(rates.Charges, formulas.PolicyFeeFormula)
+		}
+		if !ok || formulas.PerUnitFormula != nil {
+			perUnitSource = hookSource(rates.Charges, formulas.PerUnitFormula)
+		}
+	}
+	t.add(m, TraceExpenseCharge, charge, inputs, []TraceRate{
+		{"policy_fee", rates.PolicyFee[year], feeSource},
+		{"per_unit", perUnit, perUnitSource},
+	})
+}
+
+// coi traces the month's net amount at risk, from the death benefit on the
+// account value, and its COI charge at the unrated COI rate.
+func (t *tracer) coi(m *Month, dbOption DBOption, accountValue float64, deathBenefit float64, naar float64, coiRate float64, coi float64) {
+	rates, year := m.Rates, m.PolicyYear-1
+	attainedAge := t.policy.IssueAge + year
+	option := string(dbOption)
+	if option == "" {
+		option = string(DBOptionA)
+	}
+	t.add(m, TraceNAAR, naar, []TraceValue{
+		{"face_amount", m.FaceAmount},
+		{"account_value", accountValue},
+		{"death_benefit", deathBenefit},
+	}, []TraceRate{
+		{"corridor_factor", rates.CorridorFactors[year], fmt.Sprintf("%s Rate: Attained_Age %d, death benefit option %s", t.sources.Corridor, attainedAge, option)},
+		{"naar_discount", rates.NAARDiscount[year], t.sources.Product + " NAARDiscount"},
+	})
+
+	insured := fmt.Sprintf("Gender %s, Risk_Class %s, ", t.sources.Gender, t.sources.RiskClass)
+	current := TraceRate{"coi_current", rates.COI[year], fmt.Sprintf("%s Rate: %s%s", t.sources.COI, insured, t.yearKey(rates.COIBands, m.FaceAmount, m.PolicyYear))}
+	if rates.COIBands != nil {
+		current.Value = bandRate(rates.COIBands, m.FaceAmount, m.PolicyYear)
+	}
+	if rates.Survivorship != "" {
+		current.Source = fmt.Sprintf("joint last survivor rate (%s) of the lives' rates in %s", rates.Survivorship, t.sources.COI)
+	}
+	if t.sources.Improvement != "" {
+		current.Source += ", improved by " + t.sources.Improvement
+	}
+	list := []TraceRate{current}
+	if rates.GuaranteedCOI != nil {
+		list = append(list, TraceRate{"coi_guaranteed", bandRate(rates.GuaranteedCOI, m.FaceAmount, m.PolicyYear),
+			fmt.Sprintf("%s %s: %s%s", t.sources.GuaranteedCOI, t.sources.GuaranteedColumn, insured, t.yearKey(rates.GuaranteedCOI, m.FaceAmount, m.PolicyYear))})
+	}
+	if survivor, ok := t.policy.survivorCOI(rates, m.PolicyYear); ok {
+		list = append(list, TraceRate{"coi_survivor", survivor, fmt.Sprintf("single life rate of the survivor after the first death in policy year %d", t.policy.FirstDeath.PolicyYear)})
+	}
+	rated := t.policy.ratedCOI(coiRate)
+	source := "coi_current"
+	switch {
+	case len(list) > 1 && list[len(list)-1].Name == "coi_survivor":
+		source = "coi_survivor"
+	case len(list) > 1 && coiRate < current.Value:
+		source = "coi_guaranteed, the lesser of coi_current and coi_guaranteed"
+	}
+	if rated != coiRate {
+		source += fmt.Sprintf(" times table rating %s, capped at 1000", formatFloat(t.policy.TableRating))
+	}
+	list = append(list, TraceRate{"coi_rate", rated, source})
+	t.add(m, TraceCOI, coi, []TraceValue{{"naar", naar}, {"fraction", m.Fraction}}, list)
+}
+
+// interest traces the month's interest credited on the fixed account.
+func (t *tracer) interest(m *Month, interest float64) {
+	rates, year := m.Rates, m.PolicyYear-1
+	inputs := []TraceValue{
+		{"account_value", m.Value},
+		{"fixed_value", m.FixedValue},
+		{"loan_balance", m.LoanBalance},
+		{"fraction", m.Fraction},
+	}
+	declared := TraceRate{"declared_interest", rates.Interest[year], t.sources.Interest}
+	if month := max(1, m.PolicyMonth); month <= len(rates.MonthlyInterest) {
+		declared.Value = rates.MonthlyInterest[month-1]
+		declared.Source = fmt.Sprintf("%s: policy month %d", t.sources.InterestScenario, month)
+	}
+	list := []TraceRate{
+		declared,
+		{"minimum_interest", rates.MinimumInterest[year], t.sources.MinimumInterest},
+	}
+	if bonus := rates.InterestBonus[year]; bonus != 0 {
+		list = append(list, TraceRate{"interest_bonus", bonus, t.sources.InterestBonus})
+	}
+	credited := TraceRate{"credited_interest", rates.interest(max(1, m.PolicyMonth), m.PolicyYear), "the greater of declared_interest and minimum_interest, with any interest_bonus"}
+	if rates.Crediting != nil {
+		credited.Source = hookSource(rates.Crediting, nil)
+	}
+	list = append(list, credited, TraceRate{"loan_crediting", rates.LoanCrediting[year], t.sources.Product + " LoanCrediting"})
+	t.add(m, TraceInterest, interest, inputs, list)
+}
+
+// TraceColumns is the column layout written by WriteTraceCSV.
+var TraceColumns = []string{"Policy_Month", "Policy_Year", "Quantity", "Amount", "Item", "Kind", "Value", "Source"}
+
+// WriteTraceCSV writes trace entries as CSV, a row for each of an entry's
+// inputs (Kind "input") and rates (Kind "rate").
+func WriteTraceCSV(w io.Writer, entries []TraceEntry) error {
+	buffered := bufio.NewWriterSize(w, sinkBufferSize)
+	writer := csv.NewWriter(buffered)
+	if err := writer.Write(TraceColumns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		prefix := []string{strconv.Itoa(entry.PolicyMonth), strconv.Itoa(entry.PolicyYear), entry.Quantity, formatFloat(entry.Amount)}
+		for _, input := range entry.Inputs {
+			if err := writer.Write(append(prefix[:4:4], input.Name, "input", formatFloat(input.Value), "")); err != nil {
+				return err
+			}
+		}
+		for _, rate := range entry.Rates {
+			if err := writer.Write(append(prefix[:4:4], rate.Name, "rate", formatFloat(rate.Value), rate.Source)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// WriteTraceJSON writes trace entries as JSON Lines, one entry per line.
+func WriteTraceJSON(w io.Writer, entries []TraceEntry) error {
+	buffered := bufio.NewWriterSize(w, sinkBufferSize)
+	encoder := json.NewEncoder(buffered)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
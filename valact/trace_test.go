@@ -0,0 +1,70 @@
+package valact
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestTraceLedger(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 1255.03}
+	rates := sampleRates(t, policy)
+	sources, err := source.TraceSources(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, entries := TraceLedger(policy, rates, sources)
+	if !reflect.DeepEqual(ledger, IllustrateLedger(policy, rates)) {
+		t.Fatal("the traced ledger differs from the illustrated one")
+	}
+	quantities := []string{TracePremiumLoad, TraceExpenseCharge, TraceNAAR, TraceCOI, TraceInterest}
+	if len(entries) != len(quantities)*len(ledger) {
+		t.Fatalf("%d trace entries, want %d for each of %d months", len(entries), len(quantities), len(ledger))
+	}
+	for i, row := range ledger {
+		month := entries[i*len(quantities) : (i+1)*len(quantities)]
+		amounts := []float64{row.PremiumLoad, row.ExpenseCharge, row.NAAR, row.COICharge, row.Interest}
+		for j, entry := range month {
+			if entry.PolicyMonth != row.PolicyMonth || entry.Quantity != quantities[j] || entry.Amount != amounts[j] {
+				t.Fatalf("entry %+v, want %s %v in month %d", entry, quantities[j], amounts[j], row.PolicyMonth)
+			}
+		}
+	}
+	coi := entries[12*len(quantities)+3]
+	if want := "testdata/tables/coi.csv Rate: Gender M, Risk_Class NS, Issue_Age 35, Policy_Year 2"; coi.Rates[0].Source != want {
+		t.Errorf("year 2 COI rate source %q, want %q", coi.Rates[0].Source, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTraceCSV(&buf, entries[:len(quantities)]); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := 1
+	for _, entry := range entries[:len(quantities)] {
+		rows += len(entry.Inputs) + len(entry.Rates)
+	}
+	if len(records) != rows || !reflect.DeepEqual(records[0], TraceColumns) {
+		t.Errorf("trace CSV has %d rows with header %v, want %d with %v", len(records), records[0], rows, TraceColumns)
+	}
+}
+
+func TestTraceTargetPremiumSource(t *testing.T) {
+	source := RateSource{FS: sampleTables, Dir: "testdata/tables"}
+	policy := Policy{IssueAge: 35, Gender: "M", RiskClass: "NS", FaceAmount: 100000, AnnualPremium: 1255.03, TargetPremium: 1000}
+	rates := sampleRates(t, policy)
+	sources, err := source.TraceSources(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, entries := TraceLedger(policy, rates, sources)
+	target := entries[0].Rates[2]
+	if target.Name != "target_premium" || target.Value != 1000 || target.Source != "policy TargetPremium" {
+		t.Errorf("target premium rate %+v, want the policy's 1000", target)
+	}
+}
@@ -0,0 +1,502 @@
+package valact
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableProblem is a problem found in a rate table by ValidateTables; Line is
+// 0 for a problem with the table as a whole.
+type TableProblem struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (p TableProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s line %d: %s", p.Path, p.Line, p.Message)
+}
+
+// tableSpec describes a rate table for validation.
+type tableSpec struct {
+	path     string
+	required bool
+	schema   []column
+	// layouts are the key columns of the table's kinds of row; a row is of
+	// the first layout whose keys it fills, e.g. select rows and ultimate
+	// rows of a COI table
+	layouts [][]string
+	// sparse tables give values from some periods, holding until the next
+	sparse bool
+	// lifetime tables run from policy year 1 to maturity for each issue age
+	lifetime bool
+}
+
+// classColumns are the key columns whose codes each have the same keys
+// below them, such as the issue ages of each risk class.
+var classColumns = []string{"Gender", "Risk_Class", FaceBandColumn}
+
+// tableSpecs are the source's tables as the loaders read them.
+func (s RateSource) tableSpecs() []tableSpec {
+	coi := func(path string, required bool) tableSpec {
+		return tableSpec{
+			path:     path,
+			required: required,
+			schema:   coiSchema,
+			layouts: [][]string{
+				{"Gender", "Risk_Class", "Issue_Age", "Policy_Year"},
+				{"Gender", "Risk_Class", "Attained_Age"},
+			},
+			lifetime: true,
+		}
+	}
+	issueAge := func(path string, required bool) tableSpec {
+		return tableSpec{path: path, required: required, schema: issueAgeSchema, layouts: [][]string{{"Issue_Age", "Policy_Year"}}}
+	}
+	return []tableSpec{
+		coi(s.path(s.COIFile, COIFile), true),
+		coi(s.path(s.GuaranteedCOIFile, GuaranteedCOIFile), false),
+		coi(s.path(s.ShadowCOIFile, ShadowCOIFile), false),
+		coi(s.path(s.TermCOIFile, TermCOIFile), false),
+		coi(s.path(s.ValuationMortalityFile, ValuationMortalityFile), false),
+		issueAge(s.path(s.UnitLoadFile, UnitLoadFile), true),
+		issueAge(s.path(s.SurrenderChargesFile, SurrenderChargesFile), true),
+		issueAge(s.path(s.TermUnitLoadFile, TermUnitLoadFile), false),
+		issueAge(s.path(s.WaiverFile, WaiverFile), false),
+		issueAge(s.path(s.ADBFile, ADBFile), false),
+		issueAge(s.path(s.ChronicFile, ChronicFile), false),
+		{path: s.path(s.CorridorFactorsFile, CorridorFactorsFile), schema: corridorSchema, layouts: [][]string{{"Attained_Age"}}},
+		{path: s.path(s.AnnuityFactorsFile, AnnuityFactorsFile), schema: annuitySchema, layouts: [][]string{{"Attained_Age"}}},
+		{path: s.path(s.TargetPremiumFile, TargetPremiumFile), schema: targetPremiumSchema, layouts: [][]string{{"Issue_Age"}}},
+		{path: s.path(s.LoadsFile, LoadsFile), schema: loadsSchema, layouts: [][]string{{"Policy_Year"}}, sparse: true},
+		{
+			path:    s.path(s.InterestScenarioFile, InterestScenarioFile),
+			schema:  scenarioSchema,
+			layouts: [][]string{{"Scenario", "Policy_Year"}, {"Scenario", "Policy_Month"}},
+			sparse:  true,
+		},
+		{path: s.path(s.ImprovementScaleFile, ImprovementScaleFile), schema: improvementSchema, layouts: [][]string{{"Attained_Age", "Year"}}, sparse: true},
+		{path: s.path(s.StateVariationsFile, StateVariationsFile), schema: stateSchema, layouts: [][]string{{"State"}}},
+		{path: s.path(s.CodeMapFile, CodeMapFile), schema: codeMapSchema, layouts: [][]string{{"Field", "Code"}}},
+		{path: s.path(s.TableVersionsFile, TableVersionsFile), schema: tableVersionsSchema, layouts: [][]string{{"Table", "Effective_Date"}}},
+	}
+}
+
+// ValidateTables checks every rate table of the source, and the product
+// file, reporting all the problems found rather than stopping at the first:
+// missing required tables, header mismatches, non-numeric and out of range
+// values, duplicate keys, and incomplete tables. A table is incomplete when
+// its issue ages, attained ages, or policy years have gaps, when a gender,
+// risk class, or face band lacks rows the others have, or when a COI
+// table's rates stop before maturity; the loaders read such missing rows as
+// 0. Tables other than the COI, unit load, and surrender charge tables are
+// optional.
+func (s RateSource) ValidateTables() []TableProblem {
+	var problems []TableProblem
+	specs := s.tableSpecs()
+	for _, spec := range specs {
+		problems = append(problems, s.validateTable(spec)...)
+	}
+	// each version of a table is checked as the table; the versions file's
+	// own problems are reported above
+	versions, _ := s.readTableVersions()
+	for _, v := range versions {
+		at := slices.IndexFunc(specs, func(spec tableSpec) bool { return baseName(spec.path) == v.table })
+		if at < 0 {
+			problems = append(problems, TableProblem{Path: s.path(s.TableVersionsFile, TableVersionsFile), Message: fmt.Sprintf("version of unknown table %s", v.table)})
+			continue
+		}
+		spec := specs[at]
+		spec.path, spec.required = s.path("", v.file), true
+		problems = append(problems, s.validateTable(spec)...)
+	}
+	path := s.path(s.ProductsFile, ProductsFile)
+	if _, err := s.GetProducts(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// split "path line N: message" back into its parts
+		problem := TableProblem{Path: path, Message: strings.TrimPrefix(err.Error(), path)}
+		if _, scanErr := fmt.Sscanf(problem.Message, " line %d:", &problem.Line); scanErr == nil {
+			_, problem.Message, _ = strings.Cut(problem.Message, ":")
+		}
+		problem.Message = strings.TrimPrefix(strings.TrimPrefix(problem.Message, ":"), " ")
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// keyNode is a level of a table's keys, by value of the level's column.
+type keyNode struct {
+	children map[string]*keyNode
+	order    []string
+}
+
+func (n *keyNode) child(value string) *keyNode {
+	if n.children == nil {
+		n.children = make(map[string]*keyNode)
+	}
+	child, ok := n.children[value]
+	if !ok {
+		child = &keyNode{}
+		n.children[value] = child
+		n.order = append(n.order, value)
+	}
+	return child
+}
+
+// tableCheck collects the problems of one table.
+type tableCheck struct {
+	spec tableSpec
+	// maturityAge is the product's, to which lifetime tables run
+	maturityAge int
+	problems    []TableProblem
+}
+
+// add adds a problem, once.
+func (c *tableCheck) add(line int, format string, args ...any) {
+	problem := TableProblem{Path: c.spec.path, Line: line, Message: fmt.Sprintf(format, args...)}
+	if !slices.Contains(c.problems, problem) {
+		c.problems = append(c.problems, problem)
+	}
+}
+
+// validateTable checks a table against its spec.
+func (s RateSource) validateTable(spec tableSpec) []TableProblem {
+	c := &tableCheck{spec: spec, maturityAge: s.product().maturityAge()}
+	file, err := s.openPath(spec.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if spec.required {
+			c.add(0, "missing required table")
+		}
+		return c.problems
+	}
+	if err != nil {
+		c.add(0, "%v", err)
+		return c.problems
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		c.add(0, "header: %v", err)
+		return c.problems
+	}
+	columns := c.checkHeader(header)
+	if columns == nil {
+		return c.problems
+	}
+
+	// the levels of each layout's keys, with the band before the ages
+	var layouts [][]string
+	for _, layout := range spec.layouts {
+		if !hasColumns(header, layout) {
+			layouts = append(layouts, nil)
+			continue
+		}
+		levels := slices.Clone(layout)
+		if slices.Contains(header, FaceBandColumn) {
+			at := slices.IndexFunc(levels, func(name string) bool { return c.column(name).kind == intColumn })
+			levels = slices.Insert(levels, at, FaceBandColumn)
+		}
+		layouts = append(layouts, levels)
+	}
+	roots := make([]*keyNode, len(layouts))
+	for i := range roots {
+		roots[i] = &keyNode{}
+	}
+	seen := make(map[string]int)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			c.add(line, "%v", err)
+			break
+		}
+		if len(row) != len(header) {
+			c.add(line, "%d fields for %d columns", len(row), len(header))
+			continue
+		}
+		c.checkValues(line, row, columns)
+		layout := slices.IndexFunc(layouts, func(levels []string) bool {
+			return levels != nil && !slices.ContainsFunc(levels, func(column string) bool { return row[columns[column]] == "" })
+		})
+		if layout < 0 {
+			c.add(line, "missing key %s", strings.Join(missingKeys(row, columns, layouts), ", "))
+			continue
+		}
+		node, key, ok := roots[layout], fmt.Sprint(layout), true
+		for _, column := range layouts[layout] {
+			value, valid := c.checkKey(line, column, row[columns[column]])
+			ok = ok && valid
+			node = node.child(value)
+			key += "\x00" + value
+		}
+		if !ok {
+			continue
+		}
+		if first, dup := seen[key]; dup {
+			c.add(line, "duplicate of line %d", first)
+			continue
+		}
+		seen[key] = line
+	}
+	if len(seen) == 0 {
+		c.add(0, "no rows")
+	}
+	// ultimate rows, when there are any, carry a lifetime table's select
+	// rows to maturity
+	ultimate := len(roots) > 1 && len(roots[1].order) > 0
+	for i, levels := range layouts {
+		if levels != nil {
+			c.checkComplete(roots[i], levels, nil, spec.lifetime && !ultimate)
+		}
+	}
+	return c.problems
+}
+
+// checkHeader checks the header's columns, returning their indexes by name,
+// or nil when the table cannot be read.
+func (c *tableCheck) checkHeader(header []string) map[string]int {
+	columns := make(map[string]int)
+	ok := true
+	for idx, name := range header {
+		if _, dup := columns[name]; dup {
+			c.add(1, "column %s given twice", name)
+			ok = false
+		}
+		columns[name] = idx
+		if c.column(name) == nil {
+			c.add(1, "unknown column %s", name)
+		}
+	}
+	for _, col := range c.spec.schema {
+		if _, found := columns[col.name]; !found && col.required {
+			c.add(1, "missing column %s", col.name)
+			ok = false
+		}
+	}
+	if !slices.ContainsFunc(c.spec.layouts, func(layout []string) bool { return hasColumns(header, layout) }) {
+		var keys []string
+		for _, layout := range c.spec.layouts {
+			keys = append(keys, strings.Join(layout, ", "))
+		}
+		c.add(1, "missing key columns: expected %s", strings.Join(keys, " or "))
+		ok = false
+	}
+	if !ok {
+		return nil
+	}
+	return columns
+}
+
+// column is the schema column of the name, or nil.
+func (c *tableCheck) column(name string) *column {
+	for i := range c.spec.schema {
+		if c.spec.schema[i].name == name {
+			return &c.spec.schema[i]
+		}
+	}
+	return nil
+}
+
+// checkValues checks the row's values other than its keys are of their
+// columns' types and within their bounds.
+func (c *tableCheck) checkValues(line int, row []string, columns map[string]int) {
+	for _, col := range c.spec.schema {
+		idx, ok := columns[col.name]
+		if !ok || col.name == FaceBandColumn || slices.ContainsFunc(c.spec.layouts, func(layout []string) bool { return slices.Contains(layout, col.name) }) {
+			continue
+		}
+		if problem := col.check(row[idx]); problem != "" {
+			c.add(line, "%s", problem)
+		}
+	}
+}
+
+// checkKey checks a key value, returning it in canonical form, e.g. "7" for
+// a Policy_Year of "07", and whether it is valid.
+func (c *tableCheck) checkKey(line int, name string, value string) (string, bool) {
+	col := c.column(name)
+	if problem := col.check(value); problem != "" {
+		c.add(line, "%s", problem)
+		return value, false
+	}
+	switch col.kind {
+	case intColumn:
+		number, _ := strconv.Atoi(value)
+		return strconv.Itoa(number), true
+	case floatColumn:
+		number, _ := strconv.ParseFloat(value, 64)
+		return strconv.FormatFloat(number, 'f', -1, 64), true
+	}
+	return value, true
+}
+
+// check returns the problem with a value of the column, or "".
+func (col *column) check(value string) string {
+	if value == "" {
+		if col.blank {
+			return ""
+		}
+		return fmt.Sprintf("%s is blank", col.name)
+	}
+	var number float64
+	switch col.kind {
+	case textColumn:
+		if len(col.values) > 0 && !slices.Contains(col.values, value) {
+			return fmt.Sprintf("%s %q is not one of %s", col.name, value, strings.Join(col.values, ", "))
+		}
+		return ""
+	case intColumn:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Sprintf("%s %q is not a whole number", col.name, value)
+		}
+		number = float64(n)
+	case floatColumn:
+		var err error
+		if number, err = strconv.ParseFloat(value, 64); err != nil || math.IsNaN(number) {
+			return fmt.Sprintf("%s %q is not a number", col.name, value)
+		}
+	case boolColumn:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("%s %q is not true or false", col.name, value)
+		}
+		return ""
+	case dateColumn:
+		if _, err := time.Parse(DateLayout, value); err != nil {
+			return fmt.Sprintf("%s %q is not a date (YYYY-MM-DD)", col.name, value)
+		}
+		return ""
+	}
+	if col.max > col.min && (number < col.min || number > col.max) {
+		return fmt.Sprintf("%s %s is outside %g to %g", col.name, value, col.min, col.max)
+	}
+	return ""
+}
+
+// checkComplete checks the keys below the node, at the levels, are
+// complete: whole number keys without gaps, and class codes having the keys
+// their siblings have. path names the node, e.g. "Gender M, Risk_Class NS".
+func (c *tableCheck) checkComplete(node *keyNode, levels []string, path []string, lifetime bool) {
+	if len(levels) == 0 || len(node.order) == 0 {
+		return
+	}
+	column := levels[0]
+	if c.column(column).kind == intColumn && !c.spec.sparse {
+		numbers := make([]int, 0, len(node.order))
+		for _, value := range node.order {
+			number, _ := strconv.Atoi(value)
+			numbers = append(numbers, number)
+		}
+		slices.Sort(numbers)
+		first, last := numbers[0], numbers[len(numbers)-1]
+		if column == "Policy_Year" {
+			first = 1
+			if age, ok := strings.CutPrefix(path[len(path)-1], "Issue_Age "); ok && lifetime && len(path) > 0 {
+				issueAge, _ := strconv.Atoi(age)
+				last = max(last, c.maturityAge-issueAge)
+			}
+		}
+		if missing := missingRanges(numbers, first, last); missing != "" {
+			c.add(0, "%s%s %s missing", prefix(path), column, missing)
+		}
+	}
+	if len(levels) > 1 && slices.Contains(classColumns, column) {
+		var all []string
+		for _, value := range node.order {
+			for _, key := range node.children[value].order {
+				if !slices.Contains(all, key) {
+					all = append(all, key)
+				}
+			}
+		}
+		for _, value := range node.order {
+			var missing []string
+			for _, key := range all {
+				if _, ok := node.children[value].children[key]; !ok {
+					missing = append(missing, key)
+				}
+			}
+			if len(missing) > 0 {
+				c.add(0, "%s%s %s missing", prefix(append(slices.Clip(path), column+" "+value)), levels[1], strings.Join(missing, ", "))
+			}
+		}
+	}
+	for _, value := range node.order {
+		c.checkComplete(node.children[value], levels[1:], append(slices.Clip(path), column+" "+value), lifetime)
+	}
+}
+
+// prefix is the path of a problem's keys, followed by ": ".
+func prefix(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return strings.Join(path, ", ") + ": "
+}
+
+// missingRanges lists the numbers from first to last not in the sorted
+// numbers, in ranges such as "12-14, 20".
+func missingRanges(numbers []int, first int, last int) string {
+	var ranges []string
+	for n := first; n <= last; n++ {
+		if _, found := slices.BinarySearch(numbers, n); found {
+			continue
+		}
+		end := n
+		for end < last {
+			if _, found := slices.BinarySearch(numbers, end+1); found {
+				break
+			}
+			end++
+		}
+		if end == n {
+			ranges = append(ranges, strconv.Itoa(n))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", n, end))
+		}
+		n = end
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// missingKeys are the key columns a row leaves empty, from its first
+// layout in the header.
+func missingKeys(row []string, columns map[string]int, layouts [][]string) []string {
+	var missing []string
+	for _, levels := range layouts {
+		if levels == nil {
+			continue
+		}
+		for _, column := range levels {
+			if row[columns[column]] == "" {
+				missing = append(missing, column)
+			}
+		}
+		break
+	}
+	return missing
+}
+
+// hasColumns reports whether the header has every one of the columns.
+func hasColumns(header []string, columns []string) bool {
+	for _, column := range columns {
+		if !slices.Contains(header, column) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package valact
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// tableVersion is a row of the table versions file: a version of a table
+// in effect from a date.
+type tableVersion struct {
+	table     string
+	effective time.Time
+	file      string
+}
+
+// readTableVersions reads the source's table versions file (Table,
+// Effective_Date, File), where each row is a version of the table named by
+// its file name, e.g. coi.csv, read from File, relative to Dir, from the
+// date on. A table is read from its own file before its first version. A
+// missing file has no versions.
+func (s RateSource) readTableVersions() ([]tableVersion, error) {
+	// the versions file itself has no versions
+	s.AsOf = time.Time{}
+	t, err := s.openTable(s.path(s.TableVersionsFile, TableVersionsFile), tableVersionsSchema)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	tableField, dateField, fileField := t.field("Table"), t.field("Effective_Date"), t.field("File")
+	var versions []tableVersion
+	for t.next() {
+		effective, err := t.date(dateField)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, tableVersion{table: t.raw(tableField), effective: effective, file: t.raw(fileField)})
+	}
+	return versions, t.err()
+}
+
+// AtDate returns the source reading the versions of its tables in effect
+// on the date, from the table versions file, e.g. the valuation date of a
+// run or a policy's issue date. AsOf is set to the latest effective date
+// on or before the date, so sources at dates between the same versions
+// share their cached rates; it is zero before the first version, reading
+// each table from its own file.
+func (s RateSource) AtDate(date time.Time) (RateSource, error) {
+	versions, err := s.readTableVersions()
+	if err != nil {
+		return s, err
+	}
+	s.AsOf = time.Time{}
+	for _, v := range versions {
+		if !v.effective.After(date) && v.effective.After(s.AsOf) {
+			s.AsOf = v.effective
+		}
+	}
+	return s, nil
+}
+
+// version returns the path of the version of the table at the path in
+// effect at AsOf: the file of the latest version of the table's file name
+// effective by then, or the path itself.
+func (s RateSource) version(path string) (string, error) {
+	if s.AsOf.IsZero() {
+		return path, nil
+	}
+	versions, err := s.readTableVersions()
+	if err != nil {
+		return path, err
+	}
+	name := baseName(path)
+	var latest *tableVersion
+	for i, v := range versions {
+		if v.table == name && !v.effective.After(s.AsOf) && (latest == nil || v.effective.After(latest.effective)) {
+			latest = &versions[i]
+		}
+	}
+	if latest == nil {
+		return path, nil
+	}
+	return s.path("", latest.file), nil
+}
@@ -0,0 +1,375 @@
+package valact
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXSuffix is the suffix of Excel workbooks, read in place of CSV files:
+// a table is the workbook's sheet named after the table, e.g. "coi" for
+// coi.xlsx, or else its first sheet, laid out as the CSV file would be with
+// the header in the first row. Numbers are read at full precision, dates
+// as YYYY-MM-DD, and formulas by their last calculated values. Errors give
+// the sheet's row numbers as lines.
+const XLSXSuffix = ".xlsx"
+
+// openFile opens a table, decompressed, from fsys when not nil, reading
+// workbooks as CSV and Parquet files as a parquetTable. A CSV table missing under its name,
+// e.g. coi.csv, is read from the workbook of that name, coi.xlsx.
+func openFile(fsys fs.FS, name string) (io.ReadCloser, error) {
+	file, err := openCompressed(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) && strings.HasSuffix(name, ".csv") {
+		book := strings.TrimSuffix(name, ".csv") + XLSXSuffix
+		if file, bookErr := openCompressed(fsys, book); bookErr == nil {
+			return readXLSX(file, book)
+		}
+	}
+	if err == nil && strings.HasSuffix(name, XLSXSuffix) {
+		return readXLSX(file, name)
+	}
+	if err == nil && strings.HasSuffix(name, ParquetSuffix) {
+		return newParquetTable(file, name)
+	}
+	return file, err
+}
+
+// readXLSX reads the workbook's table as CSV, closing the file.
+func readXLSX(file io.ReadCloser, name string) (io.ReadCloser, error) {
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	sheet := strings.TrimSuffix(baseName(name), XLSXSuffix)
+	table, err := xlsxCSV(data, sheet)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return io.NopCloser(bytes.NewReader(table)), nil
+}
+
+// xlsxCSV returns the CSV of the workbook's sheet, or its first sheet when
+// it has none of that name, each row on the line of its row number.
+func xlsxCSV(data []byte, sheet string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	book := &workbook{files: make(map[string]*zip.File)}
+	for _, file := range archive.File {
+		book.files[file.Name] = file
+	}
+	sheetPath, err := book.sheet(sheet)
+	if err != nil {
+		return nil, err
+	}
+	if err := book.readStrings(); err != nil {
+		return nil, err
+	}
+	if err := book.readStyles(); err != nil {
+		return nil, err
+	}
+	return book.csv(sheetPath)
+}
+
+// workbook is an open XLSX archive and the parts of it shared by sheets.
+type workbook struct {
+	files   map[string]*zip.File
+	strings []string
+	// dates marks the cell styles that format numbers as dates
+	dates    []bool
+	date1904 bool
+}
+
+// decode decodes the XML part at the name into v, reporting whether the
+// archive has it.
+func (b *workbook) decode(name string, v any) (bool, error) {
+	file, ok := b.files[name]
+	if !ok {
+		return false, nil
+	}
+	r, err := file.Open()
+	if err != nil {
+		return true, err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return true, fmt.Errorf("%s: %w", name, err)
+	}
+	return true, nil
+}
+
+// sheet returns the archive path of the named sheet, or of the first.
+func (b *workbook) sheet(name string) (string, error) {
+	var book struct {
+		Properties struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if ok, err := b.decode("xl/workbook.xml", &book); err != nil {
+		return "", err
+	} else if !ok || len(book.Sheets) == 0 {
+		return "", errors.New("not an Excel workbook: no sheets")
+	}
+	b.date1904 = book.Properties.Date1904
+	id := book.Sheets[0].ID
+	for _, s := range book.Sheets {
+		if strings.EqualFold(s.Name, name) {
+			id = s.ID
+		}
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if _, err := b.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == id {
+			if target, ok := strings.CutPrefix(rel.Target, "/"); ok {
+				return target, nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("no part for sheet %s", id)
+}
+
+// readStrings reads the shared strings that text cells refer to.
+func (b *workbook) readStrings() error {
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if _, err := b.decode("xl/sharedStrings.xml", &table); err != nil {
+		return err
+	}
+	for _, item := range table.Items {
+		text := item.Text
+		for _, run := range item.Runs {
+			text += run.Text
+		}
+		b.strings = append(b.strings, text)
+	}
+	return nil
+}
+
+// readStyles reads which cell styles are date formats: the built in date
+// formats and custom formats with day, month, or year parts.
+func (b *workbook) readStyles() error {
+	var styles struct {
+		Formats []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Cells []struct {
+			Format int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if _, err := b.decode("xl/styles.xml", &styles); err != nil {
+		return err
+	}
+	custom := make(map[int]bool)
+	for _, format := range styles.Formats {
+		custom[format.ID] = dateFormat(format.Code)
+	}
+	for _, cell := range styles.Cells {
+		date, ok := custom[cell.Format]
+		if !ok {
+			date = cell.Format >= 14 && cell.Format <= 17 || cell.Format == 22
+		}
+		b.dates = append(b.dates, date)
+	}
+	return nil
+}
+
+// dateFormat reports whether a number format code shows a date, having d,
+// m, or y outside quoted text and bracketed colors and conditions.
+func dateFormat(code string) bool {
+	quoted, bracketed := false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case !bracketed && (c == 'd' || c == 'm' || c == 'y'):
+			return true
+		}
+	}
+	return false
+}
+
+// csv converts the sheet at the archive path.
+func (b *workbook) csv(sheetPath string) ([]byte, error) {
+	file, ok := b.files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("no sheet part %s", sheetPath)
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	decoder := xml.NewDecoder(r)
+	line := 1
+	// width is the header's, to which rows ending in blanks are padded
+	width := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sheetPath, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("%s: %w", sheetPath, err)
+		}
+		if row.Number == 0 {
+			row.Number = line
+		}
+		record, err := b.record(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row.Number, err)
+		}
+		if len(record) == 0 {
+			continue
+		}
+		if width == 0 {
+			width = len(record)
+		}
+		for len(record) < width {
+			record = append(record, "")
+		}
+		// blank lines keep the row on its line; CSV readers skip them
+		w.Flush()
+		for ; line < row.Number; line++ {
+			out.WriteByte('\n')
+		}
+		w.Write(record)
+		line++
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+// xlsxRow is a sheet row; Number counts from 1.
+type xlsxRow struct {
+	Number int `xml:"r,attr"`
+	Cells  []struct {
+		Ref    string `xml:"r,attr"`
+		Type   string `xml:"t,attr"`
+		Style  int    `xml:"s,attr"`
+		Value  string `xml:"v"`
+		Inline string `xml:"is>t"`
+	} `xml:"c"`
+}
+
+// record returns the row's values by column, without trailing blanks.
+func (b *workbook) record(row xlsxRow) ([]string, error) {
+	var record []string
+	for _, cell := range row.Cells {
+		col := len(record)
+		if cell.Ref != "" {
+			col = 0
+			for _, c := range cell.Ref {
+				if c < 'A' || c > 'Z' {
+					break
+				}
+				col = col*26 + int(c-'A') + 1
+			}
+			col--
+		}
+		if col < len(record) {
+			return nil, fmt.Errorf("cell %s out of order", cell.Ref)
+		}
+		value, err := b.value(cell.Type, cell.Style, cell.Value, cell.Inline)
+		if err != nil {
+			return nil, fmt.Errorf("cell %s: %w", cell.Ref, err)
+		}
+		if value == "" {
+			continue
+		}
+		for len(record) < col {
+			record = append(record, "")
+		}
+		record = append(record, value)
+	}
+	return record, nil
+}
+
+// value returns a cell's value as it would be written in a CSV file.
+func (b *workbook) value(kind string, style int, value string, inline string) (string, error) {
+	switch kind {
+	case "s":
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(b.strings) {
+			return "", fmt.Errorf("no shared string %q", value)
+		}
+		return b.strings[i], nil
+	case "inlineStr":
+		return inline, nil
+	case "b":
+		return strconv.FormatBool(value == "1"), nil
+	case "", "n":
+		if value == "" {
+			return "", nil
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("number %q: %w", value, err)
+		}
+		if style < len(b.dates) && b.dates[style] {
+			return b.date(number).Format(DateLayout), nil
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	}
+	// formula strings ("str") and errors ("e") as written
+	return value, nil
+}
+
+// date returns the date of an Excel serial day number.
+func (b *workbook) date(serial float64) time.Time {
+	if b.date1904 {
+		return time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(math.Floor(serial)))
+	}
+	// day 60 is the 29 February 1900 Excel has but the calendar does not
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if serial < 61 {
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	return epoch.AddDate(0, 0, int(math.Floor(serial)))
+}
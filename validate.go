@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"approach1/valact"
+)
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	product := fs.String("product", "", "product code from "+valact.ProductsFile+" whose data directory to check (default the data directory itself)")
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	fs.Parse(args)
+
+	source := valact.DefaultRateSource()
+	if *dataDir != "" {
+		source.Dir = *dataDir
+	}
+	source.Store = store
+	if *product != "" {
+		var err error
+		if source, err = source.WithProduct(*product); err != nil {
+			return err
+		}
+	}
+	problems := source.ValidateTables()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("validate: %d problems", len(problems))
+	}
+	fmt.Fprintln(os.Stderr, "rate tables OK")
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build js && wasm
+
+// Command wasm exposes illustrations and premium solves to JavaScript, for
+// what-if illustrations run in the browser. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o valact.wasm ./wasm
+//
+// and load it with wasm_exec.js from $(go env GOROOT)/lib/wasm. It sets
+// three global functions:
+//
+//	valactLoadTables({"coi.csv": Uint8Array, ...})
+//	valactIllustrate(policyJSON) -> resultJSON
+//	valactSolve(policyJSON)      -> resultJSON at the solved premium
+//
+// The rate tables are passed in by file name, as read from the data
+// directory, and replace any loaded before. The policy and result JSON are
+// those of the serve command; a failure returns {"error": "..."}.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	"approach1/valact"
+)
+
+// source reads the tables given to valactLoadTables.
+var source = valact.RateSource{FS: valact.TableFS{}}
+
+func main() {
+	js.Global().Set("valactLoadTables", js.FuncOf(loadTables))
+	js.Global().Set("valactIllustrate", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		return run(args, func(policy valact.Policy, rates *valact.RateSet) (valact.Result, error) {
+			return valact.NewResult(policy, rates), nil
+		})
+	}))
+	js.Global().Set("valactSolve", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		return run(args, valact.NewSolveResult)
+	}))
+	select {}
+}
+
+// loadTables copies the tables out of the object of Uint8Arrays by file
+// name.
+func loadTables(_ js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeObject {
+		return errorJSON(fmt.Errorf("valactLoadTables: expected an object of tables by file name"))
+	}
+	tables := valact.TableFS{}
+	keys := js.Global().Get("Object").Call("keys", args[0])
+	for i := range keys.Length() {
+		name := keys.Index(i).String()
+		array := args[0].Get(name)
+		data := make([]byte, array.Get("length").Int())
+		js.CopyBytesToGo(data, array)
+		tables[name] = data
+	}
+	// a new cache, as the tables changed
+	source = valact.RateSource{FS: tables, Cache: valact.NewRateCache()}
+	return nil
+}
+
+// run decodes the policy JSON of args[0], loads its rates, and returns the
+// JSON of its result.
+func run(args []js.Value, result func(valact.Policy, *valact.RateSet) (valact.Result, error)) any {
+	if len(args) != 1 {
+		return errorJSON(fmt.Errorf("expected the policy JSON"))
+	}
+	var policy valact.Policy
+	if err := json.Unmarshal([]byte(args[0].String()), &policy); err != nil {
+		return errorJSON(fmt.Errorf("policy: %w", err))
+	}
+	if err := policy.Check(); err != nil {
+		return errorJSON(err)
+	}
+	rates, err := source.PolicyRates(policy, valact.WaiverDeduction)
+	if err != nil {
+		return errorJSON(err)
+	}
+	value, err := result(policy, rates)
+	if err != nil {
+		return errorJSON(err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errorJSON(err)
+	}
+	return string(data)
+}
+
+func errorJSON(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"approach1/valact"
+)
+
+// workerRequest is one line of worker input; op is illustrate (the
+// default) or solve.
+type workerRequest struct {
+	Op     string        `json:"op"`
+	Policy valact.Policy `json:"policy"`
+}
+
+// workerError is the output line of a request that failed.
+type workerError struct {
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+func runWorker(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	waiverBasis := fs.String("waiver-basis", "deduction", "waiver of premium rate basis for Waiver riders: deduction or per-unit")
+	dataDir := fs.String("data-dir", "", "directory holding the rate tables (default $"+valact.DataDirEnv+" or the working directory)")
+	builtin := fs.Bool("builtin-tables", true, builtinTablesUsage)
+	var asOf ratesAsOf
+	fs.Func("rates-as-of", ratesAsOfUsage, func(s string) (err error) {
+		asOf, err = parseRatesAsOf(s)
+		return err
+	})
+	var store *valact.SQLStore
+	fs.Func("rate-db", rateDBUsage, func(s string) (err error) {
+		store, err = openRateStore(s)
+		return err
+	})
+	fs.Parse(args)
+
+	basis := valact.WaiverBasis(*waiverBasis)
+	if !basis.Valid() {
+		return fmt.Errorf("worker: unknown waiver basis %q", *waiverBasis)
+	}
+	source := valact.DefaultRateSource()
+	if *dataDir != "" {
+		source.Dir = *dataDir
+	}
+	source.Store = store
+	source.Defaults = defaultTables(*builtin)
+	var err error
+	if source, err = asOf.apply(source); err != nil {
+		return err
+	}
+	// requests for the same insured share their rates
+	source.Cache = valact.NewRateCache()
+	return serveLines(os.Stdin, os.Stdout, source, basis)
+}
+
+// serveLines answers each JSON line request read from r with a JSON line
+// on w, the result or {"id", "error"}, in the order of the requests. Each
+// answer is flushed before the next request is read, so a caller may wait
+// for it; blank lines are skipped.
+func serveLines(r io.Reader, w io.Writer, source valact.RateSource, basis valact.WaiverBasis) error {
+	reader := bufio.NewReader(r)
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			result, requestErr := answer(line, source, basis)
+			if requestErr != nil {
+				result = requestErr
+			}
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// answer runs one request line, returning its result or, on failure, its
+// workerError.
+func answer(line []byte, source valact.RateSource, basis valact.WaiverBasis) (any, *workerError) {
+	var request workerRequest
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, &workerError{Error: fmt.Sprintf("request: %v", err)}
+	}
+	policy := request.Policy
+	if err := policy.Check(); err != nil {
+		return nil, &workerError{ID: policy.ID, Error: err.Error()}
+	}
+	if request.Op != "" && request.Op != "illustrate" && request.Op != "solve" {
+		return nil, &workerError{ID: policy.ID, Error: fmt.Sprintf("unknown op %q", request.Op)}
+	}
+	rates, err := source.PolicyRates(policy, basis)
+	if err != nil {
+		return nil, &workerError{ID: policy.ID, Error: err.Error()}
+	}
+	if request.Op == "solve" {
+		result, err := valact.NewSolveResult(policy, rates)
+		if err != nil {
+			return nil, &workerError{ID: policy.ID, Error: err.Error()}
+		}
+		return result, nil
+	}
+	return valact.NewResult(policy, rates), nil
+}